@@ -11,6 +11,7 @@ import (
 	"os"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
 	daemon "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder/interceptor"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
@@ -28,6 +29,7 @@ type Config struct {
 	listenAddr          string
 	kataAgentSocketPath string
 	podNamespace        string
+	resolvConfPath      string
 	HostInterface       string
 }
 
@@ -50,6 +52,7 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		showVersion bool
 		disableTLS  bool
 		tlsConfig   tlsutil.TLSConfig
+		attester    string
 		services    []cmd.Service
 	)
 
@@ -59,12 +62,14 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		flags.StringVar(&cfg.listenAddr, "listen", daemon.DefaultListenAddr, "Listen address")
 		flags.StringVar(&cfg.kataAgentSocketPath, "kata-agent-socket", daemon.DefaultKataAgentSocketPath, "Path to a kata agent socket")
 		flags.StringVar(&cfg.podNamespace, "pod-namespace", daemon.DefaultPodNamespace, "Path to the network namespace where the pod runs")
+		flags.StringVar(&cfg.resolvConfPath, "pod-resolv-conf", interceptor.DefaultResolvConfPath, "Path to the resolv.conf written for the containers of the pod in the \"pod\" DNS mode")
 		flags.StringVar(&cfg.HostInterface, "host-interface", "", "network interface name that is used for network tunnel traffic")
 		flags.StringVar(&tlsConfig.CAFile, "ca-cert-file", "", "CA cert file")
 		flags.StringVar(&tlsConfig.CertFile, "cert-file", "", "cert file")
 		flags.StringVar(&tlsConfig.KeyFile, "cert-key", "", "cert key")
 		flags.BoolVar(&tlsConfig.SkipVerify, "tls-skip-verify", false, "Skip TLS certificate verification - use it only for testing")
 		flags.BoolVar(&disableTLS, "disable-tls", false, "Disable TLS encryption - use it only for testing")
+		flags.StringVar(&attester, "tls-attester", "aa", "Attester for attestation-bound TLS: aa (attestation-agent) or fake (use it only for testing)")
 	})
 
 	cmd.ShowVersion(programName)
@@ -81,11 +86,29 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		cfg.tlsConfig = &tlsConfig
 	}
 
-	interceptor := interceptor.NewInterceptor(cfg.kataAgentSocketPath, cfg.podNamespace)
+	var daemonOpts []daemon.DaemonOption
+	switch attester {
+	case "aa":
+	case "fake":
+		daemonOpts = append(daemonOpts, daemon.WithAttester(attestation.NewFakeAttester()))
+	default:
+		return nil, fmt.Errorf("unknown attester %q", attester)
+	}
+
+	var interceptorOpts []interceptor.Option
+	switch cfg.daemonConfig.DNSMode {
+	case "", interceptor.DNSModeVM:
+	case interceptor.DNSModePod:
+		interceptorOpts = append(interceptorOpts, interceptor.WithPodDNS(cfg.resolvConfPath))
+	default:
+		return nil, fmt.Errorf("unknown DNS mode %q", cfg.daemonConfig.DNSMode)
+	}
+
+	interceptor := interceptor.NewInterceptor(cfg.kataAgentSocketPath, cfg.podNamespace, interceptorOpts...)
 
 	podNode := podnetwork.NewPodNode(cfg.podNamespace, cfg.HostInterface, cfg.daemonConfig.PodNetwork)
 
-	services = append(services, daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode))
+	services = append(services, daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode, daemonOpts...))
 
 	return cmd.NewStarter(services...), nil
 }
@@ -9,18 +9,19 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	daemon "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder/interceptor"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler/vxlan"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/probe"
@@ -99,18 +100,34 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		// Common flags with environment variable support
 		reg.StringWithEnv(&cfg.serverConfig.SocketPath, "socket", adaptor.DefaultSocketPath, "REMOTE_HYPERVISOR_ENDPOINT", "Unix domain socket path of remote hypervisor service")
 		reg.StringWithEnv(&cfg.serverConfig.PodsDir, "pods-dir", adaptor.DefaultPodsDir, "PODS_DIR", "base directory for pod directories")
+		reg.StringWithEnv(&cfg.serverConfig.PodDNSMode, "pod-dns-mode", interceptor.DNSModeVM, "POD_DNS_MODE", "How the DNS settings of pods are applied in pod VMs: \"vm\" keeps them out of pod VMs, \"pod\" applies them to the containers of pods without changing the resolver of pod VMs")
 		reg.StringWithEnv(&cfg.serverConfig.PauseImage, "pause-image", "", "PAUSE_IMAGE", "pause image to be used for the pods")
 		reg.StringWithEnv(&cfg.serverConfig.ForwarderPort, "forwarder-port", daemon.DefaultListenPort, "FORWARDER_PORT", "port number of agent protocol forwarder")
 		reg.StringWithEnv(&tlsConfig.CAFile, "ca-cert-file", "", "CACERT_FILE", "CA certificate file for custom TLS (e.g. /etc/certificates/ca.crt)")
 		reg.StringWithEnv(&tlsConfig.CertFile, "cert-file", "", "CERT_FILE", "Client certificate file for custom TLS (e.g. /etc/certificates/client.crt)")
 		reg.StringWithEnv(&tlsConfig.KeyFile, "cert-key", "", "CERT_KEY", "Client key file for custom TLS (e.g. /etc/certificates/client.key)")
 		reg.BoolWithEnv(&tlsConfig.SkipVerify, "tls-skip-verify", false, "TLS_SKIP_VERIFY", "Skip TLS certificate verification - use it only for testing")
+		reg.StringWithEnv(&cfg.serverConfig.TLSSecretName, "tls-secret", "", "TLS_SECRET_NAME", "Secret in the cloud-api-adaptor namespace persisting the generated CA and client certificates")
+		reg.DurationWithEnv(&cfg.serverConfig.ServerCertValidity, "server-cert-validity", 0, "SERVER_CERT_VALIDITY", "Lifetime of the server certificates issued for pod VMs, renewed after two thirds of it (0 keeps the two year default)")
+		reg.StringWithEnv(&cfg.serverConfig.TLSAttestationVerifier, "tls-attestation-verifier", "", "TLS_ATTESTATION_VERIFIER", "Issue server certificates only for pod VM keys bound to TEE evidence verified by this attestation service URL (\"fake\" for testing)")
+		reg.StringWithEnv(&cfg.serverConfig.TLSAttestationTokenKey, "tls-attestation-token-key", "", "TLS_ATTESTATION_TOKEN_KEY", "PEM file of the public key or certificate verifying the attestation tokens of the TLS attestation verifier")
+		reg.StringWithEnv(&cfg.serverConfig.UserDataKeyID, "userdata-key-id", "", "USERDATA_KEY_ID", "Encrypt sensitive user data with a key the pod VM gets from this ID (file:///path in the pod VM image, or kbs:///repo/type/tag)")
+		reg.StringWithEnv(&cfg.serverConfig.UserDataKeyFile, "userdata-key-file", "", "USERDATA_KEY_FILE", "File of the 32 byte key, raw or base64 encoded, encrypting sensitive user data")
+		reg.IntWithEnv(&cfg.serverConfig.UserDataLimit, "userdata-limit", 0, "USERDATA_LIMIT", "Maximum size of user data in bytes. Larger user data is compressed, and image pull credentials are delivered after the pod VM starts (0 uses the limit of the cloud provider)")
+		reg.BoolWithEnv(&cfg.serverConfig.AllowPlaintextUserData, "allow-plaintext-userdata", false, "ALLOW_PLAINTEXT_USERDATA", "Pass sensitive user data in plaintext if it cannot be encrypted")
+		reg.BoolWithEnv(&cfg.serverConfig.EnableNamespaceExecPolicy, "enable-namespace-exec-policy", false, "ENABLE_NAMESPACE_EXEC_POLICY", "Deny exec into the peer pods of namespaces annotated with peerpods.confidentialcontainers.org/deny-exec=true")
+		reg.StringWithEnv(&cfg.serverConfig.AgentPolicyFile, "agent-policy", "", "AGENT_POLICY_FILE", "Rego policy checking agent requests on the worker node before they are forwarded to pod VMs")
+		reg.StringWithEnv(&cfg.serverConfig.AgentAuditLog, "agent-audit-log", "", "AGENT_AUDIT_LOG", "File to append JSON audit records of agent requests checked by the agent policy (default is the log output)")
+		reg.StringWithEnv(&cfg.serverConfig.ExecSessionRecording, "exec-session-recording", "", "EXEC_SESSION_RECORDING", "Record exec and attach sessions of pods in asciicast files in their pod directories: \"metadata\" records commands, \"io\" also records input and output (default is no recording)")
 		reg.DurationWithEnv(&cfg.serverConfig.ProxyTimeout, "proxy-timeout", proxy.DefaultProxyTimeout, "PROXY_TIMEOUT", "Maximum timeout in minutes for establishing agent proxy connection")
 		reg.StringWithEnv(&cfg.networkConfig.TunnelType, "tunnel-type", podnetwork.DefaultTunnelType, "TUNNEL_TYPE", "Tunnel provider")
 		reg.IntWithEnv(&cfg.networkConfig.VXLAN.Port, "vxlan-port", vxlan.DefaultVXLANPort, "VXLAN_PORT", "VXLAN UDP port number (VXLAN tunnel mode only")
+		reg.StringWithEnv(&cfg.serverConfig.ClusterID, "owner-cluster-id", "", "OWNER_CLUSTER_ID", "Cluster ID in the tags identifying the owner of pod VMs (default is the UID of the kube-system namespace)")
 		reg.StringWithEnv(&cfg.serverConfig.Initdata, "initdata", "", "INITDATA", "Default initdata for all Pods")
 		reg.BoolWithEnv(&cfg.serverConfig.EnableCloudConfigVerify, "cloud-config-verify", false, "CLOUD_CONFIG_VERIFY", "Enable cloud config verify - should use it for production")
 		reg.IntWithEnv(&cfg.serverConfig.PeerPodsLimitPerNode, "peerpods-limit-per-node", 10, "PEERPODS_LIMIT_PER_NODE", "peer pods limit per node (default=10)")
+		reg.IntWithEnv(&cfg.serverConfig.MaxDataDisks, "max-data-disks", 8, "MAX_DATA_DISKS", "Maximum number of data disks a pod can request with annotations")
+		reg.IntWithEnv(&cfg.serverConfig.MaxDiskSize, "max-disk-size", 2048, "MAX_DISK_SIZE", "Maximum size in GiB of the root volume and of each data disk a pod can request with annotations")
 		reg.BoolWithEnv(&cfg.serverConfig.EnableScratchSpace, "enable-scratch-space", false, "ENABLE_SCRATCH_SPACE", "Enable encrypted scratch space for pod VMs")
 		reg.BoolWithEnv(&cfg.networkConfig.ExternalNetViaPodVM, "ext-network-via-podvm", false, "EXTERNAL_NETWORK_VIA_PODVM", "[EXPERIMENTAL] Enable external networking via pod VM")
 		reg.CustomTypeWithEnv(&cfg.networkConfig.PodSubnetCIDRs, "pod-subnet-cidrs", "", "POD_SUBNET_CIDRS", "[EXPERIMENTAL] Comma separated CIDRs for local pod subnets")
@@ -131,6 +148,12 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		cfg.serverConfig.TLSConfig = &tlsConfig
 	}
 
+	cfg.serverConfig.Version = cmd.VERSION
+
+	if cfg.serverConfig.UserDataLimit == 0 {
+		cfg.serverConfig.UserDataLimit = cloudinit.UserDataLimit(cloudName)
+	}
+
 	// DEPRECATED: LoadEnv() is now a no-op for all providers.
 	// Environment variables are loaded during ParseCmd() via FlagRegistrar.
 	// This call will be removed in a future release.
@@ -147,11 +170,46 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 	}
 
 	if cfg.serverConfig.Initdata != "" {
-		idReader := strings.NewReader(cfg.serverConfig.Initdata)
-		_, err = initdata.Parse(idReader)
+		initdataToml, err := initdata.DecodeAnnotation(cfg.serverConfig.Initdata)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse global initdata: %w", err)
 		}
+		if _, err := initdata.Validate(initdataToml); err != nil {
+			return nil, fmt.Errorf("invalid global initdata: %w", err)
+		}
+	}
+
+	if cfg.serverConfig.AgentPolicyFile != "" || cfg.serverConfig.AgentAuditLog != "" {
+		policy, err := proxy.NewAgentPolicy(context.Background(), cfg.serverConfig.AgentPolicyFile, cfg.serverConfig.AgentAuditLog)
+		if err != nil {
+			return nil, err
+		}
+		cfg.serverConfig.AgentPolicy = policy
+	}
+
+	cfg.serverConfig.AttestationVerifier, err = adaptor.NewVerifier(&cfg.serverConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.serverConfig.MaxDataDisks < 0 || cfg.serverConfig.MaxDiskSize < 0 {
+		return nil, fmt.Errorf("invalid disk limits: %d data disks of %d GiB", cfg.serverConfig.MaxDataDisks, cfg.serverConfig.MaxDiskSize)
+	}
+
+	// The pod VMs get the key from the key ID, cloud-api-adaptor encrypts with the key file
+	if (cfg.serverConfig.UserDataKeyID == "") != (cfg.serverConfig.UserDataKeyFile == "") {
+		return nil, fmt.Errorf("USERDATA_KEY_ID and USERDATA_KEY_FILE must be set together to encrypt user data")
+	}
+
+	switch cfg.serverConfig.PodDNSMode {
+	case interceptor.DNSModeVM, interceptor.DNSModePod:
+	default:
+		return nil, fmt.Errorf("invalid pod DNS mode %q, expected %q or %q", cfg.serverConfig.PodDNSMode, interceptor.DNSModeVM, interceptor.DNSModePod)
+	}
+
+	cfg.serverConfig.SessionRecording, err = proxy.ParseSessionRecording(cfg.serverConfig.ExecSessionRecording)
+	if err != nil {
+		return nil, err
 	}
 
 	server := adaptor.NewServer(provider, &cfg.serverConfig, workerNode)
@@ -0,0 +1,111 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+	"github.com/spf13/cobra"
+)
+
+// readInitdata reads initdata TOML from a file, or stdin if path is "-".
+// The file content is either plain TOML or gzipped and base64 encoded.
+func readInitdata(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initdata: %w", err)
+	}
+	return initdata.Load(data)
+}
+
+func newInitdataCmd() *cobra.Command {
+	var initdataCmd = &cobra.Command{
+		Use:   "initdata",
+		Short: "Inspect initdata passed in a pod annotation or the INITDATA setting",
+	}
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate FILE",
+		Short: "Validate initdata and the files in it, and print its digest",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initdataToml, err := readInitdata(args[0])
+			if err != nil {
+				return err
+			}
+			id, err := initdata.Validate(initdataToml)
+			if err != nil {
+				return fmt.Errorf("invalid initdata:\n%w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "initdata is valid, %s digest: %s\n", id.Body.Algorithm, id.Digest)
+			return nil
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+
+	var digestCmd = &cobra.Command{
+		Use:   "digest FILE",
+		Short: "Print the initdata digest calculated in the pod VM",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initdataToml, err := readInitdata(args[0])
+			if err != nil {
+				return err
+			}
+			id, err := initdata.Validate(initdataToml)
+			if id == nil {
+				return fmt.Errorf("failed to calculate initdata digest:\n%w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), id.Digest)
+			return nil
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+
+	var diffCmd = &cobra.Command{
+		Use:   "diff FILE1 FILE2",
+		Short: "Compare two initdata, exiting with status 1 if they differ",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var bodies [2]*initdata.InitData
+			for i, path := range args {
+				initdataToml, err := readInitdata(path)
+				if err != nil {
+					return err
+				}
+				id, err := initdata.Validate(initdataToml)
+				if id == nil {
+					return fmt.Errorf("failed to parse %s:\n%w", path, err)
+				}
+				bodies[i] = id
+			}
+
+			diff, err := initdata.Diff(bodies[0].Body, bodies[1].Body, "a", "b")
+			if err != nil {
+				return err
+			}
+			if diff == "" && bodies[0].Digest == bodies[1].Digest {
+				return nil
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "-digest %s\n+digest %s\n%s", bodies[0].Digest, bodies[1].Digest, diff)
+			os.Exit(1)
+			return nil
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+
+	initdataCmd.AddCommand(validateCmd, digestCmd, diffCmd)
+	return initdataCmd
+}
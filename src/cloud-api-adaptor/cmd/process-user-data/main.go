@@ -4,7 +4,9 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	cmdUtil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/userdata"
@@ -32,19 +34,35 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	var fetchTimeout int
+	var provider string
 	rootCmd.PersistentFlags().BoolVarP(&versionFlag, "version", "v", false, "Print the version")
 
 	var provisionFilesCmd = &cobra.Command{
 		Use:   "provision-files",
 		Short: "Provision required files based on user data",
 		RunE: func(_ *cobra.Command, _ []string) error {
-			cfg := userdata.NewConfig(fetchTimeout)
+			cfg := userdata.NewConfig(fetchTimeout, userdata.WithProvider(provider))
 			return userdata.ProvisionFiles(cfg)
 		},
 		SilenceUsage: true, // Silence usage on error
 	}
 	provisionFilesCmd.Flags().IntVarP(&fetchTimeout, "user-data-fetch-timeout", "t", 180, "Timeout (in secs) for fetching user data")
+	provisionFilesCmd.Flags().StringVarP(&provider, "provider", "p", "", fmt.Sprintf("User data provider, one of %s (detected in this order if not specified)", strings.Join(userdata.ProviderNames(), ", ")))
 	rootCmd.AddCommand(provisionFilesCmd)
+
+	var provisionEncryptedFilesCmd = &cobra.Command{
+		Use:   "provision-encrypted-files",
+		Short: "Provision files encrypted with a key released by KBS after attestation",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cfg := userdata.NewConfig(fetchTimeout)
+			return userdata.ProvisionEncryptedFiles(cfg)
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+	provisionEncryptedFilesCmd.Flags().IntVarP(&fetchTimeout, "user-data-fetch-timeout", "t", 180, "Timeout (in secs) for getting the key of encrypted user data")
+	rootCmd.AddCommand(provisionEncryptedFilesCmd)
+
+	rootCmd.AddCommand(newInitdataCmd())
 }
 
 func main() {
@@ -42,7 +42,9 @@ one_of() {
 }
 
 aws() {
-    test_vars AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY
+    one_of AWS_ACCESS_KEY_ID AWS_CREDENTIALS_FILE AWS_ROLE_ARN AWS_WEB_IDENTITY_TOKEN_FILE
+    [[ -n "${AWS_ACCESS_KEY_ID}" ]] && test_vars AWS_SECRET_ACCESS_KEY
+    [[ -n "${AWS_ROLE_ARN}" ]] && test_vars AWS_WEB_IDENTITY_TOKEN_FILE
 
     set -x
     exec cloud-api-adaptor aws ${optionals}
@@ -57,7 +59,7 @@ azure() {
 }
 
 alibabacloud() {
-    one_of ALIBABACLOUD_ACCESS_KEY_ID ALIBABA_CLOUD_ROLE_ARN
+    one_of ALIBABACLOUD_ACCESS_KEY_ID ALIBABACLOUD_CREDENTIALS_FILE ALIBABA_CLOUD_ROLE_ARN
 
     # TODO: Variable name mismatch - kustomization/entrypoint uses INSTANCE_TYPE
     # but manager.go expects PODVM_INSTANCE_TYPE. Consider standardizing in future.
@@ -67,11 +69,14 @@ alibabacloud() {
 }
 
 gcp() {
-    test_vars GCP_CREDENTIALS GCP_PROJECT_ID GCP_ZONE PODVM_IMAGE_NAME
+    one_of GCP_CREDENTIALS GCP_WORKLOAD_IDENTITY_CONFIG
+    test_vars GCP_PROJECT_ID GCP_ZONE PODVM_IMAGE_NAME
 
     # Avoid using node's metadata service credentials for GCP authentication
-    echo "$GCP_CREDENTIALS" > /tmp/gcp-creds.json
-    export GOOGLE_APPLICATION_CREDENTIALS=/tmp/gcp-creds.json
+    if [[ -n "${GCP_CREDENTIALS}" ]]; then
+        echo "$GCP_CREDENTIALS" > /tmp/gcp-creds.json
+        export GOOGLE_APPLICATION_CREDENTIALS=/tmp/gcp-creds.json
+    fi
 
     set -x
     exec cloud-api-adaptor gcp ${optionals}
@@ -86,13 +91,30 @@ ibmcloud() {
 }
 
 ibmcloud_powervs() {
-    test_vars IBMCLOUD_API_KEY
+    one_of IBMCLOUD_API_KEY IBMCLOUD_API_KEY_FILE IBMCLOUD_IAM_PROFILE_ID
 
     set -x
     exec cloud-api-adaptor ibmcloud-powervs ${optionals}
 
 }
 
+openstack() {
+    test_vars OS_AUTH_URL
+    one_of OS_PASSWORD OS_APPLICATION_CREDENTIAL_SECRET
+
+    set -x
+    exec cloud-api-adaptor openstack ${optionals}
+
+}
+
+proxmox() {
+    test_vars PROXMOX_API_URL PROXMOX_TOKEN_ID PROXMOX_TOKEN_SECRET
+
+    set -x
+    exec cloud-api-adaptor proxmox ${optionals}
+
+}
+
 libvirt() {
     test_vars LIBVIRT_URI
 
@@ -118,9 +140,9 @@ byom() {
 help_msg() {
     cat <<EOF
 Usage:
-	CLOUD_PROVIDER=alibabacloud|aws|azure|byom|gcp|ibmcloud|ibmcloud-powervs|libvirt|docker $0
+	CLOUD_PROVIDER=alibabacloud|aws|azure|byom|gcp|ibmcloud|ibmcloud-powervs|libvirt|docker|openstack|proxmox $0
 or
-	$0 alibabacloud|aws|azure|byom|gcp|ibmcloud|ibmcloud-powervs|libvirt|docker
+	$0 alibabacloud|aws|azure|byom|gcp|ibmcloud|ibmcloud-powervs|libvirt|docker|openstack|proxmox
 
 in addition all cloud provider specific env variables must be set and valid
 (CLOUD_PROVIDER is currently set to "$CLOUD_PROVIDER")
@@ -145,6 +167,10 @@ elif [[ "$CLOUD_PROVIDER" == "libvirt" ]]; then
     libvirt
 elif [[ "$CLOUD_PROVIDER" == "docker" ]]; then
     docker
+elif [[ "$CLOUD_PROVIDER" == "openstack" ]]; then
+    openstack
+elif [[ "$CLOUD_PROVIDER" == "proxmox" ]]; then
+    proxmox
 else
     help_msg
 fi
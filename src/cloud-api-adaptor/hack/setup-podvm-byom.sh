@@ -103,6 +103,7 @@ fi
 systemctl daemon-reload
 systemctl enable process-user-data.path
 systemctl disable process-user-data.service
+systemctl enable process-user-data-envelope.path
 systemctl enable media-cidata.mount
 systemctl enable reboot-watcher.path
 systemctl enable sftp-dir.service
@@ -114,6 +115,7 @@ services=(
     kata-agent.path
     media-cidata.mount
     process-user-data.path
+    process-user-data-envelope.path
     reboot-watcher.path
     'run-kata\x2dcontainers.mount'
     sftp-dir.service
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
@@ -37,20 +39,65 @@ const (
 
 type ServerConfig struct {
 	TLSConfig               *tlsutil.TLSConfig
+	TLSSecretName           string
+	ServerCertValidity      time.Duration
+	TLSAttestationVerifier  string
+	TLSAttestationTokenKey  string
 	SocketPath              string
 	PauseImage              string
 	PodsDir                 string
 	ForwarderPort           string
+	PodDNSMode              string
 	ProxyTimeout            time.Duration
 	Initdata                string
 	EnableCloudConfigVerify bool
 	PeerPodsLimitPerNode    int
-	RootVolumeSize          int
+	MaxDataDisks            int
+	MaxDiskSize             int
 	EnableScratchSpace      bool
+	UserDataKeyID           string
+	UserDataKeyFile         string
+	AllowPlaintextUserData  bool
+	UserDataLimit           int
+	AgentPolicyFile         string
+	AgentAuditLog           string
+	// AgentPolicy is loaded from AgentPolicyFile, and writes audit records to AgentAuditLog
+	AgentPolicy          *proxy.AgentPolicy
+	ExecSessionRecording string
+	// SessionRecording is parsed from ExecSessionRecording
+	SessionRecording proxy.SessionRecording
+	// EnableNamespaceExecPolicy reads the deny-exec annotation of the namespace of pods on exec requests
+	EnableNamespaceExecPolicy bool
+	// AttestationVerifier is created from TLSAttestationVerifier and TLSAttestationTokenKey
+	AttestationVerifier attestation.Verifier
+	// ClusterID and Version are tagged on the pod VMs
+	ClusterID string
+	Version   string
 }
 
 var logger = log.New(log.Writer(), "[adaptor/cloud] ", log.LstdFlags|log.Lmsgprefix)
 
+// sealUserData encrypts the sensitive files of cloudConfig in an envelope, when a user data key is configured
+func (s *cloudService) sealUserData(cloudConfig *cloudinit.CloudConfig) error {
+	if s.serverConfig.UserDataKeyID == "" {
+		return nil
+	}
+
+	// Reload the key for every pod VM, so that it can be rotated without restarting cloud-api-adaptor
+	key, err := cloudinit.LoadEnvelopeKey(s.serverConfig.UserDataKeyFile)
+	if err != nil {
+		return err
+	}
+
+	sealed := []string{forwarder.DefaultConfigPath, paths.AuthFilePath}
+	// A key released by KBS is only available after attestation, which depends on initdata
+	if !strings.HasPrefix(s.serverConfig.UserDataKeyID, "kbs://") {
+		sealed = append(sealed, paths.InitDataPath)
+	}
+
+	return cloudConfig.SealFiles(s.serverConfig.UserDataKeyID, key, sealed)
+}
+
 func (s *cloudService) addSandbox(sid sandboxID, sandbox *sandbox) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -97,6 +144,7 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 		sandboxes:    map[sandboxID]*sandbox{},
 		serverConfig: serverConfig,
 		workerNode:   workerNode,
+		tags:         ownerTags(serverConfig),
 	}
 	s.cond = sync.NewCond(&s.mutex)
 	s.ppService, err = k8sops.NewPeerPodService()
@@ -107,6 +155,49 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 	return s
 }
 
+// ownerTags returns the tags identifying the cluster and the node owning the pod VMs. The cluster ID
+// defaults to the UID of the kube-system namespace.
+func ownerTags(serverConfig *ServerConfig) map[string]string {
+	clusterID := serverConfig.ClusterID
+	if clusterID == "" && k8sops.IsKubernetesEnvironment() {
+		id, err := k8sops.GetClusterID()
+		if err != nil {
+			logger.Printf("error reading the cluster ID, pod VMs are not tagged with it: %v", err)
+		}
+		clusterID = id
+	}
+
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		nodeName, _ = os.Hostname()
+	}
+
+	tags := map[string]string{}
+	for key, value := range map[string]string{
+		provider.TagClusterID: clusterID,
+		provider.TagNodeName:  nodeName,
+		provider.TagVersion:   serverConfig.Version,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// podVMTags returns the tags identifying the owner of the pod VM of a sandbox
+func (s *cloudService) podVMTags(namespace, pod string, sid sandboxID) map[string]string {
+	tags := map[string]string{
+		provider.TagPodNamespace: namespace,
+		provider.TagPodName:      pod,
+		provider.TagSandboxID:    string(sid),
+	}
+	for key, value := range s.tags {
+		tags[key] = value
+	}
+	return tags
+}
+
 func (s *cloudService) Teardown() error {
 	return s.provider.Teardown()
 }
@@ -212,6 +303,20 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		GPUs:         gpus,
 		Image:        image,
 		MultiNic:     podNetworkConfig.ExternalNetViaPodVM,
+		Tags:         s.podVMTags(namespace, pod, sid),
+	}
+
+	// Kata does not pass pod annotations other than its own, so the disk annotations are read from the pod
+	if k8sops.IsKubernetesEnvironment() {
+		podAnnotations, err := k8sops.GetPodAnnotations(pod, namespace)
+		if err != nil {
+			logger.Printf("error reading annotations of pod %s/%s: %v", namespace, pod, err)
+		} else if err := util.GetDisksFromAnnotation(podAnnotations, &vmSpec, util.DiskLimits{
+			MaxDataDisks: s.serverConfig.MaxDataDisks,
+			MaxDiskSize:  s.serverConfig.MaxDiskSize,
+		}); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO: server name is also generated in each cloud provider, and possibly inconsistent
@@ -224,15 +329,28 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	socketPath := filepath.Join(podDir, proxy.SocketName)
 
 	agentProxy := s.proxyFactory.New(serverName, socketPath)
+	podInfo := proxy.PodInfo{Namespace: namespace, Name: pod}
+	if s.serverConfig.EnableNamespaceExecPolicy && k8sops.IsKubernetesEnvironment() {
+		// The exec policy of the namespace is read on exec requests
+		podInfo.ExecDenied = func(ctx context.Context) (bool, error) {
+			return k8sops.IsExecDenied(ctx, namespace)
+		}
+	}
+	agentProxy.SetPodInfo(podInfo)
 
 	daemonConfig := forwarder.Config{
 		PodNamespace: namespace,
 		PodName:      pod,
 		PodNetwork:   podNetworkConfig,
 		TLSClientCA:  string(agentProxy.ClientCA()),
+		DNSMode:      s.serverConfig.PodDNSMode,
 	}
 
-	if caService := agentProxy.CAService(); caService != nil {
+	if agentProxy.TLSAttestation() {
+		// The server key is generated in the pod VM, and its certificate is issued after attestation
+		daemonConfig.TLSAttestation = true
+		daemonConfig.TLSServerName = serverName
+	} else if caService := agentProxy.CAService(); caService != nil {
 		certPEM, keyPEM, err := caService.Issue(serverName)
 		if err != nil {
 			return nil, fmt.Errorf("creating TLS certificate for communication between worker node and peer pod VM")
@@ -271,14 +389,10 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	}
 	if authJSON != nil {
 		logger.Printf("successfully retrieved pod image pull secrets for %s/%s", namespace, pod)
-		if len(authJSON) > cloudinit.DefaultAuthfileLimit {
-			logger.Printf("Credentials file is too large to be included in cloud-config")
-		} else {
-			cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
-				Path:    paths.AuthFilePath,
-				Content: string(authJSON),
-			})
-		}
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
+			Path:    paths.AuthFilePath,
+			Content: string(authJSON),
+		})
 	}
 
 	initdataEnc := ""
@@ -307,6 +421,28 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		})
 	}
 
+	budget := &cloudinit.Budget{
+		Limit: s.serverConfig.UserDataLimit,
+		Seal: func(cloudConfig *cloudinit.CloudConfig) error {
+			if err := s.sealUserData(cloudConfig); err != nil {
+				if !s.serverConfig.AllowPlaintextUserData {
+					return fmt.Errorf("encrypting user data: %w", err)
+				}
+				logger.Printf("falling back to plaintext user data: %v", err)
+			}
+			return nil
+		},
+	}
+
+	userData, overflowFiles, err := budget.Fit(cloudConfig, forwarder.OverflowFiles)
+	if err != nil {
+		return nil, fmt.Errorf("fitting user data: %w", err)
+	}
+	if len(overflowFiles) > 0 {
+		logger.Printf("user data exceeds %d bytes, delivering %d files after the pod VM starts", s.serverConfig.UserDataLimit, len(overflowFiles))
+		agentProxy.SetOverflowFiles(overflowFiles)
+	}
+
 	sandbox := &sandbox{
 		id:           sid,
 		podName:      pod,
@@ -314,7 +450,7 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		netNSPath:    netNSPath,
 		agentProxy:   agentProxy,
 		podNetwork:   podNetworkConfig,
-		cloudConfig:  cloudConfig,
+		cloudConfig:  userData,
 		spec:         vmSpec,
 	}
 
@@ -436,9 +572,15 @@ func (s *cloudService) StopVM(ctx context.Context, req *pb.StopVMRequest) (*pb.S
 
 	if err := s.provider.DeleteInstance(ctx, sandbox.instanceID); err != nil {
 		logger.Printf("Error deleting an instance %s: %v", sandbox.instanceID, err)
-	} else if s.ppService != nil {
-		if err := s.ppService.ReleasePeerPod(sandbox.podName, sandbox.podNamespace, sandbox.instanceID); err != nil {
-			logger.Printf("failed to release PeerPod %v", err)
+	} else {
+		// The certificate must not be accepted from a VM reusing the name or the address of the deleted one
+		if err := sandbox.agentProxy.RevokeServerCertificate(ctx); err != nil {
+			logger.Print(err)
+		}
+		if s.ppService != nil {
+			if err := s.ppService.ReleasePeerPod(sandbox.podName, sandbox.podNamespace, sandbox.instanceID); err != nil {
+				logger.Printf("failed to release PeerPod %v", err)
+			}
 		}
 	}
 
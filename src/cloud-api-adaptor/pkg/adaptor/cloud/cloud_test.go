@@ -8,14 +8,18 @@ import (
 	"fmt"
 	"net/netip"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
@@ -52,9 +56,12 @@ func (p *mockProvider) SelectInstanceType(ctx context.Context, vCPU int64, memor
 }
 
 type mockProxy struct {
-	readyCh    chan struct{}
-	stopCh     chan struct{}
-	socketPath string
+	readyCh       chan struct{}
+	stopCh        chan struct{}
+	socketPath    string
+	overflowFiles []cloudinit.WriteFile
+	revoked       bool
+	podInfo       proxy.PodInfo
 }
 
 func (p *mockProxy) Start(ctx context.Context, serverURL *url.URL) error {
@@ -76,20 +83,39 @@ func (p *mockProxy) ClientCA() (certPEM []byte) {
 	return nil
 }
 
+func (p *mockProxy) TLSAttestation() bool {
+	return false
+}
+
+func (p *mockProxy) SetOverflowFiles(files []cloudinit.WriteFile) {
+	p.overflowFiles = files
+}
+
+func (p *mockProxy) SetPodInfo(info proxy.PodInfo) {
+	p.podInfo = info
+}
+
 func (p *mockProxy) CAService() tlsutil.CAService {
 	return nil
 }
 
+func (p *mockProxy) RevokeServerCertificate(ctx context.Context) error {
+	p.revoked = true
+	return nil
+}
+
 type mockProxyFactory struct {
 	podsDir string
+	last    *mockProxy
 }
 
 func (f *mockProxyFactory) New(serverName, socketPath string) proxy.AgentProxy {
-	return &mockProxy{
+	f.last = &mockProxy{
 		socketPath: socketPath,
 		readyCh:    make(chan struct{}),
 		stopCh:     make(chan struct{}),
 	}
+	return f.last
 }
 
 type mockWorkerNode struct{}
@@ -156,4 +182,142 @@ func TestCloudService(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.NotNil(t, res3)
+	assert.True(t, proxyFactory.last.revoked, "the server certificate of the deleted VM is revoked")
+}
+
+func TestCreateVMExecPolicy(t *testing.T) {
+	// The exec policy of the namespace can't be read without a reachable API server
+	t.Setenv("NODE_NAME", "worker")
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing-kubeconfig"))
+
+	createVM := func(enabled bool) proxy.PodInfo {
+		dir := t.TempDir()
+		proxyFactory := &mockProxyFactory{podsDir: dir}
+		s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, &ServerConfig{PodsDir: dir, ForwarderPort: forwarder.DefaultListenPort, EnableNamespaceExecPolicy: enabled})
+
+		_, err := s.CreateVM(context.Background(), &pb.CreateVMRequest{
+			Id: "123",
+			Annotations: map[string]string{
+				cri.SandboxNamespace: "default",
+				cri.SandboxName:      "mypod",
+			},
+		})
+		assert.NoError(t, err)
+		return proxyFactory.last.podInfo
+	}
+
+	// The namespace is not read unless the exec policy of namespaces is enabled
+	assert.Nil(t, createVM(false).ExecDenied)
+
+	// The exec policy is read on exec requests instead of once for the lifetime of the pod VM
+	podInfo := createVM(true)
+	assert.False(t, podInfo.DenyExec)
+	require.NotNil(t, podInfo.ExecDenied)
+	_, err := podInfo.ExecDenied(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSealUserData(t *testing.T) {
+
+	keyFile := filepath.Join(t.TempDir(), "userdata.key")
+	key := []byte("0123456789abcdef0123456789abcdef")
+	assert.NoError(t, os.WriteFile(keyFile, key, 0600))
+
+	newCloudConfig := func() *cloudinit.CloudConfig {
+		return &cloudinit.CloudConfig{
+			WriteFiles: []cloudinit.WriteFile{
+				{Path: forwarder.DefaultConfigPath, Content: "{}"},
+				{Path: paths.AuthFilePath, Content: "{}"},
+				{Path: paths.InitDataPath, Content: "initdata"},
+				{Path: paths.ScratchSpacePath, Content: ""},
+			},
+		}
+	}
+
+	writtenPaths := func(cloudConfig *cloudinit.CloudConfig) (written []string) {
+		for _, wf := range cloudConfig.WriteFiles {
+			written = append(written, wf.Path)
+		}
+		return written
+	}
+
+	// No key configured
+	s := &cloudService{serverConfig: &ServerConfig{}}
+	cloudConfig := newCloudConfig()
+	assert.NoError(t, s.sealUserData(cloudConfig))
+	assert.Equal(t, newCloudConfig(), cloudConfig)
+
+	// Key in the pod VM image
+	s = &cloudService{serverConfig: &ServerConfig{UserDataKeyID: "file:///etc/peerpod/userdata.key", UserDataKeyFile: keyFile}}
+	cloudConfig = newCloudConfig()
+	assert.NoError(t, s.sealUserData(cloudConfig))
+	assert.Equal(t, []string{paths.ScratchSpacePath, cloudinit.EnvelopePath}, writtenPaths(cloudConfig))
+
+	envelope, err := cloudinit.ParseEnvelope([]byte(cloudConfig.WriteFiles[1].Content))
+	assert.NoError(t, err)
+	files, err := envelope.Open(key)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	// Key released by KBS keeps initdata in plaintext
+	s = &cloudService{serverConfig: &ServerConfig{UserDataKeyID: "kbs:///default/userdata/key", UserDataKeyFile: keyFile}}
+	cloudConfig = newCloudConfig()
+	assert.NoError(t, s.sealUserData(cloudConfig))
+	assert.Equal(t, []string{paths.InitDataPath, paths.ScratchSpacePath, cloudinit.EnvelopePath}, writtenPaths(cloudConfig))
+
+	// Missing key file
+	s = &cloudService{serverConfig: &ServerConfig{UserDataKeyID: "kbs:///default/userdata/key", UserDataKeyFile: keyFile + ".missing"}}
+	cloudConfig = newCloudConfig()
+	assert.Error(t, s.sealUserData(cloudConfig))
+	assert.Equal(t, newCloudConfig(), cloudConfig)
+}
+
+func TestCloudServiceUserDataLimit(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := &ServerConfig{
+		PodsDir:       dir,
+		ForwarderPort: forwarder.DefaultListenPort,
+		UserDataLimit: 100,
+	}
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, cfg)
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+
+	_, err := s.CreateVM(ctx, req)
+	assert.ErrorIs(t, err, cloudinit.ErrUserDataTooLarge)
+
+	cfg.UserDataLimit = 0
+	res, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestPodVMTags(t *testing.T) {
+	t.Setenv("NODE_NAME", "worker-0")
+
+	s := &cloudService{serverConfig: &ServerConfig{ClusterID: "cluster-a", Version: "v0.1.0"}}
+	s.tags = ownerTags(s.serverConfig)
+
+	assert.Equal(t, map[string]string{
+		provider.TagClusterID:    "cluster-a",
+		provider.TagNodeName:     "worker-0",
+		provider.TagVersion:      "v0.1.0",
+		provider.TagPodNamespace: "default",
+		provider.TagPodName:      "nginx",
+		provider.TagSandboxID:    "123",
+	}, s.podVMTags("default", "nginx", "123"))
+
+	// Unknown values are not tagged
+	s.tags = ownerTags(&ServerConfig{ClusterID: "cluster-a"})
+	assert.NotContains(t, s.tags, provider.TagVersion)
 }
@@ -32,6 +32,8 @@ type cloudService struct {
 	mutex        sync.Mutex
 	ppService    *k8sops.PeerPodService
 	serverConfig *ServerConfig
+	// tags identify the cluster and the node owning the pod VMs
+	tags map[string]string
 }
 
 type sandboxID string
@@ -39,7 +41,7 @@ type sandboxID string
 type sandbox struct {
 	agentProxy   proxy.AgentProxy
 	podNetwork   *tunneler.Config
-	cloudConfig  *cloudinit.CloudConfig
+	cloudConfig  cloudinit.CloudConfigGenerator
 	id           sandboxID
 	podName      string
 	podNamespace string
@@ -4,8 +4,12 @@
 package k8sops
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -14,6 +18,9 @@ const (
 
 	// DefaultNamespace is used when namespace detection fails
 	DefaultNamespace = "confidential-containers-system"
+
+	// DenyExecAnnotation is the namespace annotation that denies exec into the peer pods of the namespace
+	DenyExecAnnotation = "peerpods.confidentialcontainers.org/deny-exec"
 )
 
 // GetCurrentNamespace detects the namespace where the current pod is running
@@ -43,3 +50,40 @@ func GetCurrentNamespaceWithDefault() string {
 
 	return DefaultNamespace
 }
+
+// IsExecDenied returns whether exec into the peer pods of a namespace is denied by its annotation
+func IsExecDenied(ctx context.Context, namespace string) (bool, error) {
+	cli, err := GetClientset()
+	if err != nil {
+		return false, fmt.Errorf("failed to get k8s client: %w", err)
+	}
+
+	ns, err := cli.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	value, ok := ns.Annotations[DenyExecAnnotation]
+	if !ok {
+		return false, nil
+	}
+	deny, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation of namespace %s: %w", DenyExecAnnotation, namespace, err)
+	}
+	return deny, nil
+}
+
+// GetClusterID returns the UID of the kube-system namespace, which identifies the cluster
+func GetClusterID() (string, error) {
+	cli, err := GetClientset()
+	if err != nil {
+		return "", fmt.Errorf("failed to get k8s client: %w", err)
+	}
+
+	ns, err := cli.CoreV1().Namespaces().Get(context.TODO(), "kube-system", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(ns.UID), nil
+}
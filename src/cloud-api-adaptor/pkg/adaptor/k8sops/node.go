@@ -97,6 +97,20 @@ type Auth struct {
 	Auth     string `json:"auth"`
 }
 
+// GetPodAnnotations gets the annotations of the specified pod
+func GetPodAnnotations(podName string, namespace string) (map[string]string, error) {
+	cli, err := GetClientset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get k8s client: %w", err)
+	}
+
+	pod, err := cli.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pod.Annotations, nil
+}
+
 // GetImagePullSecrets gets image pull secrets for the specified pod
 func GetImagePullSecrets(podName string, namespace string) ([]byte, error) {
 
@@ -228,6 +242,15 @@ func getClient(kubeConfig *restclient.Config) (*k8sclient.Clientset, error) {
 	return clientSet, nil
 }
 
+// GetClientset returns a clientset using the in-cluster configuration
+func GetClientset() (*k8sclient.Clientset, error) {
+	kubeConfig, err := getKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return getClient(kubeConfig)
+}
+
 // isKubernetesEnvironment checks if the environment is Kubernetes
 func IsKubernetesEnvironment() bool {
 	nodeName := os.Getenv("NODE_NAME")
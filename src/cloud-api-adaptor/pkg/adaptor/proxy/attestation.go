@@ -0,0 +1,110 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/containerd/ttrpc"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+// attestServerCertificate connects to agent-protocol-forwarder presenting a self-signed bootstrap certificate,
+// and installs a server certificate issued for its attested key
+func (p *agentProxy) attestServerCertificate(ctx context.Context, dialer *tls.Dialer, address string) error {
+	config := dialer.Config.Clone()
+	// The bootstrap certificate can't be verified. Its key is verified with TEE evidence instead.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = nil
+
+	bootstrapDialer := &tls.Dialer{
+		NetDialer: dialer.NetDialer,
+		Config:    config,
+	}
+	conn, err := bootstrapDialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	peerCerts := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return errors.New("no server certificate is presented")
+	}
+
+	_, err = p.installAttestedServerCertificate(ctx, client, peerCerts[0])
+	return err
+}
+
+// renewAttestedServerCertificate issues a new server certificate for the attested key of agent-protocol-forwarder
+func (p *agentProxy) renewAttestedServerCertificate(ctx context.Context, address string) error {
+	conn, err := p.dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	cert, err := p.installAttestedServerCertificate(ctx, client, p.getServerCert())
+	if err != nil {
+		return err
+	}
+
+	p.replaceServerCert(ctx, cert)
+	return nil
+}
+
+// installAttestedServerCertificate verifies the evidence of a certificate request for the key of peerCert,
+// and installs a server certificate issued for it
+func (p *agentProxy) installAttestedServerCertificate(ctx context.Context, client *ttrpc.Client, peerCert *x509.Certificate) (*x509.Certificate, error) {
+	nonce, err := attestation.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	csrPEM, evidence, err := forwarder.GetAttestedCertificateRequest(ctx, client, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := tlsutil.ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key presented in the TLS handshake must be the attested one
+	if !bytes.Equal(csr.RawSubjectPublicKeyInfo, peerCert.RawSubjectPublicKeyInfo) {
+		return nil, fmt.Errorf("certificate request of %s is not for the key of its TLS connection", p.serverName)
+	}
+
+	if err := p.verifier.Verify(ctx, evidence, attestation.RuntimeData(nonce, csr.RawSubjectPublicKeyInfo)); err != nil {
+		return nil, fmt.Errorf("failed to verify evidence of %s: %w", p.serverName, err)
+	}
+
+	certPEM, err := p.caService.IssueForCSR(p.serverName, csrPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := forwarder.InstallServerCertificate(ctx, client, certPEM); err != nil {
+		return nil, err
+	}
+
+	cert, err := tlsutil.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("Installed server certificate of %s for its attested %s key", p.serverName, evidence.TEE)
+	return cert, nil
+}
@@ -0,0 +1,111 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/agentproto"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+type nopPodNode struct{}
+
+func (n *nopPodNode) Setup() error    { return nil }
+func (n *nopPodNode) Teardown() error { return nil }
+
+type rejectingVerifier struct{}
+
+func (v *rejectingVerifier) Verify(ctx context.Context, evidence *attestation.Evidence, runtimeData string) error {
+	return errors.New("untrusted evidence")
+}
+
+// startAttestedForwarder starts agent-protocol-forwarder with attestation-bound TLS for serverName
+func startAttestedForwarder(t *testing.T, clientCA []byte, serverName string) string {
+	config := &forwarder.Config{
+		TLSClientCA:    string(clientCA),
+		TLSAttestation: true,
+		TLSServerName:  serverName,
+	}
+	agentDialer := func(ctx context.Context) (net.Conn, error) {
+		return nil, errors.New("no agent")
+	}
+
+	d := forwarder.NewDaemon(config, testListenAddressProxy, &tlsutil.TLSConfig{}, agentproto.NewRedirector(agentDialer), &nopPodNode{}, forwarder.WithAttester(attestation.NewFakeAttester()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-errCh
+	})
+
+	select {
+	case <-d.Ready():
+	case err := <-errCh:
+		require.NoError(t, err)
+	}
+	return d.Addr()
+}
+
+func TestAgentProxyTLSAttestation(t *testing.T) {
+	f := NewFactory(testPauseImageLatest, &tlsutil.TLSConfig{}, time.Second, FactoryOptions{ServerCertValidity: time.Hour, Verifier: attestation.NewFakeVerifier()}).(*factory)
+	address := startAttestedForwarder(t, f.tlsConfig.CertData, testServerName)
+
+	p := f.New(testServerName, testSocketPathTest).(*agentProxy)
+	assert.True(t, p.TLSAttestation())
+
+	ctx := context.Background()
+
+	conn, err := p.dial(ctx, address)
+	require.NoError(t, err)
+	conn.Close()
+
+	// The presented certificate is issued by the CA for the attested key
+	serverCert := p.getServerCert()
+	require.NotNil(t, serverCert)
+	assert.Equal(t, testServerName, serverCert.Subject.CommonName)
+	assert.Equal(t, time.Hour, serverCert.NotAfter.Sub(serverCert.NotBefore))
+
+	require.NoError(t, p.renewServerCertificate(ctx, address))
+	renewed := p.getServerCert()
+	assert.NotEqual(t, serverCert.SerialNumber, renewed.SerialNumber)
+	assert.Equal(t, serverCert.RawSubjectPublicKeyInfo, renewed.RawSubjectPublicKeyInfo)
+
+	conn, err = p.dial(ctx, address)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, renewed.SerialNumber, p.getServerCert().SerialNumber)
+}
+
+func TestAgentProxyTLSAttestationRejected(t *testing.T) {
+	f := NewFactory(testPauseImageLatest, &tlsutil.TLSConfig{}, time.Second, FactoryOptions{Verifier: &rejectingVerifier{}}).(*factory)
+	address := startAttestedForwarder(t, f.tlsConfig.CertData, testServerName)
+
+	p := f.New(testServerName, testSocketPathTest).(*agentProxy)
+
+	_, err := p.dial(context.Background(), address)
+	assert.Error(t, err)
+	assert.Nil(t, p.getServerCert())
+}
+
+func TestNewFactoryIgnoresVerifierWithoutCA(t *testing.T) {
+	tlsConfig := &tlsutil.TLSConfig{CertData: []byte("cert"), KeyData: []byte("key"), CAData: []byte("ca")}
+	f := NewFactory(testPauseImageLatest, tlsConfig, testTimeout5SecondProxy, FactoryOptions{Verifier: attestation.NewFakeVerifier()}).(*factory)
+
+	assert.Nil(t, f.verifier)
+	assert.False(t, f.New(testServerName, testSocketPathTest).TLSAttestation())
+}
@@ -0,0 +1,130 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+const (
+	// revocationRefreshInterval bounds how often the revocation list is reloaded from the CertStore
+	revocationRefreshInterval = 30 * time.Second
+
+	// minRenewalCheckInterval and maxRenewalCheckInterval bound how often server certificates are checked for renewal
+	minRenewalCheckInterval = time.Minute
+	maxRenewalCheckInterval = time.Hour
+
+	// maxRevokedCertificates bounds the size of the revocation list kept in the CertStore, about 70 bytes
+	// per entry, well below the 1 MiB limit of a Kubernetes Secret. The entries expiring first are dropped.
+	maxRevokedCertificates = 8192
+)
+
+// certManager keeps the revocation list of the server certificates issued by cloud-api-adaptor
+type certManager struct {
+	store       CertStore
+	mutex       sync.Mutex
+	revoked     *tlsutil.RevocationList
+	lastRefresh time.Time
+}
+
+func newCertManager(store CertStore) *certManager {
+	return &certManager{
+		store:   store,
+		revoked: tlsutil.NewRevocationList(),
+	}
+}
+
+// refreshRevocationList reloads the revocation list from the CertStore when it is older than revocationRefreshInterval
+func (m *certManager) refreshRevocationList(ctx context.Context) {
+	if m.store == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if time.Since(m.lastRefresh) < revocationRefreshInterval {
+		return
+	}
+
+	data, err := m.store.Load(ctx)
+	if err != nil {
+		logger.Printf("Failed to reload the revocation list, using the previous one: %v", err)
+		return
+	}
+	m.lastRefresh = time.Now()
+
+	revoked := tlsutil.NewRevocationList()
+	if len(data[CertStoreRevoked]) > 0 {
+		if err := revoked.UnmarshalJSON(data[CertStoreRevoked]); err != nil {
+			logger.Printf("Failed to parse the revocation list, using the previous one: %v", err)
+			return
+		}
+	}
+	m.revoked = revoked
+}
+
+// revoke adds cert to the revocation list, and to the one of the CertStore shared with the other
+// cloud-api-adaptor instances. Expired certificates are dropped from the stored list, and the
+// certificates expiring first when it exceeds maxRevokedCertificates.
+func (m *certManager) revoke(ctx context.Context, cert *x509.Certificate) error {
+	if m.store != nil {
+		_, err := m.store.Update(ctx, func(data map[string][]byte) (bool, error) {
+			revoked := tlsutil.NewRevocationList()
+			if len(data[CertStoreRevoked]) > 0 {
+				if err := revoked.UnmarshalJSON(data[CertStoreRevoked]); err != nil {
+					return false, err
+				}
+			}
+			revoked.Revoke(cert)
+			revoked.Prune(time.Now())
+			if dropped := revoked.Truncate(maxRevokedCertificates); dropped > 0 {
+				logger.Printf("The revocation list exceeds %d certificates, dropped the %d expiring first", maxRevokedCertificates, dropped)
+			}
+
+			revokedJSON, err := revoked.MarshalJSON()
+			if err != nil {
+				return false, err
+			}
+			data[CertStoreRevoked] = revokedJSON
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.revoked.Revoke(cert)
+	return nil
+}
+
+// verifyConnection rejects pod VMs presenting a revoked server certificate
+func (m *certManager) verifyConnection(state tls.ConnectionState) error {
+	m.mutex.Lock()
+	revoked := m.revoked
+	m.mutex.Unlock()
+
+	return revoked.VerifyConnection(state)
+}
+
+// renewalCheckInterval returns how often a server certificate with the given lifetime is checked for renewal
+func renewalCheckInterval(lifetime time.Duration) time.Duration {
+	interval := lifetime / 10
+	if interval < minRenewalCheckInterval {
+		return minRenewalCheckInterval
+	}
+	if interval > maxRenewalCheckInterval {
+		return maxRenewalCheckInterval
+	}
+	return interval
+}
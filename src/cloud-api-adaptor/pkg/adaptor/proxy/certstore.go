@@ -0,0 +1,118 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Keys of the TLS material kept in a CertStore
+const (
+	CertStoreCACert     = "ca.crt"
+	CertStoreCAKey      = "ca.key"
+	CertStoreClientCert = "client.crt"
+	CertStoreClientKey  = "client.key"
+	CertStoreRevoked    = "revoked.json"
+)
+
+// CertStore persists the TLS material shared by cloud-api-adaptor instances
+type CertStore interface {
+	// Load returns the stored data, or nil if nothing has been stored yet
+	Load(ctx context.Context) (map[string][]byte, error)
+
+	// Update calls update with the stored data, an empty map if nothing has been stored yet,
+	// and stores the data if update reports a change. Concurrent updates are retried.
+	// It returns the resulting data.
+	Update(ctx context.Context, update func(data map[string][]byte) (bool, error)) (map[string][]byte, error)
+}
+
+type secretCertStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewSecretCertStore returns a CertStore backed by a Kubernetes Secret
+func NewSecretCertStore(client kubernetes.Interface, namespace, name string) CertStore {
+	return &secretCertStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *secretCertStore) Load(ctx context.Context) (map[string][]byte, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", s.namespace, s.name, err)
+	}
+	return secret.Data, nil
+}
+
+func (s *secretCertStore) Update(ctx context.Context, update func(data map[string][]byte) (bool, error)) (map[string][]byte, error) {
+	var result map[string][]byte
+
+	isRetriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+
+	err := retry.OnError(retry.DefaultRetry, isRetriable, func() error {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		notFound := apierrors.IsNotFound(err)
+		if err != nil && !notFound {
+			return fmt.Errorf("failed to get secret %s/%s: %w", s.namespace, s.name, err)
+		}
+
+		data := make(map[string][]byte)
+		if !notFound {
+			maps.Copy(data, secret.Data)
+		}
+
+		changed, err := update(data)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			result = data
+			return nil
+		}
+
+		if notFound {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: data,
+			}
+			_, err = s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+		} else {
+			secret.Data = data
+			_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return err
+		}
+
+		result = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update secret %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	return result, nil
+}
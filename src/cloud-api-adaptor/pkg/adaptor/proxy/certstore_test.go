@@ -0,0 +1,256 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containerd/ttrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+const (
+	testCertStoreNamespace = "confidential-containers-system"
+	testCertStoreSecret    = "peer-pods-tls"
+)
+
+func TestSecretCertStore(t *testing.T) {
+	client := fake.NewClientset()
+	store := NewSecretCertStore(client, testCertStoreNamespace, testCertStoreSecret)
+	ctx := context.Background()
+
+	data, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	data, err = store.Update(ctx, func(data map[string][]byte) (bool, error) {
+		return false, nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	_, err = client.CoreV1().Secrets(testCertStoreNamespace).Get(ctx, testCertStoreSecret, metav1.GetOptions{})
+	assert.Error(t, err, "an unchanged store must not create the secret")
+
+	for _, value := range []string{"first", "second"} {
+		data, err = store.Update(ctx, func(data map[string][]byte) (bool, error) {
+			data[CertStoreCACert] = []byte(value)
+			return true, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, value, string(data[CertStoreCACert]))
+	}
+
+	data, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data[CertStoreCACert]))
+
+	_, err = store.Update(ctx, func(data map[string][]byte) (bool, error) {
+		return false, fmt.Errorf("update failed")
+	})
+	assert.ErrorContains(t, err, "update failed")
+}
+
+func TestNewFactoryWithCertStore(t *testing.T) {
+	store := NewSecretCertStore(fake.NewClientset(), testCertStoreNamespace, testCertStoreSecret)
+
+	first := NewFactory(testPauseImageLatest, &tlsutil.TLSConfig{}, testTimeout5SecondProxy, FactoryOptions{CertStore: store, ServerCertValidity: time.Hour}).(*factory)
+	second := NewFactory(testPauseImageLatest, &tlsutil.TLSConfig{}, testTimeout5SecondProxy, FactoryOptions{CertStore: store, ServerCertValidity: time.Hour}).(*factory)
+
+	// A restarted cloud-api-adaptor reuses the persisted CA and client certificates
+	assert.Equal(t, first.tlsConfig.CAData, second.tlsConfig.CAData)
+	assert.Equal(t, first.tlsConfig.CertData, second.tlsConfig.CertData)
+	assert.Equal(t, first.tlsConfig.KeyData, second.tlsConfig.KeyData)
+
+	certPEM, _, err := first.caService.Issue(testServerName)
+	require.NoError(t, err)
+	cert, err := tlsutil.ParseCertificatePEM(certPEM)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, cert.NotAfter.Sub(cert.NotBefore))
+
+	// Explicitly configured certificates are not replaced
+	tlsConfig := &tlsutil.TLSConfig{CertData: []byte("cert"), KeyData: []byte("key"), CAData: []byte("ca")}
+	third := NewFactory(testPauseImageLatest, tlsConfig, testTimeout5SecondProxy, FactoryOptions{CertStore: store}).(*factory)
+	assert.Nil(t, third.caService)
+	assert.Equal(t, "ca", string(tlsConfig.CAData))
+}
+
+func TestLoadOrCreateCertificatesReplacesUnusable(t *testing.T) {
+	store := NewSecretCertStore(fake.NewClientset(), testCertStoreNamespace, testCertStoreSecret)
+	ctx := context.Background()
+
+	caPEM, caKeyPEM, err := tlsutil.NewCAKeyPair("agent-protocol-forwarder")
+	require.NoError(t, err)
+	_, err = store.Update(ctx, func(data map[string][]byte) (bool, error) {
+		data[CertStoreCACert] = caPEM
+		data[CertStoreCAKey] = caKeyPEM
+		data[CertStoreClientCert] = []byte("invalid")
+		data[CertStoreClientKey] = []byte("invalid")
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	data, err := loadOrCreateCertificates(ctx, store, true, true)
+	require.NoError(t, err)
+	assert.Equal(t, caPEM, data[CertStoreCACert], "a valid CA certificate must be kept")
+	_, err = tlsutil.ParseCertificatePEM(data[CertStoreClientCert])
+	assert.NoError(t, err, "an invalid client certificate must be replaced")
+
+	// Certificates expiring within minStoredCertValidity are replaced
+	cert, err := tlsutil.ParseCertificatePEM(caPEM)
+	require.NoError(t, err)
+	assert.True(t, isStoredCertUsable(caPEM, caKeyPEM, time.Now()))
+	assert.False(t, isStoredCertUsable(caPEM, caKeyPEM, cert.NotAfter.Add(-minStoredCertValidity/2)))
+	assert.False(t, isStoredCertUsable(caPEM, caKeyPEM, cert.NotAfter.Add(time.Hour)))
+	assert.False(t, isStoredCertUsable(caPEM, nil, time.Now()))
+}
+
+// startTestForwarder starts a TLS listener presenting a server certificate issued by the factory,
+// and serving the certificate service. Renewed certificates are sent to renewed.
+func startTestForwarder(t *testing.T, f *factory, serverName string, renewed chan<- []byte) string {
+	certPEM, keyPEM, err := f.caService.Issue(serverName)
+	require.NoError(t, err)
+
+	serverConfig, err := tlsutil.GetTLSConfigFor(&tlsutil.TLSConfig{CAData: f.tlsConfig.CertData, CertData: certPEM, KeyData: keyPEM})
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", testListenAddressProxy, serverConfig)
+	require.NoError(t, err)
+
+	server, err := ttrpc.NewServer()
+	require.NoError(t, err)
+	server.RegisterService(forwarder.CertificateServiceName, &ttrpc.ServiceDesc{
+		Methods: map[string]ttrpc.Method{
+			"RenewServerCertificate": func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+				req := &wrapperspb.BytesValue{}
+				if err := unmarshal(req); err != nil {
+					return nil, err
+				}
+				var payload struct {
+					Cert string `json:"cert"`
+				}
+				if err := json.Unmarshal(req.Value, &payload); err != nil {
+					return nil, err
+				}
+				renewed <- []byte(payload.Cert)
+				return &emptypb.Empty{}, nil
+			},
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+
+	return listener.Addr().String()
+}
+
+func TestAgentProxyServerCertificate(t *testing.T) {
+	store := NewSecretCertStore(fake.NewClientset(), testCertStoreNamespace, testCertStoreSecret)
+	f := NewFactory(testPauseImageLatest, &tlsutil.TLSConfig{}, time.Second, FactoryOptions{CertStore: store, ServerCertValidity: time.Hour}).(*factory)
+
+	renewed := make(chan []byte, 1)
+	address := startTestForwarder(t, f, testServerName, renewed)
+
+	p := f.New(testServerName, testSocketPathTest).(*agentProxy)
+	ctx := context.Background()
+
+	conn, err := p.dial(ctx, address)
+	require.NoError(t, err)
+	conn.Close()
+
+	serverCert := p.getServerCert()
+	require.NotNil(t, serverCert)
+	assert.Equal(t, testServerName, serverCert.Subject.CommonName)
+
+	t.Run("renewal pushes a new certificate", func(t *testing.T) {
+		require.NoError(t, p.renewServerCertificate(ctx, address))
+
+		certPEM := <-renewed
+		cert, err := tlsutil.ParseCertificatePEM(certPEM)
+		require.NoError(t, err)
+		assert.Equal(t, testServerName, cert.Subject.CommonName)
+		assert.NotEqual(t, serverCert.SerialNumber, cert.SerialNumber)
+		assert.Equal(t, cert.SerialNumber, p.getServerCert().SerialNumber)
+
+		// The replaced certificate is revoked
+		data, err := store.Load(ctx)
+		require.NoError(t, err)
+		stored := tlsutil.NewRevocationList()
+		require.NoError(t, stored.UnmarshalJSON(data[CertStoreRevoked]))
+		assert.True(t, stored.IsRevoked(serverCert))
+		assert.False(t, stored.IsRevoked(cert))
+	})
+
+	t.Run("revoked certificates are rejected", func(t *testing.T) {
+		revoked := tlsutil.NewRevocationList()
+		revoked.Revoke(serverCert)
+		revokedJSON, err := json.Marshal(revoked)
+		require.NoError(t, err)
+
+		_, err = store.Update(ctx, func(data map[string][]byte) (bool, error) {
+			data[CertStoreRevoked] = revokedJSON
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		// Force reloading the revocation list
+		f.certs.lastRefresh = time.Time{}
+
+		_, err = p.dial(ctx, address)
+		assert.ErrorIs(t, err, tlsutil.ErrCertificateRevoked)
+	})
+	t.Run("certificates of deleted pod VMs are revoked", func(t *testing.T) {
+		// Start from an empty revocation list
+		_, err := store.Update(ctx, func(data map[string][]byte) (bool, error) {
+			delete(data, CertStoreRevoked)
+			return true, nil
+		})
+		require.NoError(t, err)
+		f.certs.lastRefresh = time.Time{}
+		f.certs.refreshRevocationList(ctx)
+
+		deleted := f.New(testServerName, testSocketPathTest).(*agentProxy)
+		conn, err := deleted.dial(ctx, address)
+		require.NoError(t, err)
+		conn.Close()
+
+		cert := deleted.getServerCert()
+		require.NoError(t, deleted.RevokeServerCertificate(ctx))
+
+		data, err := store.Load(ctx)
+		require.NoError(t, err)
+		stored := tlsutil.NewRevocationList()
+		require.NoError(t, stored.UnmarshalJSON(data[CertStoreRevoked]))
+		assert.True(t, stored.IsRevoked(cert))
+
+		// Other proxies reject the certificate without reloading the revocation list
+		_, err = f.New(testServerName, testSocketPathTest).(*agentProxy).dial(ctx, address)
+		assert.ErrorIs(t, err, tlsutil.ErrCertificateRevoked)
+	})
+}
+
+func TestRenewalCheckInterval(t *testing.T) {
+	assert.Equal(t, minRenewalCheckInterval, renewalCheckInterval(time.Minute))
+	assert.Equal(t, 6*time.Minute, renewalCheckInterval(time.Hour))
+	assert.Equal(t, maxRenewalCheckInterval, renewalCheckInterval(24*time.Hour))
+}
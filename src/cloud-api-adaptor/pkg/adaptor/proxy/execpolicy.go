@@ -0,0 +1,57 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// execPolicyCacheTTL bounds how often the exec policy of a namespace is read
+const execPolicyCacheTTL = 30 * time.Second
+
+// execPolicy caches whether exec is denied in the namespace of a pod. A failed read is retried
+// on the next exec request, using the last read policy meanwhile. Exec is only denied when the
+// policy was read as denying it, so that an unreadable namespace does not block exec.
+type execPolicy struct {
+	read func(ctx context.Context) (bool, error)
+
+	mutex    sync.Mutex
+	denied   bool
+	lastRead time.Time
+	now      func() time.Time
+}
+
+func newExecPolicy(read func(ctx context.Context) (bool, error)) *execPolicy {
+	return &execPolicy{
+		read: read,
+		now:  time.Now,
+	}
+}
+
+// isDenied returns whether exec is denied in the namespace of the pod
+func (e *execPolicy) isDenied(ctx context.Context, namespace string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := e.now()
+	if !e.lastRead.IsZero() && now.Sub(e.lastRead) < execPolicyCacheTTL {
+		return e.denied
+	}
+
+	denied, err := e.read(ctx)
+	if err == nil {
+		e.denied = denied
+		e.lastRead = now
+		return denied
+	}
+
+	if !e.lastRead.IsZero() {
+		logger.Printf("error reading exec policy of namespace %s, using the one read at %s: %v", namespace, e.lastRead.Format(time.RFC3339), err)
+		return e.denied
+	}
+	logger.Printf("error reading exec policy of namespace %s, allowing exec: %v", namespace, err)
+	return false
+}
@@ -0,0 +1,78 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExecPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var denied bool
+	var readErr error
+	reads := 0
+	e := newExecPolicy(func(context.Context) (bool, error) {
+		reads++
+		return denied, readErr
+	})
+	e.now = func() time.Time { return now }
+
+	// Exec is allowed while the policy has never been read
+	readErr = errors.New("API server unavailable")
+	assert.False(t, e.isDenied(ctx, "default"))
+
+	// A failed read is retried on the next request
+	readErr = nil
+	denied = true
+	assert.True(t, e.isDenied(ctx, "default"))
+	assert.Equal(t, 2, reads)
+
+	// The policy is cached
+	denied = false
+	now = now.Add(execPolicyCacheTTL / 2)
+	assert.True(t, e.isDenied(ctx, "default"))
+	assert.Equal(t, 2, reads)
+
+	// The policy is re-read when the cache expires
+	now = now.Add(execPolicyCacheTTL)
+	assert.False(t, e.isDenied(ctx, "default"))
+	assert.Equal(t, 3, reads)
+
+	// The last read policy is used while the policy cannot be read
+	denied = true
+	now = now.Add(execPolicyCacheTTL)
+	assert.True(t, e.isDenied(ctx, "default"))
+	readErr = errors.New("API server unavailable")
+	now = now.Add(time.Hour)
+	assert.True(t, e.isDenied(ctx, "default"))
+	assert.Equal(t, 5, reads)
+}
+
+func TestProxyServiceExecPolicy(t *testing.T) {
+	service, cleanup := setupMockAgentAndService(t)
+	defer cleanup()
+
+	denied := true
+	service.pod = PodInfo{Namespace: "production", Name: "mypod"}
+	service.execPolicy = newExecPolicy(func(context.Context) (bool, error) { return denied, nil })
+
+	_, err := service.ExecProcess(context.Background(), &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The namespace no longer denies exec once the cache expires
+	denied = false
+	service.execPolicy.lastRead = time.Time{}
+	_, err = service.ExecProcess(context.Background(), &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"})
+	assert.NoError(t, err)
+}
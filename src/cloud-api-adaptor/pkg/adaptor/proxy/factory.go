@@ -4,8 +4,10 @@
 package proxy
 
 import (
+	"context"
 	"time"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 )
 
@@ -17,42 +19,157 @@ type factory struct {
 	pauseImage   string
 	tlsConfig    *tlsutil.TLSConfig
 	caService    tlsutil.CAService
+	certs        *certManager
+	verifier     attestation.Verifier
+	policy       *AgentPolicy
+	recording    SessionRecording
 	proxyTimeout time.Duration
 }
 
-func NewFactory(pauseImage string, tlsConfig *tlsutil.TLSConfig, proxyTimeout time.Duration) Factory {
+// FactoryOptions are the optional features of the agent proxies created by a factory
+type FactoryOptions struct {
+	// CertStore persists the generated CA and client certificates, which are reused by the next
+	// cloud-api-adaptor instance
+	CertStore CertStore
+	// ServerCertValidity sets the lifetime of the server certificates issued for pod VMs, 0 keeps the default
+	ServerCertValidity time.Duration
+	// Verifier restricts server certificates to keys generated by pod VMs and bound to verified TEE evidence
+	Verifier attestation.Verifier
+	// Policy checks agent requests before they are forwarded
+	Policy *AgentPolicy
+	// Recording selects what is recorded of exec and attach sessions in the pod directories
+	Recording SessionRecording
+}
+
+// NewFactory creates a factory of agent proxies with the optional features of opts
+func NewFactory(pauseImage string, tlsConfig *tlsutil.TLSConfig, proxyTimeout time.Duration, opts FactoryOptions) Factory {
 
-	if tlsConfig != nil && !tlsConfig.HasCertAuth() {
+	needClientCert := tlsConfig != nil && !tlsConfig.HasCertAuth()
+	needCA := tlsConfig != nil && !tlsConfig.HasCA()
 
-		certPEM, keyPEM, err := tlsutil.NewClientCertificate("cloud-api-adaptor")
+	data := map[string][]byte{}
+
+	if opts.CertStore != nil && (needClientCert || needCA) {
+		var err error
+		data, err = loadOrCreateCertificates(context.Background(), opts.CertStore, needClientCert, needCA)
 		if err != nil {
 			panic(err)
 		}
+	}
+
+	if needClientCert {
+
+		certPEM, keyPEM := data[CertStoreClientCert], data[CertStoreClientKey]
+		if certPEM == nil {
+			var err error
+			certPEM, keyPEM, err = tlsutil.NewClientCertificate("cloud-api-adaptor")
+			if err != nil {
+				panic(err)
+			}
+		}
 		tlsConfig.CertData = certPEM
 		tlsConfig.KeyData = keyPEM
 	}
 
 	var caService tlsutil.CAService
+	var certs *certManager
 
-	if tlsConfig != nil && !tlsConfig.HasCA() {
+	if needCA {
 
-		s, err := tlsutil.NewCAService("agent-protocol-forwarder")
+		caOpts := []tlsutil.CAOption{tlsutil.WithServerCertValidity(opts.ServerCertValidity)}
+		if data[CertStoreCACert] != nil {
+			caOpts = append(caOpts, tlsutil.WithCAKeyPair(data[CertStoreCACert], data[CertStoreCAKey]))
+		}
+
+		s, err := tlsutil.NewCAService("agent-protocol-forwarder", caOpts...)
 		if err != nil {
 			panic(err)
 		}
 		caService = s
 		tlsConfig.CAData = caService.RootCertificate()
+		certs = newCertManager(opts.CertStore)
+	}
+
+	verifier := opts.Verifier
+	if verifier != nil && caService == nil {
+		logger.Printf("Attestation-bound TLS requires automatically generated server certificates, ignoring the verifier")
+		verifier = nil
 	}
 
 	return &factory{
 		pauseImage:   pauseImage,
 		tlsConfig:    tlsConfig,
 		caService:    caService,
+		certs:        certs,
+		verifier:     verifier,
+		policy:       opts.Policy,
+		recording:    opts.Recording,
 		proxyTimeout: proxyTimeout,
 	}
 }
 
 func (f *factory) New(serverName, socketPath string) AgentProxy {
 
-	return NewAgentProxy(serverName, socketPath, f.pauseImage, f.tlsConfig, f.caService, f.proxyTimeout)
+	p := newAgentProxy(serverName, socketPath, f.pauseImage, f.tlsConfig, f.caService, f.proxyTimeout)
+	p.certs = f.certs
+	p.verifier = f.verifier
+	p.policy = f.policy
+	p.recording = f.recording
+	return p
+}
+
+// minStoredCertValidity is the validity left below which the stored CA and client certificates are replaced
+const minStoredCertValidity = 30 * 24 * time.Hour
+
+// isStoredCertUsable returns whether a stored certificate and its key are set, and the certificate is
+// valid for at least minStoredCertValidity
+func isStoredCertUsable(certPEM, keyPEM []byte, now time.Time) bool {
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return false
+	}
+	cert, err := tlsutil.ParseCertificatePEM(certPEM)
+	if err != nil {
+		logger.Printf("Failed to parse a stored certificate, replacing it: %v", err)
+		return false
+	}
+	if now.Add(minStoredCertValidity).After(cert.NotAfter) {
+		logger.Printf("The stored certificate %q expires at %s, replacing it", cert.Subject.Organization, cert.NotAfter.UTC().Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// loadOrCreateCertificates loads the client and CA certificates from certStore, generating
+// and storing the missing, invalid and expiring ones. Concurrently started instances end up
+// with the same certificates.
+func loadOrCreateCertificates(ctx context.Context, certStore CertStore, needClientCert, needCA bool) (map[string][]byte, error) {
+
+	return certStore.Update(ctx, func(data map[string][]byte) (bool, error) {
+		changed := false
+		now := time.Now()
+
+		if needClientCert && !isStoredCertUsable(data[CertStoreClientCert], data[CertStoreClientKey], now) {
+			certPEM, keyPEM, err := tlsutil.NewClientCertificate("cloud-api-adaptor")
+			if err != nil {
+				return false, err
+			}
+			data[CertStoreClientCert] = certPEM
+			data[CertStoreClientKey] = keyPEM
+			changed = true
+			logger.Printf("Stored a new client certificate")
+		}
+
+		if needCA && !isStoredCertUsable(data[CertStoreCACert], data[CertStoreCAKey], now) {
+			certPEM, keyPEM, err := tlsutil.NewCAKeyPair("agent-protocol-forwarder")
+			if err != nil {
+				return false, err
+			}
+			data[CertStoreCACert] = certPEM
+			data[CertStoreCAKey] = keyPEM
+			changed = true
+			logger.Printf("Stored a new CA certificate")
+		}
+
+		return changed, nil
+	})
 }
@@ -0,0 +1,245 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// AgentPolicyPackage is the Rego package of the node-level agent policy
+	AgentPolicyPackage = "agent_proxy"
+
+	auditAllow = "allow"
+	auditDeny  = "deny"
+)
+
+// PolicyMethods are the agent requests checked against the node-level agent policy. The policy decides
+// on each of them with a boolean rule named after the request type, e.g. data.agent_proxy.ExecProcessRequest.
+var PolicyMethods = []string{"CreateContainer", "ExecProcess", "CopyFile"}
+
+// AgentPolicy evaluates agent requests against a node-level policy before they are forwarded to pod VMs,
+// and writes an audit record of each decision. It is independent of the policy enforced in pod VMs.
+type AgentPolicy struct {
+	queries map[string]rego.PreparedEvalQuery
+
+	auditMutex sync.Mutex
+	audit      io.Writer
+}
+
+// PolicyInput is the input of the node-level agent policy
+type PolicyInput struct {
+	Pod     PodInfo        `json:"pod"`
+	Request map[string]any `json:"request"`
+}
+
+// PodInfo identifies the pod of an agent proxy
+type PodInfo struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Instance  string `json:"instance"`
+	// DenyExec denies all exec requests in the pod, as set on its namespace
+	DenyExec bool `json:"deny_exec"`
+	// ExecDenied, if set, reads whether exec is denied in the namespace of the pod. It is called on
+	// exec requests, with the result cached for a short time, and sets DenyExec.
+	ExecDenied func(ctx context.Context) (bool, error) `json:"-"`
+}
+
+// auditRecord is a line of the audit log, in JSON
+type auditRecord struct {
+	Time         string `json:"time"`
+	PodNamespace string `json:"pod_namespace,omitempty"`
+	PodName      string `json:"pod_name,omitempty"`
+	Instance     string `json:"instance"`
+	Method       string `json:"method"`
+	ContainerID  string `json:"container_id,omitempty"`
+	ExecID       string `json:"exec_id,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Decision     string `json:"decision"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// NewAgentPolicy loads the Rego policy in policyPath, and opens auditLogPath to append audit records.
+// With an empty policyPath, all requests are allowed and only audited. With an empty auditLogPath,
+// audit records are written to the standard logger output.
+func NewAgentPolicy(ctx context.Context, policyPath, auditLogPath string) (*AgentPolicy, error) {
+	p := &AgentPolicy{
+		queries: map[string]rego.PreparedEvalQuery{},
+		audit:   log.Writer(),
+	}
+
+	if policyPath != "" {
+		module, err := os.ReadFile(policyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read agent policy: %w", err)
+		}
+		if err := p.load(ctx, policyPath, string(module)); err != nil {
+			return nil, err
+		}
+	}
+
+	if auditLogPath != "" {
+		file, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open agent policy audit log: %w", err)
+		}
+		p.audit = file
+	}
+
+	return p, nil
+}
+
+func (p *AgentPolicy) load(ctx context.Context, filename, module string) error {
+	parsed, err := ast.ParseModuleWithOpts(filename, module, ast.ParserOptions{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return fmt.Errorf("failed to compile agent policy: %w", err)
+	}
+	if pkg := parsed.Package.Path.String(); pkg != "data."+AgentPolicyPackage {
+		return fmt.Errorf("agent policy is in package %s instead of %s", strings.TrimPrefix(pkg, "data."), AgentPolicyPackage)
+	}
+
+	defined := map[string]bool{}
+	for _, rule := range parsed.Rules {
+		defined[rule.Head.Ref().String()] = true
+	}
+
+	for _, method := range PolicyMethods {
+		if !defined[method+"Request"] {
+			// Requests of rules the policy does not define at all are allowed, so that a policy can restrict only some of them
+			logger.Printf("Agent policy does not define %sRequest, allowing all %s requests", method, method)
+			continue
+		}
+		query, err := rego.New(
+			rego.Query(fmt.Sprintf("data.%s.%sRequest", AgentPolicyPackage, method)),
+			rego.ParsedModule(parsed),
+			rego.SetRegoVersion(ast.RegoV1),
+		).PrepareForEval(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to compile agent policy: %w", err)
+		}
+		p.queries[method] = query
+	}
+	return nil
+}
+
+// Check evaluates an agent request, and returns a PermissionDenied error if the policy does not allow it.
+// Exec requests are denied in the pods of namespaces denying exec, whatever the policy. Other requests
+// are allowed when the policy does not define their rule, and denied when the rule is undefined for
+// the request or fails to evaluate.
+func (p *AgentPolicy) Check(ctx context.Context, pod PodInfo, method string, req proto.Message) error {
+	allowed, reason := p.evaluate(ctx, pod, method, req)
+
+	record := auditRecord{
+		Time:         time.Now().UTC().Format(time.RFC3339Nano),
+		PodNamespace: pod.Namespace,
+		PodName:      pod.Name,
+		Instance:     pod.Instance,
+		Method:       method,
+		Decision:     auditAllow,
+		Reason:       reason,
+	}
+	if r, ok := req.(interface{ GetContainerId() string }); ok {
+		record.ContainerID = r.GetContainerId()
+	}
+	if r, ok := req.(interface{ GetExecId() string }); ok {
+		record.ExecID = r.GetExecId()
+	}
+	if r, ok := req.(interface{ GetPath() string }); ok {
+		record.Path = r.GetPath()
+	}
+	if !allowed {
+		record.Decision = auditDeny
+	}
+	p.writeAudit(&record)
+
+	if !allowed {
+		return status.Errorf(codes.PermissionDenied, "%sRequest is blocked by node policy: %s", method, reason)
+	}
+	return nil
+}
+
+func (p *AgentPolicy) evaluate(ctx context.Context, pod PodInfo, method string, req proto.Message) (allowed bool, reason string) {
+	if reason := namespaceDenial(pod, method); reason != "" {
+		return false, reason
+	}
+
+	query, ok := p.queries[method]
+	if !ok {
+		return true, ""
+	}
+
+	input, err := policyInput(pod, req)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	rs, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, fmt.Sprintf("failed to evaluate policy: %v", err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, fmt.Sprintf("%sRequest is undefined", method)
+	}
+	allowed, ok = rs[0].Expressions[0].Value.(bool)
+	if !ok {
+		return false, fmt.Sprintf("%sRequest is not a boolean", method)
+	}
+	if !allowed {
+		return false, fmt.Sprintf("%sRequest is false", method)
+	}
+	return true, ""
+}
+
+// namespaceDenial returns why the namespace of the pod denies a request, or "" if it does not
+func namespaceDenial(pod PodInfo, method string) string {
+	if method == "ExecProcess" && pod.DenyExec {
+		return fmt.Sprintf("exec is denied in namespace %s", pod.Namespace)
+	}
+	return ""
+}
+
+func policyInput(pod PodInfo, req proto.Message) (*PolicyInput, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var request map[string]any
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	// File contents are not inspected
+	delete(request, "data")
+
+	return &PolicyInput{Pod: pod, Request: request}, nil
+}
+
+func (p *AgentPolicy) writeAudit(record *auditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		logger.Printf("Failed to marshal audit record: %v", err)
+		return
+	}
+
+	p.auditMutex.Lock()
+	defer p.auditMutex.Unlock()
+
+	if _, err := p.audit.Write(append(line, '\n')); err != nil {
+		logger.Printf("Failed to write audit record: %v", err)
+	}
+}
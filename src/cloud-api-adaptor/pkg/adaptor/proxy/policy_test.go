@@ -0,0 +1,173 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAgentPolicy = `package agent_proxy
+
+default CreateContainerRequest := true
+
+CreateContainerRequest := false if {
+	some mount in input.request.OCI.Mounts
+	startswith(mount.source, "/var/run/docker.sock")
+}
+
+default ExecProcessRequest := false
+
+ExecProcessRequest if {
+	input.pod.namespace != "production"
+}
+
+CopyFileRequest if {
+	startswith(input.request.path, "/run/kata-containers/shared/containers/")
+}
+`
+
+func newTestAgentPolicy(t *testing.T, policy string) (*AgentPolicy, string) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.rego")
+	auditPath := filepath.Join(dir, "audit.log")
+	if policy != "" {
+		require.NoError(t, os.WriteFile(policyPath, []byte(policy), 0600))
+	} else {
+		policyPath = ""
+	}
+
+	p, err := NewAgentPolicy(context.Background(), policyPath, auditPath)
+	require.NoError(t, err)
+	return p, auditPath
+}
+
+func readAuditLog(t *testing.T, path string) []auditRecord {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestAgentPolicy(t *testing.T) {
+	p, auditPath := newTestAgentPolicy(t, testAgentPolicy)
+	ctx := context.Background()
+	pod := PodInfo{Namespace: "default", Name: "mypod", Instance: "podvm-mypod-12345678"}
+
+	createReq := newCreateContainerRequest(testContainerID123).withMounts(&pb.Mount{Destination: testMountDestination, Source: testMountPointData}).req
+	assert.NoError(t, p.Check(ctx, pod, "CreateContainer", createReq))
+
+	createReq = newCreateContainerRequest(testContainerID123).withMounts(&pb.Mount{Destination: "/var/run/docker.sock", Source: "/var/run/docker.sock"}).req
+	err := p.Check(ctx, pod, "CreateContainer", createReq)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	execReq := &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"}
+	assert.NoError(t, p.Check(ctx, pod, "ExecProcess", execReq))
+	err = p.Check(ctx, PodInfo{Namespace: "production", Name: "mypod"}, "ExecProcess", execReq)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// CopyFileRequest is undefined for other paths
+	copyReq := &pb.CopyFileRequest{Path: "/run/kata-containers/shared/containers/abc-resolv.conf", Data: []byte("nameserver 10.0.0.10")}
+	assert.NoError(t, p.Check(ctx, pod, "CopyFile", copyReq))
+	err = p.Check(ctx, pod, "CopyFile", &pb.CopyFileRequest{Path: "/etc/passwd"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(t, err, "CopyFileRequest is undefined")
+
+	records := readAuditLog(t, auditPath)
+	require.Len(t, records, 6)
+	var decisions []string
+	for _, record := range records {
+		decisions = append(decisions, record.Decision)
+	}
+	assert.Equal(t, []string{"allow", "deny", "allow", "deny", "allow", "deny"}, decisions)
+
+	assert.Equal(t, "default", records[2].PodNamespace)
+	assert.Equal(t, "mypod", records[2].PodName)
+	assert.Equal(t, "podvm-mypod-12345678", records[2].Instance)
+	assert.Equal(t, "ExecProcess", records[2].Method)
+	assert.Equal(t, testContainerID123, records[2].ContainerID)
+	assert.Equal(t, "exec1", records[2].ExecID)
+	assert.Equal(t, "ExecProcessRequest is false", records[3].Reason)
+	assert.Equal(t, "/etc/passwd", records[5].Path)
+}
+
+func TestAgentPolicyAuditOnly(t *testing.T) {
+	p, auditPath := newTestAgentPolicy(t, "")
+
+	err := p.Check(context.Background(), PodInfo{}, "ExecProcess", &pb.ExecProcessRequest{ContainerId: testContainerID123})
+	assert.NoError(t, err)
+
+	records := readAuditLog(t, auditPath)
+	require.Len(t, records, 1)
+	assert.Equal(t, "allow", records[0].Decision)
+}
+
+func TestNewAgentPolicyErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewAgentPolicy(context.Background(), filepath.Join(dir, "missing.rego"), "")
+	assert.Error(t, err)
+
+	policyPath := filepath.Join(dir, "policy.rego")
+	require.NoError(t, os.WriteFile(policyPath, []byte("package agent_proxy\n\nExecProcessRequest if {\n"), 0600))
+	_, err = NewAgentPolicy(context.Background(), policyPath, "")
+	assert.ErrorContains(t, err, "failed to compile agent policy")
+
+	require.NoError(t, os.WriteFile(policyPath, []byte("package agent\n\ndefault ExecProcessRequest := false\n"), 0600))
+	_, err = NewAgentPolicy(context.Background(), policyPath, "")
+	assert.ErrorContains(t, err, "instead of agent_proxy")
+}
+
+func TestAgentPolicySingleRule(t *testing.T) {
+	p, _ := newTestAgentPolicy(t, `package agent_proxy
+
+default ExecProcessRequest := false
+`)
+	ctx := context.Background()
+	pod := PodInfo{Namespace: "default", Name: "mypod"}
+
+	// Requests of the rules the policy does not define are allowed
+	createReq := newCreateContainerRequest(testContainerID123).withMounts(&pb.Mount{Destination: testMountDestination, Source: testMountPointData}).req
+	assert.NoError(t, p.Check(ctx, pod, "CreateContainer", createReq))
+	assert.NoError(t, p.Check(ctx, pod, "CopyFile", &pb.CopyFileRequest{Path: "/run/kata-containers/shared/containers/abc-hosts"}))
+
+	err := p.Check(ctx, pod, "ExecProcess", &pb.ExecProcessRequest{ContainerId: testContainerID123})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestProxyServicePolicy(t *testing.T) {
+	service, cleanup := setupMockAgentAndService(t)
+	defer cleanup()
+
+	service.policy, _ = newTestAgentPolicy(t, testAgentPolicy)
+	service.pod = PodInfo{Namespace: "production", Name: "mypod"}
+
+	_, err := service.CreateContainer(context.Background(), newCreateContainerRequest(testContainerID123).req)
+	assert.NoError(t, err)
+
+	_, err = service.ExecProcess(context.Background(), &pb.ExecProcessRequest{ContainerId: testContainerID123})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = service.CopyFile(context.Background(), &pb.CopyFileRequest{Path: "/etc/passwd"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
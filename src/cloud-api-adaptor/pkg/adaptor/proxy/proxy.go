@@ -4,8 +4,10 @@
 package proxy
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log"
@@ -17,7 +19,10 @@ import (
 	"time"
 
 	retry "github.com/avast/retry-go/v4"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
 )
@@ -38,12 +43,26 @@ type AgentProxy interface {
 	Ready() chan struct{}
 	Shutdown() error
 	CAService() tlsutil.CAService
+	// TLSAttestation returns whether server certificates are only issued for keys attested by pod VMs
+	TLSAttestation() bool
 	ClientCA() (certPEM []byte)
+	// SetOverflowFiles sets files that did not fit in user data, delivered to the pod VM once it is connected
+	SetOverflowFiles(files []cloudinit.WriteFile)
+	// SetPodInfo sets the pod the proxied agent requests are checked, audited and recorded for
+	SetPodInfo(info PodInfo)
+	// RevokeServerCertificate revokes the server certificate of the pod VM, and the replaced ones that
+	// could not be revoked when they were renewed, once the pod VM has been deleted
+	RevokeServerCertificate(ctx context.Context) error
 }
 
 type agentProxy struct {
 	tlsConfig    *tlsutil.TLSConfig
 	caService    tlsutil.CAService
+	certs        *certManager
+	verifier     attestation.Verifier
+	policy       *AgentPolicy
+	podInfo      PodInfo
+	recording    SessionRecording
 	readyCh      chan struct{}
 	stopCh       chan struct{}
 	serverName   string
@@ -51,9 +70,21 @@ type agentProxy struct {
 	pauseImage   string
 	proxyTimeout time.Duration
 	stopOnce     sync.Once
+
+	// serverCert is the latest server certificate presented by the pod VM, and unrevokedCerts the
+	// certificates it replaced that could not be revoked yet
+	serverCertMutex sync.Mutex
+	serverCert      *x509.Certificate
+	unrevokedCerts  []*x509.Certificate
+
+	overflowFiles []cloudinit.WriteFile
 }
 
 func NewAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil.TLSConfig, caService tlsutil.CAService, proxyTimeout time.Duration) AgentProxy {
+	return newAgentProxy(serverName, socketPath, pauseImage, tlsConfig, caService, proxyTimeout)
+}
+
+func newAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil.TLSConfig, caService tlsutil.CAService, proxyTimeout time.Duration) *agentProxy {
 	return &agentProxy{
 		serverName:   serverName,
 		socketPath:   socketPath,
@@ -63,6 +94,7 @@ func NewAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil
 		pauseImage:   pauseImage,
 		tlsConfig:    tlsConfig,
 		caService:    caService,
+		podInfo:      PodInfo{Instance: serverName},
 	}
 }
 
@@ -74,6 +106,7 @@ func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error)
 	}
 
 	netDialer := &net.Dialer{Timeout: p.proxyTimeout}
+	var tlsDialer *tls.Dialer
 
 	if p.tlsConfig != nil {
 
@@ -95,10 +128,17 @@ func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error)
 			config.ServerName = podvmServername
 		}
 
-		dialer = &tls.Dialer{
+		// Reject pod VMs presenting a revoked server certificate
+		if p.certs != nil {
+			p.certs.refreshRevocationList(ctx)
+			config.VerifyConnection = p.certs.verifyConnection
+		}
+
+		tlsDialer = &tls.Dialer{
 			NetDialer: netDialer,
 			Config:    config,
 		}
+		dialer = tlsDialer
 	} else {
 		dialer = netDialer
 	}
@@ -111,6 +151,19 @@ func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error)
 		func() error {
 			var err error
 			if conn, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+				// A revoked server certificate will not become valid by retrying
+				if errors.Is(err, tlsutil.ErrCertificateRevoked) {
+					return retry.Unrecoverable(err)
+				}
+				// With attestation-bound TLS, the pod VM presents a self-signed certificate until it gets one issued
+				var verifyErr *tls.CertificateVerificationError
+				if tlsDialer != nil && p.TLSAttestation() && errors.As(err, &verifyErr) {
+					if err = p.attestServerCertificate(ctx, tlsDialer, address); err == nil {
+						conn, err = dialer.DialContext(ctx, "tcp", address)
+					}
+				}
+			}
+			if err != nil {
 				logger.Printf("Retrying failed agent proxy connection: %v", err)
 			}
 			return err
@@ -125,10 +178,120 @@ func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error)
 		return nil, err
 	}
 
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if peerCerts := tlsConn.ConnectionState().PeerCertificates; len(peerCerts) > 0 {
+			p.setServerCert(peerCerts[0])
+		}
+	}
+
 	logger.Printf("established agent proxy connection to %s", address)
 	return conn, nil
 }
 
+func (p *agentProxy) getServerCert() *x509.Certificate {
+	p.serverCertMutex.Lock()
+	defer p.serverCertMutex.Unlock()
+	return p.serverCert
+}
+
+func (p *agentProxy) setServerCert(cert *x509.Certificate) {
+	p.serverCertMutex.Lock()
+	defer p.serverCertMutex.Unlock()
+	p.serverCert = cert
+}
+
+// replaceServerCert sets the server certificate pushed to the pod VM, and revokes the one it replaces
+func (p *agentProxy) replaceServerCert(ctx context.Context, cert *x509.Certificate) {
+	p.serverCertMutex.Lock()
+	replaced := p.serverCert
+	p.serverCert = cert
+	p.serverCertMutex.Unlock()
+
+	if replaced == nil || p.certs == nil || replaced.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+		return
+	}
+	if err := p.certs.revoke(ctx, replaced); err != nil {
+		logger.Printf("Failed to revoke the replaced server certificate of %s, serial %s, retrying when it is deleted: %v", p.serverName, replaced.SerialNumber.Text(16), err)
+		p.serverCertMutex.Lock()
+		p.unrevokedCerts = append(p.unrevokedCerts, replaced)
+		p.serverCertMutex.Unlock()
+	}
+}
+
+// renewServerCertificates pushes a new server certificate to the pod VM whenever the
+// current one has passed two thirds of its lifetime
+func (p *agentProxy) renewServerCertificates(ctx context.Context, address string) {
+	for {
+		cert := p.getServerCert()
+		if cert == nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stopCh:
+			return
+		case <-time.After(renewalCheckInterval(cert.NotAfter.Sub(cert.NotBefore))):
+		}
+
+		if !tlsutil.NeedsRenewal(p.getServerCert(), time.Now()) {
+			continue
+		}
+		if err := p.renewServerCertificate(ctx, address); err != nil {
+			logger.Printf("Failed to renew server certificate of %s: %v", p.serverName, err)
+		}
+	}
+}
+
+// renewServerCertificate issues a new server certificate and pushes it to agent-protocol-forwarder
+func (p *agentProxy) renewServerCertificate(ctx context.Context, address string) error {
+	if p.TLSAttestation() {
+		return p.renewAttestedServerCertificate(ctx, address)
+	}
+
+	certPEM, keyPEM, err := p.caService.Issue(p.serverName)
+	if err != nil {
+		return err
+	}
+	cert, err := tlsutil.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	if err := forwarder.RenewServerCertificate(ctx, client, certPEM, keyPEM); err != nil {
+		return err
+	}
+
+	p.replaceServerCert(ctx, cert)
+	logger.Printf("Renewed server certificate of %s, valid until %s", p.serverName, cert.NotAfter.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// writeOverflowFiles delivers the files that did not fit in user data to agent-protocol-forwarder
+func (p *agentProxy) writeOverflowFiles(ctx context.Context, address string) error {
+	conn, err := p.dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	if err := forwarder.WriteFiles(ctx, client, p.overflowFiles); err != nil {
+		return err
+	}
+
+	logger.Printf("Delivered %d files that did not fit in user data to %s", len(p.overflowFiles), p.serverName)
+	return nil
+}
+
 func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 	if err := os.MkdirAll(filepath.Dir(p.socketPath), os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create parent directories for socket: %s", p.socketPath)
@@ -149,7 +312,16 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 	}
 
 	proxyService := newProxyService(dialer, p.pauseImage)
+	proxyService.policy = p.policy
+	proxyService.pod = p.podInfo
+	if p.podInfo.ExecDenied != nil {
+		proxyService.execPolicy = newExecPolicy(p.podInfo.ExecDenied)
+	}
+	proxyService.recorder = newSessionRecorder(filepath.Join(filepath.Dir(p.socketPath), SessionsDirName), p.recording)
 	defer func() {
+		if proxyService.recorder != nil {
+			proxyService.recorder.close()
+		}
 		if err := proxyService.Close(); err != nil {
 			logger.Printf("error closing agent proxy connection: %v", err)
 		}
@@ -159,6 +331,13 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 		return fmt.Errorf("error connecting to agent: %v", err)
 	}
 
+	// Deliver the files before serving agent requests that may use them
+	if len(p.overflowFiles) > 0 {
+		if err := p.writeOverflowFiles(ctx, serverURL.Host); err != nil {
+			return fmt.Errorf("error delivering files that did not fit in user data: %w", err)
+		}
+	}
+
 	ttrpcServer, err := ttrpc.NewServer()
 	if err != nil {
 		return fmt.Errorf("failed to create TTRPC server: %w", err)
@@ -170,6 +349,10 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if p.certs != nil && p.caService != nil {
+		go p.renewServerCertificates(ctx, serverURL.Host)
+	}
+
 	ttrpcServerErr := make(chan error)
 	go func() {
 		defer close(ttrpcServerErr)
@@ -215,6 +398,47 @@ func (p *agentProxy) CAService() tlsutil.CAService {
 	return p.caService
 }
 
+func (p *agentProxy) TLSAttestation() bool {
+	return p.caService != nil && p.verifier != nil
+}
+
+func (p *agentProxy) SetOverflowFiles(files []cloudinit.WriteFile) {
+	p.overflowFiles = files
+}
+
+func (p *agentProxy) SetPodInfo(info PodInfo) {
+	info.Instance = cmp.Or(info.Instance, p.serverName)
+	p.podInfo = info
+}
+
+func (p *agentProxy) RevokeServerCertificate(ctx context.Context) error {
+	if p.certs == nil {
+		return nil
+	}
+
+	p.serverCertMutex.Lock()
+	certs := p.unrevokedCerts
+	if p.serverCert != nil {
+		certs = append(certs, p.serverCert)
+	}
+	p.serverCertMutex.Unlock()
+
+	for i, cert := range certs {
+		if err := p.certs.revoke(ctx, cert); err != nil {
+			p.serverCertMutex.Lock()
+			p.unrevokedCerts = certs[i:]
+			p.serverCertMutex.Unlock()
+			return fmt.Errorf("failed to revoke the server certificate of %s: %w", p.serverName, err)
+		}
+		logger.Printf("Revoked the server certificate of %s, serial %s", p.serverName, cert.SerialNumber.Text(16))
+	}
+
+	p.serverCertMutex.Lock()
+	p.unrevokedCerts = nil
+	p.serverCertMutex.Unlock()
+	return nil
+}
+
 func (p *agentProxy) ClientCA() (certPEM []byte) {
 	if p.tlsConfig == nil {
 		return nil
@@ -296,7 +296,7 @@ func TestStartConnectionFailure(t *testing.T) {
 // Test NewFactory
 func TestNewFactory(t *testing.T) {
 	t.Run("NewFactory with nil TLS config", func(t *testing.T) {
-		proxyFactory := NewFactory(testPauseImageLatest, nil, testTimeout5SecondProxy)
+		proxyFactory := NewFactory(testPauseImageLatest, nil, testTimeout5SecondProxy, FactoryOptions{})
 		assert.NotNil(t, proxyFactory)
 
 		// Just verify it's not nil and can create proxies
@@ -305,7 +305,7 @@ func TestNewFactory(t *testing.T) {
 	})
 
 	t.Run("Factory.New creates AgentProxy", func(t *testing.T) {
-		proxyFactory := NewFactory(testPauseImageLatest, nil, testTimeout5SecondProxy)
+		proxyFactory := NewFactory(testPauseImageLatest, nil, testTimeout5SecondProxy, FactoryOptions{})
 		proxy := proxyFactory.New(testServerName, testSocketPathTest)
 
 		assert.NotNil(t, proxy)
@@ -330,3 +330,7 @@ func (m *mockCAService) RootCertificate() []byte {
 func (m *mockCAService) Issue(name string) (certPEM, keyPEM []byte, err error) {
 	return []byte(testMockCert), []byte(testMockKey), nil
 }
+
+func (m *mockCAService) IssueForCSR(name string, csrPEM []byte) (certPEM []byte, err error) {
+	return []byte(testMockCert), nil
+}
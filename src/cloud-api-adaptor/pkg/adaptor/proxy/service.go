@@ -5,20 +5,34 @@ package proxy
 
 import (
 	"context"
+	"crypto/sha256"
 	b64 "encoding/base64"
+	"encoding/hex"
+	"maps"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/agentproto"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type proxyService struct {
 	agentproto.Redirector
 	pauseImage string
+	// policy checks agent requests before they are forwarded, if not nil
+	policy *AgentPolicy
+	pod    PodInfo
+	// execPolicy reads whether exec is denied in the namespace of the pod, if not nil
+	execPolicy *execPolicy
+	// recorder records exec and attach sessions, if not nil
+	recorder *sessionRecorder
 }
 
 const (
@@ -61,10 +75,8 @@ func (s *proxyService) CreateContainer(ctx context.Context, req *pb.CreateContai
 		}
 	}
 	if len(req.OCI.Annotations) > 0 {
-		logger.Print("    annotations:")
-		for k, v := range req.OCI.Annotations {
-			logger.Printf("        %s: %s", k, v)
-		}
+		// Annotation values may carry sensitive data, e.g. the agent policy
+		logger.Printf("    annotations: %s", strings.Join(slices.Sorted(maps.Keys(req.OCI.Annotations)), ", "))
 	}
 
 	if len(req.Storages) > 0 {
@@ -94,6 +106,10 @@ func (s *proxyService) CreateContainer(ctx context.Context, req *pb.CreateContai
 		logger.Printf("Pulling image separately not support on main. It is required to use the nydus-snapshotter, which isn't configured properly here.")
 	}
 
+	if err := s.checkPolicy(ctx, s.pod, "CreateContainer", req); err != nil {
+		return nil, err
+	}
+
 	res, err := s.Redirector.CreateContainer(ctx, req)
 
 	if err != nil {
@@ -103,6 +119,23 @@ func (s *proxyService) CreateContainer(ctx context.Context, req *pb.CreateContai
 	return res, err
 }
 
+// checkPolicy checks an agent request against the node-level agent policy, if any
+func (s *proxyService) checkPolicy(ctx context.Context, pod PodInfo, method string, req proto.Message) error {
+	if s.policy == nil {
+		// Without an agent policy there is no audit log, only the namespace of the pod may deny the request
+		if reason := namespaceDenial(pod, method); reason != "" {
+			logger.Printf("%s is denied: %s", method, reason)
+			return status.Errorf(codes.PermissionDenied, "%sRequest is denied: %s", method, reason)
+		}
+		return nil
+	}
+	if err := s.policy.Check(ctx, pod, method, req); err != nil {
+		logger.Printf("%s is denied: %v", method, err)
+		return err
+	}
+	return nil
+}
+
 func isNodePublishVolumeTargetPath(volumePath, directVolumesDir string) bool {
 	if !strings.Contains(filepath.Clean(volumePath), "/volumes/"+csiPluginEscapeQualifiedName+"/") {
 		return false
@@ -116,7 +149,8 @@ func isNodePublishVolumeTargetPath(volumePath, directVolumesDir string) bool {
 
 func (s *proxyService) SetPolicy(ctx context.Context, req *pb.SetPolicyRequest) (*emptypb.Empty, error) {
 
-	logger.Printf("SetPolicy: policy:%s", req.Policy)
+	digest := sha256.Sum256([]byte(req.Policy))
+	logger.Printf("SetPolicy: size:%d sha256:%s", len(req.Policy), hex.EncodeToString(digest[:]))
 
 	res, err := s.Redirector.SetPolicy(ctx, req)
 
@@ -127,6 +161,90 @@ func (s *proxyService) SetPolicy(ctx context.Context, req *pb.SetPolicyRequest)
 	return res, err
 }
 
+func (s *proxyService) ExecProcess(ctx context.Context, req *pb.ExecProcessRequest) (*emptypb.Empty, error) {
+
+	logger.Printf("ExecProcess: containerID:%s execID:%s", req.ContainerId, req.ExecId)
+
+	pod := s.pod
+	if s.execPolicy != nil {
+		pod.DenyExec = s.execPolicy.isDenied(ctx, pod.Namespace)
+	}
+
+	if err := s.checkPolicy(ctx, pod, "ExecProcess", req); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Redirector.ExecProcess(ctx, req)
+
+	if err != nil {
+		logger.Printf("ExecProcess fails: %v", err)
+	} else if s.recorder != nil {
+		s.recorder.startExec(s.pod, req)
+	}
+
+	return res, err
+}
+
+func (s *proxyService) WriteStdin(ctx context.Context, req *pb.WriteStreamRequest) (*pb.WriteStreamResponse, error) {
+
+	if s.recorder != nil {
+		s.recorder.input(s.pod, req.ContainerId, req.ExecId, req.Data)
+	}
+
+	return s.Redirector.WriteStdin(ctx, req)
+}
+
+func (s *proxyService) ReadStdout(ctx context.Context, req *pb.ReadStreamRequest) (*pb.ReadStreamResponse, error) {
+
+	res, err := s.Redirector.ReadStdout(ctx, req)
+
+	if err == nil && s.recorder != nil {
+		s.recorder.output(req.ContainerId, req.ExecId, res.Data)
+	}
+
+	return res, err
+}
+
+func (s *proxyService) ReadStderr(ctx context.Context, req *pb.ReadStreamRequest) (*pb.ReadStreamResponse, error) {
+
+	res, err := s.Redirector.ReadStderr(ctx, req)
+
+	if err == nil && s.recorder != nil {
+		s.recorder.output(req.ContainerId, req.ExecId, res.Data)
+	}
+
+	return res, err
+}
+
+func (s *proxyService) TtyWinResize(ctx context.Context, req *pb.TtyWinResizeRequest) (*emptypb.Empty, error) {
+
+	if s.recorder != nil {
+		s.recorder.resize(s.pod, req.ContainerId, req.ExecId, req.Row, req.Column)
+	}
+
+	return s.Redirector.TtyWinResize(ctx, req)
+}
+
+func (s *proxyService) WaitProcess(ctx context.Context, req *pb.WaitProcessRequest) (*pb.WaitProcessResponse, error) {
+
+	res, err := s.Redirector.WaitProcess(ctx, req)
+
+	if err == nil && s.recorder != nil {
+		s.recorder.end(req.ContainerId, req.ExecId, res.Status)
+	}
+
+	return res, err
+}
+
+func (s *proxyService) CopyFile(ctx context.Context, req *pb.CopyFileRequest) (*emptypb.Empty, error) {
+
+	if err := s.checkPolicy(ctx, s.pod, "CopyFile", req); err != nil {
+		return nil, err
+	}
+
+	return s.Redirector.CopyFile(ctx, req)
+}
+
 func (s *proxyService) StartContainer(ctx context.Context, req *pb.StartContainerRequest) (*emptypb.Empty, error) {
 
 	logger.Printf("StartContainer: containerID:%s", req.ContainerId)
@@ -0,0 +1,319 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+)
+
+// SessionRecording selects what is recorded of exec and attach sessions
+type SessionRecording string
+
+const (
+	// SessionRecordingNone disables session recording
+	SessionRecordingNone SessionRecording = ""
+	// SessionRecordingMetadata records who started which command in which container, and when
+	SessionRecordingMetadata SessionRecording = "metadata"
+	// SessionRecordingIO also records the input, output and terminal size of sessions
+	SessionRecordingIO SessionRecording = "io"
+
+	// SessionsDirName is the directory under a pod directory with the session recordings
+	SessionsDirName = "sessions"
+
+	sessionBufferSize    = 64 * 1024
+	defaultSessionWidth  = 80
+	defaultSessionHeight = 24
+)
+
+// ParseSessionRecording parses the session recording setting
+func ParseSessionRecording(s string) (SessionRecording, error) {
+	switch recording := SessionRecording(s); recording {
+	case SessionRecordingNone, SessionRecordingMetadata, SessionRecordingIO:
+		return recording, nil
+	default:
+		return "", fmt.Errorf("invalid session recording %q, expected %q or %q", s, SessionRecordingMetadata, SessionRecordingIO)
+	}
+}
+
+// sessionHeader is the header of an asciicast v2 recording. Fields after Env are
+// not defined in asciicast, and are ignored by players.
+type sessionHeader struct {
+	Version     int               `json:"version"`
+	Width       uint32            `json:"width"`
+	Height      uint32            `json:"height"`
+	Timestamp   int64             `json:"timestamp"`
+	Command     string            `json:"command,omitempty"`
+	Title       string            `json:"title"`
+	Env         map[string]string `json:"env,omitempty"`
+	Type        string            `json:"type"`
+	Namespace   string            `json:"pod_namespace,omitempty"`
+	Pod         string            `json:"pod_name,omitempty"`
+	Instance    string            `json:"instance"`
+	ContainerID string            `json:"container_id"`
+	ExecID      string            `json:"exec_id,omitempty"`
+	User        string            `json:"user,omitempty"`
+	Cwd         string            `json:"cwd,omitempty"`
+	Terminal    bool              `json:"terminal"`
+}
+
+type sessionKey struct {
+	containerID string
+	execID      string
+}
+
+// session is an asciicast v2 recording of an exec or attach session
+type session struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	start  time.Time
+	// partial holds incomplete UTF-8 sequences at the end of the data of each event type
+	partial map[string][]byte
+}
+
+// sessionRecorder records exec and attach sessions of a pod in asciicast v2 files. Events are written
+// to buffers, so that recording does not delay the proxied streams.
+type sessionRecorder struct {
+	dir      string
+	recordIO bool
+
+	mutex    sync.Mutex
+	sessions map[sessionKey]*session
+	execs    map[sessionKey]bool
+}
+
+func newSessionRecorder(dir string, recording SessionRecording) *sessionRecorder {
+	if recording == SessionRecordingNone {
+		return nil
+	}
+	return &sessionRecorder{
+		dir:      dir,
+		recordIO: recording == SessionRecordingIO,
+		sessions: map[sessionKey]*session{},
+		execs:    map[sessionKey]bool{},
+	}
+}
+
+// startExec starts recording a session of a process started by ExecProcess
+func (r *sessionRecorder) startExec(pod PodInfo, req *pb.ExecProcessRequest) {
+	header := sessionHeader{
+		Type:        "exec",
+		ContainerID: req.ContainerId,
+		ExecID:      req.ExecId,
+	}
+	if process := req.Process; process != nil {
+		header.Command = strings.Join(process.Args, " ")
+		header.Cwd = process.Cwd
+		header.Terminal = process.Terminal
+		if process.User != nil {
+			header.User = fmt.Sprintf("%d:%d", process.User.UID, process.User.GID)
+		}
+		if process.ConsoleSize != nil {
+			header.Width, header.Height = process.ConsoleSize.Width, process.ConsoleSize.Height
+		}
+		for _, env := range process.Env {
+			if value, ok := strings.CutPrefix(env, "TERM="); ok {
+				header.Env = map[string]string{"TERM": value}
+			}
+		}
+	}
+
+	key := sessionKey{req.ContainerId, req.ExecId}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.execs[key] = true
+	r.startLocked(pod, key, header)
+}
+
+// startLocked creates the recording of a session, and must be called with r.mutex held
+func (r *sessionRecorder) startLocked(pod PodInfo, key sessionKey, header sessionHeader) *session {
+	if s := r.sessions[key]; s != nil {
+		return s
+	}
+
+	start := time.Now()
+	header.Version = 2
+	header.Timestamp = start.Unix()
+	header.Title = fmt.Sprintf("%s %s/%s %s", header.Type, pod.Namespace, pod.Name, header.ContainerID)
+	header.Namespace, header.Pod, header.Instance = pod.Namespace, pod.Name, pod.Instance
+	if header.Width == 0 || header.Height == 0 {
+		header.Width, header.Height = defaultSessionWidth, defaultSessionHeight
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.cast", header.Type, shortID(key.containerID), shortID(key.execID))
+	if key.execID == "" {
+		name = fmt.Sprintf("%s-%s-%d.cast", header.Type, shortID(key.containerID), start.UnixNano())
+	}
+
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		logger.Printf("Failed to create session recording directory: %v", err)
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		logger.Printf("Failed to create session recording: %v", err)
+		return nil
+	}
+
+	s := &session{
+		file:    file,
+		writer:  bufio.NewWriterSize(file, sessionBufferSize),
+		start:   start,
+		partial: map[string][]byte{},
+	}
+	line, err := json.Marshal(&header)
+	if err == nil {
+		_, err = s.writer.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logger.Printf("Failed to write session recording header: %v", err)
+	}
+
+	r.sessions[key] = s
+	logger.Printf("Recording %s session of container %s in %s/%s: %q", header.Type, key.containerID, pod.Namespace, pod.Name, header.Command)
+	return s
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// get returns the session of a process. An attach session is started when the
+// main process of a container gets input or a terminal resize.
+func (r *sessionRecorder) get(pod PodInfo, containerID, execID string, attach bool) *session {
+	key := sessionKey{containerID, execID}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if s := r.sessions[key]; s != nil || !attach || r.execs[key] {
+		return s
+	}
+	return r.startLocked(pod, key, sessionHeader{Type: "attach", ContainerID: containerID})
+}
+
+func (r *sessionRecorder) output(containerID, execID string, data []byte) {
+	if !r.recordIO || len(data) == 0 {
+		return
+	}
+	if s := r.get(PodInfo{}, containerID, execID, false); s != nil {
+		s.event("o", data)
+	}
+}
+
+func (r *sessionRecorder) input(pod PodInfo, containerID, execID string, data []byte) {
+	if !r.recordIO || len(data) == 0 {
+		return
+	}
+	if s := r.get(pod, containerID, execID, true); s != nil {
+		s.event("i", data)
+	}
+}
+
+func (r *sessionRecorder) resize(pod PodInfo, containerID, execID string, rows, columns uint32) {
+	if !r.recordIO {
+		return
+	}
+	if s := r.get(pod, containerID, execID, true); s != nil {
+		s.event("r", fmt.Appendf(nil, "%dx%d", columns, rows))
+	}
+}
+
+// end closes the recording of a session with a marker of the exit status
+func (r *sessionRecorder) end(containerID, execID string, status int32) {
+	key := sessionKey{containerID, execID}
+
+	r.mutex.Lock()
+	s := r.sessions[key]
+	delete(r.sessions, key)
+	delete(r.execs, key)
+	r.mutex.Unlock()
+
+	if s != nil {
+		s.event("m", fmt.Appendf(nil, "exit %d", status))
+		s.close()
+	}
+}
+
+// close closes all the recordings
+func (r *sessionRecorder) close() {
+	r.mutex.Lock()
+	sessions := r.sessions
+	r.sessions = map[sessionKey]*session{}
+	r.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+}
+
+func (s *session) event(eventType string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer == nil {
+		return
+	}
+
+	// Keep multi-byte characters split across reads in one event
+	if partial := s.partial[eventType]; len(partial) > 0 {
+		data = append(partial, data...)
+	}
+	data, s.partial[eventType] = splitIncompleteRune(data)
+	if len(data) == 0 {
+		return
+	}
+
+	line, err := json.Marshal([]any{time.Since(s.start).Seconds(), eventType, string(data)})
+	if err == nil {
+		_, err = s.writer.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logger.Printf("Failed to write session recording event: %v", err)
+	}
+}
+
+func (s *session) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer == nil {
+		return
+	}
+	if err := s.writer.Flush(); err != nil {
+		logger.Printf("Failed to write session recording: %v", err)
+	}
+	if err := s.file.Close(); err != nil {
+		logger.Printf("Failed to close session recording: %v", err)
+	}
+	s.writer = nil
+}
+
+// splitIncompleteRune splits an incomplete UTF-8 sequence at the end of data
+func splitIncompleteRune(data []byte) (complete, partial []byte) {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i], append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,241 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func readRecording(t *testing.T, path string) (sessionHeader, [][]any) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	require.True(t, scanner.Scan())
+	var header sessionHeader
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &header))
+
+	var events [][]any
+	for scanner.Scan() {
+		var event []any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.Len(t, event, 3)
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return header, events
+}
+
+func eventData(events [][]any) (types, data []string) {
+	for _, event := range events {
+		types = append(types, event[1].(string))
+		data = append(data, event[2].(string))
+	}
+	return types, data
+}
+
+func TestParseSessionRecording(t *testing.T) {
+	for _, s := range []string{"", "metadata", "io"} {
+		recording, err := ParseSessionRecording(s)
+		assert.NoError(t, err)
+		assert.Equal(t, SessionRecording(s), recording)
+	}
+	_, err := ParseSessionRecording("all")
+	assert.Error(t, err)
+
+	assert.Nil(t, newSessionRecorder(t.TempDir(), SessionRecordingNone))
+}
+
+func TestSessionRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r := newSessionRecorder(dir, SessionRecordingIO)
+	pod := PodInfo{Namespace: "default", Name: "mypod", Instance: "podvm-mypod-12345678"}
+
+	r.startExec(pod, &pb.ExecProcessRequest{
+		ContainerId: testContainerID123,
+		ExecId:      "exec1",
+		Process: &pb.Process{
+			Terminal:    true,
+			ConsoleSize: &pb.Box{Height: 40, Width: 120},
+			User:        &pb.User{UID: 1000, GID: 1000},
+			Args:        []string{"sh", "-c", "ls"},
+			Env:         []string{"PATH=/bin", "TERM=xterm"},
+			Cwd:         "/",
+		},
+	})
+	r.input(pod, testContainerID123, "exec1", []byte("ls\n"))
+	// "é" is split across two reads
+	r.output(testContainerID123, "exec1", []byte("caf\xc3"))
+	r.output(testContainerID123, "exec1", []byte("\xa9\n"))
+	r.resize(pod, testContainerID123, "exec1", 50, 132)
+	r.end(testContainerID123, "exec1", 2)
+
+	files, err := filepath.Glob(filepath.Join(dir, "exec-*.cast"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	header, events := readRecording(t, files[0])
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, uint32(120), header.Width)
+	assert.Equal(t, uint32(40), header.Height)
+	assert.Equal(t, "sh -c ls", header.Command)
+	assert.Equal(t, map[string]string{"TERM": "xterm"}, header.Env)
+	assert.Equal(t, "exec", header.Type)
+	assert.Equal(t, "default", header.Namespace)
+	assert.Equal(t, "mypod", header.Pod)
+	assert.Equal(t, "podvm-mypod-12345678", header.Instance)
+	assert.Equal(t, testContainerID123, header.ContainerID)
+	assert.Equal(t, "exec1", header.ExecID)
+	assert.Equal(t, "1000:1000", header.User)
+	assert.True(t, header.Terminal)
+
+	types, data := eventData(events)
+	assert.Equal(t, []string{"i", "o", "o", "r", "m"}, types)
+	assert.Equal(t, []string{"ls\n", "caf", "é\n", "132x50", "exit 2"}, data)
+
+	// Streams of ended sessions are not recorded
+	r.output(testContainerID123, "exec1", []byte("late"))
+	_, events = readRecording(t, files[0])
+	assert.Len(t, events, 5)
+}
+
+func TestSessionRecorderMetadata(t *testing.T) {
+	dir := t.TempDir()
+	r := newSessionRecorder(dir, SessionRecordingMetadata)
+
+	r.startExec(PodInfo{}, &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1", Process: &pb.Process{Args: []string{"cat", "/etc/passwd"}}})
+	r.input(PodInfo{}, testContainerID123, "exec1", []byte("secret\n"))
+	r.output(testContainerID123, "exec1", []byte("root:x:0:0"))
+	r.end(testContainerID123, "exec1", 0)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cast"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	header, events := readRecording(t, files[0])
+	assert.Equal(t, "cat /etc/passwd", header.Command)
+	assert.Equal(t, uint32(defaultSessionWidth), header.Width)
+	assert.Equal(t, uint32(defaultSessionHeight), header.Height)
+	types, data := eventData(events)
+	assert.Equal(t, []string{"m"}, types)
+	assert.Equal(t, []string{"exit 0"}, data)
+}
+
+func TestSessionRecorderAttach(t *testing.T) {
+	dir := t.TempDir()
+	r := newSessionRecorder(dir, SessionRecordingIO)
+
+	// Output of the main process of a container is not recorded without an attached session
+	r.output(testContainerID123, "", []byte("log line\n"))
+	r.input(PodInfo{Namespace: "default", Name: "mypod"}, testContainerID123, "", []byte("hello\n"))
+	r.output(testContainerID123, "", []byte("hello\n"))
+	r.close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "attach-*.cast"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	header, events := readRecording(t, files[0])
+	assert.Equal(t, "attach", header.Type)
+	assert.Equal(t, "attach default/mypod "+testContainerID123, header.Title)
+	types, data := eventData(events)
+	assert.Equal(t, []string{"i", "o"}, types)
+	assert.Equal(t, []string{"hello\n", "hello\n"}, data)
+}
+
+func TestSplitIncompleteRune(t *testing.T) {
+	for _, tc := range []struct {
+		data, complete, partial string
+	}{
+		{"", "", ""},
+		{"abc", "abc", ""},
+		{"caf\xc3\xa9", "caf\xc3\xa9", ""},
+		{"caf\xc3", "caf", "\xc3"},
+		{"\xe2\x82", "", "\xe2\x82"},
+		{"ab\xff", "ab\xff", ""},
+	} {
+		complete, partial := splitIncompleteRune([]byte(tc.data))
+		assert.Equal(t, tc.complete, string(complete), tc.data)
+		assert.Equal(t, tc.partial, string(partial), tc.data)
+	}
+}
+
+func TestProxyServiceSessionRecording(t *testing.T) {
+	service, cleanup := setupMockAgentAndService(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	service.recorder = newSessionRecorder(dir, SessionRecordingIO)
+	ctx := context.Background()
+
+	_, err := service.ExecProcess(ctx, &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1", Process: &pb.Process{Args: []string{"sh"}}})
+	require.NoError(t, err)
+	_, err = service.WriteStdin(ctx, &pb.WriteStreamRequest{ContainerId: testContainerID123, ExecId: "exec1", Data: []byte("exit 1\n")})
+	require.NoError(t, err)
+	_, err = service.TtyWinResize(ctx, &pb.TtyWinResizeRequest{ContainerId: testContainerID123, ExecId: "exec1", Row: 24, Column: 100})
+	require.NoError(t, err)
+	_, err = service.ReadStdout(ctx, &pb.ReadStreamRequest{ContainerId: testContainerID123, ExecId: "exec1", Len: 1024})
+	require.NoError(t, err)
+	_, err = service.WaitProcess(ctx, &pb.WaitProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cast"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	_, events := readRecording(t, files[0])
+	types, data := eventData(events)
+	assert.Equal(t, []string{"i", "r", "m"}, types)
+	assert.Equal(t, []string{"exit 1\n", "100x24", "exit 0"}, data)
+}
+
+func TestProxyServiceDenyExec(t *testing.T) {
+	service, cleanup := setupMockAgentAndService(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	service.recorder = newSessionRecorder(dir, SessionRecordingIO)
+	service.pod = PodInfo{Namespace: "production", Name: "mypod", DenyExec: true}
+
+	_, err := service.ExecProcess(context.Background(), &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cast"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	// The denial is audited by the agent policy, even if the policy allows exec
+	var auditPath string
+	service.policy, auditPath = newTestAgentPolicy(t, "")
+	_, err = service.ExecProcess(context.Background(), &pb.ExecProcessRequest{ContainerId: testContainerID123, ExecId: "exec1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	records := readAuditLog(t, auditPath)
+	require.Len(t, records, 1)
+	assert.Equal(t, "deny", records[0].Decision)
+	assert.Equal(t, "exec is denied in namespace production", records[0].Reason)
+}
+
+func TestSetPodInfo(t *testing.T) {
+	p := newAgentProxy("podvm-mypod-12345678", "", "", nil, nil, 0)
+
+	p.SetPodInfo(PodInfo{Namespace: "default", Name: "mypod", DenyExec: true})
+	assert.Equal(t, PodInfo{Namespace: "default", Name: "mypod", Instance: "podvm-mypod-12345678", DenyExec: true}, p.podInfo)
+}
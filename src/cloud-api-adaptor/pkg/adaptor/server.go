@@ -5,6 +5,7 @@ package adaptor
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"os"
@@ -18,6 +19,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/vminfo"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	pbPodVMInfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
@@ -53,7 +55,13 @@ func NewServer(provider provider.Provider, cfg *cloud.ServerConfig, workerNode p
 
 	logger.Printf("server config: %#v", cfg)
 
-	agentFactory := proxy.NewFactory(cfg.PauseImage, cfg.TLSConfig, cfg.ProxyTimeout)
+	agentFactory := proxy.NewFactory(cfg.PauseImage, cfg.TLSConfig, cfg.ProxyTimeout, proxy.FactoryOptions{
+		CertStore:          newCertStore(cfg),
+		ServerCertValidity: cfg.ServerCertValidity,
+		Verifier:           cfg.AttestationVerifier,
+		Policy:             cfg.AgentPolicy,
+		Recording:          cfg.SessionRecording,
+	})
 	cloudService := cloud.NewService(provider, agentFactory, workerNode, cfg)
 	vmInfoService := vminfo.NewService(cloudService)
 
@@ -69,6 +77,44 @@ func NewServer(provider provider.Provider, cfg *cloud.ServerConfig, workerNode p
 	}
 }
 
+// newCertStore returns the store persisting the generated TLS material, or nil if it is not configured
+func newCertStore(cfg *cloud.ServerConfig) proxy.CertStore {
+	if cfg.TLSConfig == nil || cfg.TLSSecretName == "" {
+		return nil
+	}
+	if !k8sops.IsKubernetesEnvironment() {
+		logger.Printf("Ignoring TLS secret %q outside of Kubernetes", cfg.TLSSecretName)
+		return nil
+	}
+
+	clientset, err := k8sops.GetClientset()
+	if err != nil {
+		logger.Printf("Failed to create a Kubernetes client, the generated certificates will not be persisted: %v", err)
+		return nil
+	}
+	return proxy.NewSecretCertStore(clientset, k8sops.GetCurrentNamespaceWithDefault(), cfg.TLSSecretName)
+}
+
+// NewVerifier returns the verifier of evidence for attestation-bound TLS, or nil if it is not configured
+func NewVerifier(cfg *cloud.ServerConfig) (attestation.Verifier, error) {
+	switch cfg.TLSAttestationVerifier {
+	case "":
+		return nil, nil
+	case "fake":
+		logger.Printf("Using the fake attestation verifier - use it only for testing")
+		return attestation.NewFakeVerifier(), nil
+	}
+
+	if cfg.TLSAttestationTokenKey == "" {
+		return nil, fmt.Errorf("a key verifying the attestation tokens of %s is required", cfg.TLSAttestationVerifier)
+	}
+	tokenKey, err := attestation.LoadTokenKey(cfg.TLSAttestationTokenKey)
+	if err != nil {
+		return nil, err
+	}
+	return attestation.NewRemoteVerifier(cfg.TLSAttestationVerifier, tokenKey, nil), nil
+}
+
 func (s *server) Start(ctx context.Context) (err error) {
 	if s.enableCloudConfigVerify {
 		verifierErr := s.cloudService.ConfigVerifier()
@@ -37,6 +37,24 @@ func TestServerStartAndShutdown(t *testing.T) {
 	}
 }
 
+func TestNewVerifier(t *testing.T) {
+	if v, err := NewVerifier(&cloud.ServerConfig{}); v != nil || err != nil {
+		t.Errorf("NewVerifier() = %v, %v, want no verifier", v, err)
+	}
+	if v, err := NewVerifier(&cloud.ServerConfig{TLSAttestationVerifier: "fake"}); v == nil || err != nil {
+		t.Errorf("NewVerifier() = %v, %v, want the fake verifier", v, err)
+	}
+
+	// Tokens of attestation services can't be trusted without a key
+	if _, err := NewVerifier(&cloud.ServerConfig{TLSAttestationVerifier: "https://as.example.com/attestation"}); err == nil {
+		t.Error("NewVerifier() without token key succeeded")
+	}
+	keyFile := filepath.Join(t.TempDir(), "token.pub")
+	if _, err := NewVerifier(&cloud.ServerConfig{TLSAttestationVerifier: "https://as.example.com/attestation", TLSAttestationTokenKey: keyFile}); err == nil {
+		t.Error("NewVerifier() with a missing token key succeeded")
+	}
+}
+
 func TestCreateStartAndStop(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
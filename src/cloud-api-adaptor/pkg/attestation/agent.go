@@ -0,0 +1,79 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// DefaultAgentEvidenceURL is the evidence endpoint of attestation-agent exposed by the API server in a pod VM
+const DefaultAgentEvidenceURL = "http://127.0.0.1:8006/aa/evidence"
+
+// Device files identifying hardware TEEs
+var teeDevices = []struct {
+	path string
+	tee  string
+}{
+	{"/dev/sev-guest", "snp"},
+	{"/dev/tdx_guest", "tdx"},
+	{"/dev/tdx-guest", "tdx"},
+}
+
+type agentAttester struct {
+	url     string
+	client  *http.Client
+	teeOnce sync.Once
+	tee     string
+}
+
+// NewAgentAttester returns an attester getting evidence from attestation-agent at evidenceURL
+func NewAgentAttester(evidenceURL string) Attester {
+	return &agentAttester{
+		url:    evidenceURL,
+		client: http.DefaultClient,
+	}
+}
+
+func detectTEE() string {
+	for _, device := range teeDevices {
+		if _, err := os.Stat(device.path); err == nil {
+			return device.tee
+		}
+	}
+	logger.Printf("No hardware TEE is detected, assuming %q", FakeTEE)
+	return FakeTEE
+}
+
+func (a *agentAttester) GetEvidence(ctx context.Context, runtimeData string) (*Evidence, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url+"?runtime_data="+url.QueryEscape(runtimeData), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence from %s: %w", a.url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence from %s: %w", a.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get evidence from %s: %s: %s", a.url, resp.Status, body)
+	}
+
+	a.teeOnce.Do(func() {
+		a.tee = detectTEE()
+	})
+
+	return &Evidence{TEE: a.tee, Evidence: body}, nil
+}
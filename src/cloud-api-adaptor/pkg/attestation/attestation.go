@@ -0,0 +1,54 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package attestation binds TLS keys of pod VMs to TEE evidence
+package attestation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+)
+
+var logger = log.New(log.Writer(), "[attestation] ", log.LstdFlags|log.Lmsgprefix)
+
+// NonceSize is the size of nonces sent by verifiers
+const NonceSize = 32
+
+// Evidence is TEE evidence produced by an attester
+type Evidence struct {
+	// TEE is the type of the TEE producing the evidence, e.g. "snp", "tdx" or "sample"
+	TEE      string `json:"tee"`
+	Evidence []byte `json:"evidence"`
+}
+
+// Attester produces evidence binding runtime data inside a pod VM
+type Attester interface {
+	GetEvidence(ctx context.Context, runtimeData string) (*Evidence, error)
+}
+
+// Verifier checks that evidence is genuine and binds runtime data
+type Verifier interface {
+	Verify(ctx context.Context, evidence *Evidence, runtimeData string) error
+}
+
+// NewNonce generates a random nonce
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate a nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// RuntimeData returns the runtime data binding a nonce and a DER encoded public key.
+// It is short enough to fit in the report data of hardware TEEs.
+func RuntimeData(nonce, publicKeyDER []byte) string {
+	hash := sha256.New()
+	hash.Write(nonce)
+	hash.Write(publicKeyDER)
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil))
+}
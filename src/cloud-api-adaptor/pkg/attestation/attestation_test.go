@@ -0,0 +1,170 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeData(t *testing.T) {
+	nonce, err := NewNonce()
+	require.NoError(t, err)
+	assert.Len(t, nonce, NonceSize)
+
+	runtimeData := RuntimeData(nonce, []byte("key"))
+	assert.Equal(t, runtimeData, RuntimeData(nonce, []byte("key")))
+	assert.NotEqual(t, runtimeData, RuntimeData(nonce, []byte("other key")))
+
+	// Runtime data fits in the 64 byte report data of hardware TEEs
+	assert.LessOrEqual(t, len(runtimeData), 64)
+}
+
+func TestFakeAttesterVerifier(t *testing.T) {
+	ctx := context.Background()
+	attester := NewFakeAttester()
+	verifier := NewFakeVerifier()
+
+	evidence, err := attester.GetEvidence(ctx, "runtime-data")
+	require.NoError(t, err)
+	assert.Equal(t, FakeTEE, evidence.TEE)
+
+	assert.NoError(t, verifier.Verify(ctx, evidence, "runtime-data"))
+	assert.Error(t, verifier.Verify(ctx, evidence, "other-runtime-data"))
+	assert.Error(t, verifier.Verify(ctx, &Evidence{TEE: "snp", Evidence: evidence.Evidence}, "runtime-data"))
+}
+
+func TestAgentAttester(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/aa/evidence", r.URL.Path)
+		_, _ = w.Write([]byte("evidence:" + r.URL.Query().Get("runtime_data")))
+	}))
+	defer server.Close()
+
+	attester := NewAgentAttester(server.URL + "/aa/evidence")
+	evidence, err := attester.GetEvidence(context.Background(), "runtime-data")
+	require.NoError(t, err)
+	assert.Equal(t, "evidence:runtime-data", string(evidence.Evidence))
+	assert.NotEmpty(t, evidence.TEE)
+}
+
+// newTestToken returns an attestation token signed by key, with a submodule of the given status
+// whose TEE report data is reportData
+func newTestToken(t *testing.T, key *ecdsa.PrivateKey, status string, reportData []byte, exp time.Time) string {
+	padded := make([]byte, 64)
+	copy(padded, reportData)
+
+	claims := jwt.MapClaims{
+		"exp": exp.Unix(),
+		"submods": map[string]any{
+			"cpu0": map[string]any{
+				"ear.status": status,
+				"ear.veraison.annotated-evidence": map[string]any{
+					"snp": map[string]any{"report_data": hex.EncodeToString(padded)},
+				},
+			},
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestRemoteVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// token is the response of the attestation service to the next request
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var req verificationRequest
+		require.NoError(t, json.Unmarshal(body, &req))
+		evidence, err := base64.RawURLEncoding.DecodeString(req.Evidence)
+		require.NoError(t, err)
+		runtimeData, err := base64.StdEncoding.DecodeString(req.RuntimeData.Raw)
+		require.NoError(t, err)
+
+		if req.TEE != "snp" || string(evidence) != "evidence" || string(runtimeData) != "runtime-data" {
+			http.Error(w, "verification failed", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(token))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	verifier := NewRemoteVerifier(server.URL, &key.PublicKey, nil)
+	evidence := &Evidence{TEE: "snp", Evidence: []byte("evidence")}
+	future := time.Now().Add(time.Hour)
+
+	token = newTestToken(t, key, "affirming", []byte("runtime-data"), future)
+	assert.NoError(t, verifier.Verify(ctx, evidence, "runtime-data"))
+	assert.ErrorContains(t, verifier.Verify(ctx, evidence, "other"), "verification failed")
+
+	tests := []struct {
+		name     string
+		token    string
+		evidence *Evidence
+	}{
+		{"fake TEE", token, &Evidence{TEE: FakeTEE, Evidence: []byte("evidence")}},
+		{"no token", "", evidence},
+		{"not a token", "token", evidence},
+		{"signed by another key", newTestToken(t, otherKey, "affirming", []byte("runtime-data"), future), evidence},
+		{"expired", newTestToken(t, key, "affirming", []byte("runtime-data"), time.Now().Add(-time.Hour)), evidence},
+		{"rejected by the policy", newTestToken(t, key, "contraindicated", []byte("runtime-data"), future), evidence},
+		{"other report data", newTestToken(t, key, "affirming", []byte("runtime-data-of-another-key"), future), evidence},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token = tc.token
+			assert.Error(t, verifier.Verify(ctx, tc.evidence, "runtime-data"))
+		})
+	}
+}
+
+func TestLoadTokenKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "token.pub")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	loaded, err := LoadTokenKey(keyFile)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(loaded))
+
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	_, err = LoadTokenKey(invalidFile)
+	assert.Error(t, err)
+
+	_, err = LoadTokenKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FakeTEE is the TEE type of evidence produced by the fake attester
+const FakeTEE = "sample"
+
+type fakeEvidence struct {
+	RuntimeData string `json:"runtime_data"`
+}
+
+type fakeAttester struct{}
+
+// NewFakeAttester returns an attester producing unprotected evidence. Use it only for testing.
+func NewFakeAttester() Attester {
+	return &fakeAttester{}
+}
+
+func (a *fakeAttester) GetEvidence(ctx context.Context, runtimeData string) (*Evidence, error) {
+	evidence, err := json.Marshal(&fakeEvidence{RuntimeData: runtimeData})
+	if err != nil {
+		return nil, err
+	}
+	return &Evidence{TEE: FakeTEE, Evidence: evidence}, nil
+}
+
+type fakeVerifier struct{}
+
+// NewFakeVerifier returns a verifier accepting evidence of the fake attester. Use it only for testing.
+func NewFakeVerifier() Verifier {
+	return &fakeVerifier{}
+}
+
+func (v *fakeVerifier) Verify(ctx context.Context, evidence *Evidence, runtimeData string) error {
+	if evidence.TEE != FakeTEE {
+		return fmt.Errorf("unsupported TEE type %q", evidence.TEE)
+	}
+
+	var fake fakeEvidence
+	if err := json.Unmarshal(evidence.Evidence, &fake); err != nil {
+		return fmt.Errorf("failed to parse evidence: %w", err)
+	}
+	if fake.RuntimeData != runtimeData {
+		return fmt.Errorf("evidence does not bind the expected runtime data")
+	}
+	return nil
+}
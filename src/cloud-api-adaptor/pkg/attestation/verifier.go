@@ -0,0 +1,212 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// maxTokenSize bounds the size of attestation tokens read from attestation services
+	maxTokenSize = 1 << 20
+
+	// earStatusAffirming is the status of EAR submodules whose evidence passed the appraisal policy
+	earStatusAffirming = "affirming"
+
+	// reportDataClaim is the name of the claims of the report data of the TEEs in the annotated evidence
+	reportDataClaim = "report_data"
+)
+
+// verificationRequest follows the attestation request of the attestation service used by KBS
+type verificationRequest struct {
+	TEE         string `json:"tee"`
+	Evidence    string `json:"evidence"`
+	RuntimeData struct {
+		Raw string `json:"raw"`
+	} `json:"runtime_data"`
+}
+
+// tokenClaims are the claims of an attestation token in the EAR (EAT Attestation Result) format
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Submods map[string]struct {
+		Status            string         `json:"ear.status"`
+		AnnotatedEvidence map[string]any `json:"ear.veraison.annotated-evidence"`
+	} `json:"submods"`
+}
+
+// tokenSigningMethods are the signing methods accepted for attestation tokens
+var tokenSigningMethods = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+type remoteVerifier struct {
+	url      string
+	tokenKey crypto.PublicKey
+	client   *http.Client
+}
+
+// NewRemoteVerifier returns a verifier posting evidence to an attestation service endpoint.
+// Evidence is accepted when the endpoint returns an attestation token signed with tokenKey,
+// whose submodules are all affirmed by the appraisal policy, and whose TEE report data is
+// the runtime data.
+func NewRemoteVerifier(endpoint string, tokenKey crypto.PublicKey, client *http.Client) Verifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &remoteVerifier{
+		url:      endpoint,
+		tokenKey: tokenKey,
+		client:   client,
+	}
+}
+
+// LoadTokenKey loads the public key verifying attestation tokens from a PEM file of a public key or a certificate
+func LoadTokenKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation token key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data is found in %s", path)
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s, expected a public key or a certificate", block.Type, path)
+	}
+}
+
+func (v *remoteVerifier) Verify(ctx context.Context, evidence *Evidence, runtimeData string) error {
+	// Pod VMs without hardware TEE report evidence of the sample attester, which any attestation service accepts
+	if evidence.TEE == "" || evidence.TEE == FakeTEE {
+		return fmt.Errorf("evidence of TEE type %q is only accepted by the fake verifier", evidence.TEE)
+	}
+
+	request := verificationRequest{
+		TEE:      evidence.TEE,
+		Evidence: base64.RawURLEncoding.EncodeToString(evidence.Evidence),
+	}
+	request.RuntimeData.Raw = base64.StdEncoding.EncodeToString([]byte(runtimeData))
+
+	body, err := json.Marshal(&request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify evidence at %s: %w", v.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("evidence is rejected by %s: %s: %s", v.url, resp.Status, bytes.TrimSpace(message))
+	}
+
+	token, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenSize))
+	if err != nil {
+		return fmt.Errorf("failed to read attestation token from %s: %w", v.url, err)
+	}
+
+	if err := v.verifyToken(string(bytes.TrimSpace(token)), runtimeData); err != nil {
+		return fmt.Errorf("attestation token of %s is rejected: %w", v.url, err)
+	}
+	return nil
+}
+
+// verifyToken checks the signature of an attestation token, the appraisal of its submodules, and that
+// it binds runtimeData
+func (v *remoteVerifier) verifyToken(token, runtimeData string) error {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return v.tokenKey, nil
+	}, jwt.WithValidMethods(tokenSigningMethods), jwt.WithExpirationRequired())
+	if err != nil {
+		return err
+	}
+
+	if len(claims.Submods) == 0 {
+		return errors.New("no appraisal result")
+	}
+
+	bound := false
+	for name, submod := range claims.Submods {
+		if submod.Status != earStatusAffirming {
+			return fmt.Errorf("appraisal status of %s is %q", name, submod.Status)
+		}
+		if bindsReportData(submod.AnnotatedEvidence, runtimeData) {
+			bound = true
+		}
+	}
+	if !bound {
+		return errors.New("the TEE report data is not the runtime data")
+	}
+	return nil
+}
+
+// bindsReportData returns whether the claims include the hex encoded report data of a TEE, made of
+// the runtime data padded with zeros
+func bindsReportData(claims any, runtimeData string) bool {
+	switch claims := claims.(type) {
+	case map[string]any:
+		for name, value := range claims {
+			if s, ok := value.(string); ok && name == reportDataClaim {
+				if reportData, err := hex.DecodeString(s); err == nil && isPaddedRuntimeData(reportData, runtimeData) {
+					return true
+				}
+			}
+			if bindsReportData(value, runtimeData) {
+				return true
+			}
+		}
+	case []any:
+		for _, value := range claims {
+			if bindsReportData(value, runtimeData) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPaddedRuntimeData(reportData []byte, runtimeData string) bool {
+	if len(runtimeData) == 0 || !bytes.HasPrefix(reportData, []byte(runtimeData)) {
+		return false
+	}
+	for _, b := range reportData[len(runtimeData):] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/ttrpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+// attestedCertificateRequest is the response of a GetAttestedCertificateRequest request
+type attestedCertificateRequest struct {
+	CSR      string                `json:"csr"`
+	Evidence *attestation.Evidence `json:"evidence"`
+}
+
+// attestedKey is a server key generated inside the pod VM, whose certificate requests are bound to TEE evidence
+type attestedKey struct {
+	attester  attestation.Attester
+	csrPEM    []byte
+	keyPEM    []byte
+	publicKey []byte // DER encoded public key of csrPEM
+}
+
+// newAttestedKey generates a server key for serverName, and returns it with a self-signed bootstrap certificate
+func newAttestedKey(serverName string, attester attestation.Attester) (*attestedKey, []byte, error) {
+	csrPEM, keyPEM, err := tlsutil.NewCertificateRequest(serverName)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := tlsutil.ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err := tlsutil.NewBootstrapCertificate(serverName, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k := &attestedKey{
+		attester:  attester,
+		csrPEM:    csrPEM,
+		keyPEM:    keyPEM,
+		publicKey: csr.RawSubjectPublicKeyInfo,
+	}
+	return k, certPEM, nil
+}
+
+// certificateRequest returns the certificate request together with evidence binding nonce and its public key
+func (k *attestedKey) certificateRequest(ctx context.Context, nonce []byte) ([]byte, error) {
+	if len(nonce) != attestation.NonceSize {
+		return nil, fmt.Errorf("nonce must be %d bytes long", attestation.NonceSize)
+	}
+
+	evidence, err := k.attester.GetEvidence(ctx, attestation.RuntimeData(nonce, k.publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&attestedCertificateRequest{CSR: string(k.csrPEM), Evidence: evidence})
+}
+
+// GetAttestedCertificateRequest gets a certificate request of the server key of agent-protocol-forwarder,
+// together with evidence binding nonce and the public key of the request
+func GetAttestedCertificateRequest(ctx context.Context, client *ttrpc.Client, nonce []byte) (csrPEM []byte, evidence *attestation.Evidence, err error) {
+	resp := &wrapperspb.BytesValue{}
+	if err := client.Call(ctx, CertificateServiceName, getAttestedCertificateRequestMethod, &wrapperspb.BytesValue{Value: nonce}, resp); err != nil {
+		return nil, nil, fmt.Errorf("failed to get an attested certificate request: %w", err)
+	}
+
+	var payload attestedCertificateRequest
+	if err := json.Unmarshal(resp.Value, &payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse an attested certificate request: %w", err)
+	}
+	if payload.Evidence == nil {
+		return nil, nil, fmt.Errorf("attested certificate request has no evidence")
+	}
+
+	return []byte(payload.CSR), payload.Evidence, nil
+}
+
+// InstallServerCertificate installs a server certificate issued for an attested certificate request
+func InstallServerCertificate(ctx context.Context, client *ttrpc.Client, certPEM []byte) error {
+	if err := client.Call(ctx, CertificateServiceName, installServerCertificateMethod, &wrapperspb.BytesValue{Value: certPEM}, &emptypb.Empty{}); err != nil {
+		return fmt.Errorf("failed to install server certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/containerd/ttrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+func TestAttestedCertificateService(t *testing.T) {
+	attested, bootstrapPEM, err := newAttestedKey("podvm-1", attestation.NewFakeAttester())
+	require.NoError(t, err)
+
+	bootstrap, err := tls.X509KeyPair(bootstrapPEM, attested.keyPEM)
+	require.NoError(t, err)
+	holder, err := newCertificateHolder(bootstrap)
+	require.NoError(t, err)
+
+	server, err := ttrpc.NewServer()
+	require.NoError(t, err)
+	registerCertificateService(server, holder, attested)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	nonce, err := attestation.NewNonce()
+	require.NoError(t, err)
+
+	csrPEM, evidence, err := GetAttestedCertificateRequest(ctx, client, nonce)
+	require.NoError(t, err)
+
+	csr, err := tlsutil.ParseCertificateRequestPEM(csrPEM)
+	require.NoError(t, err)
+	assert.Equal(t, bootstrap.Leaf.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo)
+	assert.NoError(t, attestation.NewFakeVerifier().Verify(ctx, evidence, attestation.RuntimeData(nonce, csr.RawSubjectPublicKeyInfo)))
+
+	_, _, err = GetAttestedCertificateRequest(ctx, client, []byte("short"))
+	assert.Error(t, err)
+
+	caService, err := tlsutil.NewCAService("agent-protocol-forwarder")
+	require.NoError(t, err)
+
+	certPEM, err := caService.IssueForCSR("podvm-1", csrPEM)
+	require.NoError(t, err)
+	require.NoError(t, InstallServerCertificate(ctx, client, certPEM))
+
+	cert, err := holder.GetCertificate(nil)
+	require.NoError(t, err)
+	expected, err := tlsutil.ParseCertificatePEM(certPEM)
+	require.NoError(t, err)
+	assert.Equal(t, expected.SerialNumber, cert.Leaf.SerialNumber)
+
+	// Certificates for other keys are rejected
+	otherCertPEM, _, err := caService.Issue("podvm-1")
+	require.NoError(t, err)
+	assert.Error(t, InstallServerCertificate(ctx, client, otherCertPEM))
+
+	// Keys generated by cloud-api-adaptor are not accepted in attested mode
+	otherCertPEM, otherKeyPEM, err := caService.Issue("podvm-1")
+	require.NoError(t, err)
+	assert.Error(t, RenewServerCertificate(ctx, client, otherCertPEM, otherKeyPEM))
+}
+
+func TestNewDaemonWithTLSAttestation(t *testing.T) {
+	config := &Config{
+		TLSClientCA:    "ca-data",
+		TLSAttestation: true,
+		TLSServerName:  "podvm-1",
+	}
+
+	d := NewDaemon(config, DefaultListenAddr, &tlsutil.TLSConfig{}, nil, &mockPodNode{}, WithAttester(attestation.NewFakeAttester())).(*daemon)
+
+	assert.Equal(t, "podvm-1", d.attestedServerName)
+	assert.Nil(t, d.tlsConfig.CertData)
+	assert.Nil(t, d.tlsConfig.KeyData)
+	assert.Equal(t, []byte("ca-data"), d.tlsConfig.CAData)
+}
@@ -0,0 +1,162 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/containerd/ttrpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	// CertificateServiceName is the TTRPC service cloud-api-adaptor uses to push renewed server certificates.
+	// It is served next to the agent services, so only a client authenticated by mutual TLS can reach it.
+	CertificateServiceName              = "peerpod.forwarder.v1.CertificateService"
+	renewServerCertificateMethod        = "RenewServerCertificate"
+	getAttestedCertificateRequestMethod = "GetAttestedCertificateRequest"
+	installServerCertificateMethod      = "InstallServerCertificate"
+)
+
+// serverCertificate is the payload of a RenewServerCertificate request
+type serverCertificate struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// certificateHolder holds the server certificate presented by the TLS listener
+type certificateHolder struct {
+	cert atomic.Pointer[tls.Certificate]
+}
+
+func newCertificateHolder(cert tls.Certificate) (*certificateHolder, error) {
+	if err := parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	h := &certificateHolder{}
+	h.cert.Store(&cert)
+	return h, nil
+}
+
+func parseLeaf(cert *tls.Certificate) error {
+	if cert.Leaf != nil {
+		return nil
+	}
+	if len(cert.Certificate) == 0 {
+		return errors.New("no certificate is found")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (h *certificateHolder) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return h.cert.Load(), nil
+}
+
+// renew replaces the server certificate. The new certificate must be for the same
+// server name, currently valid, and expire later than the current one.
+func (h *certificateHolder) renew(certPEM, keyPEM []byte) error {
+	return h.replace(certPEM, keyPEM, true)
+}
+
+func (h *certificateHolder) replace(certPEM, keyPEM []byte, mustExpireLater bool) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid server certificate: %w", err)
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return err
+	}
+
+	current := h.cert.Load().Leaf
+	if cert.Leaf.Subject.CommonName != current.Subject.CommonName {
+		return fmt.Errorf("server certificate is for %q instead of %q", cert.Leaf.Subject.CommonName, current.Subject.CommonName)
+	}
+	now := time.Now()
+	if now.Before(cert.Leaf.NotBefore) || now.After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("server certificate is not valid at %s", now.UTC().Format(time.RFC3339))
+	}
+	if mustExpireLater && !cert.Leaf.NotAfter.After(current.NotAfter) {
+		return errors.New("server certificate does not expire later than the current one")
+	}
+
+	h.cert.Store(&cert)
+	logger.Printf("Installed server certificate for %q, valid until %s", cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// registerCertificateService registers the certificate service to server. When attested is not nil, server
+// certificates are only issued for the attested key. Otherwise, certificates and keys are renewed by cloud-api-adaptor.
+func registerCertificateService(server *ttrpc.Server, holder *certificateHolder, attested *attestedKey) {
+	methods := map[string]ttrpc.Method{}
+
+	if attested != nil {
+		methods[getAttestedCertificateRequestMethod] = func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+			req := &wrapperspb.BytesValue{}
+			if err := unmarshal(req); err != nil {
+				return nil, err
+			}
+			payload, err := attested.certificateRequest(ctx, req.Value)
+			if err != nil {
+				logger.Printf("Failed to create an attested certificate request: %v", err)
+				return nil, err
+			}
+			return &wrapperspb.BytesValue{Value: payload}, nil
+		}
+		methods[installServerCertificateMethod] = func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+			req := &wrapperspb.BytesValue{}
+			if err := unmarshal(req); err != nil {
+				return nil, err
+			}
+			if err := holder.replace(req.Value, attested.keyPEM, false); err != nil {
+				logger.Printf("Rejected server certificate: %v", err)
+				return nil, err
+			}
+			return &emptypb.Empty{}, nil
+		}
+	} else {
+		methods[renewServerCertificateMethod] = func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+			req := &wrapperspb.BytesValue{}
+			if err := unmarshal(req); err != nil {
+				return nil, err
+			}
+			var payload serverCertificate
+			if err := json.Unmarshal(req.Value, &payload); err != nil {
+				return nil, fmt.Errorf("failed to parse server certificate request: %w", err)
+			}
+			if err := holder.renew([]byte(payload.Cert), []byte(payload.Key)); err != nil {
+				logger.Printf("Rejected server certificate renewal: %v", err)
+				return nil, err
+			}
+			return &emptypb.Empty{}, nil
+		}
+	}
+
+	server.RegisterService(CertificateServiceName, &ttrpc.ServiceDesc{Methods: methods})
+}
+
+// RenewServerCertificate pushes a renewed server certificate to agent-protocol-forwarder
+func RenewServerCertificate(ctx context.Context, client *ttrpc.Client, certPEM, keyPEM []byte) error {
+	payload, err := json.Marshal(&serverCertificate{Cert: string(certPEM), Key: string(keyPEM)})
+	if err != nil {
+		return err
+	}
+	if err := client.Call(ctx, CertificateServiceName, renewServerCertificateMethod, &wrapperspb.BytesValue{Value: payload}, &emptypb.Empty{}); err != nil {
+		return fmt.Errorf("failed to renew server certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/containerd/ttrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+func newTestCertificateHolder(t *testing.T, caService tlsutil.CAService, serverName string) *certificateHolder {
+	certPEM, keyPEM, err := caService.Issue(serverName)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	holder, err := newCertificateHolder(cert)
+	require.NoError(t, err)
+	return holder
+}
+
+func TestCertificateHolderRenew(t *testing.T) {
+	shortLived, err := tlsutil.NewCAService("agent-protocol-forwarder", tlsutil.WithServerCertValidity(time.Hour))
+	require.NoError(t, err)
+	longLived, err := tlsutil.NewCAService("agent-protocol-forwarder", tlsutil.WithServerCertValidity(2*time.Hour))
+	require.NoError(t, err)
+
+	t.Run("accepts a later certificate for the same server", func(t *testing.T) {
+		holder := newTestCertificateHolder(t, shortLived, "podvm-1")
+		certPEM, keyPEM, err := longLived.Issue("podvm-1")
+		require.NoError(t, err)
+
+		require.NoError(t, holder.renew(certPEM, keyPEM))
+
+		cert, err := holder.GetCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Hour, cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore))
+	})
+
+	t.Run("rejects a certificate for another server", func(t *testing.T) {
+		holder := newTestCertificateHolder(t, shortLived, "podvm-1")
+		certPEM, keyPEM, err := longLived.Issue("podvm-2")
+		require.NoError(t, err)
+
+		assert.ErrorContains(t, holder.renew(certPEM, keyPEM), "podvm-2")
+	})
+
+	t.Run("rejects a certificate expiring earlier", func(t *testing.T) {
+		holder := newTestCertificateHolder(t, longLived, "podvm-1")
+		certPEM, keyPEM, err := shortLived.Issue("podvm-1")
+		require.NoError(t, err)
+
+		assert.Error(t, holder.renew(certPEM, keyPEM))
+	})
+
+	t.Run("rejects a mismatched key", func(t *testing.T) {
+		holder := newTestCertificateHolder(t, shortLived, "podvm-1")
+		certPEM, _, err := longLived.Issue("podvm-1")
+		require.NoError(t, err)
+		_, keyPEM, err := longLived.Issue("podvm-1")
+		require.NoError(t, err)
+
+		assert.Error(t, holder.renew(certPEM, keyPEM))
+	})
+}
+
+func TestRenewServerCertificate(t *testing.T) {
+	shortLived, err := tlsutil.NewCAService("agent-protocol-forwarder", tlsutil.WithServerCertValidity(time.Hour))
+	require.NoError(t, err)
+	longLived, err := tlsutil.NewCAService("agent-protocol-forwarder", tlsutil.WithServerCertValidity(2*time.Hour))
+	require.NoError(t, err)
+
+	holder := newTestCertificateHolder(t, shortLived, "podvm-1")
+
+	server, err := ttrpc.NewServer()
+	require.NoError(t, err)
+	registerCertificateService(server, holder, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	certPEM, keyPEM, err := longLived.Issue("podvm-1")
+	require.NoError(t, err)
+	require.NoError(t, RenewServerCertificate(ctx, client, certPEM, keyPEM))
+
+	expected, err := tlsutil.ParseCertificatePEM(certPEM)
+	require.NoError(t, err)
+	cert, err := holder.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected.SerialNumber, cert.Leaf.SerialNumber)
+
+	otherCertPEM, otherKeyPEM, err := longLived.Issue("podvm-2")
+	require.NoError(t, err)
+	assert.Error(t, RenewServerCertificate(ctx, client, otherCertPEM, otherKeyPEM))
+}
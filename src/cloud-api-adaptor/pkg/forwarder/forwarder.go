@@ -15,6 +15,7 @@ import (
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/attestation"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder/interceptor"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
@@ -39,10 +40,19 @@ type Config struct {
 	PodNamespace string           `json:"pod-namespace"`
 	PodName      string           `json:"pod-name"`
 
+	// DNSMode selects how the DNS settings of the pod are applied, interceptor.DNSModeVM (the default)
+	// or interceptor.DNSModePod
+	DNSMode string `json:"dns-mode,omitempty"`
+
 	TLSServerKey  string `json:"tls-server-key,omitempty"`
 	TLSServerCert string `json:"tls-server-cert,omitempty"`
 	TLSClientCA   string `json:"tls-client-ca,omitempty"`
 
+	// TLSAttestation makes agent-protocol-forwarder generate its server key, and get a certificate for
+	// TLSServerName issued by cloud-api-adaptor after verifying TEE evidence, instead of using TLSServerKey
+	TLSAttestation bool   `json:"tls-attestation,omitempty"`
+	TLSServerName  string `json:"tls-server-name,omitempty"`
+
 	PpPrivateKey []byte `json:"sc-pp-prv,omitempty"`
 	WnPublicKey  []byte `json:"sc-wn-pub,omitempty"`
 }
@@ -63,13 +73,32 @@ type daemon struct {
 	listenAddr          string
 	stopOnce            sync.Once
 	externalNetViaPodVM bool
+	attester            attestation.Attester
+	attestedServerName  string
+}
+
+// DaemonOption customizes a daemon
+type DaemonOption func(*daemon)
+
+// WithAttester sets the attester producing evidence for attestation-bound TLS
+func WithAttester(attester attestation.Attester) DaemonOption {
+	return func(d *daemon) {
+		d.attester = attester
+	}
 }
 
-func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode) Daemon {
+func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode, opts ...DaemonOption) Daemon {
+
+	var attestedServerName string
 
 	if tlsConfig != nil && !tlsConfig.HasCertAuth() {
-		tlsConfig.CertData = []byte(spec.TLSServerCert)
-		tlsConfig.KeyData = []byte(spec.TLSServerKey)
+		if spec.TLSAttestation {
+			// The server key is generated at start up
+			attestedServerName = spec.TLSServerName
+		} else {
+			tlsConfig.CertData = []byte(spec.TLSServerCert)
+			tlsConfig.KeyData = []byte(spec.TLSServerKey)
+		}
 	}
 
 	if tlsConfig != nil && !tlsConfig.HasCA() {
@@ -83,6 +112,13 @@ func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, in
 		podNode:     podNode,
 		readyCh:     make(chan struct{}),
 		stopCh:      make(chan struct{}),
+
+		attester:           attestation.NewAgentAttester(attestation.DefaultAgentEvidenceURL),
+		attestedServerName: attestedServerName,
+	}
+
+	for _, opt := range opts {
+		opt(daemon)
 	}
 
 	if spec.PodNetwork != nil {
@@ -108,17 +144,42 @@ func (d *daemon) Start(ctx context.Context) error {
 	// Set up agent protocol interceptor
 
 	var listener net.Listener
+	var certHolder *certificateHolder
+	var attested *attestedKey
 
 	logger.Printf("Starting agent-protocol-forwarder listener on address %v", d.listenAddr)
 	if d.tlsConfig != nil {
 		logger.Printf("TLS is configured. Configure TLS listener")
 
+		if d.attestedServerName != "" {
+			logger.Printf("Attestation-bound TLS is configured. Generate a server key for %q", d.attestedServerName)
+
+			var certPEM []byte
+			var err error
+			attested, certPEM, err = newAttestedKey(d.attestedServerName, d.attester)
+			if err != nil {
+				return fmt.Errorf("Failed to generate server key: %v", err)
+			}
+			d.tlsConfig.CertData = certPEM
+			d.tlsConfig.KeyData = attested.keyPEM
+		}
+
 		// Create a TLS configuration object
 		tlsConfig, err := tlsutil.GetTLSConfigFor(d.tlsConfig)
 		if err != nil {
 			return fmt.Errorf("Failed to create tls config: %v", err)
 		}
 
+		// Serve the server certificate from a holder, so that it can be renewed without restarting the listener
+		if len(tlsConfig.Certificates) > 0 {
+			certHolder, err = newCertificateHolder(tlsConfig.Certificates[0])
+			if err != nil {
+				return fmt.Errorf("Failed to load server certificate: %v", err)
+			}
+			tlsConfig.Certificates = nil
+			tlsConfig.GetCertificate = certHolder.GetCertificate
+		}
+
 		listener, err = tls.Listen("tcp", d.listenAddr, tlsConfig)
 		if err != nil {
 			logger.Printf("failed to create tls agent-protocol-forwarder listener: %v", err)
@@ -143,6 +204,10 @@ func (d *daemon) Start(ctx context.Context) error {
 
 	pb.RegisterAgentServiceService(ttrpcServer, d.interceptor)
 	pb.RegisterHealthService(ttrpcServer, d.interceptor)
+	if certHolder != nil {
+		registerCertificateService(ttrpcServer, certHolder, attested)
+	}
+	registerUserDataService(ttrpcServer, OverflowFiles)
 
 	ttrpcServerErr := make(chan error)
 	go func() {
@@ -0,0 +1,114 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package interceptor
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+)
+
+const (
+	// DNSModeVM keeps the DNS settings of the pod out of the pod VM, and containers use the
+	// resolv.conf provided by the runtime
+	DNSModeVM = "vm"
+	// DNSModePod applies the DNS settings of the pod to its containers, without changing the resolver of the pod VM
+	DNSModePod = "pod"
+
+	// DefaultResolvConfPath is the resolv.conf written for the containers of the pod
+	DefaultResolvConfPath = "/run/peerpod/resolv.conf"
+
+	resolvConfDestination = "/etc/resolv.conf"
+)
+
+// resolvConfKeywords are the resolv.conf keywords of the DNS settings in CreateSandbox requests
+var resolvConfKeywords = map[string]bool{
+	"nameserver": true,
+	"search":     true,
+	"domain":     true,
+	"options":    true,
+	"sortlist":   true,
+}
+
+// resolvConf converts the DNS settings of a CreateSandbox request to resolv.conf. The settings are
+// resolv.conf lines, e.g. "search default.svc.cluster.local svc.cluster.local" and "options ndots:5",
+// or bare name server addresses.
+func resolvConf(dns []string) ([]byte, error) {
+	var b strings.Builder
+	for _, entry := range dns {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if addr, err := netip.ParseAddr(fields[0]); err == nil && len(fields) == 1 {
+			fmt.Fprintf(&b, "nameserver %s\n", addr)
+			continue
+		}
+		if !resolvConfKeywords[fields[0]] || len(fields) < 2 {
+			return nil, fmt.Errorf("invalid DNS setting %q", entry)
+		}
+		if fields[0] == "nameserver" {
+			if _, err := netip.ParseAddr(fields[1]); err != nil || len(fields) > 2 {
+				return nil, fmt.Errorf("invalid DNS setting %q", entry)
+			}
+		}
+		b.WriteString(strings.Join(fields, " ") + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// writeResolvConf atomically writes the DNS settings of a CreateSandbox request to path
+func writeResolvConf(path string, dns []string) error {
+	data, err := resolvConf(dns)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".resolv.conf-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// mountResolvConf bind mounts the resolv.conf of the pod to /etc/resolv.conf of a container,
+// replacing the resolv.conf provided by the runtime
+func (i *interceptor) mountResolvConf(req *pb.CreateContainerRequest) {
+	for _, m := range req.OCI.Mounts {
+		if filepath.Clean(m.Destination) == resolvConfDestination {
+			logger.Printf("    replacing %s mount source %s with %s", resolvConfDestination, m.Source, i.resolvConfPath)
+			m.Source = i.resolvConfPath
+			m.Type = "bind"
+			return
+		}
+	}
+
+	logger.Printf("    mounting %s to %s", i.resolvConfPath, resolvConfDestination)
+	req.OCI.Mounts = append(req.OCI.Mounts, &pb.Mount{
+		Destination: resolvConfDestination,
+		Source:      i.resolvConfPath,
+		Type:        "bind",
+		Options:     []string{"rbind", "ro"},
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	retry "github.com/avast/retry-go/v4"
@@ -37,6 +38,23 @@ type interceptor struct {
 	agentproto.Redirector
 
 	nsPath string
+
+	// resolvConfPath is the resolv.conf written from the DNS settings of the pod for its containers,
+	// when the DNS settings are applied to the pod instead of the pod VM
+	resolvConfPath string
+	podDNS         atomic.Bool
+}
+
+// Option customizes an interceptor
+type Option func(*interceptor)
+
+// WithPodDNS makes the interceptor write the DNS settings of CreateSandbox requests to resolvConfPath,
+// and bind mount it to /etc/resolv.conf of the containers in the pod network namespace. The resolver
+// of the pod VM is not changed.
+func WithPodDNS(resolvConfPath string) Option {
+	return func(i *interceptor) {
+		i.resolvConfPath = resolvConfPath
+	}
 }
 
 func dial(ctx context.Context, agentSocket string) (net.Conn, error) {
@@ -66,7 +84,7 @@ func dial(ctx context.Context, agentSocket string) (net.Conn, error) {
 	return conn, nil
 }
 
-func NewInterceptor(agentSocket, nsPath string) Interceptor {
+func NewInterceptor(agentSocket, nsPath string, opts ...Option) Interceptor {
 
 	agentDialer := func(ctx context.Context) (net.Conn, error) {
 		return dial(ctx, agentSocket)
@@ -74,10 +92,16 @@ func NewInterceptor(agentSocket, nsPath string) Interceptor {
 
 	redirector := agentproto.NewRedirector(agentDialer)
 
-	return &interceptor{
+	i := &interceptor{
 		Redirector: redirector,
 		nsPath:     nsPath,
 	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
 }
 
 func (i *interceptor) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (*emptypb.Empty, error) {
@@ -95,6 +119,10 @@ func (i *interceptor) CreateContainer(ctx context.Context, req *pb.CreateContain
 		logger.Printf("    %s: %q", ns.Type, ns.Path)
 	}
 
+	if i.podDNS.Load() {
+		i.mountResolvConf(req)
+	}
+
 	volumeTargetPath := req.OCI.Annotations[volumeTargetPathKey]
 	volumeTargetPathSlice := strings.Split(volumeTargetPath, ",")
 	if len(req.OCI.Mounts) > 0 {
@@ -202,6 +230,14 @@ func (i *interceptor) CreateSandbox(ctx context.Context, req *pb.CreateSandboxRe
 			logger.Printf("        %s", d)
 		}
 
+		if i.resolvConfPath != "" {
+			if err := writeResolvConf(i.resolvConfPath, req.Dns); err != nil {
+				return nil, fmt.Errorf("failed to write the DNS settings of the pod: %w", err)
+			}
+			i.podDNS.Store(true)
+			logger.Printf("      Wrote the DNS setting above to %s for the containers of the pod", i.resolvConfPath)
+		}
+
 		logger.Print("      Eliminated the DNS setting above from CreateSandboxRequest to stop updating /etc/resolv.conf on the peer pod VM")
 		logger.Print("      See https://github.com/confidential-containers/cloud-api-adaptor/issues/98 for the details.")
 		logger.Println()
@@ -85,6 +85,14 @@ func TestNewInterceptor(t *testing.T) {
 		assert.Equal(t, nsPath, interceptorImpl.nsPath)
 	})
 
+	t.Run("creates interceptor with pod DNS", func(t *testing.T) {
+		i := NewInterceptor("agent.sock", "/run/netns/test", WithPodDNS("/tmp/resolv.conf"))
+
+		interceptorImpl, ok := i.(*interceptor)
+		require.True(t, ok, "Expected *interceptor type")
+		assert.Equal(t, "/tmp/resolv.conf", interceptorImpl.resolvConfPath)
+	})
+
 	t.Run("creates interceptor with empty namespace path", func(t *testing.T) {
 		socketName := "agent.sock"
 
@@ -878,6 +886,127 @@ func TestInterceptorCreateSandboxWithDNS(t *testing.T) {
 	})
 }
 
+func TestInterceptorPodDNS(t *testing.T) {
+	t.Run("writes DNS settings for the containers of the pod", func(t *testing.T) {
+		resolvConfPath := filepath.Join(t.TempDir(), "netns", "podns", "resolv.conf")
+		mock := &mockRedirector{}
+		i := &interceptor{
+			Redirector:     mock,
+			nsPath:         "/run/netns/podns",
+			resolvConfPath: resolvConfPath,
+		}
+
+		_, err := i.CreateSandbox(context.Background(), &pb.CreateSandboxRequest{
+			SandboxId: "test-sandbox",
+			Dns: []string{
+				"nameserver 10.96.0.10",
+				"search default.svc.cluster.local svc.cluster.local cluster.local",
+				"options ndots:5",
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, mock.createSandboxCalled)
+
+		data, err := os.ReadFile(resolvConfPath)
+		require.NoError(t, err)
+		assert.Equal(t, "nameserver 10.96.0.10\nsearch default.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n", string(data))
+
+		// The resolv.conf provided by the runtime is replaced
+		req := &pb.CreateContainerRequest{
+			ContainerId: "test-container",
+			OCI: &pb.Spec{
+				Linux: &pb.Linux{},
+				Mounts: []*pb.Mount{
+					{Destination: "/etc/hosts", Source: "/run/kata-containers/shared/containers/test-hosts", Type: "bind"},
+					{Destination: "/etc/resolv.conf", Source: "/run/kata-containers/shared/containers/test-resolv.conf", Type: "bind", Options: []string{"rbind", "ro"}},
+				},
+			},
+		}
+		_, err = i.CreateContainer(context.Background(), req)
+		require.NoError(t, err)
+		require.Len(t, req.OCI.Mounts, 2)
+		assert.Equal(t, "/run/kata-containers/shared/containers/test-hosts", req.OCI.Mounts[0].Source)
+		assert.Equal(t, resolvConfPath, req.OCI.Mounts[1].Source)
+		assert.Equal(t, []string{"rbind", "ro"}, req.OCI.Mounts[1].Options)
+
+		// resolv.conf is mounted in containers without one
+		req = &pb.CreateContainerRequest{ContainerId: "test-container-2", OCI: &pb.Spec{Linux: &pb.Linux{}}}
+		_, err = i.CreateContainer(context.Background(), req)
+		require.NoError(t, err)
+		require.Len(t, req.OCI.Mounts, 1)
+		assert.Equal(t, "/etc/resolv.conf", req.OCI.Mounts[0].Destination)
+		assert.Equal(t, resolvConfPath, req.OCI.Mounts[0].Source)
+	})
+
+	t.Run("keeps DNS settings out of the pod VM", func(t *testing.T) {
+		i := &interceptor{
+			Redirector:     &mockRedirector{},
+			resolvConfPath: filepath.Join(t.TempDir(), "resolv.conf"),
+		}
+
+		req := &pb.CreateSandboxRequest{SandboxId: "test-sandbox", Dns: []string{"8.8.8.8"}}
+		_, err := i.CreateSandbox(context.Background(), req)
+		require.NoError(t, err)
+		assert.Nil(t, req.Dns)
+	})
+
+	t.Run("does not mount resolv.conf without DNS settings", func(t *testing.T) {
+		resolvConfPath := filepath.Join(t.TempDir(), "resolv.conf")
+		i := &interceptor{
+			Redirector:     &mockRedirector{},
+			resolvConfPath: resolvConfPath,
+		}
+
+		_, err := i.CreateSandbox(context.Background(), &pb.CreateSandboxRequest{SandboxId: "test-sandbox"})
+		require.NoError(t, err)
+		assert.NoFileExists(t, resolvConfPath)
+
+		mount := &pb.Mount{Destination: "/etc/resolv.conf", Source: "/run/kata-containers/shared/containers/test-resolv.conf", Type: "bind"}
+		req := &pb.CreateContainerRequest{ContainerId: "test-container", OCI: &pb.Spec{Linux: &pb.Linux{}, Mounts: []*pb.Mount{mount}}}
+		_, err = i.CreateContainer(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "/run/kata-containers/shared/containers/test-resolv.conf", mount.Source)
+	})
+
+	t.Run("rejects invalid DNS settings", func(t *testing.T) {
+		mock := &mockRedirector{}
+		i := &interceptor{
+			Redirector:     mock,
+			resolvConfPath: filepath.Join(t.TempDir(), "resolv.conf"),
+		}
+
+		_, err := i.CreateSandbox(context.Background(), &pb.CreateSandboxRequest{SandboxId: "test-sandbox", Dns: []string{"nameserver dns.example.com"}})
+		assert.ErrorContains(t, err, "invalid DNS setting")
+		assert.False(t, mock.createSandboxCalled)
+	})
+}
+
+func TestResolvConf(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dns      []string
+		expected string
+		err      bool
+	}{
+		{name: "nil", dns: nil, expected: ""},
+		{name: "bare addresses", dns: []string{"8.8.8.8", "2001:4860:4860::8888"}, expected: "nameserver 8.8.8.8\nnameserver 2001:4860:4860::8888\n"},
+		{name: "resolv.conf lines", dns: []string{"nameserver 10.96.0.10", "search  ns1.svc.cluster.local\tcluster.local ", "domain cluster.local", "options ndots:5 timeout:2", ""}, expected: "nameserver 10.96.0.10\nsearch ns1.svc.cluster.local cluster.local\ndomain cluster.local\noptions ndots:5 timeout:2\n"},
+		{name: "unknown keyword", dns: []string{"resolver 10.96.0.10"}, err: true},
+		{name: "invalid name server", dns: []string{"nameserver 10.96.0"}, err: true},
+		{name: "missing value", dns: []string{"search"}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := resolvConf(tc.dns)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(data))
+		})
+	}
+}
+
 func TestInterceptorWithComplexAnnotations(t *testing.T) {
 	t.Run("handles annotation with whitespace in paths", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -0,0 +1,98 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/containerd/ttrpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const (
+	// UserDataServiceName is the TTRPC service cloud-api-adaptor uses to deliver files that do not fit in user data
+	UserDataServiceName = "peerpod.forwarder.v1.UserDataService"
+	writeFilesMethod    = "WriteFiles"
+)
+
+// OverflowFiles are the user data files that can be delivered after agent-protocol-forwarder starts,
+// because they are only used once the pod is created
+var OverflowFiles = []string{paths.AuthFilePath}
+
+// overflowFile is an entry of a WriteFiles request
+type overflowFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// registerUserDataService registers the user data service to server. Only files in allowed are written.
+func registerUserDataService(server *ttrpc.Server, allowed []string) {
+	server.RegisterService(UserDataServiceName, &ttrpc.ServiceDesc{
+		Methods: map[string]ttrpc.Method{
+			writeFilesMethod: func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+				req := &wrapperspb.BytesValue{}
+				if err := unmarshal(req); err != nil {
+					return nil, err
+				}
+				var files []overflowFile
+				if err := json.Unmarshal(req.Value, &files); err != nil {
+					return nil, fmt.Errorf("failed to parse write files request: %w", err)
+				}
+				for _, file := range files {
+					if !slices.Contains(allowed, file.Path) {
+						return nil, fmt.Errorf("file %s is not allowed to be written", file.Path)
+					}
+				}
+				for _, file := range files {
+					if err := writeOverflowFile(file); err != nil {
+						logger.Printf("Failed to write %s: %v", file.Path, err)
+						return nil, err
+					}
+					logger.Printf("Wrote %s delivered by cloud-api-adaptor", file.Path)
+				}
+				return &emptypb.Empty{}, nil
+			},
+		},
+	})
+}
+
+func writeOverflowFile(file overflowFile) error {
+	if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	// Write to a temporary file first, so that readers never see a partial file
+	tmp := file.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(file.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, file.Path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+// WriteFiles delivers files that do not fit in user data to agent-protocol-forwarder
+func WriteFiles(ctx context.Context, client *ttrpc.Client, files []cloudinit.WriteFile) error {
+	var payload []overflowFile
+	for _, wf := range files {
+		payload = append(payload, overflowFile{Path: wf.Path, Content: wf.Content})
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := client.Call(ctx, UserDataServiceName, writeFilesMethod, &wrapperspb.BytesValue{Value: data}, &emptypb.Empty{}); err != nil {
+		return fmt.Errorf("failed to write files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/ttrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	authPath := filepath.Join(dir, "peerpod", "auth.json")
+	otherPath := filepath.Join(dir, "peerpod", "apf.json")
+
+	server, err := ttrpc.NewServer()
+	require.NoError(t, err)
+	registerUserDataService(server, []string{authPath})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	require.NoError(t, WriteFiles(ctx, client, []cloudinit.WriteFile{{Path: authPath, Content: "{}"}}))
+
+	data, err := os.ReadFile(authPath)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	// A request including a file not allowed is rejected as a whole
+	err = WriteFiles(ctx, client, []cloudinit.WriteFile{
+		{Path: authPath, Content: "{\"auths\": {}}"},
+		{Path: otherPath, Content: "{}"},
+	})
+	assert.ErrorContains(t, err, "not allowed")
+
+	data, err = os.ReadFile(authPath)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	assert.NoFileExists(t, otherPath)
+}
@@ -0,0 +1,67 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Diff returns a unified diff of two initdata bodies. The algorithm and the version are compared
+// first, then each file in data. An empty string is returned when the bodies are equivalent.
+func Diff(a, b *InitDataBody, nameA, nameB string) (string, error) {
+	var sb strings.Builder
+
+	for _, field := range []struct{ name, a, b string }{
+		{"algorithm", a.Algorithm, b.Algorithm},
+		{"version", a.Version, b.Version},
+	} {
+		if field.a != field.b {
+			fmt.Fprintf(&sb, "-%s = %q\n+%s = %q\n", field.name, field.a, field.name, field.b)
+		}
+	}
+
+	keys := slices.Sorted(maps.Keys(a.Data))
+	for key := range maps.Keys(b.Data) {
+		if _, ok := a.Data[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		fromFile, toFile := nameA+"/"+key, nameB+"/"+key
+		if _, ok := a.Data[key]; !ok {
+			fromFile = "/dev/null"
+		}
+		if _, ok := b.Data[key]; !ok {
+			toFile = "/dev/null"
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(a.Data[key]),
+			B:        splitLines(b.Data[key]),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to diff %s: %w", key, err)
+		}
+		sb.WriteString(diff)
+	}
+
+	return sb.String(), nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(text, "\n"))
+}
@@ -96,7 +96,7 @@ func Encode(initdataStr string) (string, error) {
 	return val.String(), nil
 }
 
-// Used in e2e testing
+// DecodeAnnotation decodes gzipped and base64 encoded initdata
 func DecodeAnnotation(annotation string) ([]byte, error) {
 	reader := strings.NewReader(annotation)
 	return decode(reader)
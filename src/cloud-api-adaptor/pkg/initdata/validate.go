@@ -0,0 +1,146 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+const (
+	// Version is the initdata spec version supported in the pod VM
+	Version = "0.1.0"
+
+	AAConfigKey  = "aa.toml"
+	CDHConfigKey = "cdh.toml"
+	PolicyKey    = "policy.rego"
+)
+
+var logger = log.New(log.Writer(), "[initdata] ", log.LstdFlags|log.Lmsgprefix)
+
+// Algorithms are the digest algorithms supported in the pod VM
+var Algorithms = []string{"sha256", "sha384", "sha512"}
+
+// DataKeys are the files in initdata that are provisioned in the pod VM
+var DataKeys = []string{AAConfigKey, CDHConfigKey, PolicyKey}
+
+// Load returns the initdata TOML of data, which is either plain TOML as in the pod annotation,
+// or gzipped and base64 encoded as in the INITDATA setting and user data.
+func Load(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if decoded, err := decode(bytes.NewReader(trimmed)); err == nil {
+		return decoded, nil
+	}
+	if !isText(trimmed) {
+		return nil, errors.New("initdata is neither TOML nor gzipped and base64 encoded TOML")
+	}
+	return data, nil
+}
+
+func isText(data []byte) bool {
+	return !bytes.ContainsRune(data, 0) && bytes.Equal(bytes.ToValidUTF8(data, nil), data)
+}
+
+// Validate checks initdata TOML against the initdata spec and lints the embedded files.
+// All the problems found are joined in the returned error, data keys not provisioned in
+// the pod VM are only logged. The returned InitData has the
+// digest the pod VM calculates, and is nil if the digest can't be calculated.
+func Validate(initdataToml []byte) (*InitData, error) {
+	var errs []error
+
+	body := &InitDataBody{}
+	decoder := toml.NewDecoder(bytes.NewReader(initdataToml)).DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		var strictErr *toml.StrictMissingError
+		if !errors.As(err, &strictErr) {
+			return nil, tomlError("initdata", err)
+		}
+		for _, e := range strictErr.Errors {
+			errs = append(errs, fmt.Errorf("initdata: unknown key %q", strings.Join(e.Key(), ".")))
+		}
+	}
+
+	switch {
+	case body.Version == "":
+		errs = append(errs, errors.New("initdata: version is missing"))
+	case body.Version != Version:
+		errs = append(errs, fmt.Errorf("initdata: version %q is not supported, expected %q", body.Version, Version))
+	}
+
+	var initdata *InitData
+	switch {
+	case body.Algorithm == "":
+		errs = append(errs, errors.New("initdata: algorithm is missing"))
+	case !slices.Contains(Algorithms, body.Algorithm):
+		errs = append(errs, fmt.Errorf("initdata: algorithm %q is not supported, expected one of %s", body.Algorithm, strings.Join(Algorithms, ", ")))
+	default:
+		digest, err := digest(body.Algorithm, initdataToml)
+		if err != nil {
+			return nil, err
+		}
+		initdata = &InitData{Body: body, Digest: digest}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(body.Data)) {
+		value := body.Data[key]
+		switch key {
+		case AAConfigKey, CDHConfigKey:
+			if err := toml.Unmarshal([]byte(value), &map[string]any{}); err != nil {
+				errs = append(errs, tomlError(key, err))
+			}
+		case PolicyKey:
+			for _, err := range lintPolicy(value) {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		default:
+			// The initdata spec allows other keys, which the pod VM ignores
+			logger.Printf("Warning: initdata data key %q is not provisioned in the pod VM, expected one of %s", key, strings.Join(DataKeys, ", "))
+		}
+	}
+
+	return initdata, errors.Join(errs...)
+}
+
+func tomlError(name string, err error) error {
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		row, column := decodeErr.Position()
+		return fmt.Errorf("%s: line %d, column %d: %w", name, row, column, err)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// lintPolicy parses a Rego policy, either in the Rego v1 syntax or in the v0 syntax of
+// older policies, and returns the errors of the v1 parser
+func lintPolicy(policy string) []error {
+	_, err := ast.ParseModuleWithOpts(PolicyKey, policy, ast.ParserOptions{RegoVersion: ast.RegoV1})
+	if err == nil {
+		return nil
+	}
+	if _, v0Err := ast.ParseModuleWithOpts(PolicyKey, policy, ast.ParserOptions{RegoVersion: ast.RegoV0}); v0Err == nil {
+		return nil
+	}
+
+	var astErrs ast.Errors
+	if !errors.As(err, &astErrs) {
+		return []error{err}
+	}
+	var errs []error
+	for _, astErr := range astErrs {
+		if astErr.Location != nil {
+			errs = append(errs, fmt.Errorf("line %d, column %d: %s", astErr.Location.Row, astErr.Location.Col, astErr.Message))
+		} else {
+			errs = append(errs, errors.New(astErr.Message))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,166 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInitdata = `algorithm = "sha256"
+version = "0.1.0"
+
+[data]
+"aa.toml" = '''
+[token_configs]
+[token_configs.kbs]
+url = 'http://127.0.0.1:8080'
+'''
+
+"cdh.toml" = '''
+socket = 'unix:///run/confidential-containers/cdh.sock'
+credentials = []
+
+[kbc]
+name = 'cc_kbc'
+url = 'http://127.0.0.1:8080'
+'''
+
+"policy.rego" = '''
+package agent_policy
+
+import future.keywords.in
+
+default CreateContainerRequest := true
+default ExecProcessRequest := false
+
+# Allow reading logs "only" from containers {
+ReadStreamRequest if {
+	input.process_id in ["1", "2"]
+}
+'''
+`
+
+func TestValidate(t *testing.T) {
+	id, err := Validate([]byte(testInitdata))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", id.Body.Algorithm)
+	assert.Len(t, id.Body.Data, 3)
+
+	// The digest is the same as calculated in the pod VM
+	encoded, err := Encode(testInitdata)
+	require.NoError(t, err)
+	parsed, err := DecodeAnnotation(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(testInitdata), parsed)
+	guest, err := Parse(strings.NewReader(encoded))
+	require.NoError(t, err)
+	assert.Equal(t, guest.Digest, id.Digest)
+
+	for name, tc := range map[string]struct {
+		initdata string
+		errs     []string
+		noDigest bool
+	}{
+		"syntax error": {
+			initdata: "algorithm = sha256\n",
+			errs:     []string{"initdata: line 1, column 13"},
+			noDigest: true,
+		},
+		"missing fields": {
+			initdata: "[data]\n",
+			errs:     []string{"version is missing", "algorithm is missing"},
+			noDigest: true,
+		},
+		"unsupported algorithm and version": {
+			initdata: "algorithm = \"md5\"\nversion = \"0.2.0\"\n",
+			errs:     []string{`version "0.2.0" is not supported`, `algorithm "md5" is not supported`},
+			noDigest: true,
+		},
+		"unknown keys": {
+			initdata: "algorithm = \"sha384\"\nversion = \"0.1.0\"\nfoo = 1\n[data]\n\"agent.toml\" = ''\n",
+			errs:     []string{`unknown key "foo"`},
+		},
+		"invalid embedded files": {
+			initdata: "algorithm = \"sha512\"\nversion = \"0.1.0\"\n[data]\n\"aa.toml\" = 'url ='\n\"cdh.toml\" = '[kbc'\n" +
+				"\"policy.rego\" = '''\ndefault A := true\nB if {\n  input.x == [1, 2)\n'''\n",
+			errs: []string{
+				"aa.toml: line 1, column 6",
+				"cdh.toml: line 1",
+				"policy.rego: line 3, column 19: unexpected ) token",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			id, err := Validate([]byte(tc.initdata))
+			require.Error(t, err)
+			for _, msg := range tc.errs {
+				assert.ErrorContains(t, err, msg)
+			}
+			if tc.noDigest {
+				assert.Nil(t, id)
+			} else {
+				assert.NotEmpty(t, id.Digest)
+			}
+		})
+	}
+}
+
+func TestLintPolicy(t *testing.T) {
+	// Policies in the Rego v1 and v0 syntaxes are accepted
+	assert.Empty(t, lintPolicy("package p\nimport rego.v1\nb if { input.x }\n"))
+	assert.Empty(t, lintPolicy("package p\ndefault a = true\nb { input.x }\n"))
+
+	errs := lintPolicy("default a := true\n")
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "line 1, column 1: package expected")
+
+	errs = lintPolicy("package p\nb if { input.x \n")
+	require.NotEmpty(t, errs)
+	assert.ErrorContains(t, errs[0], "unexpected eof token")
+}
+
+func TestValidateExtraDataKeys(t *testing.T) {
+	// The initdata spec allows data keys the pod VM does not provision
+	id, err := Validate([]byte(testInitdata + "\"agent.toml\" = ''\n"))
+	require.NoError(t, err)
+	assert.Len(t, id.Body.Data, 4)
+}
+
+func TestLoad(t *testing.T) {
+	encoded, err := Encode(testInitdata)
+	require.NoError(t, err)
+
+	for _, data := range []string{testInitdata, encoded, encoded + "\n"} {
+		initdataToml, err := Load([]byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, testInitdata, string(initdataToml))
+	}
+
+	_, err = Load([]byte{0x1f, 0x8b, 0x00})
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	a, err := Validate([]byte(testInitdata))
+	require.NoError(t, err)
+
+	diff, err := Diff(a.Body, a.Body, "a", "b")
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	b, err := Validate([]byte("algorithm = \"sha384\"\nversion = \"0.1.0\"\n[data]\n\"aa.toml\" = '''\n[token_configs]\n[token_configs.kbs]\nurl = 'http://10.0.0.1:8080'\n'''\n"))
+	require.NoError(t, err)
+
+	diff, err = Diff(a.Body, b.Body, "a", "b")
+	require.NoError(t, err)
+	assert.Contains(t, diff, "-algorithm = \"sha256\"\n+algorithm = \"sha384\"\n")
+	assert.Contains(t, diff, "--- a/aa.toml\n+++ b/aa.toml\n")
+	assert.Contains(t, diff, "-url = 'http://127.0.0.1:8080'\n+url = 'http://10.0.0.1:8080'\n")
+	assert.Contains(t, diff, "--- a/cdh.toml\n+++ /dev/null\n")
+	assert.Contains(t, diff, "-package agent_policy\n")
+}
@@ -0,0 +1,84 @@
+package userdata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Ref: https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
+	NoCloudLabel    = "cidata"
+	NoCloudUserData = "user-data"
+	// Ref: https://docs.openstack.org/nova/latest/user/config-drive.html
+	ConfigDriveLabel    = "config-2"
+	ConfigDriveUserData = "openstack/latest/user_data"
+)
+
+// errNoDisk is returned when no disk has the expected file system label
+var errNoDisk = errors.New("no disk with the file system label is found")
+
+// diskByLabelDir, mountReadOnly and unmount are variables to be overridden in tests
+var diskByLabelDir = "/dev/disk/by-label"
+
+var mountReadOnly = func(device, dir string) error {
+	var err error
+	for _, fstype := range []string{"iso9660", "vfat"} {
+		if err = unix.Mount(device, dir, fstype, unix.MS_RDONLY, ""); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+var unmount = func(dir string) error {
+	return unix.Unmount(dir, 0)
+}
+
+// findDiskByLabel returns the device of a disk with one of the file system labels
+func findDiskByLabel(labels ...string) (string, error) {
+	for _, label := range labels {
+		device := filepath.Join(diskByLabelDir, label)
+		if _, err := os.Stat(device); err == nil {
+			return device, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %v", errNoDisk, labels)
+}
+
+func hasDiskWithLabel(labels ...string) bool {
+	_, err := findDiskByLabel(labels...)
+	return err == nil
+}
+
+// readDiskFile reads a file in the file system of a disk with one of the labels
+func readDiskFile(path string, labels ...string) ([]byte, error) {
+	device, err := findDiskByLabel(labels...)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "userdata-disk-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mount point: %w", err)
+	}
+	defer os.Remove(dir)
+
+	if err := mountReadOnly(device, dir); err != nil {
+		return nil, fmt.Errorf("failed to mount %s: %w", device, err)
+	}
+	defer func() {
+		if err := unmount(dir); err != nil {
+			logger.Printf("failed to unmount %s: %v\n", dir, err)
+		}
+	}()
+
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in %s: %w", path, device, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,150 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	retry "github.com/avast/retry-go/v4"
+	"github.com/containerd/ttrpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const (
+	CDHSocketPath = "/run/confidential-containers/cdh.sock"
+
+	cdhGetResourceService = "api.GetResourceService"
+	cdhGetResourceMethod  = "GetResource"
+)
+
+// ResourceGetter gets a resource released by KBS after attestation
+type ResourceGetter func(ctx context.Context, uri string) ([]byte, error)
+
+// getCDHResource gets a KBS resource through confidential-data-hub
+func getCDHResource(ctx context.Context, uri string) ([]byte, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", CDHSocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to confidential-data-hub: %w", err)
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	// GetResourceRequest and GetResourceResponse of confidential-data-hub have
+	// the same wire format as StringValue and BytesValue
+	resp := &wrapperspb.BytesValue{}
+	if err := client.Call(ctx, cdhGetResourceService, cdhGetResourceMethod, &wrapperspb.StringValue{Value: uri}, resp); err != nil {
+		return nil, fmt.Errorf("failed to get resource %s: %w", uri, err)
+	}
+	return resp.Value, nil
+}
+
+// readEnvelope returns the envelope written from user data, or nil if there is none
+func readEnvelope(cfg *Config) (*cloudinit.Envelope, error) {
+	content, err := os.ReadFile(cfg.envelopePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read envelope: %w", err)
+	}
+	return cloudinit.ParseEnvelope(content)
+}
+
+// needsAttestation returns whether the key of envelope is released after attestation
+func needsAttestation(envelope *cloudinit.Envelope) (bool, error) {
+	u, err := url.Parse(envelope.KeyID)
+	if err != nil {
+		return false, fmt.Errorf("invalid envelope key ID %q: %w", envelope.KeyID, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return false, nil
+	case "kbs":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported envelope key ID %q", envelope.KeyID)
+	}
+}
+
+// getEnvelopeKey gets the key of envelope from the pod VM image or KBS
+func getEnvelopeKey(ctx context.Context, cfg *Config, envelope *cloudinit.Envelope) ([]byte, error) {
+	attested, err := needsAttestation(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	if !attested {
+		u, _ := url.Parse(envelope.KeyID)
+		return cloudinit.LoadEnvelopeKey(u.Path)
+	}
+
+	var key []byte
+	err = retry.Do(
+		func() error {
+			data, err := cfg.getResource(ctx, envelope.KeyID)
+			if err != nil {
+				return err
+			}
+			key, err = cloudinit.ParseEnvelopeKey(data)
+			if err != nil {
+				return retry.Unrecoverable(err)
+			}
+			return nil
+		},
+		retry.Context(ctx),
+		retry.Delay(DefaultRetry{}.GetRetryDelay()),
+		retry.LastErrorOnly(true),
+		retry.DelayType(retry.FixedDelay),
+		retry.OnRetry(func(n uint, err error) {
+			logger.Printf("Retry attempt %d: %v\n", n, err)
+		}),
+	)
+	return key, err
+}
+
+// processEnvelope writes the files sealed in the envelope. When attested is false, envelopes
+// whose key is released after attestation are left for ProvisionEncryptedFiles.
+func processEnvelope(ctx context.Context, cfg *Config, attested bool) error {
+	envelope, err := readEnvelope(cfg)
+	if err != nil || envelope == nil {
+		return err
+	}
+
+	needed, err := needsAttestation(envelope)
+	if err != nil {
+		return err
+	}
+	if needed != attested {
+		if needed {
+			logger.Printf("Envelope key %s is released after attestation, deferring encrypted files\n", envelope.KeyID)
+		}
+		return nil
+	}
+
+	key, err := getEnvelopeKey(ctx, cfg, envelope)
+	if err != nil {
+		return fmt.Errorf("failed to get envelope key %s: %w", envelope.KeyID, err)
+	}
+
+	files, err := envelope.Open(key)
+	if err != nil {
+		return err
+	}
+
+	for _, wf := range files {
+		if !isAllowed(wf.Path, cfg.writeFiles) {
+			logger.Printf("File: %s is not allowed in the envelope.\n", wf.Path)
+			continue
+		}
+		if err := writeFile(wf.Path, []byte(wf.Content)); err != nil {
+			return fmt.Errorf("failed to write encrypted file %s: %w", wf.Path, err)
+		}
+	}
+
+	return nil
+}
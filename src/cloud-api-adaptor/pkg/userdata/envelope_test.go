@@ -0,0 +1,169 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+var testEnvelopeKey = []byte("0123456789abcdef0123456789abcdef")
+
+func sealedTestConfig(t *testing.T, keyID string, apfCfgPath, authPath string) *CloudConfig {
+	config := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: apfCfgPath, Content: testAPFConfig},
+			{Path: authPath, Content: testAuthJSON},
+		},
+	}
+	if err := config.SealFiles(keyID, testEnvelopeKey, []string{apfCfgPath, authPath}); err != nil {
+		t.Fatalf("failed to seal files: %v", err)
+	}
+
+	content, err := config.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+
+	cc, err := retrieveCloudConfig(context.TODO(), &TestProvider{content: content})
+	if err != nil {
+		t.Fatalf("couldn't retrieve cloud config: %v", err)
+	}
+	return cc
+}
+
+func checkFileContent(t *testing.T, path, expected string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if string(data) != expected {
+		t.Fatalf("file content of %s does not match: got %q", path, string(data))
+	}
+}
+
+func TestProcessEnvelopeWithImageKey(t *testing.T) {
+	tempDir := t.TempDir()
+
+	keyPath := filepath.Join(tempDir, "userdata.key")
+	if err := os.WriteFile(keyPath, testEnvelopeKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	apfCfgPath := filepath.Join(tempDir, "apf.json")
+	authPath := filepath.Join(tempDir, "auth.json")
+
+	cfg := Config{
+		fetchTimeout: 180,
+		parentPath:   tempDir,
+		envelopePath: filepath.Join(tempDir, "userdata.envelope"),
+		writeFiles:   []string{apfCfgPath, authPath},
+		getResource: func(ctx context.Context, uri string) ([]byte, error) {
+			return nil, errors.New("unexpected resource request")
+		},
+	}
+
+	cc := sealedTestConfig(t, "file://"+keyPath, apfCfgPath, authPath)
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+	if _, err := os.Stat(apfCfgPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("sealed file %s is written in plaintext", apfCfgPath)
+	}
+
+	if err := processEnvelope(context.TODO(), &cfg, false); err != nil {
+		t.Fatalf("failed to process envelope: %v", err)
+	}
+	checkFileContent(t, apfCfgPath, testAPFConfig)
+	checkFileContent(t, authPath, testAuthJSON)
+}
+
+func TestProcessEnvelopeWithKBSKey(t *testing.T) {
+	tempDir := t.TempDir()
+
+	apfCfgPath := filepath.Join(tempDir, "apf.json")
+	authPath := filepath.Join(tempDir, "auth.json")
+	keyID := "kbs:///default/userdata/key"
+
+	var requested []string
+	cfg := Config{
+		fetchTimeout: 180,
+		parentPath:   tempDir,
+		envelopePath: filepath.Join(tempDir, "userdata.envelope"),
+		// auth.json is not allowed, so it must not be written
+		writeFiles: []string{apfCfgPath},
+		getResource: func(ctx context.Context, uri string) ([]byte, error) {
+			requested = append(requested, uri)
+			return testEnvelopeKey, nil
+		},
+	}
+
+	cc := sealedTestConfig(t, keyID, apfCfgPath, authPath)
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+
+	// The key is only available after attestation
+	if err := processEnvelope(context.TODO(), &cfg, false); err != nil {
+		t.Fatalf("failed to process envelope: %v", err)
+	}
+	if len(requested) != 0 {
+		t.Fatalf("key is requested before attestation")
+	}
+	if _, err := os.Stat(apfCfgPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("sealed file %s is written before attestation", apfCfgPath)
+	}
+
+	if err := ProvisionEncryptedFiles(&cfg); err != nil {
+		t.Fatalf("failed to provision encrypted files: %v", err)
+	}
+	if len(requested) != 1 || requested[0] != keyID {
+		t.Fatalf("unexpected key requests: %v", requested)
+	}
+	checkFileContent(t, apfCfgPath, testAPFConfig)
+	if _, err := os.Stat(authPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file %s is written while not allowed", authPath)
+	}
+}
+
+func TestProcessEnvelopeWrongKey(t *testing.T) {
+	tempDir := t.TempDir()
+
+	apfCfgPath := filepath.Join(tempDir, "apf.json")
+	authPath := filepath.Join(tempDir, "auth.json")
+
+	cfg := Config{
+		fetchTimeout: 1,
+		parentPath:   tempDir,
+		envelopePath: filepath.Join(tempDir, "userdata.envelope"),
+		writeFiles:   []string{apfCfgPath, authPath},
+		getResource: func(ctx context.Context, uri string) ([]byte, error) {
+			return []byte("fedcba9876543210fedcba9876543210"), nil
+		},
+	}
+
+	cc := sealedTestConfig(t, "kbs:///default/userdata/key", apfCfgPath, authPath)
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+
+	if err := ProvisionEncryptedFiles(&cfg); err == nil {
+		t.Fatalf("expected an error opening the envelope with a wrong key")
+	}
+	if _, err := os.Stat(apfCfgPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file %s is written with a wrong key", apfCfgPath)
+	}
+}
+
+func TestProvisionEncryptedFilesWithoutEnvelope(t *testing.T) {
+	cfg := Config{
+		fetchTimeout: 1,
+		envelopePath: filepath.Join(t.TempDir(), "userdata.envelope"),
+	}
+	if err := ProvisionEncryptedFiles(&cfg); err != nil {
+		t.Fatalf("unexpected error without envelope: %v", err)
+	}
+}
@@ -28,7 +28,7 @@ func isGCPVM(ctx context.Context) bool {
 	if cpuid.CPU.HypervisorVendorID != cpuid.KVM {
 		return false
 	}
-	_, err := imdsGet(ctx, GcpImdsURL, false, []kvPair{{"Metadata-Flavor", "Google"}})
+	_, err := gcpIMDS.get(ctx, GcpImdsURL, false)
 	return err == nil
 }
 
@@ -50,3 +50,25 @@ func isAlibabaCloudVM() bool {
 
 	return provider == "Alibaba Cloud"
 }
+
+func isIBMCloudVM() bool {
+	t, err := dmidecode.NewDMITable()
+	if err != nil {
+		return false
+	}
+
+	return t.Query(dmidecode.KeywordChassisAssetTag) == "ibmcloud"
+}
+
+func isOpenStackVM() bool {
+	if hasDiskWithLabel(ConfigDriveLabel, "CONFIG-2") {
+		return true
+	}
+
+	t, err := dmidecode.NewDMITable()
+	if err != nil {
+		return false
+	}
+
+	return t.Query(dmidecode.KeywordSystemManufacturer) == "OpenStack Foundation"
+}
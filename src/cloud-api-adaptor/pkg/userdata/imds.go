@@ -3,26 +3,202 @@ package userdata
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
+const (
+	// imdsMaxResponseSize bounds metadata responses, well above the largest user data limit of providers
+	imdsMaxResponseSize = 1 << 20
+	// awsTokenTTL is the lifetime in seconds of IMDSv2 session tokens
+	awsTokenTTL = "300"
+	// ibmCloudTokenTTL is the lifetime in seconds of IBM Cloud instance identity tokens
+	ibmCloudTokenTTL = "300"
+)
+
+// imdsRequestTimeout bounds each metadata request. It is a variable to be overridden in tests.
+var imdsRequestTimeout = 10 * time.Second
+
+// errIMDSResponseTooLarge is returned when a metadata response exceeds imdsMaxResponseSize
+var errIMDSResponseTooLarge = errors.New("metadata response is too large")
+
 type kvPair struct {
 	k string
 	v string
 }
 
+// imdsStatusError is returned when a metadata service responds with a status other than 200
+type imdsStatusError struct {
+	url        string
+	statusCode int
+	status     string
+}
+
+func (e *imdsStatusError) Error() string {
+	return fmt.Sprintf("endpoint %s returned != 200 status code: %s", e.url, e.status)
+}
+
+// isRetryable returns whether a failed metadata request may succeed later, e.g. because
+// user data is not available yet right after the pod VM boots
+func isRetryable(err error) bool {
+	if errors.Is(err, errIMDSResponseTooLarge) {
+		return false
+	}
+
+	var statusErr *imdsStatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.statusCode; {
+		case code >= http.StatusInternalServerError:
+			return true
+		case code == http.StatusNotFound, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+			return true
+		case code == http.StatusUnauthorized:
+			// A session token expired, and a new one is requested on retry
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Network errors and invalid user data
+	return true
+}
+
+// imdsService describes the headers an instance metadata service requires
+type imdsService struct {
+	headers []kvPair
+	// tokenURL, if set, is where a session token is requested by PUT before each request, as in AWS IMDSv2
+	tokenURL string
+	// tokenRequestHeaders and tokenRequestBody are sent with the token request
+	tokenRequestHeaders []kvPair
+	tokenRequestBody    string
+	// parseToken extracts the token from the token response, the trimmed response if nil
+	parseToken func(body []byte) (string, error)
+	// tokenHeader carries the token, prefixed with tokenPrefix, in metadata requests
+	tokenHeader string
+	tokenPrefix string
+}
+
+var (
+	azureIMDS = imdsService{headers: []kvPair{{"Metadata", "true"}}}
+	gcpIMDS   = imdsService{headers: []kvPair{{"Metadata-Flavor", "Google"}}}
+	// Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+	awsIMDS = imdsService{
+		tokenURL:            AWSTokenImdsURL,
+		tokenRequestHeaders: []kvPair{{"X-aws-ec2-metadata-token-ttl-seconds", awsTokenTTL}},
+		tokenHeader:         "X-aws-ec2-metadata-token",
+	}
+	// Ref: https://cloud.ibm.com/docs/vpc?topic=vpc-imd-configure-service
+	ibmCloudIMDS = imdsService{
+		tokenURL:            IBMCloudTokenImdsURL,
+		tokenRequestHeaders: []kvPair{{"Metadata-Flavor", "ibm"}, {"Content-Type", "application/json"}},
+		tokenRequestBody:    fmt.Sprintf(`{"expires_in": %s}`, ibmCloudTokenTTL),
+		parseToken:          parseIBMCloudToken,
+		tokenHeader:         "Authorization",
+		tokenPrefix:         "Bearer ",
+	}
+	plainIMDS = imdsService{}
+)
+
+// get gets a metadata value, base64 decoded if b64 is true
+func (s imdsService) get(ctx context.Context, url string, b64 bool) ([]byte, error) {
+	headers := s.headers
+
+	if s.tokenURL != "" {
+		token, err := s.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(slices.Clone(headers), kvPair{s.tokenHeader, s.tokenPrefix + token})
+	}
+
+	return imdsGet(ctx, url, b64, headers)
+}
+
+// getToken requests a session token from tokenURL
+func (s imdsService) getToken(ctx context.Context) (string, error) {
+	var reqBody io.Reader
+	if s.tokenRequestBody != "" {
+		reqBody = strings.NewReader(s.tokenRequestBody)
+	}
+
+	body, err := imdsRequest(ctx, http.MethodPut, s.tokenURL, reqBody, s.tokenRequestHeaders)
+	if err != nil {
+		return "", fmt.Errorf("failed to get a metadata session token: %w", err)
+	}
+
+	if s.parseToken == nil {
+		return strings.TrimSpace(string(body)), nil
+	}
+	token, err := s.parseToken(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse a metadata session token: %w", err)
+	}
+	return token, nil
+}
+
+// parseIBMCloudToken extracts the access token from an IBM Cloud instance identity token response
+func parseIBMCloudToken(body []byte) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("empty instance identity token")
+	}
+	return token.AccessToken, nil
+}
+
 func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byte, error) {
+	body, err := imdsRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b64 {
+		return body, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode b64 encoded userData: %s", err)
+	}
+	return decoded, nil
+}
+
+// newIMDSClient returns an HTTP client for link-local metadata services. It never uses
+// proxies or follows redirects, and bounds the time of each request.
+func newIMDSClient() *http.Client {
+	return &http.Client{
+		Timeout: imdsRequestTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           (&net.Dialer{Timeout: imdsRequestTimeout}).DialContext,
+			ResponseHeaderTimeout: imdsRequestTimeout,
+			DisableKeepAlives:     true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func imdsRequest(ctx context.Context, method, url string, reqBody io.Reader, headers []kvPair) ([]byte, error) {
 	// If url is empty then return empty string
 	if url == "" {
 		return nil, fmt.Errorf("url is empty")
 	}
 
-	// Create a new HTTP client
-	client := &http.Client{}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %s", err)
 
@@ -33,31 +209,26 @@ func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byt
 	}
 
 	// Send the request and retrieve the response
-	resp, err := client.Do(req)
+	resp, err := newIMDSClient().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %s", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 
 	}
 	defer resp.Body.Close()
 
 	// Check if the response was successful
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("endpoint %s returned != 200 status code: %s", url, resp.Status)
+		return nil, &imdsStatusError{url: url, statusCode: resp.StatusCode, status: resp.Status}
 	}
 
-	// Read the response body and return it as a string
-	body, err := io.ReadAll(resp.Body)
+	// Read the response body up to the size limit
+	body, err := io.ReadAll(io.LimitReader(resp.Body, imdsMaxResponseSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %s", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-
-	if !b64 {
-		return body, nil
+	if len(body) > imdsMaxResponseSize {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", errIMDSResponseTooLarge, url, imdsMaxResponseSize)
 	}
 
-	decoded, err := base64.StdEncoding.DecodeString(string(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode b64 encoded userData: %s", err)
-	}
-	return decoded, nil
+	return body, nil
 }
@@ -0,0 +1,176 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestAWSIMDS starts a stand-in of AWS IMDS with IMDSv1 disabled
+func startTestAWSIMDS(t *testing.T, userData string) *httptest.Server {
+	const token = "test-session-token"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method is not supported.", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+			http.Error(w, "Missing TTL.", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, token)
+	})
+	mux.HandleFunc("/latest/user-data", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != token {
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, userData)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAWSIMDSv2(t *testing.T) {
+	srv := startTestAWSIMDS(t, testUserData)
+
+	// IMDSv1 requests are rejected
+	_, err := imdsGet(context.TODO(), srv.URL+"/latest/user-data", false, nil)
+	var statusErr *imdsStatusError
+	if !errors.As(err, &statusErr) || statusErr.statusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an IMDSv1 request, got %v", err)
+	}
+
+	checkUserData(t, AWSUserDataProvider{url: srv.URL + "/latest/user-data", tokenURL: srv.URL + "/latest/api/token"})
+
+	// No fallback to IMDSv1 when the token can't be obtained
+	provider := AWSUserDataProvider{url: srv.URL + "/latest/user-data", tokenURL: srv.URL + "/missing"}
+	if _, err := provider.GetUserData(context.TODO()); err == nil {
+		t.Fatalf("expected an error without a session token")
+	}
+}
+
+func TestIMDSHeaders(t *testing.T) {
+	t.Run("azure", func(t *testing.T) {
+		srv := startTestIMDS(t, "/metadata", "dGVzdA==", kvPair{"Metadata", "true"})
+		data, err := azureIMDS.get(context.TODO(), srv.URL+"/metadata", true)
+		if err != nil || string(data) != "test" {
+			t.Fatalf("unexpected response %q: %v", data, err)
+		}
+		if _, err := plainIMDS.get(context.TODO(), srv.URL+"/metadata", true); err == nil {
+			t.Fatalf("expected an error without the Metadata header")
+		}
+	})
+
+	t.Run("gcp", func(t *testing.T) {
+		srv := startTestIMDS(t, "/computeMetadata/v1/instance", "test", kvPair{"Metadata-Flavor", "Google"})
+		data, err := gcpIMDS.get(context.TODO(), srv.URL+"/computeMetadata/v1/instance", false)
+		if err != nil || string(data) != "test" {
+			t.Fatalf("unexpected response %q: %v", data, err)
+		}
+		if _, err := plainIMDS.get(context.TODO(), srv.URL+"/computeMetadata/v1/instance", false); err == nil {
+			t.Fatalf("expected an error without the Metadata-Flavor header")
+		}
+	})
+}
+
+func TestIMDSLimits(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("a", imdsMaxResponseSize+1))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/large", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	_, err := imdsGet(context.TODO(), srv.URL+"/large", false, nil)
+	if !errors.Is(err, errIMDSResponseTooLarge) {
+		t.Fatalf("expected %v, got %v", errIMDSResponseTooLarge, err)
+	}
+	if isRetryable(err) {
+		t.Fatalf("expected a too large response not to be retried")
+	}
+
+	_, err = imdsGet(context.TODO(), srv.URL+"/redirect", false, nil)
+	var statusErr *imdsStatusError
+	if !errors.As(err, &statusErr) || statusErr.statusCode != http.StatusFound {
+		t.Fatalf("expected a redirect not to be followed, got %v", err)
+	}
+
+	orig := imdsRequestTimeout
+	imdsRequestTimeout = 100 * time.Millisecond
+	defer func() { imdsRequestTimeout = orig }()
+
+	start := time.Now()
+	if _, err := imdsGet(context.TODO(), srv.URL+"/slow", false, nil); err == nil {
+		t.Fatalf("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("request took %s despite the timeout", elapsed)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for code, expected := range map[int]bool{
+		http.StatusNotFound:            true,
+		http.StatusUnauthorized:        true,
+		http.StatusTooManyRequests:     true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusBadRequest:          false,
+		http.StatusForbidden:           false,
+		http.StatusMethodNotAllowed:    false,
+		http.StatusFound:               false,
+		http.StatusInternalServerError: true,
+	} {
+		err := &imdsStatusError{url: "http://127.0.0.1", statusCode: code, status: http.StatusText(code)}
+		if actual := isRetryable(err); actual != expected {
+			t.Errorf("status %d: expected retryable %v, got %v", code, expected, actual)
+		}
+	}
+
+	if !isRetryable(errors.New("connection refused")) {
+		t.Errorf("expected network errors to be retried")
+	}
+}
+
+// forbiddenProvider fails with an error that is not retried
+type forbiddenProvider struct {
+	calls int
+}
+
+func (p *forbiddenProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	p.calls++
+	return nil, &imdsStatusError{url: "http://127.0.0.1", statusCode: http.StatusForbidden, status: "403 Forbidden"}
+}
+
+func (p *forbiddenProvider) GetRetryDelay() time.Duration {
+	return time.Millisecond
+}
+
+func TestRetrieveCloudConfigUnrecoverable(t *testing.T) {
+	provider := &forbiddenProvider{}
+	_, err := retrieveCloudConfig(context.TODO(), provider)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if provider.calls != 1 {
+		t.Fatalf("expected no retry, got %d calls", provider.calls)
+	}
+}
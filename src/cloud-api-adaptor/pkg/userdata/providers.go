@@ -0,0 +1,48 @@
+package userdata
+
+import (
+	"cmp"
+	"context"
+)
+
+// NoCloudUserDataProvider reads user data from a NoCloud disk, e.g. the ISO the libvirt provider attaches
+type NoCloudUserDataProvider struct{ DefaultRetry }
+
+func (n NoCloudUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	logger.Printf("provider: NoCloud, disk label: %s\n", NoCloudLabel)
+	return readDiskFile(NoCloudUserData, NoCloudLabel, "CIDATA")
+}
+
+// IBMCloudUserDataProvider gets user data from the IBM Cloud VPC metadata service
+type IBMCloudUserDataProvider struct {
+	DefaultRetry
+	tokenURL string
+	url      string
+}
+
+func (i IBMCloudUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	url := cmp.Or(i.url, IBMCloudUserDataImdsURL)
+	logger.Printf("provider: IBM Cloud, userDataUrl: %s\n", url)
+
+	imds := ibmCloudIMDS
+	imds.tokenURL = cmp.Or(i.tokenURL, IBMCloudTokenImdsURL)
+	return imds.get(ctx, url, false)
+}
+
+// OpenStackUserDataProvider reads user data from the config drive if attached, e.g. on IBM Power Virtual Server,
+// or gets it from the OpenStack metadata service otherwise
+type OpenStackUserDataProvider struct {
+	DefaultRetry
+	url string
+}
+
+func (o OpenStackUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	if hasDiskWithLabel(ConfigDriveLabel, "CONFIG-2") {
+		logger.Printf("provider: OpenStack, config drive label: %s\n", ConfigDriveLabel)
+		return readDiskFile(ConfigDriveUserData, ConfigDriveLabel, "CONFIG-2")
+	}
+
+	url := cmp.Or(o.url, OpenStackUserDataImdsURL)
+	logger.Printf("provider: OpenStack, userDataUrl: %s\n", url)
+	return plainIMDS.get(ctx, url, false)
+}
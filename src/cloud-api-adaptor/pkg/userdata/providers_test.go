@@ -0,0 +1,192 @@
+package userdata
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testUserData = "#cloud-config\nwrite_files: []\n"
+
+// startTestIMDS starts an IMDS stand-in serving content at path, when the request has the header
+func startTestIMDS(t *testing.T, path, content string, header kvPair) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method is not supported.", http.StatusMethodNotAllowed)
+			return
+		}
+		if header.k != "" && r.Header.Get(header.k) != header.v {
+			http.Error(w, "Missing header.", http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func checkUserData(t *testing.T, provider UserDataProvider) {
+	data, err := provider.GetUserData(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to get user data: %v", err)
+	}
+	if string(data) != testUserData {
+		t.Fatalf("unexpected user data: %q", data)
+	}
+}
+
+func TestIMDSProviders(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(testUserData))
+
+	t.Run("azure", func(t *testing.T) {
+		srv := startTestIMDS(t, "/metadata/instance/compute/userData", encoded, kvPair{"Metadata", "true"})
+		checkUserData(t, AzureUserDataProvider{url: srv.URL + "/metadata/instance/compute/userData"})
+	})
+
+	t.Run("aws", func(t *testing.T) {
+		srv := startTestAWSIMDS(t, testUserData)
+		checkUserData(t, AWSUserDataProvider{url: srv.URL + "/latest/user-data", tokenURL: srv.URL + "/latest/api/token"})
+	})
+
+	t.Run("gcp", func(t *testing.T) {
+		srv := startTestIMDS(t, "/computeMetadata/v1/instance/attributes/user-data", encoded, kvPair{"Metadata-Flavor", "Google"})
+		checkUserData(t, GCPUserDataProvider{url: srv.URL + "/computeMetadata/v1/instance/attributes/user-data"})
+	})
+
+	t.Run("alibabacloud", func(t *testing.T) {
+		srv := startTestIMDS(t, "/latest/user-data", testUserData, kvPair{})
+		checkUserData(t, AlibabaCloudDataProvider{url: srv.URL + "/latest/user-data"})
+	})
+
+	t.Run("openstack", func(t *testing.T) {
+		// No config drive
+		fakeDisks(t)
+		srv := startTestIMDS(t, "/openstack/latest/user_data", testUserData, kvPair{})
+		checkUserData(t, OpenStackUserDataProvider{url: srv.URL + "/openstack/latest/user_data"})
+	})
+}
+
+func TestIBMCloudProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Metadata-Flavor") != "ibm" {
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, `{"access_token": "test-token", "expires_in": 300}`)
+	})
+	mux.HandleFunc("/user-data/v1/user_data", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, testUserData)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	checkUserData(t, IBMCloudUserDataProvider{
+		tokenURL: srv.URL + "/identity/v1/token?version=2022-03-01",
+		url:      srv.URL + "/user-data/v1/user_data?version=2022-03-01",
+	})
+
+	provider := IBMCloudUserDataProvider{
+		tokenURL: srv.URL + "/identity/v1/token?version=2022-03-01",
+		url:      srv.URL + "/missing",
+	}
+	if _, err := provider.GetUserData(context.TODO()); err == nil {
+		t.Fatalf("expected an error for a missing endpoint")
+	}
+}
+
+// fakeDisks makes directories under a temporary directory appear as disks with file system labels
+func fakeDisks(t *testing.T) string {
+	dir := t.TempDir()
+
+	origDir, origMount, origUnmount := diskByLabelDir, mountReadOnly, unmount
+	t.Cleanup(func() {
+		diskByLabelDir, mountReadOnly, unmount = origDir, origMount, origUnmount
+	})
+
+	diskByLabelDir = dir
+	mountReadOnly = func(device, target string) error {
+		return os.CopyFS(target, os.DirFS(device))
+	}
+	unmount = func(target string) error {
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(filepath.Join(target, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return dir
+}
+
+func writeDiskFile(t *testing.T, dir, label, path, content string) {
+	path = filepath.Join(dir, label, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskProviders(t *testing.T) {
+	t.Run("nocloud", func(t *testing.T) {
+		dir := fakeDisks(t)
+		if _, err := (NoCloudUserDataProvider{}).GetUserData(context.TODO()); err == nil {
+			t.Fatalf("expected an error without a NoCloud disk")
+		}
+
+		writeDiskFile(t, dir, NoCloudLabel, NoCloudUserData, testUserData)
+		checkUserData(t, NoCloudUserDataProvider{})
+	})
+
+	t.Run("config drive", func(t *testing.T) {
+		dir := fakeDisks(t)
+		writeDiskFile(t, dir, "CONFIG-2", ConfigDriveUserData, testUserData)
+		// The config drive is used instead of the metadata service
+		checkUserData(t, OpenStackUserDataProvider{url: "http://127.0.0.1:0/unreachable"})
+	})
+}
+
+func TestNewProvider(t *testing.T) {
+	dir := fakeDisks(t)
+
+	// Detect a NoCloud disk, unless a user data file exists
+	writeDiskFile(t, dir, NoCloudLabel, NoCloudUserData, testUserData)
+	if !hasUserDataFile() {
+		provider, err := newProvider(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("failed to detect a provider: %v", err)
+		}
+		if _, ok := provider.(NoCloudUserDataProvider); !ok {
+			t.Fatalf("expected NoCloud provider, got %T", provider)
+		}
+	}
+
+	provider, err := newProvider(context.TODO(), "openstack")
+	if err != nil {
+		t.Fatalf("failed to select a provider: %v", err)
+	}
+	if _, ok := provider.(OpenStackUserDataProvider); !ok {
+		t.Fatalf("expected OpenStack provider, got %T", provider)
+	}
+
+	if _, err := newProvider(context.TODO(), "unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown provider")
+	}
+}
@@ -1,6 +1,7 @@
 package userdata
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 const (
@@ -23,6 +25,7 @@ const (
 	// Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 	AWSImdsURL         = "http://169.254.169.254/latest/dynamic/instance-identity/document"
 	AWSUserDataImdsURL = "http://169.254.169.254/latest/user-data"
+	AWSTokenImdsURL    = "http://169.254.169.254/latest/api/token"
 	// Ref: https://docs.microsoft.com/en-us/azure/virtual-machines/linux/instance-metadata-service
 	AzureImdsURL         = "http://169.254.169.254/metadata/instance/compute?api-version=2021-01-01"
 	AzureUserDataImdsURL = "http://169.254.169.254/metadata/instance/compute/userData?api-version=2021-01-01&format=text"
@@ -32,6 +35,12 @@ const (
 	// Ref: https://www.alibabacloud.com/help/en/ecs/user-guide/customize-the-initialization-configuration-for-an-instance
 	AlibabaCloudImdsURL         = "http://100.100.100.200/latest/dynamic/instance-identity/document"
 	AlibabaCloudUserDataImdsURL = "http://100.100.100.200/latest/user-data"
+	// Ref: https://cloud.ibm.com/docs/vpc?topic=vpc-imd-about
+	IBMCloudImdsURL         = "http://api.metadata.cloud.ibm.com"
+	IBMCloudTokenImdsURL    = IBMCloudImdsURL + "/identity/v1/token?version=2022-03-01"
+	IBMCloudUserDataImdsURL = IBMCloudImdsURL + "/user-data/v1/user_data?version=2022-03-01"
+	// Ref: https://docs.openstack.org/nova/latest/user/metadata.html
+	OpenStackUserDataImdsURL = "http://169.254.169.254/openstack/latest/user_data"
 )
 
 var logger = log.New(log.Writer(), "[userdata/provision] ", log.LstdFlags|log.Lmsgprefix)
@@ -43,19 +52,40 @@ type Config struct {
 	digestPath    string
 	initdataPath  string
 	parentPath    string
+	envelopePath  string
 	writeFiles    []string
 	initdataFiles []string
+	getResource   ResourceGetter
+	provider      string
 }
 
-func NewConfig(fetchTimeout int) *Config {
-	return &Config{
+// ConfigOption customizes a Config
+type ConfigOption func(*Config)
+
+// WithProvider selects a registered user data provider by name instead of detecting it
+func WithProvider(name string) ConfigOption {
+	return func(c *Config) {
+		c.provider = name
+	}
+}
+
+func NewConfig(fetchTimeout int, opts ...ConfigOption) *Config {
+	cfg := &Config{
 		fetchTimeout:  fetchTimeout,
 		parentPath:    ConfigParent,
 		initdataPath:  paths.InitDataPath,
 		digestPath:    DigestPath,
+		envelopePath:  cloudinit.EnvelopePath,
 		writeFiles:    WriteFilesList,
 		initdataFiles: InitdDataFilesList,
+		getResource:   getCDHResource,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
 	}
+
+	return cfg
 }
 
 type WriteFile struct {
@@ -78,35 +108,52 @@ func (d DefaultRetry) GetRetryDelay() time.Duration {
 	return 5 * time.Second
 }
 
-type AzureUserDataProvider struct{ DefaultRetry }
+// The url and path fields of providers override the default IMDS URLs and paths, e.g. for testing
+
+type AzureUserDataProvider struct {
+	DefaultRetry
+	url string
+}
 
 func (a AzureUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
-	url := AzureUserDataImdsURL
+	url := cmp.Or(a.url, AzureUserDataImdsURL)
 	logger.Printf("provider: Azure, userDataUrl: %s\n", url)
-	return imdsGet(ctx, url, true, []kvPair{{"Metadata", "true"}})
+	return azureIMDS.get(ctx, url, true)
 }
 
-type AWSUserDataProvider struct{ DefaultRetry }
+type AWSUserDataProvider struct {
+	DefaultRetry
+	url      string
+	tokenURL string
+}
 
 func (a AWSUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
-	url := AWSUserDataImdsURL
+	url := cmp.Or(a.url, AWSUserDataImdsURL)
 	logger.Printf("provider: AWS, userDataUrl: %s\n", url)
-	// aws user data is not base64 encoded
-	return imdsGet(ctx, url, false, nil)
+	// aws user data is not base64 encoded, and only IMDSv2 requests with a session token are made
+	imds := awsIMDS
+	imds.tokenURL = cmp.Or(a.tokenURL, AWSTokenImdsURL)
+	return imds.get(ctx, url, false)
 }
 
-type GCPUserDataProvider struct{ DefaultRetry }
+type GCPUserDataProvider struct {
+	DefaultRetry
+	url string
+}
 
 func (g GCPUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
-	url := GcpUserDataImdsURL
+	url := cmp.Or(g.url, GcpUserDataImdsURL)
 	logger.Printf("provider: GCP, userDataUrl: %s\n", url)
-	return imdsGet(ctx, url, true, []kvPair{{"Metadata-Flavor", "Google"}})
+	return gcpIMDS.get(ctx, url, true)
 }
 
-type FileUserDataProvider struct{ DefaultRetry }
+type FileUserDataProvider struct {
+	DefaultRetry
+	path string
+}
 
 func (a FileUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
-	path := paths.UserDataPath
+	path := cmp.Or(a.path, paths.UserDataPath)
 	logger.Printf("provider: File, userDataPath: %s\n", path)
 	userData, err := os.ReadFile(path)
 	if err != nil {
@@ -116,38 +163,15 @@ func (a FileUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
 	return userData, nil
 }
 
-type AlibabaCloudDataProvider struct{ DefaultRetry }
+type AlibabaCloudDataProvider struct {
+	DefaultRetry
+	url string
+}
 
 func (a AlibabaCloudDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
-	url := AlibabaCloudUserDataImdsURL
+	url := cmp.Or(a.url, AlibabaCloudUserDataImdsURL)
 	logger.Printf("provider: AlibabaCloud, userDataUrl: %s\n", url)
-	return imdsGet(ctx, url, false, nil)
-}
-
-func newProvider(ctx context.Context) (UserDataProvider, error) {
-	// This checks for the presence of a file and doesn't rely on http req like the
-	// azure, aws ones, thereby making it faster and hence checking this first
-	if hasUserDataFile() {
-		return FileUserDataProvider{}, nil
-	}
-
-	if isAzureVM() {
-		return AzureUserDataProvider{}, nil
-	}
-
-	if isAWSVM(ctx) {
-		return AWSUserDataProvider{}, nil
-	}
-
-	if isGCPVM(ctx) {
-		return GCPUserDataProvider{}, nil
-	}
-
-	if isAlibabaCloudVM() {
-		return AlibabaCloudDataProvider{}, nil
-	}
-
-	return nil, fmt.Errorf("unsupported user data provider")
+	return plainIMDS.get(ctx, url, false)
 }
 
 func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*CloudConfig, error) {
@@ -159,7 +183,11 @@ func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*Cloud
 		func() error {
 			ud, err := provider.GetUserData(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to get user data: %w", err)
+				err = fmt.Errorf("failed to get user data: %w", err)
+				if !isRetryable(err) {
+					return retry.Unrecoverable(err)
+				}
+				return err
 			}
 
 			// We parse user data now, b/c we want to retry if it's not valid
@@ -184,12 +212,22 @@ func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*Cloud
 	return &cc, err
 }
 
+// parseUserData parses a cloud config, which may be compressed in a MIME multipart message
+// when it does not fit in the user data size limit of the cloud provider
 func parseUserData(userData []byte) (*CloudConfig, error) {
-	var cc CloudConfig
-	err := yaml.UnmarshalStrict(userData, &cc)
+	docs, err := cloudinit.Decode(userData)
 	if err != nil {
 		return nil, err
 	}
+
+	var cc CloudConfig
+	for _, doc := range docs {
+		var part CloudConfig
+		if err := yaml.UnmarshalStrict(doc, &part); err != nil {
+			return nil, err
+		}
+		cc.WriteFiles = append(cc.WriteFiles, part.WriteFiles...)
+	}
 	return &cc, nil
 }
 
@@ -221,7 +259,12 @@ func processCloudConfig(cfg *Config, cc *CloudConfig) error {
 	for _, wf := range cc.WriteFiles {
 		path := wf.Path
 		bytes := []byte(wf.Content)
-		if isAllowed(path, cfg.writeFiles) {
+		if path == cloudinit.EnvelopePath {
+			// Encrypted files are written by processEnvelope
+			if err := writeFile(cfg.envelopePath, bytes); err != nil {
+				return fmt.Errorf("failed to write envelope %s: %w", cfg.envelopePath, err)
+			}
+		} else if isAllowed(path, cfg.writeFiles) {
 			if err := writeFile(path, bytes); err != nil {
 				return fmt.Errorf("failed to write config file %s: %w", path, err)
 			}
@@ -307,7 +350,10 @@ func ProvisionFiles(cfg *Config) error {
 	// some providers provision config files via process-user-data
 	// some providers rely on cloud-init provision config files
 	// all providers need extract files from initdata and calculate the hash value for attesters usage
-	provider, _ := newProvider(ctx)
+	provider, err := newProvider(ctx, cfg.provider)
+	if err != nil && cfg.provider != "" {
+		return err
+	}
 	if provider != nil {
 		cc, err := retrieveCloudConfig(ctx, provider)
 		if err != nil {
@@ -321,9 +367,28 @@ func ProvisionFiles(cfg *Config) error {
 		logger.Printf("unsupported user data provider, we extract and calculate initdata hash only.\n")
 	}
 
+	// The envelope is either written above, or by cloud-init. It may include initdata
+	// when encrypted with a key pre-provisioned in the pod VM image.
+	if err := processEnvelope(ctx, cfg, false); err != nil {
+		return fmt.Errorf("failed to process encrypted files: %w", err)
+	}
+
 	if err := extractInitdataAndHash(cfg); err != nil {
 		return fmt.Errorf("failed to extract initdata hash: %w", err)
 	}
 
 	return nil
 }
+
+// ProvisionEncryptedFiles writes the files encrypted with a key that KBS releases after
+// attestation. It runs once confidential-data-hub is configured by ProvisionFiles.
+func ProvisionEncryptedFiles(cfg *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.fetchTimeout)*time.Second)
+	defer cancel()
+
+	if err := processEnvelope(ctx, cfg, true); err != nil {
+		return fmt.Errorf("failed to process encrypted files: %w", err)
+	}
+
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 var testAPFConfig string = `{
@@ -319,6 +321,32 @@ write_files:
 	}
 }
 
+func TestRetrieveCompressedCloudConfig(t *testing.T) {
+	config := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: "/test", Content: "test\n"},
+			{Path: "/test2", Content: testAPFConfig},
+		},
+	}
+	plain, err := config.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+	compressed, err := cloudinit.Compress(plain)
+	if err != nil {
+		t.Fatalf("failed to compress cloud config: %v", err)
+	}
+
+	provider := TestProvider{content: compressed}
+	cc, err := retrieveCloudConfig(context.TODO(), &provider)
+	if err != nil {
+		t.Fatalf("couldn't retrieve compressed cloud config: %v", err)
+	}
+	if len(cc.WriteFiles) != 2 || cc.WriteFiles[1].Path != "/test2" || cc.WriteFiles[1].Content != testAPFConfig {
+		t.Fatalf("unexpected write files: %v", cc.WriteFiles)
+	}
+}
+
 func indentTextBlock(text string, by int) string {
 	whiteSpace := strings.Repeat(" ", by)
 	split := strings.Split(text, "\n")
@@ -0,0 +1,62 @@
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// providerRegistration is a user data provider with a function detecting whether it is available in the pod VM
+type providerRegistration struct {
+	name     string
+	detect   func(ctx context.Context) bool
+	provider UserDataProvider
+}
+
+// providers are detected in the registration order
+var providers []providerRegistration
+
+// RegisterProvider registers a user data provider. Unless a provider is selected by name, the first
+// registered provider whose detect function returns true is used.
+func RegisterProvider(name string, detect func(ctx context.Context) bool, provider UserDataProvider) {
+	if slices.ContainsFunc(providers, func(r providerRegistration) bool { return r.name == name }) {
+		panic(fmt.Sprintf("user data provider %q is already registered", name))
+	}
+	providers = append(providers, providerRegistration{name: name, detect: detect, provider: provider})
+}
+
+// ProviderNames returns the names of the registered user data providers in the detection order
+func ProviderNames() []string {
+	var names []string
+	for _, r := range providers {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// newProvider returns the user data provider of name, or detects one if name is empty
+func newProvider(ctx context.Context, name string) (UserDataProvider, error) {
+	for _, r := range providers {
+		if name == r.name || (name == "" && r.detect(ctx)) {
+			return r.provider, nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("unknown user data provider %q, use one of %v", name, ProviderNames())
+	}
+	return nil, fmt.Errorf("unsupported user data provider")
+}
+
+func init() {
+	// The file and disk checks don't rely on http req like the azure, aws ones,
+	// thereby making them faster and hence checking them first
+	RegisterProvider("file", func(context.Context) bool { return hasUserDataFile() }, FileUserDataProvider{})
+	RegisterProvider("nocloud", func(context.Context) bool { return hasDiskWithLabel(NoCloudLabel, "CIDATA") }, NoCloudUserDataProvider{})
+	RegisterProvider("azure", func(context.Context) bool { return isAzureVM() }, AzureUserDataProvider{})
+	RegisterProvider("aws", isAWSVM, AWSUserDataProvider{})
+	RegisterProvider("gcp", isGCPVM, GCPUserDataProvider{})
+	RegisterProvider("alibabacloud", func(context.Context) bool { return isAlibabaCloudVM() }, AlibabaCloudDataProvider{})
+	RegisterProvider("ibmcloud", func(context.Context) bool { return isIBMCloudVM() }, IBMCloudUserDataProvider{})
+	RegisterProvider("openstack", func(context.Context) bool { return isOpenStackVM() }, OpenStackUserDataProvider{})
+}
@@ -6,10 +6,30 @@ import (
 	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
 )
 
+const (
+	// RootVolumeSizeAnnotation is the pod annotation with the root volume size of the pod VM in GiB
+	RootVolumeSizeAnnotation = "peerpods.confidentialcontainers.org/root-volume-size"
+	// RootVolumeTypeAnnotation is the pod annotation with the provider specific root volume type of the pod VM
+	RootVolumeTypeAnnotation = "peerpods.confidentialcontainers.org/root-volume-type"
+	// RootVolumeIOPSAnnotation is the pod annotation with the provisioned IOPS of the root volume of the pod VM
+	RootVolumeIOPSAnnotation = "peerpods.confidentialcontainers.org/root-volume-iops"
+	// DataDisksAnnotation is the pod annotation with the data disks of the pod VM, e.g. "100,50:gp3"
+	DataDisksAnnotation = "peerpods.confidentialcontainers.org/data-disks"
+)
+
+// DiskLimits bounds the disks a pod can request with annotations
+type DiskLimits struct {
+	// MaxDataDisks is the maximum number of data disks
+	MaxDataDisks int
+	// MaxDiskSize is the maximum size in GiB of the root volume and of each data disk
+	MaxDiskSize int
+}
+
 func GetPodName(annotations map[string]string) string {
 
 	sandboxName := annotations[cri.SandboxName]
@@ -97,6 +117,11 @@ func GetInitdataFromAnnotation(annotations map[string]string) (string, error) {
 		return "", nil
 	}
 
+	// Reject initdata that the pod VM would fail to provision
+	if _, err := initdata.Validate([]byte(str)); err != nil {
+		return "", fmt.Errorf("invalid initdata: %w", err)
+	}
+
 	initdataEnc, err := initdata.Encode(str)
 	if err != nil {
 		return "", fmt.Errorf("failed to encode initdata: %w", err)
@@ -105,6 +130,50 @@ func GetInitdataFromAnnotation(annotations map[string]string) (string, error) {
 	return initdataEnc, nil
 }
 
+// Method to get the root volume and data disks of the pod VM from pod annotations.
+// Annotations requesting more or larger disks than limits are rejected.
+func GetDisksFromAnnotation(annotations map[string]string, spec *provider.InstanceTypeSpec, limits DiskLimits) error {
+	for annotation, field := range map[string]*int{
+		RootVolumeSizeAnnotation: &spec.RootVolumeSize,
+		RootVolumeIOPSAnnotation: &spec.RootVolumeIOPS,
+	} {
+		value, ok := annotations[annotation]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid %s annotation %q: must be a positive integer", annotation, value)
+		}
+		*field = n
+	}
+	if spec.RootVolumeSize > limits.MaxDiskSize {
+		return fmt.Errorf("invalid %s annotation: %d GiB exceeds the limit of %d GiB", RootVolumeSizeAnnotation, spec.RootVolumeSize, limits.MaxDiskSize)
+	}
+
+	if value, ok := annotations[RootVolumeTypeAnnotation]; ok {
+		spec.RootVolumeType = strings.TrimSpace(value)
+	}
+
+	if value, ok := annotations[DataDisksAnnotation]; ok {
+		disks, err := provider.ParseDataDisks(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", DataDisksAnnotation, err)
+		}
+		if len(disks) > limits.MaxDataDisks {
+			return fmt.Errorf("invalid %s annotation: %d data disks exceed the limit of %d", DataDisksAnnotation, len(disks), limits.MaxDataDisks)
+		}
+		for _, disk := range disks {
+			if disk.Size > limits.MaxDiskSize {
+				return fmt.Errorf("invalid %s annotation: %d GiB exceeds the limit of %d GiB", DataDisksAnnotation, disk.Size, limits.MaxDiskSize)
+			}
+		}
+		spec.DataDisks = disks
+	}
+
+	return nil
+}
+
 // Method to check if a string exists in a slice
 func Contains(slice []string, s string) bool {
 	for _, item := range slice {
@@ -1,8 +1,10 @@
 package util
 
 import (
+	"reflect"
 	"testing"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
 )
 
@@ -189,3 +191,118 @@ func TestGetImageFromAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestGetInitdataFromAnnotation(t *testing.T) {
+	const annotation = "io.katacontainers.config.hypervisor.cc_init_data"
+	tests := []struct {
+		name     string
+		initdata string
+		wantErr  bool
+	}{
+		{
+			name:     "no initdata",
+			initdata: "",
+		},
+		{
+			name:     "valid initdata",
+			initdata: "algorithm = \"sha384\"\nversion = \"0.1.0\"\n\n[data]\n\"policy.rego\" = '''\npackage agent_policy\n\ndefault ExecProcessRequest := false\n'''\n",
+		},
+		{
+			name:     "unsupported algorithm",
+			initdata: "algorithm = \"md5\"\nversion = \"0.1.0\"\n",
+			wantErr:  true,
+		},
+		{
+			name:     "malformed policy",
+			initdata: "algorithm = \"sha384\"\nversion = \"0.1.0\"\n\n[data]\n\"policy.rego\" = '''\npackage agent_policy\n\nExecProcessRequest if {\n'''\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetInitdataFromAnnotation(map[string]string{annotation: tt.initdata})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetInitdataFromAnnotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != "") != (tt.initdata != "" && !tt.wantErr) {
+				t.Errorf("GetInitdataFromAnnotation() = %q", got)
+			}
+		})
+	}
+}
+
+func TestGetDisksFromAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        provider.InstanceTypeSpec
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "root volume and data disks",
+			annotations: map[string]string{
+				RootVolumeSizeAnnotation: "200",
+				RootVolumeTypeAnnotation: "io2",
+				RootVolumeIOPSAnnotation: "3000",
+				DataDisksAnnotation:      "100,50:gp3",
+			},
+			want: provider.InstanceTypeSpec{
+				RootVolumeSize: 200,
+				RootVolumeType: "io2",
+				RootVolumeIOPS: 3000,
+				DataDisks:      []provider.DataDisk{{Size: 100}, {Size: 50, Type: "gp3"}},
+			},
+		},
+		{
+			name:        "invalid root volume size",
+			annotations: map[string]string{RootVolumeSizeAnnotation: "200Gi"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid data disks",
+			annotations: map[string]string{DataDisksAnnotation: "-1"},
+			wantErr:     true,
+		},
+		{
+			name:        "root volume size at the limit",
+			annotations: map[string]string{RootVolumeSizeAnnotation: "1000"},
+			want:        provider.InstanceTypeSpec{RootVolumeSize: 1000},
+		},
+		{
+			name:        "root volume size over the limit",
+			annotations: map[string]string{RootVolumeSizeAnnotation: "1001"},
+			wantErr:     true,
+		},
+		{
+			name:        "data disk size over the limit",
+			annotations: map[string]string{DataDisksAnnotation: "100,1001"},
+			wantErr:     true,
+		},
+		{
+			name:        "data disks at the limit",
+			annotations: map[string]string{DataDisksAnnotation: "10,10,10"},
+			want:        provider.InstanceTypeSpec{DataDisks: []provider.DataDisk{{Size: 10}, {Size: 10}, {Size: 10}}},
+		},
+		{
+			name:        "too many data disks",
+			annotations: map[string]string{DataDisksAnnotation: "10,10,10,10"},
+			wantErr:     true,
+		},
+	}
+	limits := DiskLimits{MaxDataDisks: 3, MaxDiskSize: 1000}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got provider.InstanceTypeSpec
+			err := GetDisksFromAnnotation(tt.annotations, &got, limits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetDisksFromAnnotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetDisksFromAnnotation() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -30,39 +31,87 @@ import (
 // 5. cloud-api-adaptor initiates TLS connection to agent-protocol-forwarder using the client cert/key
 // 6. agent-protocol-adaptor validates incoming TLS connection using the client certificate
 // 7. cloud-api-adaptor validates the server certificate sent from agent-protocol-forwarder using the server CA certificate
+//
+// The CA and client certificates can be persisted (see proxy.CertStore), so that a restarted cloud-api-adaptor
+// still trusts, and is trusted by, existing pod VMs. Server certificates can be short-lived, in which case
+// cloud-api-adaptor pushes renewed ones to agent-protocol-forwarder before they expire.
 
 const (
 	validFor = 2 * 365 * 24 * time.Hour
+
+	// renewalFraction is the fraction of the lifetime of a certificate after which it is renewed
+	renewalFraction = 2.0 / 3.0
 )
 
 type CAService interface {
 	RootCertificate() (certPEM []byte)
 	Issue(serverName string) (certPEM, keyPEM []byte, err error)
+	IssueForCSR(serverName string, csrPEM []byte) (certPEM []byte, err error)
 }
 
 type caService struct {
-	orgName string
-	certPEM []byte
-	keyPEM  []byte
+	orgName        string
+	certPEM        []byte
+	keyPEM         []byte
+	serverValidFor time.Duration
 }
 
-func NewCAService(orgName string) (CAService, error) {
+// CAOption customizes a CA service
+type CAOption func(*caService)
 
-	certPEM, keyPEM, err := generateCertificate(orgName, "", nil, nil, false, true)
+// WithCAKeyPair makes the CA service use an existing CA certificate and key instead of generating them
+func WithCAKeyPair(certPEM, keyPEM []byte) CAOption {
+	return func(s *caService) {
+		s.certPEM = certPEM
+		s.keyPEM = keyPEM
+	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to set up a CA service for %q", orgName)
+// WithServerCertValidity sets the lifetime of issued server certificates
+func WithServerCertValidity(validity time.Duration) CAOption {
+	return func(s *caService) {
+		if validity > 0 {
+			s.serverValidFor = validity
+		}
 	}
+}
+
+func NewCAService(orgName string, opts ...CAOption) (CAService, error) {
 
 	s := &caService{
-		orgName: orgName,
-		certPEM: certPEM,
-		keyPEM:  keyPEM,
+		orgName:        orgName,
+		serverValidFor: validFor,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.certPEM == nil {
+		certPEM, keyPEM, err := NewCAKeyPair(orgName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up a CA service for %q", orgName)
+		}
+		s.certPEM = certPEM
+		s.keyPEM = keyPEM
+	} else if _, err := tls.X509KeyPair(s.certPEM, s.keyPEM); err != nil {
+		return nil, fmt.Errorf("failed to load the CA key pair for %q: %w", orgName, err)
 	}
 
 	return s, nil
 }
 
+// NewCAKeyPair generates a self-signed CA certificate for orgName and its private key
+func NewCAKeyPair(orgName string) (certPEM, keyPEM []byte, err error) {
+
+	certPEM, keyPEM, err = generateCertificate(orgName, "", nil, nil, false, true, validFor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate a CA certificate for %q: %w", orgName, err)
+	}
+
+	return certPEM, keyPEM, nil
+}
+
 func (s *caService) RootCertificate() (certPEM []byte) {
 	return s.certPEM
 }
@@ -70,7 +119,7 @@ func (s *caService) RootCertificate() (certPEM []byte) {
 // Issue generates a server certificate for serverName and its private key
 func (s *caService) Issue(serverName string) (certPEM, keyPEM []byte, err error) {
 
-	serverCertPEM, serverKeyPEM, err := generateCertificate(s.orgName, serverName, s.certPEM, s.keyPEM, false, false)
+	serverCertPEM, serverKeyPEM, err := generateCertificate(s.orgName, serverName, s.certPEM, s.keyPEM, false, false, s.serverValidFor)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to issue a server certificate for %q: %w", serverName, err)
 	}
@@ -81,7 +130,7 @@ func (s *caService) Issue(serverName string) (certPEM, keyPEM []byte, err error)
 // NewClientCertificate generates a self-signed client certificate for orgName and its private key
 func NewClientCertificate(orgName string) (certPEM, keyPEM []byte, err error) {
 
-	certPEM, keyPEM, err = generateCertificate(orgName, "", nil, nil, true, false)
+	certPEM, keyPEM, err = generateCertificate(orgName, "", nil, nil, true, false, validFor)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate a client certificate for %q", orgName)
 	}
@@ -89,6 +138,31 @@ func NewClientCertificate(orgName string) (certPEM, keyPEM []byte, err error) {
 	return certPEM, keyPEM, nil
 }
 
+// ParseCertificatePEM parses a single PEM encoded certificate
+func ParseCertificatePEM(certPEM []byte) (*x509.Certificate, error) {
+
+	certDER, err := decodePEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode a certificate PEM: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse a certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// NeedsRenewal returns whether cert has passed two thirds of its lifetime at now
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewAt := cert.NotBefore.Add(time.Duration(float64(lifetime) * renewalFraction))
+
+	return !now.Before(renewAt)
+}
+
 func decodePEM(pemBytes []byte) ([]byte, error) {
 
 	firstBlock, remainingBlocks := pem.Decode(pemBytes)
@@ -111,7 +185,47 @@ func encodePEM(dataType string, der []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM []byte, isClient, isCA bool) (certPEM, keyPEM []byte, err error) {
+func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM []byte, isClient, isCA bool, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+
+	key, keyPEM, err := generateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM, err = createCertificate(orgName, serverName, parentCertPEM, parentKeyPEM, &key.PublicKey, key, isClient, isCA, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// generateKey generates a private key and returns it with its PEM form
+func generateKey() (key *ecdsa.PrivateKey, keyPEM []byte, err error) {
+
+	// TODO: Support key algorithms other than ECDSA P-256
+	curve := elliptic.P256()
+	key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ECDSA key for %s: %w", curve.Params().Name, err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert a private key to PKCS #8 form: %w", err)
+	}
+
+	keyPEM, err = encodePEM("PRIVATE KEY", keyDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed ot encode a private key to PEM: %w", err)
+	}
+
+	return key, keyPEM, nil
+}
+
+// createCertificate creates a certificate for publicKey. The certificate is signed by the parent
+// certificate and key if specified, or self-signed with selfKey otherwise.
+func createCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM []byte, publicKey, selfKey any, isClient, isCA bool, validFor time.Duration) (certPEM []byte, err error) {
 
 	var (
 		signerCert, parentCert *x509.Certificate
@@ -123,12 +237,12 @@ func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM
 	if parentCertPEM != nil {
 		parentCertDER, err := decodePEM(parentCertPEM)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to decode a parent certificate PEM: %w", err)
+			return nil, fmt.Errorf("failed to decode a parent certificate PEM: %w", err)
 		}
 
 		parentCert, err = x509.ParseCertificate(parentCertDER)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse a parent certificate: %w", err)
+			return nil, fmt.Errorf("failed to parse a parent certificate: %w", err)
 		}
 	}
 
@@ -137,12 +251,12 @@ func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM
 	if parentKeyPEM != nil {
 		parentKeyDER, err := decodePEM(parentKeyPEM)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to decode a parent key PEM: %w", err)
+			return nil, fmt.Errorf("failed to decode a parent key PEM: %w", err)
 		}
 
 		parentKey, err = x509.ParsePKCS8PrivateKey(parentKeyDER)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse a parent key: %w", err)
+			return nil, fmt.Errorf("failed to parse a parent key: %w", err)
 		}
 	}
 	// Prepare a certificate template
@@ -162,7 +276,7 @@ func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate a serial number of a new certificate: %w", err)
+		return nil, fmt.Errorf("failed to generate a serial number of a new certificate: %w", err)
 	}
 
 	var authType x509.ExtKeyUsage
@@ -192,25 +306,6 @@ func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM
 		certTemplate.KeyUsage |= x509.KeyUsageCertSign
 	}
 
-	// Generate a private key
-
-	// TODO: Support key algorithms other than ECDSA P-256
-	curve := elliptic.P256()
-	key, err := ecdsa.GenerateKey(curve, rand.Reader)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate ECDSA key for %s: %w", curve.Params().Name, err)
-	}
-
-	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to convert a private key to PKCS #8 form: %w", err)
-	}
-
-	keyPEM, err = encodePEM("PRIVATE KEY", keyDER)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed ot encode a private key to PEM: %w", err)
-	}
-
 	// Create a certificate
 
 	if parentCert != nil {
@@ -219,18 +314,18 @@ func generateCertificate(orgName, serverName string, parentCertPEM, parentKeyPEM
 	} else {
 		// self-signed certificate
 		signerCert = &certTemplate
-		signerKey = key
+		signerKey = selfKey
 	}
 
-	certDER, err := x509.CreateCertificate(rand.Reader, &certTemplate, signerCert, &key.PublicKey, signerKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, &certTemplate, signerCert, publicKey, signerKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create a certificate: %w", err)
+		return nil, fmt.Errorf("failed to create a certificate: %w", err)
 	}
 
 	certPEM, err = encodePEM("CERTIFICATE", certDER)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed ot encode a certificate to PEM: %w", err)
+		return nil, fmt.Errorf("failed ot encode a certificate to PEM: %w", err)
 	}
 
-	return certPEM, keyPEM, nil
+	return certPEM, nil
 }
@@ -6,7 +6,9 @@ package tlsutil
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -75,3 +77,44 @@ func TestGenerateCertificate(t *testing.T) {
 
 	assert.Equal(t, recv, msg)
 }
+
+func TestCAServiceWithKeyPair(t *testing.T) {
+
+	caCertPEM, caKeyPEM, err := NewCAKeyPair("agent-protocol-forwarder")
+	require.NoError(t, err)
+
+	caService, err := NewCAService("agent-protocol-forwarder", WithCAKeyPair(caCertPEM, caKeyPEM), WithServerCertValidity(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, caCertPEM, caService.RootCertificate())
+
+	serverCertPEM, _, err := caService.Issue("server1")
+	require.NoError(t, err)
+
+	serverCert, err := ParseCertificatePEM(serverCertPEM)
+	require.NoError(t, err)
+	assert.Equal(t, "server1", serverCert.Subject.CommonName)
+	assert.Equal(t, time.Hour, serverCert.NotAfter.Sub(serverCert.NotBefore))
+
+	caCert, err := ParseCertificatePEM(caCertPEM)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = serverCert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "server1"})
+	assert.NoError(t, err)
+
+	_, otherKeyPEM, err := NewCAKeyPair("agent-protocol-forwarder")
+	require.NoError(t, err)
+	_, err = NewCAService("agent-protocol-forwarder", WithCAKeyPair(caCertPEM, otherKeyPEM))
+	assert.Error(t, err)
+}
+
+func TestNeedsRenewal(t *testing.T) {
+
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(3 * time.Hour)}
+
+	assert.False(t, NeedsRenewal(cert, notBefore))
+	assert.False(t, NeedsRenewal(cert, notBefore.Add(2*time.Hour-time.Second)))
+	assert.True(t, NeedsRenewal(cert, notBefore.Add(2*time.Hour)))
+	assert.True(t, NeedsRenewal(cert, notBefore.Add(4*time.Hour)))
+}
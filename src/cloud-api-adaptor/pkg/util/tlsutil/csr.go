@@ -0,0 +1,120 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"time"
+)
+
+// Attestation-bound TLS configuration works as follows
+//
+// 1. agent-protocol-forwarder generates its server private key inside the pod VM, and presents a self-signed
+//    bootstrap certificate for that key
+// 2. cloud-api-adaptor connects with its client certificate, and requests a certificate signing request (CSR)
+//    together with TEE evidence binding a nonce and the public key of the CSR
+// 3. cloud-api-adaptor verifies the evidence, checks that the CSR is for the key presented in the TLS handshake,
+//    and issues a server certificate for the CSR using the server CA certificate
+// 4. agent-protocol-forwarder installs the issued certificate, and cloud-api-adaptor reconnects verifying it
+//
+// The server private key never leaves the pod VM, so it is no longer passed in cloud-init data.
+
+// bootstrapValidFor is the lifetime of self-signed bootstrap certificates
+const bootstrapValidFor = 24 * time.Hour
+
+// NewCertificateRequest generates a private key and a certificate signing request for serverName
+func NewCertificateRequest(serverName string) (csrPEM, keyPEM []byte, err error) {
+
+	key, keyPEM, err := generateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: serverName},
+		DNSNames: []string{serverName},
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create a certificate request for %q: %w", serverName, err)
+	}
+
+	csrPEM, err = encodePEM("CERTIFICATE REQUEST", csrDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return csrPEM, keyPEM, nil
+}
+
+// ParseCertificateRequestPEM parses a PEM encoded certificate signing request, and checks its signature
+func ParseCertificateRequestPEM(csrPEM []byte) (*x509.CertificateRequest, error) {
+
+	csrDER, err := decodePEM(csrPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode a certificate request PEM: %w", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse a certificate request: %w", err)
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid signature of a certificate request: %w", err)
+	}
+
+	return csr, nil
+}
+
+// NewBootstrapCertificate creates a self-signed server certificate for serverName and keyPEM. It is presented
+// until a certificate issued by cloud-api-adaptor is installed.
+func NewBootstrapCertificate(serverName string, keyPEM []byte) (certPEM []byte, err error) {
+
+	keyDER, err := decodePEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode a private key PEM: %w", err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse a private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	certPEM, err = createCertificate(serverName, serverName, nil, nil, signer.Public(), signer, false, false, bootstrapValidFor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a bootstrap certificate for %q: %w", serverName, err)
+	}
+
+	return certPEM, nil
+}
+
+// IssueForCSR issues a server certificate for serverName and the public key of a certificate signing request
+func (s *caService) IssueForCSR(serverName string, csrPEM []byte) (certPEM []byte, err error) {
+
+	csr, err := ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if csr.Subject.CommonName != serverName {
+		return nil, fmt.Errorf("certificate request is for %q instead of %q", csr.Subject.CommonName, serverName)
+	}
+
+	certPEM, err = createCertificate(s.orgName, serverName, s.certPEM, s.keyPEM, csr.PublicKey, nil, false, false, s.serverValidFor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue a server certificate for %q: %w", serverName, err)
+	}
+
+	return certPEM, nil
+}
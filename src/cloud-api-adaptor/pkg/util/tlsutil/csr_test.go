@@ -0,0 +1,64 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueForCSR(t *testing.T) {
+
+	caService, err := NewCAService("agent-protocol-forwarder")
+	require.NoError(t, err)
+
+	csrPEM, keyPEM, err := NewCertificateRequest("server1")
+	require.NoError(t, err)
+
+	certPEM, err := caService.IssueForCSR("server1", csrPEM)
+	require.NoError(t, err)
+
+	// The issued certificate is for the key of the request
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(t, err)
+
+	cert, err := ParseCertificatePEM(certPEM)
+	require.NoError(t, err)
+	caCert, err := ParseCertificatePEM(caService.RootCertificate())
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "server1"})
+	assert.NoError(t, err)
+
+	_, err = caService.IssueForCSR("server2", csrPEM)
+	assert.Error(t, err)
+
+	_, err = caService.IssueForCSR("server1", certPEM)
+	assert.Error(t, err)
+}
+
+func TestNewBootstrapCertificate(t *testing.T) {
+
+	csrPEM, keyPEM, err := NewCertificateRequest("server1")
+	require.NoError(t, err)
+
+	certPEM, err := NewBootstrapCertificate("server1", keyPEM)
+	require.NoError(t, err)
+
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(t, err)
+
+	cert, err := ParseCertificatePEM(certPEM)
+	require.NoError(t, err)
+	csr, err := ParseCertificateRequestPEM(csrPEM)
+	require.NoError(t, err)
+
+	assert.Equal(t, "server1", cert.Subject.CommonName)
+	assert.Equal(t, csr.RawSubjectPublicKeyInfo, cert.RawSubjectPublicKeyInfo)
+}
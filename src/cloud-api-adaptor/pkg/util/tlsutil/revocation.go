@@ -0,0 +1,121 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCertificateRevoked is returned when a peer presents a revoked certificate
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
+// RevocationList holds the serial numbers of revoked certificates issued by a CA service.
+// Its JSON form maps hex serial numbers to the expiry of the revoked certificates.
+type RevocationList struct {
+	mutex   sync.RWMutex
+	revoked map[string]time.Time // hex serial number -> expiry of the revoked certificate
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke adds cert to the revocation list
+func (r *RevocationList) Revoke(cert *x509.Certificate) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.revoked[cert.SerialNumber.Text(16)] = cert.NotAfter.UTC()
+}
+
+// Prune removes the certificates that have expired before now, which are rejected anyway
+func (r *RevocationList) Prune(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for serial, notAfter := range r.revoked {
+		if notAfter.Before(now) {
+			delete(r.revoked, serial)
+		}
+	}
+}
+
+// Truncate keeps at most max certificates, dropping the ones expiring first.
+// It returns the number of dropped certificates.
+func (r *RevocationList) Truncate(max int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	excess := len(r.revoked) - max
+	if excess <= 0 {
+		return 0
+	}
+
+	serials := make([]string, 0, len(r.revoked))
+	for serial := range r.revoked {
+		serials = append(serials, serial)
+	}
+	slices.SortFunc(serials, func(a, b string) int {
+		return r.revoked[a].Compare(r.revoked[b])
+	})
+	for _, serial := range serials[:excess] {
+		delete(r.revoked, serial)
+	}
+	return excess
+}
+
+// IsRevoked returns whether cert has been revoked
+func (r *RevocationList) IsRevoked(cert *x509.Certificate) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, ok := r.revoked[cert.SerialNumber.Text(16)]
+	return ok
+}
+
+// VerifyConnection can be used as tls.Config.VerifyConnection to reject peers presenting a revoked certificate
+func (r *RevocationList) VerifyConnection(state tls.ConnectionState) error {
+	for _, cert := range state.PeerCertificates {
+		if r.IsRevoked(cert) {
+			return fmt.Errorf("%w: serial %s for %q", ErrCertificateRevoked, cert.SerialNumber.Text(16), cert.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+func (r *RevocationList) MarshalJSON() ([]byte, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return json.Marshal(r.revoked)
+}
+
+func (r *RevocationList) UnmarshalJSON(data []byte) error {
+	entries := make(map[string]time.Time)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse revocation list: %w", err)
+	}
+
+	// Serial numbers are also accepted in the upper case form printed by openssl
+	revoked := make(map[string]time.Time, len(entries))
+	for serial, notAfter := range entries {
+		revoked[strings.TrimLeft(strings.ToLower(serial), "0")] = notAfter
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.revoked = revoked
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationList(t *testing.T) {
+
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	revoked := &x509.Certificate{SerialNumber: big.NewInt(0xabc), NotAfter: notAfter}
+	valid := &x509.Certificate{SerialNumber: big.NewInt(0xdef), NotAfter: notAfter}
+
+	list := NewRevocationList()
+	list.Revoke(revoked)
+
+	assert.True(t, list.IsRevoked(revoked))
+	assert.False(t, list.IsRevoked(valid))
+
+	assert.ErrorIs(t, list.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{revoked}}), ErrCertificateRevoked)
+	assert.NoError(t, list.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{valid}}))
+
+	data, err := json.Marshal(list)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"abc": "2030-01-01T00:00:00Z"}`, string(data))
+
+	restored := NewRevocationList()
+	require.NoError(t, json.Unmarshal(data, restored))
+	assert.True(t, restored.IsRevoked(revoked))
+	assert.False(t, restored.IsRevoked(valid))
+}
+
+func TestRevocationListSerialFormat(t *testing.T) {
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0xabc)}
+
+	list := NewRevocationList()
+	require.NoError(t, list.UnmarshalJSON([]byte(`{"0ABC": "2030-01-01T00:00:00Z"}`)))
+	assert.True(t, list.IsRevoked(cert))
+
+	assert.Error(t, list.UnmarshalJSON([]byte(`["abc"]`)))
+}
+
+func TestRevocationListPrune(t *testing.T) {
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	expired := &x509.Certificate{SerialNumber: big.NewInt(0xabc), NotAfter: now.Add(-time.Hour)}
+	valid := &x509.Certificate{SerialNumber: big.NewInt(0xdef), NotAfter: now.Add(time.Hour)}
+
+	list := NewRevocationList()
+	list.Revoke(expired)
+	list.Revoke(valid)
+	list.Prune(now)
+
+	assert.False(t, list.IsRevoked(expired))
+	assert.True(t, list.IsRevoked(valid))
+}
+
+func TestRevocationListTruncate(t *testing.T) {
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := &x509.Certificate{SerialNumber: big.NewInt(0xabc), NotAfter: now.Add(time.Hour)}
+	second := &x509.Certificate{SerialNumber: big.NewInt(0xdef), NotAfter: now.Add(2 * time.Hour)}
+	third := &x509.Certificate{SerialNumber: big.NewInt(0x123), NotAfter: now.Add(3 * time.Hour)}
+
+	list := NewRevocationList()
+	list.Revoke(second)
+	list.Revoke(third)
+	list.Revoke(first)
+
+	assert.Equal(t, 0, list.Truncate(3))
+	assert.Equal(t, 1, list.Truncate(2))
+
+	assert.False(t, list.IsRevoked(first))
+	assert.True(t, list.IsRevoked(second))
+	assert.True(t, list.IsRevoked(third))
+}
@@ -0,0 +1,106 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package alibabacloud
+
+import (
+	"fmt"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/aliyun/credentials-go/credentials"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	ini "gopkg.in/ini.v1"
+)
+
+// fileCredential reads an AccessKey from a credentials file, e.g. mounted from a Secret, in the INI
+// format of the Alibaba Cloud credentials file. The file is read again when the Secret is rotated.
+type fileCredential struct {
+	credential *util.SecretFileValue[credentials.Credential]
+}
+
+func newFileCredential(path string) (*fileCredential, error) {
+	credential, err := util.NewSecretFileValue(path, func(data []byte) (credentials.Credential, error) {
+		config, err := parseCredentialsFile(data)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewCredential(config)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fileCredential{credential: credential}, nil
+}
+
+// parseCredentialsFile parses the default profile of a credentials file with an AccessKey
+// ("access_key"), or an STS token ("sts")
+func parseCredentialsFile(data []byte) (*credentials.Config, error) {
+	file, err := ini.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	section, err := file.GetSection("default")
+	if err != nil {
+		return nil, err
+	}
+
+	config := &credentials.Config{
+		Type:            tea.String(section.Key("type").MustString("access_key")),
+		AccessKeyId:     tea.String(section.Key("access_key_id").String()),
+		AccessKeySecret: tea.String(section.Key("access_key_secret").String()),
+	}
+	switch tea.StringValue(config.Type) {
+	case "access_key":
+	case "sts":
+		config.SecurityToken = tea.String(section.Key("security_token").String())
+	default:
+		return nil, fmt.Errorf("unsupported credential type %q", tea.StringValue(config.Type))
+	}
+	if tea.StringValue(config.AccessKeyId) == "" || tea.StringValue(config.AccessKeySecret) == "" {
+		return nil, fmt.Errorf("access_key_id and access_key_secret are required")
+	}
+	return config, nil
+}
+
+func (c *fileCredential) GetCredential() (*credentials.CredentialModel, error) {
+	return c.credential.Get().GetCredential()
+}
+
+// GetAccessKeyId implements a deprecated method of credentials.Credential
+func (c *fileCredential) GetAccessKeyId() (*string, error) {
+	model, err := c.GetCredential()
+	if err != nil {
+		return nil, err
+	}
+	return model.AccessKeyId, nil
+}
+
+// GetAccessKeySecret implements a deprecated method of credentials.Credential
+func (c *fileCredential) GetAccessKeySecret() (*string, error) {
+	model, err := c.GetCredential()
+	if err != nil {
+		return nil, err
+	}
+	return model.AccessKeySecret, nil
+}
+
+// GetSecurityToken implements a deprecated method of credentials.Credential
+func (c *fileCredential) GetSecurityToken() (*string, error) {
+	model, err := c.GetCredential()
+	if err != nil {
+		return nil, err
+	}
+	return model.SecurityToken, nil
+}
+
+func (c *fileCredential) GetBearerToken() *string {
+	return tea.String("")
+}
+
+func (c *fileCredential) GetType() *string {
+	model, err := c.GetCredential()
+	if err != nil {
+		return nil
+	}
+	return model.Type
+}
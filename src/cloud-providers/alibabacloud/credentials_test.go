@@ -0,0 +1,112 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package alibabacloud
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+func TestParseCredentialsFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantType  string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:     "access key",
+			data:     "[default]\ntype = access_key\naccess_key_id = id\naccess_key_secret = secret\n",
+			wantType: "access_key",
+		},
+		{
+			name:     "access key by default",
+			data:     "[default]\naccess_key_id = id\naccess_key_secret = secret\n",
+			wantType: "access_key",
+		},
+		{
+			name:      "sts token",
+			data:      "[default]\ntype = sts\naccess_key_id = id\naccess_key_secret = secret\nsecurity_token = token\n",
+			wantType:  "sts",
+			wantToken: "token",
+		},
+		{
+			name:    "missing access key secret",
+			data:    "[default]\ntype = access_key\naccess_key_id = id\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			data:    "[default]\ntype = ram_role_arn\naccess_key_id = id\naccess_key_secret = secret\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing default profile",
+			data:    "[prod]\naccess_key_id = id\naccess_key_secret = secret\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseCredentialsFile([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCredentialsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tea.StringValue(config.Type) != tt.wantType || tea.StringValue(config.AccessKeyId) != "id" ||
+				tea.StringValue(config.AccessKeySecret) != "secret" || tea.StringValue(config.SecurityToken) != tt.wantToken {
+				t.Errorf("parseCredentialsFile() = %v", config)
+			}
+		})
+	}
+}
+
+// rotateSecret replaces a file the way Kubernetes updates a mounted Secret
+func rotateSecret(t *testing.T, path, data string) {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileCredential(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+
+	rotateSecret(t, path, "[default]\naccess_key_id = id1\naccess_key_secret = secret1\n")
+	c, err := newFileCredential(path)
+	if err != nil {
+		t.Fatalf("newFileCredential() error = %v", err)
+	}
+
+	checkAccessKey := func(want string) {
+		t.Helper()
+		id, err := c.GetAccessKeyId()
+		if err != nil || tea.StringValue(id) != want {
+			t.Errorf("GetAccessKeyId() = %q, %v, want %s", tea.StringValue(id), err, want)
+		}
+	}
+	checkAccessKey("id1")
+
+	rotateSecret(t, path, "[default]\naccess_key_id = id2\naccess_key_secret = secret2\n")
+	checkAccessKey("id2")
+
+	path = filepath.Join(t.TempDir(), "missing")
+	if _, err := newFileCredential(path); err == nil {
+		t.Error("newFileCredential() expected an error for a missing file")
+	}
+	rotateSecret(t, path, "[default]\ntype = sts\n")
+	if _, err := newFileCredential(path); err == nil {
+		t.Error("newFileCredential() expected an error for an invalid file")
+	}
+}
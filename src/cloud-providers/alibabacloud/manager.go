@@ -23,6 +23,7 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	// Flags with environment variable support
 	reg.StringWithEnv(&alibabacloudcfg.AccessKeyID, "alibabacloud-access-key-id", "", "ALIBABACLOUD_ACCESS_KEY_ID", "Access Key ID", provider.Secret())
 	reg.StringWithEnv(&alibabacloudcfg.SecretKey, "alibabacloud-secret-access-key", "", "ALIBABACLOUD_ACCESS_KEY_SECRET", "Secret Key", provider.Secret())
+	reg.StringWithEnv(&alibabacloudcfg.CredentialsFile, "alibabacloud-credentials-file", "", "ALIBABACLOUD_CREDENTIALS_FILE", "Credentials file with an AccessKey, read again when it changes")
 	reg.StringWithEnv(&alibabacloudcfg.Region, "region", "cn-beijing", "REGION", "Region")
 	reg.StringWithEnv(&alibabacloudcfg.ImageID, "imageid", "", "IMAGEID", "Pod VM image id", provider.Required())
 	reg.StringWithEnv(&alibabacloudcfg.InstanceType, "instance-type", "ecs.g8i.xlarge", "PODVM_INSTANCE_TYPE", "Pod VM instance type")
@@ -38,6 +39,7 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 
 	// Custom flag types (comma-separated lists)
 	reg.CustomTypeWithEnv(&alibabacloudcfg.SecurityGroupIDs, "security-group-ids", "cn-beijing", "SECURITY_GROUP_IDS", "Security Group Ids to be used for the Pod VM, comma separated")
+	reg.CustomTypeWithEnv(&alibabacloudcfg.InstanceTypes, "instance-types", "", "PODVM_INSTANCE_TYPES", "Instance types to be used for the Pod VMs, comma separated")
 	reg.CustomTypeWithEnv(&alibabacloudcfg.Tags, "tags", "", "TAGS", "Custom tags (key=value pairs) to be used for the Pod VMs, comma separated")
 }
 
@@ -4,6 +4,7 @@
 package alibabacloud
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -29,6 +30,9 @@ import (
 var logger = log.New(log.Writer(), "[adaptor/cloud/alibabacloud] ", log.LstdFlags|log.Lmsgprefix)
 
 const (
+	// defaultDiskCategory is the category of the disks of pod VMs, unless requested otherwise
+	defaultDiskCategory = "cloud_essd"
+
 	maxInstanceNameLen = 63
 
 	EnvRoleArn         = "ALIBABA_CLOUD_ROLE_ARN"
@@ -45,6 +49,9 @@ type ecsClient interface {
 	// Describe InstanceTypes
 	DescribeInstanceTypes(
 		params *ecs.DescribeInstanceTypesRequest) (*ecs.DescribeInstanceTypesResponse, error)
+	// Describe Images
+	DescribeImages(
+		params *ecs.DescribeImagesRequest) (*ecs.DescribeImagesResponse, error)
 	// Describe InstanceAttribute
 	DescribeInstanceAttribute(
 		params *ecs.DescribeInstanceAttributeRequest) (*ecs.DescribeInstanceAttributeResponse, error)
@@ -96,7 +103,19 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	logger.Printf("alibabacloud config: %#v", config.Redact())
 
 	var c openapi.Config
-	if len(config.AccessKeyID) == 0 || len(config.SecretKey) == 0 {
+	if config.CredentialsFile != "" && (len(config.AccessKeyID) == 0 || len(config.SecretKey) == 0) {
+		logger.Printf("Use credentials file %s as credential", config.CredentialsFile)
+		cred, err := newFileCredential(config.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials of alibaba cloud: %v", err)
+		}
+
+		c = openapi.Config{
+			Credential: cred,
+			RegionId:   tea.String(config.Region),
+		}
+
+	} else if len(config.AccessKeyID) == 0 || len(config.SecretKey) == 0 {
 		logger.Printf("ALIBABACLOUD_ACCESS_KEY_ID and ALIBABACLOUD_ACCESS_KEY_SECRET not provided, try using ACK RRSA (ALIBABA_CLOUD_ROLE_ARN, ALIBABA_CLOUD_OIDC_PROVIDER_ARN, ALIBABA_CLOUD_OIDC_TOKEN_FILE) to get credential...")
 		cred, err := credentials.NewCredential(nil)
 		if err != nil {
@@ -150,6 +169,21 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	return provider, nil
 }
 
+// getImageSize returns the size of an image in GiB
+func (p *alibabaCloudProvider) getImageSize(imageID string) (int, error) {
+	resp, err := p.ecsClient.DescribeImages(&ecs.DescribeImagesRequest{
+		RegionId: tea.String(p.serviceConfig.Region),
+		ImageId:  tea.String(imageID),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("describing image %s: %w", imageID, err)
+	}
+	if resp.Body == nil || resp.Body.Images == nil || len(resp.Body.Images.Image) == 0 {
+		return 0, fmt.Errorf("image %s is not found", imageID)
+	}
+	return int(tea.Int32Value(resp.Body.Images.Image[0].Size)), nil
+}
+
 func (p *alibabaCloudProvider) getIPs(instanceID string, ecsClient ecsClient) ([]netip.Addr, error) {
 	var podNodeIPs []netip.Addr
 
@@ -216,7 +250,7 @@ func (p *alibabaCloudProvider) CreateInstance(ctx context.Context, podName, sand
 	}
 
 	tags := make([]*ecs.RunInstancesRequestTag, 0)
-	for k, v := range p.serviceConfig.Tags {
+	for k, v := range provider.MergeTags(p.serviceConfig.Tags, spec) {
 		tags = append(tags, &ecs.RunInstancesRequestTag{
 			Key:   tea.String(k),
 			Value: tea.String(v),
@@ -265,14 +299,35 @@ func (p *alibabaCloudProvider) CreateInstance(ctx context.Context, podName, sand
 		}
 	}
 
-	// Add block device mappings to the instance to set the root volume size
-	if p.serviceConfig.SystemDiskSize > 0 {
-		req.ImageId = tea.String(p.serviceConfig.ImageID)
+	// Add block device mappings to the instance to set the root volume size. ECS rejects
+	// sizes smaller than the image. An image that cannot be looked up does not fail the instance creation.
+	imageSize := 0
+	if spec.RootVolumeSize > 0 || p.serviceConfig.SystemDiskSize > 0 {
+		imageSize, err = p.getImageSize(p.serviceConfig.ImageID)
+		if err != nil {
+			logger.Printf("failed to get the size of image %s, using the requested system disk size: %v", p.serviceConfig.ImageID, err)
+			imageSize = 0
+		}
+	}
+	if size := provider.RootVolumeSize(spec, p.serviceConfig.SystemDiskSize, imageSize); size > 0 || spec.RootVolumeType != "" {
 		req.SystemDisk = &ecs.RunInstancesRequestSystemDisk{
-			Size:     tea.String(strconv.Itoa(p.serviceConfig.SystemDiskSize)),
-			Category: tea.String("cloud_essd"),
+			Category: tea.String(cmp.Or(spec.RootVolumeType, defaultDiskCategory)),
 		}
-		logger.Printf("Setting the SystemDisk size to %d GiB with ImageId %s", p.serviceConfig.SystemDiskSize, p.serviceConfig.ImageID)
+		if size > 0 {
+			req.SystemDisk.Size = tea.String(strconv.Itoa(size))
+			logger.Printf("Setting the SystemDisk size to %d GiB with ImageId %s", size, p.serviceConfig.ImageID)
+		}
+	}
+	if spec.RootVolumeIOPS > 0 {
+		logger.Printf("Ignoring root volume IOPS %d, system disks have the IOPS of their size and category", spec.RootVolumeIOPS)
+	}
+
+	for _, disk := range spec.DataDisks {
+		req.DataDisk = append(req.DataDisk, &ecs.RunInstancesRequestDataDisk{
+			Size:               tea.Int32(int32(disk.Size)),
+			Category:           tea.String(cmp.Or(disk.Type, defaultDiskCategory)),
+			DeleteWithInstance: tea.Bool(true),
+		})
 	}
 
 	logger.Printf("CreateInstance: name: %q", instanceName)
@@ -489,12 +544,12 @@ func (p *alibabaCloudProvider) getInstanceTypeInformation(instanceType string) (
 	}
 
 	// Get the vcpu, memory and gpu from the result
-	if len(result.Body.InstanceTypes.InstanceType) > 0 {
+	if result.Body != nil && result.Body.InstanceTypes != nil && len(result.Body.InstanceTypes.InstanceType) > 0 {
 		instanceInfo := result.Body.InstanceTypes.InstanceType[0]
-		vcpu = int64(*instanceInfo.CpuCoreCount)
-		memory = int64(*instanceInfo.MemorySize * 1024)
+		vcpu = int64(tea.Int32Value(instanceInfo.CpuCoreCount))
+		memory = int64(tea.Float32Value(instanceInfo.MemorySize) * 1024)
 
-		return vcpu, memory, int64(*instanceInfo.GPUAmount), nil
+		return vcpu, memory, int64(tea.Int32Value(instanceInfo.GPUAmount)), nil
 	}
 	return 0, 0, 0, fmt.Errorf("instance type %s not found", instanceType)
 
@@ -38,6 +38,7 @@ func (i *instanceTypes) Set(value string) error {
 type Config struct {
 	AccessKeyID          string
 	SecretKey            string
+	CredentialsFile      string
 	Region               string
 	ImageID              string
 	InstanceType         string
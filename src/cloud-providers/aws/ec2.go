@@ -4,30 +4,61 @@
 package aws
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	ini "gopkg.in/ini.v1"
 )
 
-// TODO: Use IAM role
+// credentialsFileRefresh is how often the credentials file is read again
+var credentialsFileRefresh = time.Minute
+
 func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 
 	var cfg aws.Config
 	var err error
 
-	if cloudCfg.AccessKeyID != "" && cloudCfg.SecretKey != "" {
+	switch {
+	case cloudCfg.AccessKeyID != "" && cloudCfg.SecretKey != "":
 		cfg, err = config.LoadDefaultConfig(context.TODO(),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cloudCfg.AccessKeyID, cloudCfg.SecretKey, cloudCfg.SessionToken)), config.WithRegion(cloudCfg.Region))
 		if err != nil {
 			return nil, fmt.Errorf("configuration error when using creds: %s", err)
 		}
 
-	} else {
+	case cloudCfg.CredentialsFile != "":
+		logger.Printf("using credentials file %s", cloudCfg.CredentialsFile)
+		provider, err := newFileCredentialsProvider(cloudCfg.CredentialsFile, cloudCfg.LoginProfile)
+		if err != nil {
+			return nil, fmt.Errorf("configuration error when using credentials file: %s", err)
+		}
+		cfg, err = config.LoadDefaultConfig(context.TODO(),
+			config.WithCredentialsProvider(aws.NewCredentialsCache(provider)),
+			config.WithRegion(cloudCfg.Region))
+		if err != nil {
+			return nil, fmt.Errorf("configuration error when using credentials file: %s", err)
+		}
+
+	case cloudCfg.RoleARN != "" && cloudCfg.WebIdentityTokenFile != "":
+		logger.Printf("using web identity of role %s", cloudCfg.RoleARN)
+		cfg, err = config.LoadDefaultConfig(context.TODO(), config.WithRegion(cloudCfg.Region))
+		if err != nil {
+			return nil, fmt.Errorf("configuration error when using web identity: %s", err)
+		}
+		// The token file is read again each time the credentials expire, so that rotated tokens are used
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg),
+			cloudCfg.RoleARN, stscreds.IdentityTokenFile(cloudCfg.WebIdentityTokenFile)))
 
+	default:
 		cfg, err = config.LoadDefaultConfig(context.TODO(),
 			config.WithRegion(cloudCfg.Region),
 			config.WithSharedConfigProfile(cloudCfg.LoginProfile))
@@ -38,3 +69,51 @@ func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 	client := ec2.NewFromConfig(cfg)
 	return client, nil
 }
+
+// fileCredentialsProvider reads credentials from a shared credentials file, e.g. mounted from a Secret.
+// The file is read again when the Secret is rotated. The credentials expire after credentialsFileRefresh,
+// so that a rotated file is read when they are used with a credentials cache.
+type fileCredentialsProvider struct {
+	credentials *util.SecretFileValue[aws.Credentials]
+}
+
+func newFileCredentialsProvider(path, profile string) (*fileCredentialsProvider, error) {
+	profile = cmp.Or(profile, "default")
+	credentials, err := util.NewSecretFileValue(path, func(data []byte) (aws.Credentials, error) {
+		return parseCredentialsFile(data, profile)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fileCredentialsProvider{credentials: credentials}, nil
+}
+
+// parseCredentialsFile parses the credentials of a profile of a shared credentials file
+func parseCredentialsFile(data []byte, profile string) (aws.Credentials, error) {
+	file, err := ini.Load(data)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	section, err := file.GetSection(profile)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("no credentials for profile %s: %w", profile, err)
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     section.Key("aws_access_key_id").String(),
+		SecretAccessKey: section.Key("aws_secret_access_key").String(),
+		SessionToken:    section.Key("aws_session_token").String(),
+		Source:          "CredentialsFile",
+	}
+	if !creds.HasKeys() {
+		return aws.Credentials{}, fmt.Errorf("aws_access_key_id and aws_secret_access_key are required for profile %s", profile)
+	}
+	return creds, nil
+}
+
+func (p *fileCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds := p.credentials.Get()
+	creds.CanExpire = true
+	creds.Expires = time.Now().Add(credentialsFileRefresh)
+	return creds, nil
+}
@@ -24,6 +24,9 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg.StringWithEnv(&awscfg.AccessKeyID, "aws-access-key-id", "", "AWS_ACCESS_KEY_ID", "Access Key ID", provider.Secret())
 	reg.StringWithEnv(&awscfg.SecretKey, "aws-secret-key", "", "AWS_SECRET_ACCESS_KEY", "Secret Key", provider.Secret())
 	reg.StringWithEnv(&awscfg.SessionToken, "aws-session-token", "", "AWS_SESSION_TOKEN", "Session Token", provider.Secret())
+	reg.StringWithEnv(&awscfg.CredentialsFile, "aws-credentials-file", "", "AWS_CREDENTIALS_FILE", "Shared credentials file, read again when it changes")
+	reg.StringWithEnv(&awscfg.RoleARN, "aws-role-arn", "", "AWS_ROLE_ARN", "IAM role assumed with the web identity token")
+	reg.StringWithEnv(&awscfg.WebIdentityTokenFile, "aws-web-identity-token-file", "", "AWS_WEB_IDENTITY_TOKEN_FILE", "Web identity token file, e.g. a projected service account token")
 	reg.StringWithEnv(&awscfg.InstanceType, "instance-type", "m6a.large", "PODVM_INSTANCE_TYPE", "Pod VM instance type")
 	reg.StringWithEnv(&awscfg.Region, "aws-region", "", "AWS_REGION", "Region")
 	reg.StringWithEnv(&awscfg.LaunchTemplateName, "aws-lt-name", "kata", "PODVM_LAUNCHTEMPLATE_NAME", "AWS Launch Template Name")
@@ -30,6 +30,9 @@ var (
 	errEmptyPublicIPAddress = errors.New("public IP address is empty")
 	errImageDetailsFailed   = errors.New("unable to get image details")
 	errDeviceNameEmpty      = errors.New("empty device name")
+
+	// dataDiskDeviceNames are the device names of data disks, as recommended for EBS volumes
+	dataDiskDeviceNames = []string{"/dev/sdf", "/dev/sdg", "/dev/sdh", "/dev/sdi", "/dev/sdj", "/dev/sdk", "/dev/sdl", "/dev/sdm", "/dev/sdn", "/dev/sdo", "/dev/sdp"}
 )
 
 const (
@@ -208,8 +211,8 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		},
 	}
 
-	// Add custom tags (k=v) from serviceConfig.Tags to the instance
-	for k, v := range p.serviceConfig.Tags {
+	// Add custom tags (k=v) from serviceConfig.Tags and the tags of the pod VM to the instance
+	for k, v := range provider.MergeTags(p.serviceConfig.Tags, spec) {
 		instanceTags = append(instanceTags, types.Tag{
 			Key:   aws.String(k),
 			Value: aws.String(v),
@@ -291,18 +294,10 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		}
 	}
 
-	// Add block device mappings to the instance to set the root volume size
-	if p.serviceConfig.RootVolumeSize > 0 {
-		input.BlockDeviceMappings = []types.BlockDeviceMapping{
-			{
-				DeviceName: aws.String(p.serviceConfig.RootDeviceName),
-				Ebs: &types.EbsBlockDevice{
-					// We have already ensured RootVolumeSize is not more than max int32 in NewProvider
-					// Hence we can safely convert it to int32
-					VolumeSize: aws.Int32(int32(p.serviceConfig.RootVolumeSize)),
-				},
-			},
-		}
+	// Add block device mappings to the instance to set the root volume and add data disks
+	input.BlockDeviceMappings, err = p.blockDeviceMappings(aws.ToString(input.ImageId), spec)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Printf("Creating instance %s for sandbox %s", instanceName, sandboxID)
@@ -693,6 +688,61 @@ func (p *awsProvider) deleteElasticIPforInstance(ctx context.Context, instanceID
 	return nil
 }
 
+// blockDeviceMappings returns the block device mappings of the root volume and the data disks of a pod VM
+func (p *awsProvider) blockDeviceMappings(imageID string, spec provider.InstanceTypeSpec) ([]types.BlockDeviceMapping, error) {
+	var mappings []types.BlockDeviceMapping
+
+	if spec.RootVolumeSize > 0 || spec.RootVolumeType != "" || spec.RootVolumeIOPS > 0 {
+		if imageID == "" {
+			imageID = p.serviceConfig.ImageID
+		}
+		if imageID == "" {
+			return nil, fmt.Errorf("the root volume of a pod VM can only be set with an image ID")
+		}
+		deviceName, deviceSize, err := p.getDeviceNameAndSize(imageID)
+		if err != nil {
+			return nil, err
+		}
+
+		ebs := &types.EbsBlockDevice{}
+		if size := provider.RootVolumeSize(spec, p.serviceConfig.RootVolumeSize, int(deviceSize)); size > 0 {
+			ebs.VolumeSize = aws.Int32(int32(min(size, maxInt32)))
+		}
+		if spec.RootVolumeType != "" {
+			ebs.VolumeType = types.VolumeType(spec.RootVolumeType)
+		}
+		if spec.RootVolumeIOPS > 0 {
+			ebs.Iops = aws.Int32(int32(min(spec.RootVolumeIOPS, maxInt32)))
+		}
+		mappings = append(mappings, types.BlockDeviceMapping{DeviceName: aws.String(deviceName), Ebs: ebs})
+	} else if p.serviceConfig.RootVolumeSize > 0 {
+		mappings = append(mappings, types.BlockDeviceMapping{
+			DeviceName: aws.String(p.serviceConfig.RootDeviceName),
+			Ebs: &types.EbsBlockDevice{
+				// We have already ensured RootVolumeSize is not more than max int32 in NewProvider
+				// Hence we can safely convert it to int32
+				VolumeSize: aws.Int32(int32(p.serviceConfig.RootVolumeSize)),
+			},
+		})
+	}
+
+	if len(spec.DataDisks) > len(dataDiskDeviceNames) {
+		return nil, fmt.Errorf("%d data disks requested, at most %d are supported", len(spec.DataDisks), len(dataDiskDeviceNames))
+	}
+	for i, disk := range spec.DataDisks {
+		ebs := &types.EbsBlockDevice{
+			VolumeSize:          aws.Int32(int32(min(disk.Size, maxInt32))),
+			DeleteOnTermination: aws.Bool(true),
+		}
+		if disk.Type != "" {
+			ebs.VolumeType = types.VolumeType(disk.Type)
+		}
+		mappings = append(mappings, types.BlockDeviceMapping{DeviceName: aws.String(dataDiskDeviceNames[i]), Ebs: ebs})
+	}
+
+	return mappings, nil
+}
+
 func (p *awsProvider) getDeviceNameAndSize(imageID string) (string, int32, error) {
 	// Add describe images input
 	describeImagesInput := &ec2.DescribeImagesInput{
@@ -719,7 +769,10 @@ func (p *awsProvider) getDeviceNameAndSize(imageID string) (string, int32, error
 	}
 
 	// Get the device size if it is set
-	deviceSize := describeImagesOutput.Images[0].BlockDeviceMappings[0].Ebs.VolumeSize
+	var deviceSize *int32
+	if mappings := describeImagesOutput.Images[0].BlockDeviceMappings; len(mappings) > 0 && mappings[0].Ebs != nil {
+		deviceSize = mappings[0].Ebs.VolumeSize
+	}
 
 	if deviceSize == nil {
 		logger.Printf("image %s device size not set", imageID)
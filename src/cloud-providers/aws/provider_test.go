@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"net/netip"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -257,7 +259,14 @@ func (m mockEC2Client) DescribeImages(ctx context.Context,
 	return &ec2.DescribeImagesOutput{
 		Images: []types.Image{
 			{
-				ImageId: &mockImageID,
+				ImageId:        &mockImageID,
+				RootDeviceName: aws.String("/dev/xvda"),
+				BlockDeviceMappings: []types.BlockDeviceMapping{
+					{
+						DeviceName: aws.String("/dev/xvda"),
+						Ebs:        &types.EbsBlockDevice{VolumeSize: aws.Int32(8)},
+					},
+				},
 			},
 		},
 	}, nil
@@ -544,6 +553,52 @@ func TestCreateInstance(t *testing.T) {
 	}
 }
 
+func TestBlockDeviceMappings(t *testing.T) {
+	p := &awsProvider{
+		ec2Client:     newMockEC2Client(),
+		serviceConfig: &Config{ImageID: "ami-1234567890abcdef0", RootDeviceName: "/dev/xvda", RootVolumeSize: 30},
+	}
+
+	// The configured root volume size is used without per-pod settings
+	mappings, err := p.blockDeviceMappings("", provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("blockDeviceMappings() error = %v", err)
+	}
+	if len(mappings) != 1 || aws.ToInt32(mappings[0].Ebs.VolumeSize) != 30 {
+		t.Errorf("blockDeviceMappings() = %v, want a 30 GiB root volume", mappings)
+	}
+
+	spec := provider.InstanceTypeSpec{
+		RootVolumeSize: 4,
+		RootVolumeType: "io2",
+		RootVolumeIOPS: 3000,
+		DataDisks:      []provider.DataDisk{{Size: 100}, {Size: 50, Type: "gp3"}},
+	}
+	mappings, err = p.blockDeviceMappings("", spec)
+	if err != nil {
+		t.Fatalf("blockDeviceMappings() error = %v", err)
+	}
+	if len(mappings) != 3 {
+		t.Fatalf("blockDeviceMappings() returned %d mappings, want 3", len(mappings))
+	}
+	root := mappings[0]
+	if aws.ToString(root.DeviceName) != "/dev/xvda" || aws.ToInt32(root.Ebs.VolumeSize) != 8 ||
+		root.Ebs.VolumeType != types.VolumeTypeIo2 || aws.ToInt32(root.Ebs.Iops) != 3000 {
+		t.Errorf("root volume = %+v, want an 8 GiB io2 volume with 3000 IOPS", root.Ebs)
+	}
+	if aws.ToString(mappings[1].DeviceName) != "/dev/sdf" || aws.ToInt32(mappings[1].Ebs.VolumeSize) != 100 || !aws.ToBool(mappings[1].Ebs.DeleteOnTermination) {
+		t.Errorf("first data disk = %+v, want a 100 GiB volume deleted on termination", mappings[1].Ebs)
+	}
+	if aws.ToString(mappings[2].DeviceName) != "/dev/sdg" || mappings[2].Ebs.VolumeType != types.VolumeTypeGp3 {
+		t.Errorf("second data disk = %+v, want a gp3 volume", mappings[2].Ebs)
+	}
+
+	_, err = p.blockDeviceMappings("", provider.InstanceTypeSpec{DataDisks: make([]provider.DataDisk, len(dataDiskDeviceNames)+1)})
+	if err == nil {
+		t.Errorf("blockDeviceMappings() expected an error for too many data disks")
+	}
+}
+
 func TestDeleteInstance(t *testing.T) {
 	type fields struct {
 		ec2Client     ec2Client
@@ -726,3 +781,50 @@ func TestConfigVerifier(t *testing.T) {
 		})
 	}
 }
+
+func TestFileCredentialsProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte("[default]\naws_access_key_id = AKID1\naws_secret_access_key = secret1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newFileCredentialsProvider(path, "")
+	if err != nil {
+		t.Fatalf("newFileCredentialsProvider() error = %v", err)
+	}
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if creds.AccessKeyID != "AKID1" || creds.SecretAccessKey != "secret1" || !creds.CanExpire {
+		t.Errorf("Retrieve() = %+v, want expiring AKID1 credentials", creds)
+	}
+
+	// Rotated credentials are read again
+	rotate := func(data string) {
+		t.Helper()
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotate("[default]\naws_access_key_id = AKID2\naws_secret_access_key = secret2\naws_session_token = token2\n")
+	creds, err = p.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKID2" || creds.SessionToken != "token2" {
+		t.Errorf("Retrieve() = %+v, %v, want AKID2 credentials", creds, err)
+	}
+
+	// The last valid credentials are kept when the rotated file is invalid
+	rotate("[default]\naws_access_key_id = AKID3\n")
+	creds, err = p.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKID2" {
+		t.Errorf("Retrieve() = %+v, %v, want AKID2 credentials", creds, err)
+	}
+
+	if _, err := newFileCredentialsProvider(path, "other"); err == nil {
+		t.Errorf("newFileCredentialsProvider() expected an error for a missing profile")
+	}
+}
@@ -40,6 +40,9 @@ type Config struct {
 	AccessKeyID          string
 	SecretKey            string
 	SessionToken         string
+	CredentialsFile      string
+	RoleARN              string
+	WebIdentityTokenFile string
 	Region               string
 	LoginProfile         string
 	LaunchTemplateName   string
@@ -4,16 +4,47 @@
 package azure
 
 import (
+	"context"
+	"strings"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
 func NewAzureClient(config Config) (azcore.TokenCredential, error) {
+	if config.ClientSecret != "" {
+		return azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, config.ClientSecret, nil)
+	}
+
+	if config.ClientSecretFile != "" {
+		logger.Printf("using client secret file %s", config.ClientSecretFile)
+		return newSecretFileCredential(config)
+	}
+
 	// Use workload identity if the client secret is empty.
-	if config.ClientSecret == "" {
-		logger.Printf("using workload identity")
-		return azidentity.NewWorkloadIdentityCredential(nil)
+	// The federated token file is read again each time a token is requested, so that rotated tokens are used.
+	logger.Printf("using workload identity")
+	return azidentity.NewWorkloadIdentityCredential(nil)
+}
+
+// secretFileCredential is a client secret credential with the secret read from a file, e.g. mounted
+// from a Secret. The credential is created again when the secret is rotated.
+type secretFileCredential struct {
+	credential *util.SecretFileValue[azcore.TokenCredential]
+}
+
+func newSecretFileCredential(config Config) (*secretFileCredential, error) {
+	credential, err := util.NewSecretFileValue(config.ClientSecretFile, func(secret []byte) (azcore.TokenCredential, error) {
+		return azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, strings.TrimSpace(string(secret)), nil)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &secretFileCredential{credential: credential}, nil
+}
 
-	return azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, config.ClientSecret, nil)
+func (c *secretFileCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return c.credential.Get().GetToken(ctx, options)
 }
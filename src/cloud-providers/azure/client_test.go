@@ -0,0 +1,41 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretFileCredential(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("secret1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newSecretFileCredential(Config{TenantID: "tenant", ClientID: "client", ClientSecretFile: path})
+	if err != nil {
+		t.Fatalf("newSecretFileCredential() error = %v", err)
+	}
+	first := c.credential.Get()
+	if same := c.credential.Get(); same != first {
+		t.Errorf("Get() created a new credential without a secret change")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("secret2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if rotated := c.credential.Get(); rotated == first {
+		t.Errorf("Get() = %v, want a new credential after a secret change", rotated)
+	}
+
+	if _, err := newSecretFileCredential(Config{ClientSecretFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Errorf("newSecretFileCredential() expected an error for a missing file")
+	}
+}
@@ -23,6 +23,7 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	// Flags with environment variable support
 	reg.StringWithEnv(&azurecfg.ClientID, "clientid", "", "AZURE_CLIENT_ID", "Client Id", provider.Secret())
 	reg.StringWithEnv(&azurecfg.ClientSecret, "secret", "", "AZURE_CLIENT_SECRET", "Client Secret", provider.Secret())
+	reg.StringWithEnv(&azurecfg.ClientSecretFile, "secret-file", "", "AZURE_CLIENT_SECRET_FILE", "Client Secret file, read again when it changes")
 	reg.StringWithEnv(&azurecfg.TenantID, "tenantid", "", "AZURE_TENANT_ID", "Tenant Id", provider.Secret())
 	reg.StringWithEnv(&azurecfg.SubscriptionID, "subscriptionid", "", "AZURE_SUBSCRIPTION_ID", "Subscription ID", provider.Required())
 	reg.StringWithEnv(&azurecfg.Region, "region", "", "AZURE_REGION", "Region", provider.Required())
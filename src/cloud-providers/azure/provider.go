@@ -18,6 +18,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
 	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
@@ -283,7 +284,18 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 		imageID = spec.Image
 	}
 
-	vmParameters, err := p.getVMParameters(instanceSize, diskName, cloudConfigData, sshBytes, instanceName, nicName, imageID)
+	// Azure rejects OS disks smaller than the image, so look up the image size when a size is configured or requested.
+	// The size is only used to raise the requested size, so an image that cannot be looked up does not fail the VM creation.
+	imageSizeGB := 0
+	if spec.RootVolumeSize > 0 || p.serviceConfig.RootVolumeSize > 0 {
+		imageSizeGB, err = p.getImageSizeGB(ctx, imageID)
+		if err != nil {
+			logger.Printf("Failed to get the size of image %s, using the requested root volume size: %v", imageID, err)
+			imageSizeGB = 0
+		}
+	}
+
+	vmParameters, err := p.getVMParameters(instanceSize, diskName, cloudConfigData, sshBytes, instanceName, nicName, imageID, imageSizeGB, spec)
 	if err != nil {
 		return nil, err
 	}
@@ -412,17 +424,117 @@ func (p *azureProvider) updateInstanceSizeSpecList() error {
 	return nil
 }
 
-func (p *azureProvider) getResourceTags() map[string]*string {
+func (p *azureProvider) getResourceTags(spec provider.InstanceTypeSpec) map[string]*string {
 	tags := map[string]*string{}
 
-	// Add custom tags from serviceConfig.Tags
-	for k, v := range p.serviceConfig.Tags {
+	// Add custom tags from serviceConfig.Tags and the tags of the pod VM
+	for k, v := range provider.MergeTags(p.serviceConfig.Tags, spec) {
 		tags[k] = to.Ptr(v)
 	}
 	return tags
 }
 
-func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName, nicName string, imageID string) (*armcompute.VirtualMachine, error) {
+// imageRef identifies an image of a pod VM
+type imageRef struct {
+	kind          string
+	resourceGroup string
+	gallery       string
+	image         string
+	version       string
+}
+
+const (
+	managedImage          = "managed"
+	galleryImageVersion   = "gallery"
+	communityImageVersion = "community"
+)
+
+// parseImageID parses the ID of a managed image, of an image version of a gallery, or of an image
+// version of a community gallery
+func parseImageID(imageID string) (*imageRef, error) {
+	if strings.HasPrefix(imageID, "/CommunityGalleries/") {
+		// /CommunityGalleries/{gallery}/Images/{image}/Versions/{version}
+		parts := strings.Split(strings.TrimPrefix(imageID, "/"), "/")
+		if len(parts) != 6 || !strings.EqualFold(parts[2], "Images") || !strings.EqualFold(parts[4], "Versions") {
+			return nil, fmt.Errorf("invalid community gallery image ID %q", imageID)
+		}
+		return &imageRef{kind: communityImageVersion, gallery: parts[1], image: parts[3], version: parts[5]}, nil
+	}
+
+	id, err := arm.ParseResourceID(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image ID %q: %w", imageID, err)
+	}
+	switch {
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/images"):
+		return &imageRef{kind: managedImage, resourceGroup: id.ResourceGroupName, image: id.Name}, nil
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/galleries/images/versions"):
+		return &imageRef{
+			kind:          galleryImageVersion,
+			resourceGroup: id.ResourceGroupName,
+			gallery:       id.Parent.Parent.Name,
+			image:         id.Parent.Name,
+			version:       id.Name,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image resource type %s of image ID %q", id.ResourceType, imageID)
+	}
+}
+
+// getImageSizeGB returns the OS disk size of an image in GB, or 0 if the image does not record it
+func (p *azureProvider) getImageSizeGB(ctx context.Context, imageID string) (int, error) {
+	ref, err := parseImageID(imageID)
+	if err != nil {
+		return 0, err
+	}
+
+	var size *int32
+	switch ref.kind {
+	case managedImage:
+		client, err := armcompute.NewImagesClient(p.serviceConfig.SubscriptionID, p.azureClient, nil)
+		if err != nil {
+			return 0, fmt.Errorf("creating images client: %w", err)
+		}
+		resp, err := client.Get(ctx, ref.resourceGroup, ref.image, nil)
+		if err != nil {
+			return 0, fmt.Errorf("getting image %s: %w", imageID, err)
+		}
+		if props := resp.Properties; props != nil && props.StorageProfile != nil && props.StorageProfile.OSDisk != nil {
+			size = props.StorageProfile.OSDisk.DiskSizeGB
+		}
+	case galleryImageVersion:
+		client, err := armcompute.NewGalleryImageVersionsClient(p.serviceConfig.SubscriptionID, p.azureClient, nil)
+		if err != nil {
+			return 0, fmt.Errorf("creating gallery image versions client: %w", err)
+		}
+		resp, err := client.Get(ctx, ref.resourceGroup, ref.gallery, ref.image, ref.version, nil)
+		if err != nil {
+			return 0, fmt.Errorf("getting image version %s: %w", imageID, err)
+		}
+		if props := resp.Properties; props != nil && props.StorageProfile != nil && props.StorageProfile.OSDiskImage != nil {
+			size = props.StorageProfile.OSDiskImage.SizeInGB
+		}
+	case communityImageVersion:
+		client, err := armcompute.NewCommunityGalleryImageVersionsClient(p.serviceConfig.SubscriptionID, p.azureClient, nil)
+		if err != nil {
+			return 0, fmt.Errorf("creating community gallery image versions client: %w", err)
+		}
+		resp, err := client.Get(ctx, p.serviceConfig.Region, ref.gallery, ref.image, ref.version, nil)
+		if err != nil {
+			return 0, fmt.Errorf("getting image version %s: %w", imageID, err)
+		}
+		if props := resp.Properties; props != nil && props.StorageProfile != nil && props.StorageProfile.OSDiskImage != nil {
+			size = props.StorageProfile.OSDiskImage.DiskSizeGB
+		}
+	}
+
+	if size == nil {
+		return 0, nil
+	}
+	return int(*size), nil
+}
+
+func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName, nicName string, imageID string, imageSizeGB int, spec provider.InstanceTypeSpec) (*armcompute.VirtualMachine, error) {
 	userDataB64 := base64.StdEncoding.EncodeToString([]byte(cloudConfig))
 
 	// Azure limits the base64 encrypted userData to 64KB.
@@ -476,10 +588,35 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 		ManagedDisk:  managedDiskParams,
 	}
 
-	// Set disk size if RootVolumeSize is configured
-	if p.serviceConfig.RootVolumeSize > 0 {
-		osDisk.DiskSizeGB = to.Ptr(int32(p.serviceConfig.RootVolumeSize))
-		logger.Printf("Setting root volume size to %d GB", p.serviceConfig.RootVolumeSize)
+	// Set disk size if RootVolumeSize is configured or requested for the pod. Azure rejects
+	// sizes smaller than the image.
+	if size := provider.RootVolumeSize(spec, p.serviceConfig.RootVolumeSize, imageSizeGB); size > 0 {
+		osDisk.DiskSizeGB = to.Ptr(int32(size))
+		logger.Printf("Setting root volume size to %d GB", size)
+	}
+	if spec.RootVolumeType != "" {
+		managedDiskParams.StorageAccountType = to.Ptr(armcompute.StorageAccountTypes(spec.RootVolumeType))
+		logger.Printf("Setting root volume type to %s", spec.RootVolumeType)
+	}
+	if spec.RootVolumeIOPS > 0 {
+		logger.Printf("Ignoring root volume IOPS %d, OS disks have the IOPS of their size and type", spec.RootVolumeIOPS)
+	}
+
+	var dataDisks []*armcompute.DataDisk
+	for i, disk := range spec.DataDisks {
+		dataDisk := &armcompute.DataDisk{
+			Name:         to.Ptr(fmt.Sprintf("%s-data-%d", diskName, i)),
+			Lun:          to.Ptr(int32(i)),
+			CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesEmpty),
+			DiskSizeGB:   to.Ptr(int32(disk.Size)),
+			DeleteOption: to.Ptr(armcompute.DiskDeleteOptionTypesDelete),
+		}
+		if disk.Type != "" {
+			dataDisk.ManagedDisk = &armcompute.ManagedDiskParameters{
+				StorageAccountType: to.Ptr(armcompute.StorageAccountTypes(disk.Type)),
+			}
+		}
+		dataDisks = append(dataDisks, dataDisk)
 	}
 
 	vmParameters := armcompute.VirtualMachine{
@@ -491,6 +628,7 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 			StorageProfile: &armcompute.StorageProfile{
 				ImageReference: imgRef,
 				OSDisk:         osDisk,
+				DataDisks:      dataDisks,
 			},
 			OSProfile: &armcompute.OSProfile{
 				AdminUsername: to.Ptr(p.serviceConfig.SSHUserName),
@@ -518,7 +656,7 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 			},
 			UserData: to.Ptr(userDataB64),
 		},
-		Tags: p.getResourceTags(),
+		Tags: p.getResourceTags(spec),
 	}
 
 	return &vmParameters, nil
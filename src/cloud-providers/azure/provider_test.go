@@ -0,0 +1,61 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseImageID(t *testing.T) {
+	tests := []struct {
+		name    string
+		imageID string
+		want    *imageRef
+		wantErr bool
+	}{
+		{
+			name:    "managed image",
+			imageID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/podvm",
+			want:    &imageRef{kind: managedImage, resourceGroup: "rg", image: "podvm"},
+		},
+		{
+			name:    "gallery image version",
+			imageID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/podvm/versions/1.0.0",
+			want:    &imageRef{kind: galleryImageVersion, resourceGroup: "rg", gallery: "gallery", image: "podvm", version: "1.0.0"},
+		},
+		{
+			name:    "community gallery image version",
+			imageID: "/CommunityGalleries/cococommunity-42d8482d/Images/peerpod-podvm-fedora/Versions/0.8.0",
+			want:    &imageRef{kind: communityImageVersion, gallery: "cococommunity-42d8482d", image: "peerpod-podvm-fedora", version: "0.8.0"},
+		},
+		{
+			name:    "incomplete community gallery image ID",
+			imageID: "/CommunityGalleries/cococommunity-42d8482d/Images/peerpod-podvm-fedora",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported resource type",
+			imageID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk",
+			wantErr: true,
+		},
+		{
+			name:    "invalid ID",
+			imageID: "podvm",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImageID(tt.imageID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImageID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseImageID() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
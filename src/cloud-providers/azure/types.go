@@ -29,6 +29,7 @@ type Config struct {
 	SubscriptionID       string
 	ClientID             string
 	ClientSecret         string
+	ClientSecretFile     string
 	TenantID             string
 	ResourceGroupName    string
 	Zone                 string
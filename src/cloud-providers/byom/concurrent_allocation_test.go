@@ -290,7 +290,7 @@ func TestConcurrentAllocationAndDeallocation(t *testing.T) {
 		t.Fatalf("Failed to list final allocated IPs: %v", err)
 	}
 
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Fatalf("Failed to get pool status: %v", err)
 	}
@@ -112,7 +112,7 @@ func (cm *ConfigMapVMPoolManager) marshalStateForConfigMap(state *IPAllocationSt
 
 // selectIPIndex uses hash-based distribution to select an IP index from available IPs
 // This reduces conflicts when multiple CAA instances try to allocate simultaneously
-func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocationID string) int {
+func selectIPIndex(availableIPs []string, allocationID string) int {
 	if len(availableIPs) <= 1 {
 		return 0
 	}
@@ -130,7 +130,7 @@ func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocatio
 }
 
 // checkVMReadiness verifies that a VM is ready by checking network connectivity
-func (cm *ConfigMapVMPoolManager) checkVMReadiness(ctx context.Context, ipStr string) error {
+func checkVMReadiness(ctx context.Context, ipStr string) error {
 	logger.Printf("Checking VM readiness for IP %s", ipStr)
 
 	// Use retry package for consistent retry behavior
@@ -192,14 +192,14 @@ func (cm *ConfigMapVMPoolManager) doAllocateIP(ctx context.Context, allocationID
 	}
 
 	// IP selection: use hash-based distribution to reduce conflicts
-	selectedIndex := cm.selectIPIndex(state.AvailableIPs, allocationID)
+	selectedIndex := selectIPIndex(state.AvailableIPs, allocationID)
 	ipStr := state.AvailableIPs[selectedIndex]
 	logger.Printf("Selected IP %s (index %d of %d) for allocation %s",
 		ipStr, selectedIndex, len(state.AvailableIPs), allocationID)
 
 	// Verify VM is ready before committing to allocation (skip in test mode)
 	if !cm.config.SkipVMReadiness {
-		if err := cm.checkVMReadiness(ctx, ipStr); err != nil {
+		if err := checkVMReadiness(ctx, ipStr); err != nil {
 			logger.Printf("VM %s failed readiness check. Can't be allocated: %v", ipStr, err)
 			return netip.Addr{}, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
 		}
@@ -339,20 +339,21 @@ func (cm *ConfigMapVMPoolManager) GetAllocationIDfromIP(ctx context.Context, ip
 }
 
 // GetPoolStatus returns current pool statistics
-func (cm *ConfigMapVMPoolManager) GetPoolStatus(ctx context.Context) (total, available, inUse int, err error) {
+func (cm *ConfigMapVMPoolManager) GetPoolStatus(ctx context.Context) (total, available, inUse, quarantined int, err error) {
 	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
 	defer cancel()
 
 	state, _, err := cm.getCurrentState(ctx)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+		return 0, 0, 0, 0, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
 	}
 
 	available = len(state.AvailableIPs)
 	inUse = len(state.AllocatedIPs)
-	total = available + inUse
+	quarantined = len(state.QuarantinedIPs)
+	total = available + inUse + quarantined
 
-	return total, available, inUse, nil
+	return total, available, inUse, quarantined, nil
 }
 
 // ListAllocatedIPs returns all currently allocated IPs
@@ -374,6 +375,160 @@ func (cm *ConfigMapVMPoolManager) ListAllocatedIPs(ctx context.Context) (map[str
 	return result, nil
 }
 
+// ListAvailableIPs returns all IPs that can currently be allocated
+func (cm *ConfigMapVMPoolManager) ListAvailableIPs(ctx context.Context) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	state, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	result := make([]netip.Addr, 0, len(state.AvailableIPs))
+	for _, ipStr := range state.AvailableIPs {
+		ip, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidIPAddress, ipStr, err)
+		}
+		result = append(result, ip)
+	}
+
+	return result, nil
+}
+
+// QuarantineIP moves an available IP to quarantine
+func (cm *ConfigMapVMPoolManager) QuarantineIP(ctx context.Context, ip netip.Addr, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	state, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	ipStr := ip.String()
+	index := -1
+	for i, availableIP := range state.AvailableIPs {
+		if availableIP == ipStr {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		// Allocated by another CAA instance in the meantime, or already quarantined
+		logger.Printf("IP %s is not available, not quarantining it", ipStr)
+		return nil
+	}
+
+	state.AvailableIPs = append(state.AvailableIPs[:index], state.AvailableIPs[index+1:]...)
+	addQuarantinedIP(state, ipStr, reason)
+
+	if err := cm.updateState(ctx, state); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+
+	logger.Printf("Quarantined IP %s: %s", ipStr, reason)
+	return nil
+}
+
+// DeallocateIPToQuarantine releases an allocation and quarantines its IP in a single update
+func (cm *ConfigMapVMPoolManager) DeallocateIPToQuarantine(ctx context.Context, allocationID string, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	state, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	allocation, exists := state.AllocatedIPs[allocationID]
+	if !exists {
+		logger.Printf("allocation ID %s not found", allocationID)
+		return nil
+	}
+
+	delete(state.AllocatedIPs, allocationID)
+	addQuarantinedIP(state, allocation.IP, reason)
+
+	if err := cm.updateState(ctx, state); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+
+	logger.Printf("Deallocated IP %s to quarantine: %s", allocation.IP, reason)
+	return nil
+}
+
+// ReadmitIP returns a quarantined IP to the available pool
+func (cm *ConfigMapVMPoolManager) ReadmitIP(ctx context.Context, ip netip.Addr) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	state, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	ipStr := ip.String()
+	if _, exists := state.QuarantinedIPs[ipStr]; !exists {
+		logger.Printf("IP %s is not quarantined, nothing to readmit", ipStr)
+		return nil
+	}
+
+	delete(state.QuarantinedIPs, ipStr)
+	state.AvailableIPs = append(state.AvailableIPs, ipStr)
+	state.LastUpdated = metav1.Now()
+	state.Version = state.Version + 1
+
+	if err := cm.updateState(ctx, state); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+
+	logger.Printf("Readmitted IP %s to the pool", ipStr)
+	return nil
+}
+
+// ListQuarantinedIPs returns all quarantined IPs keyed by IP
+func (cm *ConfigMapVMPoolManager) ListQuarantinedIPs(ctx context.Context) (map[string]QuarantinedIP, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	state, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	result := make(map[string]QuarantinedIP, len(state.QuarantinedIPs))
+	for ip, quarantined := range state.QuarantinedIPs {
+		result[ip] = quarantined
+	}
+
+	return result, nil
+}
+
+// addQuarantinedIP records ip as quarantined and bumps the state version
+func addQuarantinedIP(state *IPAllocationState, ip, reason string) {
+	if state.QuarantinedIPs == nil {
+		state.QuarantinedIPs = make(map[string]QuarantinedIP)
+	}
+	state.QuarantinedIPs[ip] = QuarantinedIP{
+		IP:            ip,
+		Reason:        reason,
+		QuarantinedAt: metav1.Now(),
+	}
+	state.LastUpdated = metav1.Now()
+	state.Version = state.Version + 1
+}
+
 // getCurrentState retrieves the current allocation state from ConfigMap with ResourceVersion
 func (cm *ConfigMapVMPoolManager) getCurrentState(ctx context.Context) (*IPAllocationState, string, error) {
 	configMap, err := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Get(
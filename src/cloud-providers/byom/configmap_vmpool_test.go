@@ -230,7 +230,7 @@ func TestConfigMapVMPoolManagerDeallocateIP(t *testing.T) {
 	}
 
 	// Verify state after deallocation
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
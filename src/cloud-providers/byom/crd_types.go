@@ -0,0 +1,135 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The PeerPodVMPool and PeerPodVM custom resources are managed through the
+// dynamic client so that the cloud-providers module does not need to depend
+// on generated clientsets. The CRD manifests are shipped with the peerpods
+// helm chart.
+
+const (
+	// vmPoolGroup is the API group of the BYOM pool custom resources
+	vmPoolGroup = "confidentialcontainers.org"
+
+	// vmPoolVersion is the API version of the BYOM pool custom resources
+	vmPoolVersion = "v1alpha1"
+
+	// vmPoolLabel is set on every PeerPodVM and holds the name of its pool
+	vmPoolLabel = "confidentialcontainers.org/vm-pool"
+)
+
+var (
+	// peerPodVMPoolGVR identifies the PeerPodVMPool resource
+	peerPodVMPoolGVR = schema.GroupVersionResource{Group: vmPoolGroup, Version: vmPoolVersion, Resource: "peerpodvmpools"}
+
+	// peerPodVMGVR identifies the PeerPodVM resource
+	peerPodVMGVR = schema.GroupVersionResource{Group: vmPoolGroup, Version: vmPoolVersion, Resource: "peerpodvms"}
+)
+
+// PeerPodVMPhase is the lifecycle phase of a pool VM
+type PeerPodVMPhase string
+
+const (
+	// VMPhaseAvailable means the VM can be allocated to a new peer pod
+	VMPhaseAvailable PeerPodVMPhase = "Available"
+
+	// VMPhaseAllocated means the VM is running a peer pod
+	VMPhaseAllocated PeerPodVMPhase = "Allocated"
+
+	// VMPhaseDraining means the VM is cordoned and won't receive new allocations
+	VMPhaseDraining PeerPodVMPhase = "Draining"
+
+	// VMPhaseUnhealthy means the VM failed a check and is kept out of the pool
+	VMPhaseUnhealthy PeerPodVMPhase = "Unhealthy"
+)
+
+// PeerPodVMPoolSpec defines the desired state of a PeerPodVMPool
+type PeerPodVMPoolSpec struct {
+	// Cordoned stops new allocations from every VM of the pool
+	Cordoned bool `json:"cordoned,omitempty"`
+}
+
+// PeerPodVMPoolStatus reports aggregated statistics of a PeerPodVMPool
+type PeerPodVMPoolStatus struct {
+	Total       int         `json:"total"`
+	Available   int         `json:"available"`
+	Allocated   int         `json:"allocated"`
+	Draining    int         `json:"draining"`
+	Unhealthy   int         `json:"unhealthy"`
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// PeerPodVMPool groups the PeerPodVM objects that a set of CAA instances allocate from
+type PeerPodVMPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PeerPodVMPoolSpec   `json:"spec,omitempty"`
+	Status PeerPodVMPoolStatus `json:"status,omitempty"`
+}
+
+// PeerPodVMSpec defines a pre-created VM that belongs to a pool
+type PeerPodVMSpec struct {
+	// PoolName is the name of the PeerPodVMPool this VM belongs to
+	PoolName string `json:"poolName"`
+
+	// IP is the address CAA uses to reach the VM
+	IP string `json:"ip"`
+
+	// Cordoned stops new allocations; an existing allocation is kept until released
+	Cordoned bool `json:"cordoned,omitempty"`
+}
+
+// PeerPodVMStatus is the allocation state of a pool VM, owned by CAA
+type PeerPodVMStatus struct {
+	Phase              PeerPodVMPhase `json:"phase,omitempty"`
+	AllocationID       string         `json:"allocationID,omitempty"`
+	PodName            string         `json:"podName,omitempty"`
+	NodeName           string         `json:"nodeName,omitempty"`
+	AllocatedAt        *metav1.Time   `json:"allocatedAt,omitempty"`
+	Message            string         `json:"message,omitempty"`
+	LastTransitionTime metav1.Time    `json:"lastTransitionTime,omitempty"`
+}
+
+// PeerPodVM represents a single pre-created VM of a BYOM pool
+type PeerPodVM struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PeerPodVMSpec   `json:"spec,omitempty"`
+	Status PeerPodVMStatus `json:"status,omitempty"`
+}
+
+// effectivePhase returns the phase used for allocation decisions.
+// VMs created by an administrator start without a phase and are treated as
+// available, and cordoning only takes effect once the VM is not allocated.
+func (vm *PeerPodVM) effectivePhase(poolCordoned bool) PeerPodVMPhase {
+	switch vm.Status.Phase {
+	case VMPhaseAllocated, VMPhaseUnhealthy:
+		return vm.Status.Phase
+	}
+	if vm.Spec.Cordoned || poolCordoned {
+		return VMPhaseDraining
+	}
+	return VMPhaseAvailable
+}
+
+// toIPAllocation converts an allocated VM into the IPAllocation used by GlobalVMPoolManager
+func (vm *PeerPodVM) toIPAllocation() IPAllocation {
+	allocation := IPAllocation{
+		AllocationID: vm.Status.AllocationID,
+		IP:           vm.Spec.IP,
+		NodeName:     vm.Status.NodeName,
+		PodName:      vm.Status.PodName,
+	}
+	if vm.Status.AllocatedAt != nil {
+		allocation.AllocatedAt = *vm.Status.AllocatedAt
+	}
+	return allocation
+}
@@ -0,0 +1,748 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// CRDVMPoolManager implements GlobalVMPoolManager using PeerPodVMPool and PeerPodVM custom resources.
+// Every VM is a separate object, so allocations only conflict when two CAA instances pick the same VM,
+// and VMs can be added, removed or cordoned at runtime without restarting CAA.
+type CRDVMPoolManager struct {
+	client dynamic.Interface
+	config *GlobalVMPoolConfig
+	mutex  sync.Mutex
+}
+
+// NewCRDVMPoolManager creates a new CRD-based VM pool manager
+func NewCRDVMPoolManager(client dynamic.Interface, config *GlobalVMPoolConfig) (GlobalVMPoolManager, error) {
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+
+	if config.PoolName == "" {
+		return nil, ErrEmptyPoolName
+	}
+
+	// PoolIPs are optional here, they are only used to seed the pool
+	for _, ipStr := range config.PoolIPs {
+		if _, err := netip.ParseAddr(ipStr); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidIPAddress, ipStr, err)
+		}
+	}
+
+	manager := &CRDVMPoolManager{
+		client: client,
+		config: config,
+	}
+
+	return manager, nil
+}
+
+// vmObjectName returns the PeerPodVM object name used when seeding the pool from an IP address
+func vmObjectName(poolName, ip string) string {
+	return fmt.Sprintf("%s-%s", poolName, strings.NewReplacer(".", "-", ":", "-").Replace(ip))
+}
+
+// AllocateIP allocates an IP from the global pool
+func (cm *CRDVMPoolManager) AllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	allocatedIP, err := cm.doAllocateIP(ctx, allocationID, podName)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	cm.syncPoolStatus(ctx)
+
+	logger.Printf("Successfully allocated IP %s to allocation ID %s", allocatedIP.String(), allocationID)
+	return allocatedIP, nil
+}
+
+// doAllocateIP picks an allocatable VM and claims it with a resourceVersion-guarded status update.
+// When another CAA instance claims the same VM first, the update conflicts and the
+// selection is done again on a fresh list.
+func (cm *CRDVMPoolManager) doAllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	nodeName, err := getCurrentNodeName()
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %w", ErrNodeNameDetection, err)
+	}
+
+	var allocated string
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		poolCordoned, err := cm.isPoolCordoned(ctx)
+		if err != nil {
+			return err
+		}
+
+		vms, err := cm.listVMs(ctx)
+		if err != nil {
+			return err
+		}
+
+		candidates := make(map[string]*PeerPodVM)
+		candidateIPs := []string{}
+		for _, vm := range vms {
+			// Check if already allocated
+			if vm.Status.Phase == VMPhaseAllocated && vm.Status.AllocationID == allocationID {
+				logger.Printf("IP %s already allocated to allocation ID %s", vm.Spec.IP, allocationID)
+				allocated = vm.Spec.IP
+				return nil
+			}
+			if vm.effectivePhase(poolCordoned) == VMPhaseAvailable {
+				candidates[vm.Spec.IP] = vm
+				candidateIPs = append(candidateIPs, vm.Spec.IP)
+			}
+		}
+
+		if len(candidateIPs) == 0 {
+			return ErrNoAvailableIPs
+		}
+
+		// Sort so that the hash-based selection is stable across CAA instances
+		sort.Strings(candidateIPs)
+		selectedIndex := selectIPIndex(candidateIPs, allocationID)
+		ipStr := candidateIPs[selectedIndex]
+		vm := candidates[ipStr]
+		logger.Printf("Selected VM %s with IP %s (index %d of %d) for allocation %s",
+			vm.Name, ipStr, selectedIndex, len(candidateIPs), allocationID)
+
+		// Verify VM is ready before committing to allocation (skip in test mode)
+		if !cm.config.SkipVMReadiness {
+			if err := checkVMReadiness(ctx, ipStr); err != nil {
+				logger.Printf("VM %s failed readiness check. Can't be allocated: %v", ipStr, err)
+				return fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
+			}
+		} else {
+			logger.Printf("Skipping VM readiness check for IP %s (test mode)", ipStr)
+		}
+
+		now := metav1.Now()
+		vm.Status = PeerPodVMStatus{
+			Phase:              VMPhaseAllocated,
+			AllocationID:       allocationID,
+			PodName:            podName,
+			NodeName:           nodeName,
+			AllocatedAt:        &now,
+			LastTransitionTime: now,
+		}
+
+		// The update carries the resourceVersion of the listed object, so the API server
+		// rejects it with a conflict if the VM was modified in the meantime.
+		if err := cm.updateVMStatus(ctx, vm); err != nil {
+			return err
+		}
+
+		allocated = ipStr
+		return nil
+	})
+	if err != nil {
+		if errors.IsConflict(err) {
+			return netip.Addr{}, fmt.Errorf("%w: %w", ErrAllocationRetryExhausted, err)
+		}
+		return netip.Addr{}, err
+	}
+
+	ip, err := netip.ParseAddr(allocated)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, allocated, err)
+	}
+
+	logger.Printf("Successfully allocated IP %s to allocation %s on node %s",
+		ip.String(), allocationID, nodeName)
+
+	return ip, nil
+}
+
+// DeallocateIP returns an IP to the global pool by allocation ID
+func (cm *CRDVMPoolManager) DeallocateIP(ctx context.Context, allocationID string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	if err := cm.doDeallocateIP(ctx, allocationID); err != nil {
+		return err
+	}
+
+	cm.syncPoolStatus(ctx)
+
+	logger.Printf("Successfully deallocated IP for allocation ID %s", allocationID)
+	return nil
+}
+
+// doDeallocateIP releases the VM holding allocationID. Cordoned VMs move to
+// Draining instead of Available so that they are not handed out again.
+func (cm *CRDVMPoolManager) doDeallocateIP(ctx context.Context, allocationID string) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		vm, err := cm.findVMByAllocationID(ctx, allocationID)
+		if err != nil {
+			return err
+		}
+		if vm == nil {
+			logger.Printf("allocation ID %s not found", allocationID)
+			return nil
+		}
+
+		phase := VMPhaseAvailable
+		if vm.Spec.Cordoned {
+			phase = VMPhaseDraining
+		}
+		vm.Status = PeerPodVMStatus{
+			Phase:              phase,
+			LastTransitionTime: metav1.Now(),
+		}
+
+		if err := cm.updateVMStatus(ctx, vm); err != nil {
+			return err
+		}
+
+		logger.Printf("Successfully deallocated IP %s (VM %s is now %s)", vm.Spec.IP, vm.Name, phase)
+		return nil
+	})
+	if err != nil {
+		if errors.IsConflict(err) {
+			return fmt.Errorf("%w: %w", ErrDeallocationRetryExhausted, err)
+		}
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+
+	return nil
+}
+
+// GetIPfromAllocationID returns the IP allocated to a specific allocation ID
+func (cm *CRDVMPoolManager) GetIPfromAllocationID(ctx context.Context, allocationID string) (netip.Addr, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	vm, err := cm.findVMByAllocationID(ctx, allocationID)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+	if vm == nil {
+		return netip.Addr{}, false, nil
+	}
+
+	ip, err := netip.ParseAddr(vm.Spec.IP)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, vm.Spec.IP, err)
+	}
+
+	return ip, true, nil
+}
+
+// GetAllocationIDfromIP returns the allocation ID for a given IP address
+func (cm *CRDVMPoolManager) GetAllocationIDfromIP(ctx context.Context, ip netip.Addr) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	ipStr := ip.String()
+	for _, vm := range vms {
+		if vm.Spec.IP == ipStr && vm.Status.Phase == VMPhaseAllocated {
+			return vm.Status.AllocationID, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// GetPoolStatus returns current pool statistics. Unhealthy VMs are reported as quarantined,
+// draining VMs are counted in total but neither available, in use nor quarantined.
+func (cm *CRDVMPoolManager) GetPoolStatus(ctx context.Context) (total, available, inUse, quarantined int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	status, err := cm.computePoolStatus(ctx)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	return status.Total, status.Available, status.Allocated, status.Unhealthy, nil
+}
+
+// ListAllocatedIPs returns all currently allocated IPs
+func (cm *CRDVMPoolManager) ListAllocatedIPs(ctx context.Context) (map[string]IPAllocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	result := make(map[string]IPAllocation)
+	for _, vm := range vms {
+		if vm.Status.Phase == VMPhaseAllocated {
+			result[vm.Status.AllocationID] = vm.toIPAllocation()
+		}
+	}
+
+	return result, nil
+}
+
+// ListAvailableIPs returns all IPs that can currently be allocated
+func (cm *CRDVMPoolManager) ListAvailableIPs(ctx context.Context) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	poolCordoned, err := cm.isPoolCordoned(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	result := []netip.Addr{}
+	for _, vm := range vms {
+		if vm.effectivePhase(poolCordoned) == VMPhaseAvailable {
+			// listVMs already dropped VMs with invalid IPs
+			result = append(result, netip.MustParseAddr(vm.Spec.IP))
+		}
+	}
+
+	return result, nil
+}
+
+// QuarantineIP marks an available VM as Unhealthy
+func (cm *CRDVMPoolManager) QuarantineIP(ctx context.Context, ip netip.Addr, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	err := cm.transitionVM(ctx, func(vm *PeerPodVM) bool {
+		return vm.Spec.IP == ip.String()
+	}, func(vm *PeerPodVM) bool {
+		if vm.Status.Phase == VMPhaseAllocated || vm.Status.Phase == VMPhaseUnhealthy {
+			logger.Printf("VM %s is %s, not quarantining it", vm.Name, vm.Status.Phase)
+			return false
+		}
+		vm.Status = PeerPodVMStatus{
+			Phase:              VMPhaseUnhealthy,
+			Message:            reason,
+			LastTransitionTime: metav1.Now(),
+		}
+		logger.Printf("Quarantined VM %s with IP %s: %s", vm.Name, vm.Spec.IP, reason)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	cm.syncPoolStatus(ctx)
+	return nil
+}
+
+// DeallocateIPToQuarantine releases an allocation and marks its VM as Unhealthy in a single update
+func (cm *CRDVMPoolManager) DeallocateIPToQuarantine(ctx context.Context, allocationID string, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	err := cm.transitionVM(ctx, func(vm *PeerPodVM) bool {
+		return vm.Status.Phase == VMPhaseAllocated && vm.Status.AllocationID == allocationID
+	}, func(vm *PeerPodVM) bool {
+		vm.Status = PeerPodVMStatus{
+			Phase:              VMPhaseUnhealthy,
+			Message:            reason,
+			LastTransitionTime: metav1.Now(),
+		}
+		logger.Printf("Deallocated VM %s with IP %s to quarantine: %s", vm.Name, vm.Spec.IP, reason)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	cm.syncPoolStatus(ctx)
+	return nil
+}
+
+// ReadmitIP returns an Unhealthy VM to the pool. Cordoned VMs become Draining.
+func (cm *CRDVMPoolManager) ReadmitIP(ctx context.Context, ip netip.Addr) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	err := cm.transitionVM(ctx, func(vm *PeerPodVM) bool {
+		return vm.Spec.IP == ip.String()
+	}, func(vm *PeerPodVM) bool {
+		if vm.Status.Phase != VMPhaseUnhealthy {
+			logger.Printf("VM %s is not quarantined, nothing to readmit", vm.Name)
+			return false
+		}
+		phase := VMPhaseAvailable
+		if vm.Spec.Cordoned {
+			phase = VMPhaseDraining
+		}
+		vm.Status = PeerPodVMStatus{
+			Phase:              phase,
+			LastTransitionTime: metav1.Now(),
+		}
+		logger.Printf("Readmitted VM %s with IP %s to the pool", vm.Name, vm.Spec.IP)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	cm.syncPoolStatus(ctx)
+	return nil
+}
+
+// ListQuarantinedIPs returns all Unhealthy VMs keyed by IP
+func (cm *CRDVMPoolManager) ListQuarantinedIPs(ctx context.Context) (map[string]QuarantinedIP, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	result := make(map[string]QuarantinedIP)
+	for _, vm := range vms {
+		if vm.Status.Phase == VMPhaseUnhealthy {
+			result[vm.Spec.IP] = QuarantinedIP{
+				IP:            vm.Spec.IP,
+				Reason:        vm.Status.Message,
+				QuarantinedAt: vm.Status.LastTransitionTime,
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// transitionVM applies update to the first VM matching match and writes its status,
+// retrying on conflicts. update returns false when no change is needed.
+func (cm *CRDVMPoolManager) transitionVM(ctx context.Context, match func(*PeerPodVM) bool, update func(*PeerPodVM) bool) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		vms, err := cm.listVMs(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, vm := range vms {
+			if !match(vm) {
+				continue
+			}
+			if !update(vm) {
+				return nil
+			}
+			return cm.updateVMStatus(ctx, vm)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+	return nil
+}
+
+// RecoverState makes sure the PeerPodVMPool exists and seeds it with a PeerPodVM
+// for every configured pool IP that is not yet part of the pool.
+// VMs added to the pool out of band are kept, and allocations are never released here,
+// cleanup of stale allocations is left to the peerpod controller.
+func (cm *CRDVMPoolManager) RecoverState(ctx context.Context, vmCleanupFunc func(context.Context, netip.Addr) error) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	logger.Printf("Starting state recovery for VM pool %s...", cm.config.PoolName)
+
+	currentNode, err := getCurrentNodeName()
+	if err != nil {
+		return fmt.Errorf("failed to get current node name: %w", err)
+	}
+	logger.Printf("CAA running on node: %s", currentNode)
+
+	if err := cm.ensurePool(ctx); err != nil {
+		return err
+	}
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	knownIPs := make(map[string]bool, len(vms))
+	nodeAllocations := 0
+	for _, vm := range vms {
+		knownIPs[vm.Spec.IP] = true
+		if vm.Status.Phase == VMPhaseAllocated && vm.Status.NodeName == currentNode {
+			nodeAllocations++
+			logger.Printf("Found allocation on current node %s: IP=%s, Pod=%s",
+				currentNode, vm.Spec.IP, vm.Status.PodName)
+		}
+	}
+	logger.Printf("Current node %s has %d allocations - will be cleaned by PeerPod controller", currentNode, nodeAllocations)
+
+	added := 0
+	for _, ip := range cm.config.PoolIPs {
+		if knownIPs[ip] {
+			continue
+		}
+		if err := cm.createVM(ctx, ip); err != nil {
+			return err
+		}
+		added++
+	}
+
+	logger.Printf("State recovered for pool %s: %d VMs found, %d added from configuration",
+		cm.config.PoolName, len(vms), added)
+
+	cm.syncPoolStatus(ctx)
+	return nil
+}
+
+// ensurePool creates the PeerPodVMPool object if it doesn't exist yet
+func (cm *CRDVMPoolManager) ensurePool(ctx context.Context) error {
+	_, err := cm.client.Resource(peerPodVMPoolGVR).Namespace(cm.config.Namespace).Get(ctx, cm.config.PoolName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	pool := &PeerPodVMPool{
+		TypeMeta: metav1.TypeMeta{APIVersion: peerPodVMPoolGVR.GroupVersion().String(), Kind: "PeerPodVMPool"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cm.config.PoolName,
+			Namespace: cm.config.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":      "cloud-api-adaptor",
+				"app.kubernetes.io/component": "byom-vm-pool",
+			},
+		},
+	}
+	obj, err := toUnstructured(pool)
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.client.Resource(peerPodVMPoolGVR).Namespace(cm.config.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+	if err == nil {
+		logger.Printf("Created PeerPodVMPool %s", cm.config.PoolName)
+	}
+	return nil
+}
+
+// createVM adds a PeerPodVM for ip to the pool
+func (cm *CRDVMPoolManager) createVM(ctx context.Context, ip string) error {
+	vm := &PeerPodVM{
+		TypeMeta: metav1.TypeMeta{APIVersion: peerPodVMGVR.GroupVersion().String(), Kind: "PeerPodVM"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      vmObjectName(cm.config.PoolName, ip),
+			Namespace: cm.config.Namespace,
+			Labels: map[string]string{
+				vmPoolLabel: cm.config.PoolName,
+			},
+		},
+		Spec: PeerPodVMSpec{
+			PoolName: cm.config.PoolName,
+			IP:       ip,
+		},
+		Status: PeerPodVMStatus{
+			Phase:              VMPhaseAvailable,
+			LastTransitionTime: metav1.Now(),
+		},
+	}
+	obj, err := toUnstructured(vm)
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.client.Resource(peerPodVMGVR).Namespace(cm.config.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("%w: %s: %w", ErrUpdatingPoolVM, vm.Name, err)
+	}
+	if err == nil {
+		logger.Printf("Added VM %s with IP %s to pool %s", vm.Name, ip, cm.config.PoolName)
+	}
+	return nil
+}
+
+// isPoolCordoned reports whether the whole pool is cordoned. A missing pool object is not cordoned.
+func (cm *CRDVMPoolManager) isPoolCordoned(ctx context.Context) (bool, error) {
+	obj, err := cm.client.Resource(peerPodVMPoolGVR).Namespace(cm.config.Namespace).Get(ctx, cm.config.PoolName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	var pool PeerPodVMPool
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &pool); err != nil {
+		return false, fmt.Errorf("failed to decode PeerPodVMPool %s: %w", obj.GetName(), err)
+	}
+	return pool.Spec.Cordoned, nil
+}
+
+// listVMs returns the PeerPodVM objects of the pool
+func (cm *CRDVMPoolManager) listVMs(ctx context.Context) ([]*PeerPodVM, error) {
+	list, err := cm.client.Resource(peerPodVMGVR).Namespace(cm.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", vmPoolLabel, cm.config.PoolName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolVMs, err)
+	}
+
+	vms := make([]*PeerPodVM, 0, len(list.Items))
+	for i := range list.Items {
+		var vm PeerPodVM
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &vm); err != nil {
+			return nil, fmt.Errorf("failed to decode PeerPodVM %s: %w", list.Items[i].GetName(), err)
+		}
+		if _, err := netip.ParseAddr(vm.Spec.IP); err != nil {
+			logger.Printf("Ignoring PeerPodVM %s with invalid IP %q: %v", vm.Name, vm.Spec.IP, err)
+			continue
+		}
+		vms = append(vms, &vm)
+	}
+
+	return vms, nil
+}
+
+// findVMByAllocationID returns the VM holding allocationID, or nil if there is none
+func (cm *CRDVMPoolManager) findVMByAllocationID(ctx context.Context, allocationID string) (*PeerPodVM, error) {
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vm := range vms {
+		if vm.Status.Phase == VMPhaseAllocated && vm.Status.AllocationID == allocationID {
+			return vm, nil
+		}
+	}
+	return nil, nil
+}
+
+// updateVMStatus writes the status of vm, guarded by the resourceVersion it was read with
+func (cm *CRDVMPoolManager) updateVMStatus(ctx context.Context, vm *PeerPodVM) error {
+	vm.APIVersion = peerPodVMGVR.GroupVersion().String()
+	vm.Kind = "PeerPodVM"
+
+	obj, err := toUnstructured(vm)
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.client.Resource(peerPodVMGVR).Namespace(cm.config.Namespace).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	if err != nil {
+		// Conflicts are returned unwrapped so that RetryOnConflict can detect them
+		if errors.IsConflict(err) {
+			logger.Printf("Conflict updating VM %s (resourceVersion %s), retrying", vm.Name, vm.ResourceVersion)
+			return err
+		}
+		return fmt.Errorf("%w: %s: %w", ErrUpdatingPoolVM, vm.Name, err)
+	}
+	return nil
+}
+
+// computePoolStatus aggregates the phases of all VMs of the pool
+func (cm *CRDVMPoolManager) computePoolStatus(ctx context.Context) (*PeerPodVMPoolStatus, error) {
+	poolCordoned, err := cm.isPoolCordoned(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := cm.listVMs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PeerPodVMPoolStatus{
+		Total:       len(vms),
+		LastUpdated: metav1.Now(),
+	}
+	for _, vm := range vms {
+		switch vm.effectivePhase(poolCordoned) {
+		case VMPhaseAvailable:
+			status.Available++
+		case VMPhaseAllocated:
+			status.Allocated++
+		case VMPhaseDraining:
+			status.Draining++
+		case VMPhaseUnhealthy:
+			status.Unhealthy++
+		}
+	}
+	return status, nil
+}
+
+// syncPoolStatus refreshes the PeerPodVMPool status. It is informational only,
+// so failures are logged and not returned.
+func (cm *CRDVMPoolManager) syncPoolStatus(ctx context.Context) {
+	status, err := cm.computePoolStatus(ctx)
+	if err != nil {
+		logger.Printf("Warning: failed to compute status of pool %s: %v", cm.config.PoolName, err)
+		return
+	}
+
+	poolClient := cm.client.Resource(peerPodVMPoolGVR).Namespace(cm.config.Namespace)
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		obj, err := poolClient.Get(ctx, cm.config.PoolName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		statusObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, statusObj, "status"); err != nil {
+			return err
+		}
+
+		_, err = poolClient.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		logger.Printf("Warning: failed to update status of pool %s: %v", cm.config.PoolName, err)
+	}
+}
+
+// toUnstructured converts a typed pool object for use with the dynamic client
+func toUnstructured(obj any) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %T to unstructured: %w", obj, err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,340 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	stderrors "errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// newFakeDynamicClient returns a fake dynamic client that knows the pool resources
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			peerPodVMPoolGVR: "PeerPodVMPoolList",
+			peerPodVMGVR:     "PeerPodVMList",
+		}, objects...)
+}
+
+// newTestCRDPoolConfig returns a crd backend configuration for tests
+func newTestCRDPoolConfig(ips ...string) *GlobalVMPoolConfig {
+	return &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		PoolName:         "test-pool",
+		PoolIPs:          ips,
+		OperationTimeout: 10 * time.Second,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+}
+
+// getTestVM reads back a PeerPodVM from the fake client
+func getTestVM(t *testing.T, client *dynamicfake.FakeDynamicClient, name string) *PeerPodVM {
+	t.Helper()
+
+	obj, err := client.Resource(peerPodVMGVR).Namespace("test-namespace").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get PeerPodVM %s: %v", name, err)
+	}
+	var vm PeerPodVM
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &vm); err != nil {
+		t.Fatalf("Failed to decode PeerPodVM %s: %v", name, err)
+	}
+	return &vm
+}
+
+// setTestVMSpec overwrites the spec of a PeerPodVM, as an administrator would do with kubectl
+func setTestVMSpec(t *testing.T, client *dynamicfake.FakeDynamicClient, name string, spec PeerPodVMSpec) {
+	t.Helper()
+
+	vm := getTestVM(t, client, name)
+	vm.Spec = spec
+	obj, err := toUnstructured(vm)
+	if err != nil {
+		t.Fatalf("Failed to convert PeerPodVM: %v", err)
+	}
+	if _, err := client.Resource(peerPodVMGVR).Namespace("test-namespace").Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to update PeerPodVM %s: %v", name, err)
+	}
+}
+
+func TestNewCRDVMPoolManagerValidation(t *testing.T) {
+	client := newFakeDynamicClient()
+
+	if _, err := NewCRDVMPoolManager(nil, newTestCRDPoolConfig()); err != ErrInvalidClient {
+		t.Errorf("Expected ErrInvalidClient, got %v", err)
+	}
+
+	if _, err := NewCRDVMPoolManager(client, nil); err != ErrNilConfig {
+		t.Errorf("Expected ErrNilConfig, got %v", err)
+	}
+
+	config := newTestCRDPoolConfig()
+	config.PoolName = ""
+	if _, err := NewCRDVMPoolManager(client, config); err != ErrEmptyPoolName {
+		t.Errorf("Expected ErrEmptyPoolName, got %v", err)
+	}
+
+	if _, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10", "invalid-ip")); !stderrors.Is(err, ErrInvalidIPAddress) {
+		t.Errorf("Expected ErrInvalidIPAddress, got %v", err)
+	}
+
+	// Seed IPs are optional with the crd backend
+	if _, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig()); err != nil {
+		t.Errorf("Expected no error without seed IPs, got %v", err)
+	}
+}
+
+func TestCRDVMPoolManagerRecoverStateSeedsPool(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10", "192.168.1.11"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+	// A second recovery must be idempotent
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Second RecoverState failed: %v", err)
+	}
+
+	if _, err := client.Resource(peerPodVMPoolGVR).Namespace("test-namespace").Get(ctx, "test-pool", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected PeerPodVMPool to be created: %v", err)
+	}
+
+	vm := getTestVM(t, client, "test-pool-192-168-1-10")
+	if vm.Spec.IP != "192.168.1.10" || vm.Labels[vmPoolLabel] != "test-pool" {
+		t.Errorf("Unexpected seeded VM: %+v", vm)
+	}
+
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetPoolStatus failed: %v", err)
+	}
+	if total != 2 || available != 2 || inUse != 0 {
+		t.Errorf("Expected 2/2/0, got %d/%d/%d", total, available, inUse)
+	}
+}
+
+func TestCRDVMPoolManagerAllocateAndDeallocate(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10", "192.168.1.11"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	ip, err := manager.AllocateIP(ctx, "alloc-1", "pod-1")
+	if err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	// Allocating again with the same ID returns the same IP
+	again, err := manager.AllocateIP(ctx, "alloc-1", "pod-1")
+	if err != nil || again != ip {
+		t.Errorf("Expected idempotent allocation of %s, got %s (%v)", ip, again, err)
+	}
+
+	gotIP, found, err := manager.GetIPfromAllocationID(ctx, "alloc-1")
+	if err != nil || !found || gotIP != ip {
+		t.Errorf("GetIPfromAllocationID returned %s, %v, %v", gotIP, found, err)
+	}
+
+	allocationID, found, err := manager.GetAllocationIDfromIP(ctx, ip)
+	if err != nil || !found || allocationID != "alloc-1" {
+		t.Errorf("GetAllocationIDfromIP returned %s, %v, %v", allocationID, found, err)
+	}
+
+	allocations, err := manager.ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListAllocatedIPs failed: %v", err)
+	}
+	if allocation := allocations["alloc-1"]; allocation.IP != ip.String() || allocation.NodeName != "test-node" || allocation.PodName != "pod-1" {
+		t.Errorf("Unexpected allocation: %+v", allocation)
+	}
+
+	vm := getTestVM(t, client, vmObjectName("test-pool", ip.String()))
+	if vm.Status.Phase != VMPhaseAllocated {
+		t.Errorf("Expected VM phase %s, got %s", VMPhaseAllocated, vm.Status.Phase)
+	}
+
+	if _, err := manager.AllocateIP(ctx, "alloc-2", "pod-2"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	if _, err := manager.AllocateIP(ctx, "alloc-3", "pod-3"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Errorf("Expected ErrNoAvailableIPs, got %v", err)
+	}
+
+	if err := manager.DeallocateIP(ctx, "alloc-1"); err != nil {
+		t.Fatalf("DeallocateIP failed: %v", err)
+	}
+	// Deallocating an unknown allocation is not an error
+	if err := manager.DeallocateIP(ctx, "alloc-1"); err != nil {
+		t.Errorf("Expected no error deallocating twice, got %v", err)
+	}
+
+	vm = getTestVM(t, client, vmObjectName("test-pool", ip.String()))
+	if vm.Status.Phase != VMPhaseAvailable || vm.Status.AllocationID != "" {
+		t.Errorf("Expected released VM to be available, got %+v", vm.Status)
+	}
+
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetPoolStatus failed: %v", err)
+	}
+	if total != 2 || available != 1 || inUse != 1 {
+		t.Errorf("Expected 2/1/1, got %d/%d/%d", total, available, inUse)
+	}
+}
+
+func TestCRDVMPoolManagerLivePoolChanges(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	ip, err := manager.AllocateIP(ctx, "alloc-1", "pod-1")
+	if err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	// Add a VM to the pool without restarting the manager
+	cm := manager.(*CRDVMPoolManager)
+	if err := cm.createVM(ctx, "192.168.1.20"); err != nil {
+		t.Fatalf("Failed to add VM: %v", err)
+	}
+
+	added, err := manager.AllocateIP(ctx, "alloc-2", "pod-2")
+	if err != nil {
+		t.Fatalf("AllocateIP after adding a VM failed: %v", err)
+	}
+	if added != netip.MustParseAddr("192.168.1.20") {
+		t.Errorf("Expected newly added VM to be allocated, got %s", added)
+	}
+
+	// Cordon the allocated VM: it keeps its allocation and drains on release
+	name := vmObjectName("test-pool", ip.String())
+	setTestVMSpec(t, client, name, PeerPodVMSpec{PoolName: "test-pool", IP: ip.String(), Cordoned: true})
+
+	if err := manager.DeallocateIP(ctx, "alloc-1"); err != nil {
+		t.Fatalf("DeallocateIP failed: %v", err)
+	}
+	if vm := getTestVM(t, client, name); vm.Status.Phase != VMPhaseDraining {
+		t.Errorf("Expected cordoned VM to be draining, got %s", vm.Status.Phase)
+	}
+	if _, err := manager.AllocateIP(ctx, "alloc-3", "pod-3"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Errorf("Expected ErrNoAvailableIPs with a draining VM, got %v", err)
+	}
+
+	// Uncordon returns it to the pool
+	setTestVMSpec(t, client, name, PeerPodVMSpec{PoolName: "test-pool", IP: ip.String()})
+	if got, err := manager.AllocateIP(ctx, "alloc-3", "pod-3"); err != nil || got != ip {
+		t.Errorf("Expected uncordoned VM %s to be allocated, got %s (%v)", ip, got, err)
+	}
+
+	// Removing a VM object removes it from the pool
+	if err := client.Resource(peerPodVMGVR).Namespace("test-namespace").Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete VM: %v", err)
+	}
+	total, _, inUse, _, err := manager.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetPoolStatus failed: %v", err)
+	}
+	if total != 1 || inUse != 1 {
+		t.Errorf("Expected 1 VM in use after removal, got total=%d inUse=%d", total, inUse)
+	}
+}
+
+func TestCRDVMPoolManagerRetriesOnConflict(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	// Simulate another CAA instance updating the VM between our read and write
+	conflicts := 0
+	client.PrependReactor("update", "peerpodvms", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "status" && conflicts < 2 {
+			conflicts++
+			return true, nil, errors.NewConflict(peerPodVMGVR.GroupResource(), "test-pool-192-168-1-10", stderrors.New("stale resourceVersion"))
+		}
+		return false, nil, nil
+	})
+
+	if _, err := manager.AllocateIP(ctx, "alloc-1", "pod-1"); err != nil {
+		t.Fatalf("Expected allocation to succeed after conflicts, got %v", err)
+	}
+	if conflicts != 2 {
+		t.Errorf("Expected 2 conflicts, got %d", conflicts)
+	}
+}
+
+func TestCRDVMPoolManagerPoolCordon(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	pool, err := client.Resource(peerPodVMPoolGVR).Namespace("test-namespace").Get(ctx, "test-pool", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get pool: %v", err)
+	}
+	pool.Object["spec"] = map[string]any{"cordoned": true}
+	if _, err := client.Resource(peerPodVMPoolGVR).Namespace("test-namespace").Update(ctx, pool, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to cordon pool: %v", err)
+	}
+
+	if _, err := manager.AllocateIP(ctx, "alloc-1", "pod-1"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Errorf("Expected ErrNoAvailableIPs with a cordoned pool, got %v", err)
+	}
+}
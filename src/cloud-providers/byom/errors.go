@@ -30,6 +30,12 @@ var (
 
 	// ErrUpdatingConfigMap indicates an error related to updating the pool state ConfigMap
 	ErrUpdatingConfigMap = errors.New("failed to update the pool state configmap")
+
+	// ErrRetrievingPoolVMs indicates an error related to listing the PeerPodVM resources of a pool
+	ErrRetrievingPoolVMs = errors.New("failed to retrieve the pool VMs")
+
+	// ErrUpdatingPoolVM indicates an error related to updating a PeerPodVM resource
+	ErrUpdatingPoolVM = errors.New("failed to update the pool VM")
 )
 
 // Configuration Validation Errors
@@ -45,6 +51,12 @@ var (
 
 	// ErrInvalidIPAddress indicates that an IP address format is invalid
 	ErrInvalidIPAddress = errors.New("invalid IP address")
+
+	// ErrEmptyPoolName indicates that no PeerPodVMPool name was provided
+	ErrEmptyPoolName = errors.New("pool name cannot be empty")
+
+	// ErrInvalidPoolBackend indicates that the pool backend is not supported
+	ErrInvalidPoolBackend = errors.New("invalid pool backend")
 )
 
 // Node Detection Errors
@@ -0,0 +1,193 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// quarantineReasonPendingReboot is used for VMs released by DeleteInstance until they come back clean
+	quarantineReasonPendingReboot = "awaiting post-reboot health check"
+
+	// forwarderDialTimeout bounds the agent-protocol-forwarder port probe
+	forwarderDialTimeout = 2 * time.Second
+)
+
+var (
+	// errHostKeyRejected indicates that the VM presented an SSH host key that was not accepted
+	errHostKeyRejected = errors.New("SSH host key verification failed")
+
+	// errVMNotClean indicates that files of a previous peer pod are still present on the VM
+	errVMNotClean = errors.New("VM has not been cleaned by a reboot")
+
+	// errForwarderRunning indicates that the agent-protocol-forwarder of a previous peer pod is still running
+	errForwarderRunning = errors.New("agent-protocol-forwarder is still running")
+)
+
+// vmHealthChecker periodically checks the pool VMs that are not allocated.
+//
+// A VM is healthy when:
+//   - the SSH handshake succeeds and its host key is accepted by the configured host key policy,
+//   - the /media/cidata tmpfs holds neither user-data nor the reboot trigger, which proves it was rebooted
+//     since its last allocation,
+//   - the agent-protocol-forwarder port is closed. The forwarder is only started once a pod VM has
+//     been provisioned, so an open port means a previous sandbox is still running.
+//
+// Available VMs failing failureThreshold consecutive checks are quarantined. Quarantined VMs,
+// including the ones released by DeleteInstance, are readmitted as soon as a check succeeds.
+type vmHealthChecker struct {
+	poolMgr          GlobalVMPoolManager
+	sshConfig        *ssh.ClientConfig
+	sshPort          string
+	forwarderPort    string
+	interval         time.Duration
+	failureThreshold int
+
+	mutex    sync.Mutex
+	failures map[string]int
+}
+
+// newVMHealthChecker creates a health checker for the VMs of poolMgr
+func newVMHealthChecker(poolMgr GlobalVMPoolManager, sshConfig *ssh.ClientConfig, forwarderPort string, interval time.Duration, failureThreshold int) *vmHealthChecker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &vmHealthChecker{
+		poolMgr:          poolMgr,
+		sshConfig:        sshConfig,
+		sshPort:          sshPort,
+		forwarderPort:    forwarderPort,
+		interval:         interval,
+		failureThreshold: failureThreshold,
+		failures:         make(map[string]int),
+	}
+}
+
+// Start runs the health checks every interval until ctx is cancelled
+func (h *vmHealthChecker) Start(ctx context.Context) {
+	logger.Printf("Starting VM health checker (interval %s, failure threshold %d)", h.interval, h.failureThreshold)
+
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Printf("VM health checker stopped")
+				return
+			case <-ticker.C:
+				h.runOnce(ctx)
+			}
+		}
+	}()
+}
+
+// runOnce checks quarantined VMs for readmission and available VMs for quarantine
+func (h *vmHealthChecker) runOnce(ctx context.Context) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	quarantined, err := h.poolMgr.ListQuarantinedIPs(ctx)
+	if err != nil {
+		logger.Printf("Health check: failed to list quarantined VMs: %v", err)
+	}
+	for ipStr, entry := range quarantined {
+		ip, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			logger.Printf("Health check: ignoring invalid quarantined IP %q: %v", ipStr, err)
+			continue
+		}
+		if err := h.checkVM(ctx, ip); err != nil {
+			logger.Printf("Health check: VM %s stays quarantined (%s): %v", ipStr, entry.Reason, err)
+			continue
+		}
+		if err := h.poolMgr.ReadmitIP(ctx, ip); err != nil {
+			logger.Printf("Health check: failed to readmit VM %s: %v", ipStr, err)
+		}
+	}
+
+	available, err := h.poolMgr.ListAvailableIPs(ctx)
+	if err != nil {
+		logger.Printf("Health check: failed to list available VMs: %v", err)
+		return
+	}
+	for _, ip := range available {
+		ipStr := ip.String()
+		if err := h.checkVM(ctx, ip); err != nil {
+			h.failures[ipStr]++
+			logger.Printf("Health check: VM %s failed (%d/%d): %v", ipStr, h.failures[ipStr], h.failureThreshold, err)
+			if h.failures[ipStr] < h.failureThreshold {
+				continue
+			}
+			if err := h.poolMgr.QuarantineIP(ctx, ip, err.Error()); err != nil {
+				logger.Printf("Health check: failed to quarantine VM %s: %v", ipStr, err)
+				continue
+			}
+		}
+		delete(h.failures, ipStr)
+	}
+
+	if total, available, inUse, quarantined, err := h.poolMgr.GetPoolStatus(ctx); err == nil {
+		logger.Printf("Health check: pool has %d VMs (%d available, %d in use, %d quarantined)", total, available, inUse, quarantined)
+	}
+}
+
+// checkVM runs all health checks against the VM at ip
+func (h *vmHealthChecker) checkVM(ctx context.Context, ip netip.Addr) error {
+	// Record whether the configured host key policy rejected the key, so that
+	// host key failures can be told apart from connectivity problems
+	var hostKeyErr error
+	var fingerprint string
+	sshConfig := *h.sshConfig
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint = ssh.FingerprintSHA256(key)
+		if h.sshConfig.HostKeyCallback != nil {
+			hostKeyErr = h.sshConfig.HostKeyCallback(hostname, remote, key)
+		}
+		return hostKeyErr
+	}
+
+	// The SFTP server chroots to /media
+	rebootPath := strings.TrimPrefix(rebootFile, "/media/")
+	userDataPath := strings.TrimPrefix(userDataFile, "/media/")
+
+	address := net.JoinHostPort(ip.String(), h.sshPort)
+	exists, err := util.CheckFilesViaSFTPWithContext(ctx, address, &sshConfig, rebootPath, userDataPath)
+	if hostKeyErr != nil {
+		return fmt.Errorf("%w: %s: %w", errHostKeyRejected, fingerprint, hostKeyErr)
+	}
+	if err != nil {
+		return fmt.Errorf("SSH check failed: %w", err)
+	}
+
+	for _, p := range []string{rebootPath, userDataPath} {
+		if exists[p] {
+			return fmt.Errorf("%w: %s is present", errVMNotClean, path.Base(p))
+		}
+	}
+
+	if h.forwarderPort != "" {
+		dialer := &net.Dialer{Timeout: forwarderDialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), h.forwarderPort))
+		if err == nil {
+			conn.Close()
+			return fmt.Errorf("%w on port %s", errForwarderRunning, h.forwarderPort)
+		}
+	}
+
+	return nil
+}
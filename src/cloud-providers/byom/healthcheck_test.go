@@ -0,0 +1,389 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testSSHServer is an in-process SSH server exposing the SFTP subsystem on a
+// directory laid out like the chrooted /media of a BYOM VM
+type testSSHServer struct {
+	listener net.Listener
+	root     string
+	port     string
+}
+
+// newTestSSHServer starts an SSH server on host accepting clientKey
+func newTestSSHServer(t *testing.T, host string, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("Failed to create host signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", host, err)
+	}
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "cidata"), 0o755); err != nil {
+		t.Fatalf("Failed to create cidata directory: %v", err)
+	}
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	s := &testSSHServer{listener: listener, root: root, port: port}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+
+	return s
+}
+
+// serve handles a single SSH connection
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.root))
+				if err != nil {
+					channel.Close()
+					return
+				}
+				_ = server.Serve()
+				channel.Close()
+				return
+			}
+		}()
+	}
+}
+
+// writeFile creates a file below the cidata directory of the server
+func (s *testSSHServer) writeFile(t *testing.T, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(s.root, "cidata", name), []byte(name), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+// newTestSSHClientConfig returns a client configuration and the public key the server must accept
+func newTestSSHClientConfig(t *testing.T) (*ssh.ClientConfig, ssh.PublicKey) {
+	t.Helper()
+
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatalf("Failed to create client signer: %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            "peerpod",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}, signer.PublicKey()
+}
+
+func TestVMHealthCheckerCheckVM(t *testing.T) {
+	clientConfig, clientKey := newTestSSHClientConfig(t)
+	server := newTestSSHServer(t, "127.0.0.1", clientKey)
+	ip := netip.MustParseAddr("127.0.0.1")
+
+	// Use a port nobody listens on as forwarder port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	_, closedPort, _ := net.SplitHostPort(closed.Addr().String())
+	closed.Close()
+
+	newChecker := func(sshConfig *ssh.ClientConfig, forwarderPort string) *vmHealthChecker {
+		checker := newVMHealthChecker(nil, sshConfig, forwarderPort, time.Second, 1)
+		checker.sshPort = server.port
+		return checker
+	}
+
+	ctx := context.Background()
+
+	t.Run("Healthy", func(t *testing.T) {
+		if err := newChecker(clientConfig, closedPort).checkVM(ctx, ip); err != nil {
+			t.Errorf("Expected clean VM to be healthy, got %v", err)
+		}
+	})
+
+	t.Run("HostKeyRejected", func(t *testing.T) {
+		rejecting := *clientConfig
+		rejecting.HostKeyCallback = func(string, net.Addr, ssh.PublicKey) error {
+			return fmt.Errorf("not in allowlist")
+		}
+		if err := newChecker(&rejecting, closedPort).checkVM(ctx, ip); !stderrors.Is(err, errHostKeyRejected) {
+			t.Errorf("Expected errHostKeyRejected, got %v", err)
+		}
+	})
+
+	t.Run("ForwarderRunning", func(t *testing.T) {
+		forwarder, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer forwarder.Close()
+		_, forwarderPort, _ := net.SplitHostPort(forwarder.Addr().String())
+
+		if err := newChecker(clientConfig, forwarderPort).checkVM(ctx, ip); !stderrors.Is(err, errForwarderRunning) {
+			t.Errorf("Expected errForwarderRunning, got %v", err)
+		}
+	})
+
+	t.Run("NotRebooted", func(t *testing.T) {
+		server.writeFile(t, "reboot")
+		defer os.Remove(filepath.Join(server.root, "cidata", "reboot"))
+
+		if err := newChecker(clientConfig, closedPort).checkVM(ctx, ip); !stderrors.Is(err, errVMNotClean) {
+			t.Errorf("Expected errVMNotClean, got %v", err)
+		}
+	})
+
+	t.Run("UnreachableVM", func(t *testing.T) {
+		checker := newChecker(clientConfig, closedPort)
+		checker.sshPort = closedPort
+		if err := checker.checkVM(ctx, ip); err == nil {
+			t.Error("Expected unreachable VM to be unhealthy")
+		}
+	})
+}
+
+func TestVMHealthCheckerQuarantineAndReadmit(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	clientConfig, clientKey := newTestSSHClientConfig(t)
+	server := newTestSSHServer(t, "127.0.0.1", clientKey)
+
+	poolMgr, err := NewConfigMapVMPoolManager(fake.NewClientset(), &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"127.0.0.1"},
+		OperationTimeout: 10 * time.Second,
+		SkipVMReadiness:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create pool manager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := poolMgr.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	checker := newVMHealthChecker(poolMgr, clientConfig, "", time.Second, 2)
+	checker.sshPort = server.port
+
+	// A leftover user-data file makes the VM unhealthy, quarantine happens after the threshold
+	server.writeFile(t, "user-data")
+	checker.runOnce(ctx)
+	if _, available, _, quarantined, _ := poolMgr.GetPoolStatus(ctx); available != 1 || quarantined != 0 {
+		t.Errorf("Expected VM to stay available below the threshold, got available=%d quarantined=%d", available, quarantined)
+	}
+	checker.runOnce(ctx)
+	total, available, _, quarantined, err := poolMgr.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetPoolStatus failed: %v", err)
+	}
+	if total != 1 || available != 0 || quarantined != 1 {
+		t.Errorf("Expected VM to be quarantined, got total=%d available=%d quarantined=%d", total, available, quarantined)
+	}
+	if _, err := poolMgr.AllocateIP(ctx, "alloc-1", "pod-1"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Errorf("Expected quarantined VM not to be allocated, got %v", err)
+	}
+
+	// Once clean it is readmitted on the next check
+	os.Remove(filepath.Join(server.root, "cidata", "user-data"))
+	checker.runOnce(ctx)
+	if _, available, _, quarantined, _ := poolMgr.GetPoolStatus(ctx); available != 1 || quarantined != 0 {
+		t.Errorf("Expected VM to be readmitted, got available=%d quarantined=%d", available, quarantined)
+	}
+
+	// A released VM is quarantined until it came back from the reboot
+	if _, err := poolMgr.AllocateIP(ctx, "alloc-1", "pod-1"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	server.writeFile(t, "reboot")
+	if err := poolMgr.DeallocateIPToQuarantine(ctx, "alloc-1", quarantineReasonPendingReboot); err != nil {
+		t.Fatalf("DeallocateIPToQuarantine failed: %v", err)
+	}
+	checker.runOnce(ctx)
+	quarantinedIPs, err := poolMgr.ListQuarantinedIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListQuarantinedIPs failed: %v", err)
+	}
+	if entry, ok := quarantinedIPs["127.0.0.1"]; !ok || entry.Reason != quarantineReasonPendingReboot {
+		t.Errorf("Expected VM to wait for its reboot, got %+v", quarantinedIPs)
+	}
+
+	os.Remove(filepath.Join(server.root, "cidata", "reboot"))
+	checker.runOnce(ctx)
+	if _, available, inUse, quarantined, _ := poolMgr.GetPoolStatus(ctx); available != 1 || inUse != 0 || quarantined != 0 {
+		t.Errorf("Expected rebooted VM to be readmitted, got available=%d inUse=%d quarantined=%d", available, inUse, quarantined)
+	}
+}
+
+func TestConfigMapVMPoolManagerQuarantineSkipsAllocatedIP(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	poolMgr, err := NewConfigMapVMPoolManager(fake.NewClientset(), &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10"},
+		OperationTimeout: 10 * time.Second,
+		SkipVMReadiness:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create pool manager: %v", err)
+	}
+
+	ctx := context.Background()
+	ip, err := poolMgr.AllocateIP(ctx, "alloc-1", "pod-1")
+	if err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	// The health checker may race with an allocation on another node
+	if err := poolMgr.QuarantineIP(ctx, ip, "test"); err != nil {
+		t.Fatalf("QuarantineIP failed: %v", err)
+	}
+	if _, _, inUse, quarantined, _ := poolMgr.GetPoolStatus(ctx); inUse != 1 || quarantined != 0 {
+		t.Errorf("Expected allocation to be kept, got inUse=%d quarantined=%d", inUse, quarantined)
+	}
+
+	// Quarantine survives state repair on restart
+	if err := poolMgr.DeallocateIPToQuarantine(ctx, "alloc-1", "test"); err != nil {
+		t.Fatalf("DeallocateIPToQuarantine failed: %v", err)
+	}
+	if err := poolMgr.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+	if total, available, _, quarantined, _ := poolMgr.GetPoolStatus(ctx); total != 1 || available != 0 || quarantined != 1 {
+		t.Errorf("Expected quarantine to survive recovery, got total=%d available=%d quarantined=%d", total, available, quarantined)
+	}
+}
+
+func TestCRDVMPoolManagerQuarantine(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := newFakeDynamicClient()
+	manager, err := NewCRDVMPoolManager(client, newTestCRDPoolConfig("192.168.1.10", "192.168.1.11"))
+	if err != nil {
+		t.Fatalf("Failed to create CRDVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("RecoverState failed: %v", err)
+	}
+
+	ip := netip.MustParseAddr("192.168.1.10")
+	if err := manager.QuarantineIP(ctx, ip, "ssh failed"); err != nil {
+		t.Fatalf("QuarantineIP failed: %v", err)
+	}
+	if vm := getTestVM(t, client, vmObjectName("test-pool", ip.String())); vm.Status.Phase != VMPhaseUnhealthy || vm.Status.Message != "ssh failed" {
+		t.Errorf("Expected VM to be unhealthy, got %+v", vm.Status)
+	}
+
+	available, err := manager.ListAvailableIPs(ctx)
+	if err != nil || len(available) != 1 || available[0] != netip.MustParseAddr("192.168.1.11") {
+		t.Errorf("Unexpected available IPs %v (%v)", available, err)
+	}
+
+	total, availableCount, inUse, quarantined, err := manager.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetPoolStatus failed: %v", err)
+	}
+	if total != 2 || availableCount != 1 || inUse != 0 || quarantined != 1 {
+		t.Errorf("Expected 2/1/0/1, got %d/%d/%d/%d", total, availableCount, inUse, quarantined)
+	}
+
+	if err := manager.ReadmitIP(ctx, ip); err != nil {
+		t.Fatalf("ReadmitIP failed: %v", err)
+	}
+
+	allocated, err := manager.AllocateIP(ctx, "alloc-1", "pod-1")
+	if err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	if err := manager.DeallocateIPToQuarantine(ctx, "alloc-1", quarantineReasonPendingReboot); err != nil {
+		t.Fatalf("DeallocateIPToQuarantine failed: %v", err)
+	}
+
+	quarantinedIPs, err := manager.ListQuarantinedIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListQuarantinedIPs failed: %v", err)
+	}
+	if entry, ok := quarantinedIPs[allocated.String()]; !ok || entry.Reason != quarantineReasonPendingReboot {
+		t.Errorf("Expected released VM to be quarantined, got %+v", quarantinedIPs)
+	}
+}
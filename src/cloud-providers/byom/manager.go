@@ -24,14 +24,19 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg := provider.NewFlagRegistrar(flags)
 
 	// Flags with environment variable support
-	reg.CustomTypeWithEnv(&byomcfg.VMPoolIPs, "vm-pool-ips", "", "VM_POOL_IPS", "Comma-separated list of IP addresses for pre-created VMs", provider.Required())
+	reg.CustomTypeWithEnv(&byomcfg.VMPoolIPs, "vm-pool-ips", "", "VM_POOL_IPS", "Comma-separated list of IP addresses for pre-created VMs (required with the configmap pool backend, optional with the crd pool backend)")
 	reg.StringWithEnv(&byomcfg.SSHUserName, "ssh-username", "peerpod", "SSH_USERNAME", "SSH username for VM access")
 	reg.StringWithEnv(&byomcfg.SSHPubKeyPath, "ssh-pub-key", "/root/.ssh/id_rsa.pub", "SSH_PUB_KEY_PATH", "SSH public key file path")
 	reg.StringWithEnv(&byomcfg.SSHPrivKeyPath, "ssh-priv-key", "/root/.ssh/id_rsa", "SSH_PRIV_KEY_PATH", "SSH private key file path")
-	reg.StringWithEnv(&byomcfg.PoolNamespace, "pool-namespace", "", "POOL_NAMESPACE", "Namespace for ConfigMap storage (default: auto-detect from running pod)")
+	reg.StringWithEnv(&byomcfg.PoolBackend, "pool-backend", PoolBackendConfigMap, "POOL_BACKEND", "Pool state backend (configmap, crd)")
+	reg.StringWithEnv(&byomcfg.PoolNamespace, "pool-namespace", "", "POOL_NAMESPACE", "Namespace for pool state storage (default: auto-detect from running pod)")
 	reg.StringWithEnv(&byomcfg.PoolConfigMapName, "pool-configmap-name", "byom-ip-pool-state", "POOL_CONFIGMAP_NAME", "ConfigMap name for state storage")
+	reg.StringWithEnv(&byomcfg.PoolName, "pool-name", "byom-pool", "POOL_NAME", "PeerPodVMPool name (crd pool backend only)")
 	reg.IntWithEnv(&maxRangeIPs, "max-range-ips", 100, "MAX_RANGE_IPS", "Maximum number of IPs allowed in a range")
 	reg.IntWithEnv(&byomcfg.SSHTimeout, "ssh-timeout", 30, "SSH_TIMEOUT", "SSH connection timeout in seconds")
+	reg.IntWithEnv(&byomcfg.HealthCheckInterval, "health-check-interval", 0, "HEALTH_CHECK_INTERVAL", "Interval in seconds between VM health checks, e.g. 30 (0 disables health checking and quarantine)")
+	reg.IntWithEnv(&byomcfg.HealthCheckFailureThreshold, "health-check-failure-threshold", 3, "HEALTH_CHECK_FAILURE_THRESHOLD", "Consecutive failed health checks before an available VM is quarantined")
+	reg.StringWithEnv(&byomcfg.HealthCheckForwarderPort, "health-check-forwarder-port", "15150", "HEALTH_CHECK_FORWARDER_PORT", "agent-protocol-forwarder port that must be closed on idle VMs (empty disables the check)")
 	reg.StringWithEnv(&byomcfg.SSHHostKeyAllowlistDir, "ssh-host-key-allowlist-dir", "", "SSH_HOST_KEY_ALLOWLIST_DIR", "Directory containing allowed SSH host key files (enables allowlist mode if set)")
 }
 
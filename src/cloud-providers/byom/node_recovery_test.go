@@ -121,7 +121,7 @@ func TestNodeSpecificStateRecovery(t *testing.T) {
 	}
 
 	// Verify pool status reflects all allocations preserved
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Fatalf("Failed to get pool status: %v", err)
 	}
@@ -16,6 +16,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 	"golang.org/x/crypto/ssh"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -30,9 +31,11 @@ const (
 
 // byomProvider implements the Provider interface for BYOM
 type byomProvider struct {
-	serviceConfig *Config
-	globalPoolMgr GlobalVMPoolManager
-	sshConfig     *ssh.ClientConfig // Pre-computed SSH client configuration
+	serviceConfig   *Config
+	globalPoolMgr   GlobalVMPoolManager
+	sshConfig       *ssh.ClientConfig // Pre-computed SSH client configuration
+	healthChecker   *vmHealthChecker  // nil when health checking is disabled
+	stopHealthCheck context.CancelFunc
 }
 
 // NewProvider creates a new BYOM provider instance
@@ -72,7 +75,7 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
-	// Determine namespace for ConfigMap storage
+	// Determine namespace for pool state storage
 	poolNamespace := config.PoolNamespace
 	if poolNamespace == "" {
 		// Auto-detect namespace from running pod
@@ -83,17 +86,14 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	poolConfig := &GlobalVMPoolConfig{
 		Namespace:        poolNamespace,
 		ConfigMapName:    config.PoolConfigMapName,
+		PoolName:         config.PoolName,
 		PoolIPs:          config.VMPoolIPs,
 		MaxRetries:       5,
 		RetryInterval:    100 * time.Millisecond,
 		OperationTimeout: 30 * time.Second,
 	}
 
-	logger.Printf("Pool configuration: namespace=%s, configMap=%s, IPs=%d",
-		poolNamespace, config.PoolConfigMapName, len(config.VMPoolIPs))
-
-	// Create ConfigMap-based pool manager
-	globalPoolMgr, err := NewConfigMapVMPoolManager(kubeClient, poolConfig)
+	globalPoolMgr, err := newGlobalVMPoolManager(config.PoolBackend, kubeConfig, kubeClient, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrCreatingPoolMgr, err)
 	}
@@ -111,15 +111,44 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	}
 
 	// Log pool status
-	if total, available, inUse, err := p.globalPoolMgr.GetPoolStatus(ctx); err != nil {
+	if total, available, inUse, quarantined, err := p.globalPoolMgr.GetPoolStatus(ctx); err != nil {
 		logger.Printf("Warning: failed to get pool status: %v", err)
 	} else {
-		logger.Printf("Initialized BYOM provider with %d VMs (%d available, %d in use)", total, available, inUse)
+		logger.Printf("Initialized BYOM provider with %d VMs (%d available, %d in use, %d quarantined)", total, available, inUse, quarantined)
+	}
+
+	// Start background health checking of idle VMs
+	if config.HealthCheckInterval > 0 {
+		p.healthChecker = newVMHealthChecker(globalPoolMgr, sshClientConf, config.HealthCheckForwarderPort,
+			time.Duration(config.HealthCheckInterval)*time.Second, config.HealthCheckFailureThreshold)
+		var healthCtx context.Context
+		healthCtx, p.stopHealthCheck = context.WithCancel(context.Background())
+		p.healthChecker.Start(healthCtx)
 	}
 
 	return p, nil
 }
 
+// newGlobalVMPoolManager creates the pool manager for the configured backend
+func newGlobalVMPoolManager(backend string, kubeConfig *rest.Config, kubeClient kubernetes.Interface, poolConfig *GlobalVMPoolConfig) (GlobalVMPoolManager, error) {
+	switch backend {
+	case PoolBackendConfigMap, "":
+		logger.Printf("Pool configuration: backend=%s, namespace=%s, configMap=%s, IPs=%d",
+			PoolBackendConfigMap, poolConfig.Namespace, poolConfig.ConfigMapName, len(poolConfig.PoolIPs))
+		return NewConfigMapVMPoolManager(kubeClient, poolConfig)
+	case PoolBackendCRD:
+		logger.Printf("Pool configuration: backend=%s, namespace=%s, pool=%s, seed IPs=%d",
+			PoolBackendCRD, poolConfig.Namespace, poolConfig.PoolName, len(poolConfig.PoolIPs))
+		dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+		}
+		return NewCRDVMPoolManager(dynamicClient, poolConfig)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPoolBackend, backend)
+	}
+}
+
 // CreateInstance allocates a VM from the pool and configures it
 func (p *byomProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
 	// Generate allocation ID
@@ -193,6 +222,15 @@ func (p *byomProvider) DeleteInstance(ctx context.Context, instanceID string) er
 		return nil
 	}
 
+	// With health checking enabled the VM stays quarantined until it came back clean from the reboot
+	if p.healthChecker != nil {
+		if err := p.globalPoolMgr.DeallocateIPToQuarantine(ctx, allocationID, quarantineReasonPendingReboot); err != nil {
+			return fmt.Errorf("failed to deallocate IP %s (allocation ID: %s): %w", ip.String(), allocationID, err)
+		}
+		logger.Printf("Quarantined VM until it passes health checks: IP=%s", ip.String())
+		return nil
+	}
+
 	// Return IP to global pool using allocation ID
 	if err := p.globalPoolMgr.DeallocateIP(ctx, allocationID); err != nil {
 		return fmt.Errorf("failed to deallocate IP %s (allocation ID: %s): %w", ip.String(), allocationID, err)
@@ -205,13 +243,17 @@ func (p *byomProvider) DeleteInstance(ctx context.Context, instanceID string) er
 
 // Teardown cleans up resources
 func (p *byomProvider) Teardown() error {
+	if p.stopHealthCheck != nil {
+		p.stopHealthCheck()
+	}
 	logger.Printf("BYOM provider teardown completed")
 	return nil
 }
 
 // ConfigVerifier validates the provider configuration
 func (p *byomProvider) ConfigVerifier() error {
-	if len(p.serviceConfig.VMPoolIPs) == 0 {
+	// With the crd backend VMs can be added to the pool at runtime
+	if p.serviceConfig.PoolBackend != PoolBackendCRD && len(p.serviceConfig.VMPoolIPs) == 0 {
 		return fmt.Errorf("vm-pool-ips is required")
 	}
 
@@ -0,0 +1,42 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import "testing"
+
+func TestConfigVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "configmap backend with pool IPs",
+			config: Config{PoolBackend: PoolBackendConfigMap, VMPoolIPs: vmPoolIPs{"192.168.1.10"}, SSHUserName: "peerpod", SSHPrivKey: "key"},
+		},
+		{
+			name:    "configmap backend without pool IPs",
+			config:  Config{PoolBackend: PoolBackendConfigMap, SSHUserName: "peerpod", SSHPrivKey: "key"},
+			wantErr: true,
+		},
+		{
+			name:    "default backend without pool IPs",
+			config:  Config{SSHUserName: "peerpod", SSHPrivKey: "key"},
+			wantErr: true,
+		},
+		{
+			name:   "crd backend without pool IPs",
+			config: Config{PoolBackend: PoolBackendCRD, SSHUserName: "peerpod", SSHPrivKey: "key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &byomProvider{serviceConfig: &tt.config}
+			if err := p.ConfigVerifier(); (err != nil) != tt.wantErr {
+				t.Errorf("ConfigVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -35,9 +35,9 @@ func (cm *ConfigMapVMPoolManager) RecoverState(ctx context.Context, vmCleanupFun
 	state, _, err := cm.getCurrentState(ctx)
 	if err == nil && state != nil {
 		// ConfigMap exists and is valid
-		total := len(state.AllocatedIPs) + len(state.AvailableIPs)
-		logger.Printf("State recovered from ConfigMap: %d total IPs, %d allocated, %d available",
-			total, len(state.AllocatedIPs), len(state.AvailableIPs))
+		total := len(state.AllocatedIPs) + len(state.AvailableIPs) + len(state.QuarantinedIPs)
+		logger.Printf("State recovered from ConfigMap: %d total IPs, %d allocated, %d available, %d quarantined",
+			total, len(state.AllocatedIPs), len(state.AvailableIPs), len(state.QuarantinedIPs))
 
 		// Log node allocations but do NOT release them
 		// This is important as cleanup for stale allocations must be done by peerpod controller.
@@ -85,23 +85,37 @@ func (cm *ConfigMapVMPoolManager) repairStateFromPrimaryConfig(ctx context.Conte
 		allocatedIPSet[allocation.IP] = true
 	}
 
+	// Quarantined IPs stay out of the pool until the health checker readmits them,
+	// unless they were removed from the primary configuration
+	primaryIPSet := make(map[string]bool, len(cm.config.PoolIPs))
+	for _, ip := range cm.config.PoolIPs {
+		primaryIPSet[ip] = true
+	}
+	quarantinedIPs := make(map[string]QuarantinedIP)
+	for ip, quarantined := range currentState.QuarantinedIPs {
+		if primaryIPSet[ip] && !allocatedIPSet[ip] {
+			quarantinedIPs[ip] = quarantined
+		}
+	}
+
 	availableIPs := []string{}
 	for _, ip := range cm.config.PoolIPs {
-		if !allocatedIPSet[ip] {
+		if _, isQuarantined := quarantinedIPs[ip]; !allocatedIPSet[ip] && !isQuarantined {
 			availableIPs = append(availableIPs, ip)
 		}
 	}
 
 	// Update state with repaired configuration
 	repairedState := &IPAllocationState{
-		AllocatedIPs: validAllocatedIPs, // Keep all allocations unchanged
-		AvailableIPs: availableIPs,
-		LastUpdated:  metav1.Now(),
-		Version:      currentState.Version + 1,
+		AllocatedIPs:   validAllocatedIPs, // Keep all allocations unchanged
+		AvailableIPs:   availableIPs,
+		QuarantinedIPs: quarantinedIPs,
+		LastUpdated:    metav1.Now(),
+		Version:        currentState.Version + 1,
 	}
 
-	logger.Printf("Repairing state: primary config has %d IPs, keeping %d allocated (including orphaned), %d available",
-		len(cm.config.PoolIPs), len(validAllocatedIPs), len(availableIPs))
+	logger.Printf("Repairing state: primary config has %d IPs, keeping %d allocated (including orphaned), %d quarantined, %d available",
+		len(cm.config.PoolIPs), len(validAllocatedIPs), len(quarantinedIPs), len(availableIPs))
 
 	if err := cm.updateState(ctx, repairedState); err != nil {
 		return fmt.Errorf("failed to update repaired state: %w", err)
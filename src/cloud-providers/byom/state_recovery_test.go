@@ -71,7 +71,7 @@ func TestConfigMapVMPoolManagerRecoverState(t *testing.T) {
 	}
 
 	// Verify state was recovered correctly
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -181,7 +181,7 @@ func TestConfigMapVMPoolManagerRecoverStateWithNodeAllocations(t *testing.T) {
 	}
 
 	// Verify state after recovery - all allocations should be preserved
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -282,7 +282,7 @@ func TestConfigMapVMPoolManagerRecoverStateKeepsOrphanedAllocations(t *testing.T
 	}
 
 	// Verify orphaned allocation is preserved
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -338,7 +338,7 @@ func TestConfigMapVMPoolManagerRecoverEmptyState(t *testing.T) {
 	}
 
 	// Verify empty state was initialized
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -423,7 +423,7 @@ func TestConfigMapVMPoolManagerRepairStateFromPrimaryConfig(t *testing.T) {
 	}
 
 	// Test that recovery repairs state to match primary config while preserving allocations
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -540,7 +540,7 @@ func TestConfigMapVMPoolManagerMismatchedPoolSizes(t *testing.T) {
 	}
 
 	// Verify repair: AvailableIPs should ONLY contain primary config IPs
-	_, available, inUse, err := manager.GetPoolStatus(ctx)
+	_, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -634,7 +634,7 @@ func TestConfigMapVMPoolManagerMissingPrimaryIPs(t *testing.T) {
 	}
 
 	// Verify all primary IPs are now accounted for
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -723,7 +723,7 @@ func TestConfigMapVMPoolManagerPoolIPsChange(t *testing.T) {
 	}
 
 	// Verify that the state was updated to reflect new pool configuration
-	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	total, available, inUse, _, err := manager.GetPoolStatus(ctx)
 	if err != nil {
 		t.Errorf("Failed to get pool status: %v", err)
 	}
@@ -89,7 +89,7 @@ func (v *vmPoolIPs) Set(value string) error {
 
 // Config holds the BYOM provider configuration
 type Config struct {
-	VMPoolIPs              vmPoolIPs // VM pool IP addresses (required)
+	VMPoolIPs              vmPoolIPs // VM pool IP addresses (required with the configmap backend)
 	SSHUserName            string    // SSH username for VM access
 	SSHPubKeyPath          string    // SSH public key file path
 	SSHPrivKeyPath         string    // SSH private key file path
@@ -99,8 +99,15 @@ type Config struct {
 	SSHHostKeyAllowlistDir string    // Directory containing allowed SSH host key files (enables allowlist mode if set)
 
 	// Pool management configuration
-	PoolNamespace     string // Namespace for ConfigMap storage (default: auto-detect from running pod)
+	PoolBackend       string // Pool state backend: "configmap" or "crd" (default: "configmap")
+	PoolNamespace     string // Namespace for pool state storage (default: auto-detect from running pod)
 	PoolConfigMapName string // ConfigMap name for state storage (default: "byom-ip-pool-state")
+	PoolName          string // PeerPodVMPool name used by the crd backend (default: "byom-pool")
+
+	// Health check configuration
+	HealthCheckInterval         int    // Interval in seconds between VM health checks, 0 disables them (default: 0)
+	HealthCheckFailureThreshold int    // Consecutive failed checks before an available VM is quarantined (default: 3)
+	HealthCheckForwarderPort    string // agent-protocol-forwarder port that must be closed on idle VMs (default: "15150")
 }
 
 // Redact returns a copy of the config with sensitive information redacted
@@ -108,11 +115,20 @@ func (c Config) Redact() Config {
 	return *util.RedactStruct(&c, "SSHPrivKey").(*Config)
 }
 
+const (
+	// PoolBackendConfigMap stores the whole pool state in a single ConfigMap
+	PoolBackendConfigMap = "configmap"
+
+	// PoolBackendCRD stores each VM of the pool as a PeerPodVM custom resource
+	PoolBackendCRD = "crd"
+)
+
 // GlobalVMPoolConfig holds configuration for the global VM pool manager
 type GlobalVMPoolConfig struct {
 	// Kubernetes client configuration
 	Namespace     string
 	ConfigMapName string
+	PoolName      string // PeerPodVMPool name (crd backend only)
 
 	// Pool configuration
 	PoolIPs []string
@@ -142,14 +158,29 @@ type GlobalVMPoolManager interface {
 	// GetAllocationIDfromIP returns the allocation ID for a given IP address
 	GetAllocationIDfromIP(ctx context.Context, ip netip.Addr) (string, bool, error)
 
-	// GetPoolStatus returns current pool statistics
-	GetPoolStatus(ctx context.Context) (total, available, inUse int, err error)
+	// GetPoolStatus returns current pool statistics, total includes quarantined IPs
+	GetPoolStatus(ctx context.Context) (total, available, inUse, quarantined int, err error)
 
 	// RecoverState initializes state from persistent storage
 	RecoverState(ctx context.Context, vmCleanupFunc func(context.Context, netip.Addr) error) error
 
 	// ListAllocatedIPs returns all currently allocated IPs
 	ListAllocatedIPs(ctx context.Context) (map[string]IPAllocation, error)
+
+	// ListAvailableIPs returns all IPs that can currently be allocated
+	ListAvailableIPs(ctx context.Context) ([]netip.Addr, error)
+
+	// QuarantineIP moves an available IP to quarantine. Allocated IPs are left untouched.
+	QuarantineIP(ctx context.Context, ip netip.Addr, reason string) error
+
+	// DeallocateIPToQuarantine releases an allocation and quarantines its IP in a single update
+	DeallocateIPToQuarantine(ctx context.Context, allocationID string, reason string) error
+
+	// ReadmitIP returns a quarantined IP to the available pool
+	ReadmitIP(ctx context.Context, ip netip.Addr) error
+
+	// ListQuarantinedIPs returns all quarantined IPs keyed by IP
+	ListQuarantinedIPs(ctx context.Context) (map[string]QuarantinedIP, error)
 }
 
 // IPAllocation represents an allocated IP address
@@ -161,10 +192,18 @@ type IPAllocation struct {
 	AllocatedAt  metav1.Time `json:"allocatedAt"`
 }
 
+// QuarantinedIP represents an IP kept out of the pool until it passes the health checks
+type QuarantinedIP struct {
+	IP            string      `json:"ip"`
+	Reason        string      `json:"reason"`
+	QuarantinedAt metav1.Time `json:"quarantinedAt"`
+}
+
 // IPAllocationState represents the global allocation state stored in ConfigMap
 type IPAllocationState struct {
-	AllocatedIPs map[string]IPAllocation `json:"allocatedIPs"`
-	AvailableIPs []string                `json:"availableIPs"`
-	LastUpdated  metav1.Time             `json:"lastUpdated"`
-	Version      int64                   `json:"version"` // For optimistic locking
+	AllocatedIPs   map[string]IPAllocation  `json:"allocatedIPs"`
+	AvailableIPs   []string                 `json:"availableIPs"`
+	QuarantinedIPs map[string]QuarantinedIP `json:"quarantinedIPs,omitempty"`
+	LastUpdated    metav1.Time              `json:"lastUpdated"`
+	Version        int64                    `json:"version"` // For optimistic locking
 }
@@ -5,6 +5,8 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	// Ensure you explicitly get the specific docker module version
 	// to avoid incompatibility with the opentelemetry packages that
@@ -12,7 +14,9 @@ import (
 	// Refer to docker module specific vendor.mod for the versions
 	// eg. - https://github.com/moby/moby/blob/v25.0.5/vendor.mod
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -24,20 +28,38 @@ const defaultPodVMDockerImage = "quay.io/confidential-containers/podvm-docker-im
 // Default docker network name to connect to
 const defaultDockerNetworkName = "bridge"
 
+// Label of the containers and the networks of the pod VMs, with the instance name as value
+const instanceLabel = "peerpods-pod-vm"
+
 // dockerClient defines the interface for Docker operations
 type dockerClient interface {
 	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error)
 	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
 	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
+	NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error
+	NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error
+	NetworkRemove(ctx context.Context, networkID string) error
 	Close() error
 }
 
+// containerSpec is the specification of the container of a pod VM
+type containerSpec struct {
+	name          string
+	image         string
+	volumeBinding []string
+	networkName   string
+	labels        map[string]string
+	// nanoCPUs and memory limit the resources of the container, 0 is no limit
+	nanoCPUs int64
+	memory   int64 // in bytes
+}
+
 // Method to create and start a container
 // Returns the container ID and the IP address of the container
-func createContainer(ctx context.Context, client dockerClient,
-	instanceName string, volumeBinding []string,
-	podvmImage string, networkName string) (string, string, error) {
+func createContainer(ctx context.Context, client dockerClient, spec containerSpec) (string, string, error) {
 
 	// No need to bind the port to the host
 	portBinding := nat.PortMap{}
@@ -46,24 +68,29 @@ func createContainer(ctx context.Context, client dockerClient,
 	resp, err := client.ContainerCreate(
 		ctx,
 		&container.Config{
-			Image: podvmImage,
+			Image:  spec.image,
+			Labels: spec.labels,
 			ExposedPorts: nat.PortSet{
 				"15150/tcp": struct{}{},
 			},
 		},
 		&container.HostConfig{
 			PortBindings: portBinding,
-			Binds:        volumeBinding,
+			Binds:        spec.volumeBinding,
 			Privileged:   true, // This line is added to create a privileged container
+			Resources: container.Resources{
+				NanoCPUs: spec.nanoCPUs,
+				Memory:   spec.memory,
+			},
 		},
 		// Connect to specific network name
 		&network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
-				networkName: {},
+				spec.networkName: {},
 			},
 		},
 
-		nil, instanceName,
+		nil, spec.name,
 	)
 	if err != nil {
 		return "", "", err
@@ -72,27 +99,84 @@ func createContainer(ctx context.Context, client dockerClient,
 	// Start the container
 
 	if err := client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return "", "", err
+		return resp.ID, "", err
 	}
 
 	// Get the IP address of the container
 
 	inspect, err := client.ContainerInspect(ctx, resp.ID)
 	if err != nil {
-		return "", "", err
+		return resp.ID, "", err
 	}
 
 	// Get the IP address of the container from the network settings
 	// networks: map[network-name: {IPAddress: ip-address}]
 	// The network name is the key in the networks map
+	endpoint, ok := inspect.NetworkSettings.Networks[spec.networkName]
+	if !ok || endpoint == nil {
+		return resp.ID, "", fmt.Errorf("container %s is not connected to network %s", resp.ID, spec.networkName)
+	}
 
-	return resp.ID, inspect.NetworkSettings.Networks[networkName].IPAddress, nil
+	return resp.ID, endpoint.IPAddress, nil
 
 }
 
 // Method to delete container given container id
 func deleteContainer(ctx context.Context, client dockerClient, containerID string) error {
-	return client.ContainerRemove(ctx, containerID, container.RemoveOptions{
+	err := client.ContainerRemove(ctx, containerID, container.RemoveOptions{
 		Force: true,
 	})
+	if cerrdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// listContainers returns the containers of pod VMs, all of them or the ones of an instance name
+func listContainers(ctx context.Context, client dockerClient, instanceName string) ([]container.Summary, error) {
+	label := instanceLabel
+	if instanceName != "" {
+		label += "=" + instanceName
+	}
+	return client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+}
+
+// containerName returns the name of a container listed by the docker API, without its leading slash
+func containerName(summary container.Summary) string {
+	if len(summary.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(summary.Names[0], "/")
+}
+
+// createNetwork creates a bridge network for a pod VM, and connects the peer container to it, if any, so
+// that the pod VM can be reached from the peer
+func createNetwork(ctx context.Context, client dockerClient, name, peer string, labels map[string]string) error {
+	if _, err := client.NetworkCreate(ctx, name, network.CreateOptions{Driver: "bridge", Labels: labels}); err != nil {
+		return fmt.Errorf("creating network %s: %w", name, err)
+	}
+	if peer != "" {
+		if err := client.NetworkConnect(ctx, name, peer, nil); err != nil {
+			return fmt.Errorf("connecting %s to network %s: %w", peer, name, err)
+		}
+	}
+	return nil
+}
+
+// deleteNetwork disconnects the peer container from the network of a pod VM, and deletes the network.
+// A network that does not exist is ignored.
+func deleteNetwork(ctx context.Context, client dockerClient, name, peer string) error {
+	if peer != "" {
+		// The peer is not connected if connecting it failed, which does not prevent deleting the network
+		if err := client.NetworkDisconnect(ctx, name, peer, true); err != nil && !cerrdefs.IsNotFound(err) {
+			logger.Printf("failed to disconnect %s from network %s: %v", peer, name, err)
+		}
+	}
+	if err := client.NetworkRemove(ctx, name); err != nil && !cerrdefs.IsNotFound(err) {
+		return fmt.Errorf("deleting network %s: %w", name, err)
+	}
+	return nil
 }
@@ -23,12 +23,20 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg := provider.NewFlagRegistrar(flags)
 
 	// Flags with environment variable support
+	reg.StringWithEnv(&dockerCfg.Backend, "docker-backend", backendDocker, "DOCKER_BACKEND", "Container engine running the Pod VM containers: docker or podman")
 	reg.StringWithEnv(&dockerCfg.DockerHost, "docker-host", "unix:///var/run/docker.sock", "DOCKER_HOST", "Docker host")
 	reg.StringWithEnv(&dockerCfg.DockerAPIVersion, "docker-api-version", "1.44", "DOCKER_API_VERSION", "Docker API version")
 	reg.StringWithEnv(&dockerCfg.DockerCertPath, "docker-cert-path", "", "DOCKER_CERT_PATH", "Path to directory with Docker TLS certificates")
 	reg.BoolWithEnv(&dockerCfg.DockerTLSVerify, "docker-tls-verify", false, "DOCKER_TLS_VERIFY", "Use TLS and verify the remote server certificate")
+	reg.StringWithEnv(&dockerCfg.PodmanHost, "podman-host", defaultPodmanHost, "CONTAINER_HOST", "Podman REST API socket, e.g. unix:///run/user/1000/podman/podman.sock for rootless Podman")
 	reg.StringWithEnv(&dockerCfg.PodVMDockerImage, "podvm-docker-image", defaultPodVMDockerImage, "DOCKER_PODVM_IMAGE", "Docker image to use for podvm")
 	reg.StringWithEnv(&dockerCfg.NetworkName, "docker-network-name", defaultDockerNetworkName, "DOCKER_NETWORK_NAME", "Docker network name to connect to")
+	reg.BoolWithEnv(&dockerCfg.PodNetworks, "docker-pod-networks", false, "DOCKER_POD_NETWORKS", "Create a network for each Pod VM instead of connecting the Pod VMs to the docker network")
+	reg.BoolWithEnv(&dockerCfg.DeleteOrphans, "docker-delete-orphans", false, "DOCKER_DELETE_ORPHANS", "Delete the data directories and networks of the Pod VMs without a container before creating the first Pod VM. Only enable it when the data directory and the container engine are not shared with other cloud-api-adaptor instances")
+	reg.StringWithEnv(&dockerCfg.PodNetworkPeer, "docker-pod-network-peer", "", "DOCKER_POD_NETWORK_PEER", "Container connected to the network of each Pod VM to reach it, e.g. the kind node running cloud-api-adaptor")
+
+	// Custom flag types (comma-separated lists)
+	reg.CustomTypeWithEnv(&dockerCfg.Tags, "tags", "", "TAGS", "Custom labels (key=value pairs) to be used for the Pod VM containers, comma separated")
 
 	// Flags without environment variable support (pass empty string for envVarName)
 	reg.StringWithEnv(&dockerCfg.DataDir, "data-dir", defaultDataDir, "", "docker storage dir")
@@ -0,0 +1,403 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Backends of the provider, i.e. the container engines running the containers of the pod VMs
+const (
+	backendDocker = "docker"
+	backendPodman = "podman"
+)
+
+// The default socket of the Podman REST API, of the system service
+const defaultPodmanHost = "unix:///run/podman/podman.sock"
+
+// Default podman network name to connect to, the equivalent of the docker bridge network
+const defaultPodmanNetworkName = "podman"
+
+// Version of the Podman libpod REST API, supported since Podman 4.0
+const podmanAPIVersion = "v4.0.0"
+
+// podmanClient implements dockerClient with the Podman libpod REST API, so that the pod VMs are created
+// with the same volume bindings and IP discovery as with the docker backend
+type podmanClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// podmanError is an error response of the Podman REST API
+type podmanError struct {
+	Cause    string `json:"cause"`
+	Message  string `json:"message"`
+	Response int    `json:"response"`
+}
+
+// podmanMount is a mount of a container, as in the OCI runtime spec
+type podmanMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// podmanResources limits the resources of a container, as in the OCI runtime spec
+type podmanResources struct {
+	CPU    *podmanCPU    `json:"cpu,omitempty"`
+	Memory *podmanMemory `json:"memory,omitempty"`
+}
+
+type podmanCPU struct {
+	Quota  int64  `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"` // in microseconds
+}
+
+type podmanMemory struct {
+	Limit int64 `json:"limit,omitempty"` // in bytes
+}
+
+// podmanContainerSpec is the subset of the libpod SpecGenerator used to create the containers of pod VMs
+type podmanContainerSpec struct {
+	Name           string              `json:"name"`
+	Image          string              `json:"image"`
+	Labels         map[string]string   `json:"labels,omitempty"`
+	Privileged     bool                `json:"privileged"`
+	Mounts         []podmanMount       `json:"mounts,omitempty"`
+	Expose         map[uint16]string   `json:"expose,omitempty"`
+	NetNS          map[string]string   `json:"netns"`
+	Networks       map[string]struct{} `json:"Networks"`
+	ResourceLimits *podmanResources    `json:"resource_limits,omitempty"`
+}
+
+// podmanInspect is the subset of the inspect response of a container used by the provider
+type podmanInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// newPodmanClient returns a client of the Podman REST API listening at host, a unix:// socket or a
+// tcp:// address
+func newPodmanClient(host string) (*podmanClient, error) {
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parsing podman host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	baseURL := "http://" + hostURL.Host
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		// The host of the requests is ignored by the socket
+		baseURL = "http://podman"
+	case "tcp":
+	default:
+		return nil, fmt.Errorf("podman host %q is neither a unix:// socket nor a tcp:// address", host)
+	}
+
+	return &podmanClient{
+		baseURL: baseURL + "/" + podmanAPIVersion + "/libpod",
+		httpClient: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// do sends a request with a JSON body, if in is not nil, and decodes the JSON response into out, if not nil.
+// The errors report cerrdefs.ErrNotFound and cerrdefs.ErrConflict as the docker client does.
+func (c *podmanClient) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	reqURL := c.baseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		var apiErr podmanError
+		if err := json.Unmarshal(data, &apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		message := fmt.Sprintf("podman API error %d: %s", resp.StatusCode, apiErr.Message)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return cerrdefs.ErrNotFound.WithMessage(message)
+		case http.StatusConflict:
+			return cerrdefs.ErrConflict.WithMessage(message)
+		}
+		return errors.New(message)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Version returns the version of Podman and of its REST API
+func (c *podmanClient) Version(ctx context.Context) (string, string, error) {
+	var version struct {
+		Version    string `json:"Version"`
+		APIVersion string `json:"APIVersion"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/version", nil, nil, &version); err != nil {
+		return "", "", err
+	}
+	return version.Version, version.APIVersion, nil
+}
+
+func (c *podmanClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+	spec := podmanContainerSpec{
+		Name:     containerName,
+		Image:    config.Image,
+		Labels:   config.Labels,
+		NetNS:    map[string]string{"nsmode": "bridge"},
+		Networks: map[string]struct{}{},
+	}
+
+	for port := range config.ExposedPorts {
+		if spec.Expose == nil {
+			spec.Expose = map[uint16]string{}
+		}
+		spec.Expose[uint16(port.Int())] = port.Proto()
+	}
+
+	if networkingConfig != nil {
+		for name := range networkingConfig.EndpointsConfig {
+			spec.Networks[name] = struct{}{}
+		}
+	}
+
+	if hostConfig != nil {
+		spec.Privileged = hostConfig.Privileged
+		for _, bind := range hostConfig.Binds {
+			mount, err := parseBind(bind)
+			if err != nil {
+				return container.CreateResponse{}, err
+			}
+			spec.Mounts = append(spec.Mounts, mount)
+		}
+		spec.ResourceLimits = podmanResourceLimits(hostConfig.Resources)
+	}
+
+	var resp struct {
+		ID       string   `json:"Id"`
+		Warnings []string `json:"Warnings"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/containers/create", nil, spec, &resp); err != nil {
+		return container.CreateResponse{}, err
+	}
+	return container.CreateResponse{ID: resp.ID, Warnings: resp.Warnings}, nil
+}
+
+func (c *podmanClient) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/start", nil, nil, nil)
+}
+
+func (c *podmanClient) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	var inspect podmanInspect
+	if err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/json", nil, nil, &inspect); err != nil {
+		return container.InspectResponse{}, err
+	}
+
+	networks := map[string]*network.EndpointSettings{}
+	for name, endpoint := range inspect.NetworkSettings.Networks {
+		networks[name] = &network.EndpointSettings{IPAddress: endpoint.IPAddress}
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:   inspect.ID,
+			Name: inspect.Name,
+		},
+		Config:          &container.Config{Labels: inspect.Config.Labels},
+		NetworkSettings: &container.NetworkSettings{Networks: networks},
+	}, nil
+}
+
+func (c *podmanClient) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	query := url.Values{}
+	if options.All {
+		query.Set("all", "true")
+	}
+	if options.Filters.Len() > 0 {
+		filters := map[string][]string{}
+		for _, key := range options.Filters.Keys() {
+			filters[key] = options.Filters.Get(key)
+		}
+		data, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(data))
+	}
+
+	var list []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/containers/json", query, nil, &list); err != nil {
+		return nil, err
+	}
+
+	var summaries []container.Summary
+	for _, c := range list {
+		summaries = append(summaries, container.Summary{ID: c.ID, Names: c.Names, Labels: c.Labels})
+	}
+	return summaries, nil
+}
+
+func (c *podmanClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	query := url.Values{}
+	if options.Force {
+		query.Set("force", "true")
+	}
+	if options.RemoveVolumes {
+		query.Set("v", "true")
+	}
+	return c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(containerID), query, nil, nil)
+}
+
+func (c *podmanClient) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	req := struct {
+		Name   string            `json:"name"`
+		Driver string            `json:"driver,omitempty"`
+		Labels map[string]string `json:"labels,omitempty"`
+	}{
+		Name:   name,
+		Driver: options.Driver,
+		Labels: options.Labels,
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/networks/create", nil, req, &resp); err != nil {
+		return network.CreateResponse{}, err
+	}
+	return network.CreateResponse{ID: resp.ID}, nil
+}
+
+func (c *podmanClient) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	req := struct {
+		Container string `json:"container"`
+	}{
+		Container: containerID,
+	}
+	return c.do(ctx, http.MethodPost, "/networks/"+url.PathEscape(networkID)+"/connect", nil, req, nil)
+}
+
+func (c *podmanClient) NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error {
+	req := struct {
+		Container string `json:"Container"`
+		Force     bool   `json:"Force"`
+	}{
+		Container: containerID,
+		Force:     force,
+	}
+	return c.do(ctx, http.MethodPost, "/networks/"+url.PathEscape(networkID)+"/disconnect", nil, req, nil)
+}
+
+func (c *podmanClient) NetworkRemove(ctx context.Context, networkID string) error {
+	return c.do(ctx, http.MethodDelete, "/networks/"+url.PathEscape(networkID), nil, nil, nil)
+}
+
+func (c *podmanClient) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// parseBind converts a docker volume binding, source:destination[:options], to a bind mount
+func parseBind(bind string) (podmanMount, error) {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return podmanMount{}, fmt.Errorf("invalid volume binding %q", bind)
+	}
+	mount := podmanMount{
+		Destination: parts[1],
+		Type:        "bind",
+		Source:      parts[0],
+		// Docker binds are recursive
+		Options: []string{"rbind"},
+	}
+	if len(parts) == 3 {
+		mount.Options = append(mount.Options, strings.Split(parts[2], ",")...)
+	}
+	return mount, nil
+}
+
+// podmanResourceLimits converts the docker resources of a container to the limits of the OCI runtime spec.
+// The CPUs are limited with a quota of the default CFS period of 100ms.
+func podmanResourceLimits(resources container.Resources) *podmanResources {
+	if resources.NanoCPUs == 0 && resources.Memory == 0 {
+		return nil
+	}
+	var limits podmanResources
+	if resources.NanoCPUs > 0 {
+		const period = 100000 // in microseconds
+		limits.CPU = &podmanCPU{Quota: resources.NanoCPUs * period / 1e9, Period: period}
+	}
+	if resources.Memory > 0 {
+		limits.Memory = &podmanMemory{Limit: resources.Memory}
+	}
+	return &limits
+}
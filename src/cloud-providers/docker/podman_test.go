@@ -0,0 +1,335 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/network"
+)
+
+// fakePodman is a fake of the libpod REST API, keeping the containers and the networks in memory
+type fakePodman struct {
+	nextID     int
+	containers map[string]podmanContainerSpec
+	// networks maps the names of networks to the containers connected to them, other than pod VMs
+	networks map[string][]string
+}
+
+func newFakePodman(t *testing.T) (*fakePodman, *podmanClient) {
+	f := &fakePodman{
+		nextID:     1,
+		containers: map[string]podmanContainerSpec{},
+		networks:   map[string][]string{defaultPodmanNetworkName: nil},
+	}
+
+	mux := http.NewServeMux()
+	prefix := "/" + podmanAPIVersion + "/libpod"
+	mux.HandleFunc("GET "+prefix+"/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"Version": "5.0.0", "APIVersion": "5.0.0"})
+	})
+	mux.HandleFunc("POST "+prefix+"/containers/create", f.createContainer)
+	mux.HandleFunc("POST "+prefix+"/containers/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.containers[r.PathValue("id")]; !ok {
+			writeError(w, http.StatusNotFound, "no such container")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET "+prefix+"/containers/{id}/json", f.inspectContainer)
+	mux.HandleFunc("GET "+prefix+"/containers/json", f.listContainers)
+	mux.HandleFunc("DELETE "+prefix+"/containers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.containers[r.PathValue("id")]; !ok || r.URL.Query().Get("force") != "true" {
+			writeError(w, http.StatusNotFound, "no such container")
+			return
+		}
+		delete(f.containers, r.PathValue("id"))
+		writeJSON(w, http.StatusOK, []any{})
+	})
+	mux.HandleFunc("POST "+prefix+"/networks/create", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := f.networks[req.Name]; ok {
+			writeError(w, http.StatusConflict, "network already exists")
+			return
+		}
+		f.networks[req.Name] = nil
+		writeJSON(w, http.StatusOK, map[string]string{"name": req.Name, "id": "network-" + req.Name})
+	})
+	mux.HandleFunc("POST "+prefix+"/networks/{name}/connect", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Container string `json:"container"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.networks[r.PathValue("name")] = append(f.networks[r.PathValue("name")], req.Container)
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST "+prefix+"/networks/{name}/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("DELETE "+prefix+"/networks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.networks[r.PathValue("name")]; !ok {
+			writeError(w, http.StatusNotFound, "unable to find network")
+			return
+		}
+		delete(f.networks, r.PathValue("name"))
+		writeJSON(w, http.StatusOK, []any{})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := newPodmanClient("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("newPodmanClient() error = %v", err)
+	}
+	return f, client
+}
+
+func (f *fakePodman) createContainer(w http.ResponseWriter, r *http.Request) {
+	var spec podmanContainerSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, c := range f.containers {
+		if c.Name == spec.Name {
+			writeError(w, http.StatusInternalServerError, "name is already in use")
+			return
+		}
+	}
+	for name := range spec.Networks {
+		if _, ok := f.networks[name]; !ok {
+			writeError(w, http.StatusNotFound, "unable to find network")
+			return
+		}
+	}
+	id := fmt.Sprintf("podman-container-%d", f.nextID)
+	f.nextID++
+	f.containers[id] = spec
+	writeJSON(w, http.StatusCreated, map[string]any{"Id": id, "Warnings": []string{}})
+}
+
+func (f *fakePodman) inspectContainer(w http.ResponseWriter, r *http.Request) {
+	spec, ok := f.containers[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such container")
+		return
+	}
+	networks := map[string]any{}
+	for name := range spec.Networks {
+		networks[name] = map[string]string{"IPAddress": "10.88.0.2"}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"Id":              r.PathValue("id"),
+		"Name":            spec.Name,
+		"Config":          map[string]any{"Labels": spec.Labels},
+		"NetworkSettings": map[string]any{"Networks": networks},
+	})
+}
+
+func (f *fakePodman) listContainers(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	list := []map[string]any{}
+	for id, spec := range f.containers {
+		match := true
+		for _, label := range filters["label"] {
+			key, value, hasValue := strings.Cut(label, "=")
+			v, ok := spec.Labels[key]
+			if !ok || hasValue && v != value {
+				match = false
+			}
+		}
+		if match {
+			list = append(list, map[string]any{"Id": id, "Names": []string{spec.Name}, "Labels": spec.Labels})
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, podmanError{Cause: message, Message: message, Response: status})
+}
+
+func TestPodmanCreateInstance(t *testing.T) {
+	fake, client := newFakePodman(t)
+
+	defer func(f func() int) { numCPU = f }(numCPU)
+	numCPU = func() int { return 4 }
+	p := &dockerProvider{
+		Client:           client,
+		DataDir:          t.TempDir(),
+		PodVMDockerImage: defaultPodVMDockerImage,
+		NetworkName:      defaultPodmanNetworkName,
+	}
+
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{VCPUs: 2, Memory: 4096})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if want := []netip.Addr{netip.MustParseAddr("10.88.0.2")}; !reflect.DeepEqual(instance.IPs, want) {
+		t.Errorf("IPs = %v, want %v", instance.IPs, want)
+	}
+
+	spec := fake.containers[instance.ID]
+	if spec.Name != instance.Name || spec.Image != defaultPodVMDockerImage || !spec.Privileged {
+		t.Errorf("container = %+v, want a privileged container %s of image %s", spec, instance.Name, defaultPodVMDockerImage)
+	}
+	if _, ok := spec.Networks[defaultPodmanNetworkName]; !ok || spec.NetNS["nsmode"] != "bridge" {
+		t.Errorf("container networks = %v, netns = %v, want network %s", spec.Networks, spec.NetNS, defaultPodmanNetworkName)
+	}
+	if spec.Expose[15150] != "tcp" {
+		t.Errorf("container exposed ports = %v, want 15150/tcp", spec.Expose)
+	}
+	if spec.Labels[instanceLabel] != instance.Name {
+		t.Errorf("container labels = %v, want instance label %s", spec.Labels, instance.Name)
+	}
+	wantLimits := &podmanResources{CPU: &podmanCPU{Quota: 200000, Period: 100000}, Memory: &podmanMemory{Limit: 4096 << 20}}
+	if !reflect.DeepEqual(spec.ResourceLimits, wantLimits) {
+		t.Errorf("container resource limits = %+v, want %+v", spec.ResourceLimits, wantLimits)
+	}
+	wantMount := podmanMount{Destination: "/lib/modules", Type: "bind", Source: "/lib/modules", Options: []string{"rbind", "ro"}}
+	if len(spec.Mounts) != 5 || !reflect.DeepEqual(spec.Mounts[2], wantMount) {
+		t.Errorf("container mounts = %+v, want %+v among 5 mounts", spec.Mounts, wantMount)
+	}
+
+	// The container of the same pod VM left by a previous attempt is replaced
+	again, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, ok := fake.containers[instance.ID]; ok || len(fake.containers) != 1 {
+		t.Errorf("containers = %v, want only %s", fake.containers, again.ID)
+	}
+	if spec := fake.containers[again.ID]; spec.ResourceLimits != nil {
+		t.Errorf("container resource limits = %+v, want no limits", spec.ResourceLimits)
+	}
+
+	if err := p.DeleteInstance(context.Background(), again.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if len(fake.containers) != 0 {
+		t.Errorf("containers = %v, want none", fake.containers)
+	}
+	if err := p.DeleteInstance(context.Background(), again.ID); err != nil {
+		t.Errorf("DeleteInstance() of a deleted container error = %v", err)
+	}
+}
+
+func TestPodmanCreateInstancePodNetworks(t *testing.T) {
+	fake, client := newFakePodman(t)
+	p := &dockerProvider{
+		Client:           client,
+		DataDir:          t.TempDir(),
+		PodVMDockerImage: defaultPodVMDockerImage,
+		NetworkName:      defaultPodmanNetworkName,
+		PodNetworks:      true,
+		PodNetworkPeer:   "kind-control-plane",
+	}
+
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, ok := fake.containers[instance.ID].Networks[instance.Name]; !ok {
+		t.Errorf("container networks = %v, want %s", fake.containers[instance.ID].Networks, instance.Name)
+	}
+	if peers := fake.networks[instance.Name]; !reflect.DeepEqual(peers, []string{"kind-control-plane"}) {
+		t.Errorf("containers connected to the network = %v, want the peer", peers)
+	}
+
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, ok := fake.networks[instance.Name]; ok {
+		t.Errorf("network %s is not deleted", instance.Name)
+	}
+}
+
+func TestPodmanErrors(t *testing.T) {
+	_, client := newFakePodman(t)
+
+	if _, err := client.ContainerInspect(context.Background(), "missing"); !cerrdefs.IsNotFound(err) {
+		t.Errorf("ContainerInspect() of a missing container error = %v, want not found", err)
+	}
+	if err := deleteNetwork(context.Background(), client, "missing", ""); err != nil {
+		t.Errorf("deleteNetwork() of a missing network error = %v", err)
+	}
+	if _, err := client.NetworkCreate(context.Background(), defaultPodmanNetworkName, network.CreateOptions{Driver: "bridge"}); !cerrdefs.IsConflict(err) {
+		t.Errorf("NetworkCreate() of an existing network error = %v, want conflict", err)
+	}
+	version, _, err := client.Version(context.Background())
+	if err != nil || version != "5.0.0" {
+		t.Errorf("Version() = %q, %v, want 5.0.0", version, err)
+	}
+}
+
+func TestNewPodmanClient(t *testing.T) {
+	for host, want := range map[string]string{
+		"unix:///run/user/1000/podman/podman.sock": "http://podman/" + podmanAPIVersion + "/libpod",
+		"tcp://127.0.0.1:8888":                     "http://127.0.0.1:8888/" + podmanAPIVersion + "/libpod",
+	} {
+		client, err := newPodmanClient(host)
+		if err != nil {
+			t.Errorf("newPodmanClient(%q) error = %v", host, err)
+			continue
+		}
+		if client.baseURL != want {
+			t.Errorf("newPodmanClient(%q) base URL = %s, want %s", host, client.baseURL, want)
+		}
+	}
+	if _, err := newPodmanClient("ssh://core@localhost/run/podman/podman.sock"); err == nil {
+		t.Errorf("newPodmanClient() of an ssh host succeeded, want an error")
+	}
+}
+
+func TestParseBind(t *testing.T) {
+	for bind, want := range map[string]podmanMount{
+		"/data/userdata:/media/cidata/user-data": {Destination: "/media/cidata/user-data", Type: "bind", Source: "/data/userdata", Options: []string{"rbind"}},
+		"/lib/modules:/lib/modules:ro,z":         {Destination: "/lib/modules", Type: "bind", Source: "/lib/modules", Options: []string{"rbind", "ro", "z"}},
+	} {
+		got, err := parseBind(bind)
+		if err != nil {
+			t.Errorf("parseBind(%q) error = %v", bind, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseBind(%q) = %+v, want %+v", bind, got, want)
+		}
+	}
+	for _, bind := range []string{"", "/data", ":/data", "/a:/b:ro:z"} {
+		if _, err := parseBind(bind); err == nil {
+			t.Errorf("parseBind(%q) succeeded, want an error", bind)
+		}
+	}
+}
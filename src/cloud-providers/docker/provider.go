@@ -10,10 +10,14 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	putil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/client"
 )
 
@@ -24,6 +28,17 @@ type dockerProvider struct {
 	DataDir          string
 	PodVMDockerImage string
 	NetworkName      string
+	PodNetworks      bool
+	PodNetworkPeer   string
+	Tags             map[string]string
+	// DeleteOrphans enables deleting the resources of the pod VMs without a container, once before
+	// the first pod VM is created
+	DeleteOrphans     bool
+	deleteOrphansOnce sync.Once
+
+	// instanceNames maps the IDs of the containers created by the provider to their instance names, so that
+	// the resources of a container deleted by other means are deleted with the instance
+	instanceNames sync.Map
 }
 
 const maxInstanceNameLen = 63
@@ -32,6 +47,59 @@ func NewProvider(config *Config) (*dockerProvider, error) {
 
 	logger.Printf("docker config: %#v", config)
 
+	var cli dockerClient
+	networkName := config.NetworkName
+	switch config.Backend {
+	case backendDocker, "":
+		dockerCli, err := newDockerClient(config)
+		if err != nil {
+			return nil, err
+		}
+		cli = dockerCli
+	case backendPodman:
+		podmanCli, err := newPodmanClient(config.PodmanHost)
+		if err != nil {
+			return nil, err
+		}
+		cli = podmanCli
+
+		version, apiVersion, err := podmanCli.Version(context.Background())
+		if err != nil {
+			logger.Printf("Warning: failed to get Podman version: %v", err)
+		} else {
+			logger.Printf("Podman version: %s, API version: %s", version, apiVersion)
+		}
+
+		// The default network of Podman is not named bridge
+		if networkName == defaultDockerNetworkName {
+			networkName = defaultPodmanNetworkName
+		}
+	default:
+		return nil, fmt.Errorf("unsupported docker backend %q, must be %s or %s", config.Backend, backendDocker, backendPodman)
+	}
+
+	// Create the data directory if it doesn't exist
+	err := os.MkdirAll(config.DataDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &dockerProvider{
+		Client:           cli,
+		DataDir:          config.DataDir,
+		PodVMDockerImage: config.PodVMDockerImage,
+		NetworkName:      networkName,
+		PodNetworks:      config.PodNetworks,
+		PodNetworkPeer:   config.PodNetworkPeer,
+		Tags:             config.Tags,
+		DeleteOrphans:    config.DeleteOrphans,
+	}
+
+	return p, nil
+}
+
+// newDockerClient returns a client of the Docker Engine API, configured with the DOCKER_* environment variables
+func newDockerClient(config *Config) (*client.Client, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithVersion(config.DockerAPIVersion))
 	if err != nil {
 		return nil, err
@@ -47,18 +115,7 @@ func NewProvider(config *Config) (*dockerProvider, error) {
 	}
 	logger.Printf("Docker client API version: %s", cli.ClientVersion())
 
-	// Create the data directory if it doesn't exist
-	err = os.MkdirAll(config.DataDir, 0755)
-	if err != nil {
-		return nil, err
-	}
-
-	return &dockerProvider{
-		Client:           cli,
-		DataDir:          config.DataDir,
-		PodVMDockerImage: config.PodVMDockerImage,
-		NetworkName:      config.NetworkName,
-	}, nil
+	return cli, nil
 }
 
 func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID string,
@@ -72,10 +129,30 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	if err != nil {
 		return nil, err
 	}
-	// Write userdata to a file named after the instance name in the data directory
-	// File name: $data-dir/instanceName-userdata
+
+	// Pod VMs whose containers were deleted while cloud-api-adaptor was not running leave their resources.
+	// Other pod VMs are not created until they are deleted, so that their resources are not taken for orphans.
+	if p.DeleteOrphans {
+		p.deleteOrphansOnce.Do(func() {
+			if err := p.deleteOrphanedResources(ctx); err != nil {
+				logger.Printf("Warning: failed to delete the resources of deleted pod VMs: %v", err)
+			}
+		})
+	}
+
+	// A container of a previous attempt, e.g. before cloud-api-adaptor restarted, has the same name
+	if err := p.deleteStaleInstances(ctx, instanceName); err != nil {
+		return nil, err
+	}
+
+	// Each pod VM has a private data directory, deleted with the pod VM
+	// $data-dir/instanceName/
+	instanceDir := p.instanceDir(instanceName)
+
+	// Write userdata to a file named after the instance name in the data directory of the instance
+	// File name: $data-dir/instanceName/instanceName-userdata
 	// File content: userdata
-	instanceUserdataFile, err := provider.WriteUserData(instanceName, userData, p.DataDir)
+	instanceUserdataFile, err := provider.WriteUserData(instanceName, userData, instanceDir)
 	if err != nil {
 		return nil, err
 	}
@@ -94,25 +171,59 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	// overlay on overlay issue
 	// (host)kata-containers dir -> (container) /run/kata-containers
 	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s",
-		filepath.Join(p.DataDir, "kata-containers"), "/run/kata-containers"))
+		filepath.Join(instanceDir, "kata-containers"), "/run/kata-containers"))
 
-	// Add host bind mounts required by iptables
-	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s", "/lib/modules", "/lib/modules"))
+	// Add host bind mounts required by iptables, the kernel modules are only read
+	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s:ro", "/lib/modules", "/lib/modules"))
 	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s", "/run/xtables.lock", "/run/xtables.lock"))
 
+	podvmImage := p.PodVMDockerImage
 	if spec.Image != "" {
 		logger.Printf("Choosing %s from annotation as the docker image for the PodVM image", spec.Image)
-		p.PodVMDockerImage = spec.Image
+		podvmImage = spec.Image
 	}
 
 	// (host)image dir -> (container) /image
 	// There is a podvm systemd service in pod which bind mounts /run/image to /image
 	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s",
-		filepath.Join(p.DataDir, "image"), "/image"))
+		filepath.Join(instanceDir, "image"), "/image"))
+
+	// The tags of the pod VM are added to the labels of the container, and the instance label
+	// identifies the containers of pod VMs
+	labels := provider.MergeTags(p.Tags, spec)
+	labels[instanceLabel] = instanceName
+
+	networkName := p.NetworkName
+	if p.PodNetworks {
+		networkName = instanceName
+		if err := createNetwork(ctx, p.Client, networkName, p.PodNetworkPeer, map[string]string{instanceLabel: instanceName}); err != nil {
+			if cleanupErr := p.deleteInstanceResources(ctx, instanceName); cleanupErr != nil {
+				logger.Printf("failed to clean up pod VM %s: %v", instanceName, cleanupErr)
+			}
+			return nil, err
+		}
+	}
 
-	instanceID, ip, err := createContainer(ctx, p.Client, instanceName, volumeBinding,
-		p.PodVMDockerImage, p.NetworkName)
+	instanceID, ip, err := createContainer(ctx, p.Client, containerSpec{
+		name:          instanceName,
+		image:         podvmImage,
+		volumeBinding: volumeBinding,
+		networkName:   networkName,
+		labels:        labels,
+		nanoCPUs:      containerNanoCPUs(instanceName, spec.VCPUs),
+		memory:        spec.Memory << 20,
+	})
+	if instanceID != "" {
+		p.instanceNames.Store(instanceID, instanceName)
+	}
 	if err != nil {
+		if instanceID != "" {
+			// The caller deletes the container with its resources
+			return &provider.Instance{ID: instanceID, Name: instanceName}, err
+		}
+		if cleanupErr := p.deleteInstanceResources(ctx, instanceName); cleanupErr != nil {
+			logger.Printf("failed to clean up pod VM %s: %v", instanceName, cleanupErr)
+		}
 		return nil, err
 	}
 
@@ -121,7 +232,7 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	// Convert ip to []netip.Addr
 	ipAddr, err := netip.ParseAddr(ip)
 	if err != nil {
-		return nil, err
+		return &provider.Instance{ID: instanceID, Name: instanceName}, err
 	}
 
 	return &provider.Instance{
@@ -132,19 +243,111 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 
 }
 
+// numCPU returns the number of CPUs of the host, the most a container can use
+var numCPU = runtime.NumCPU
+
+// containerNanoCPUs returns the CPU limit of the container of a pod VM. Docker refuses containers
+// requesting more CPUs than the host has, so the vCPUs of large pods are limited to the host CPUs.
+func containerNanoCPUs(instanceName string, vcpus int64) int64 {
+	if hostCPUs := int64(numCPU()); vcpus > hostCPUs {
+		logger.Printf("pod VM %s requests %d vCPUs, limiting its container to the %d CPUs of the host", instanceName, vcpus, hostCPUs)
+		vcpus = hostCPUs
+	}
+	return vcpus * 1e9
+}
+
 func (p *dockerProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
 	logger.Printf("DeleteInstance: instanceID: %q", instanceID)
 
-	// Delete the container
-	err := deleteContainer(ctx, p.Client, instanceID)
+	// The instance label of the container identifies the data directory and the network of the pod VM
+	var instanceName string
+	if name, ok := p.instanceNames.Load(instanceID); ok {
+		instanceName = name.(string)
+	}
+	inspect, err := p.Client.ContainerInspect(ctx, instanceID)
+	if cerrdefs.IsNotFound(err) {
+		logger.Printf("DeleteInstance: container %q does not exist", instanceID)
+	} else if err != nil {
+		return err
+	} else {
+		// Delete the container
+		if err := deleteContainer(ctx, p.Client, instanceID); err != nil {
+			return err
+		}
+		if inspect.Config != nil && inspect.Config.Labels[instanceLabel] != "" {
+			instanceName = inspect.Config.Labels[instanceLabel]
+		}
+	}
+
+	if err := p.deleteInstanceResources(ctx, instanceName); err != nil {
+		return err
+	}
+	p.instanceNames.Delete(instanceID)
+	return nil
+}
+
+// deleteStaleInstances deletes the containers of an instance name, with their resources
+func (p *dockerProvider) deleteStaleInstances(ctx context.Context, instanceName string) error {
+	containers, err := listContainers(ctx, p.Client, instanceName)
+	if err != nil {
+		return fmt.Errorf("listing containers of %s: %w", instanceName, err)
+	}
+	for _, c := range containers {
+		logger.Printf("deleting stale container %s (%s) of pod VM %s", c.ID, containerName(c), instanceName)
+		if err := deleteContainer(ctx, p.Client, c.ID); err != nil {
+			return err
+		}
+	}
+	return p.deleteInstanceResources(ctx, instanceName)
+}
+
+// deleteOrphanedResources deletes the networks and the data directories of the pod VMs that have no container
+func (p *dockerProvider) deleteOrphanedResources(ctx context.Context) error {
+	entries, err := os.ReadDir(p.DataDir)
 	if err != nil {
 		return err
 	}
+	containers, err := listContainers(ctx, p.Client, "")
+	if err != nil {
+		return fmt.Errorf("listing containers of pod VMs: %w", err)
+	}
+	instances := map[string]bool{}
+	for _, c := range containers {
+		instances[c.Labels[instanceLabel]] = true
+	}
 
+	for _, entry := range entries {
+		instanceName := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(instanceName, "podvm-") || instances[instanceName] {
+			continue
+		}
+		logger.Printf("deleting the resources of pod VM %s, which has no container", instanceName)
+		if err := p.deleteInstanceResources(ctx, instanceName); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// deleteInstanceResources deletes the network and the data directory of a pod VM
+func (p *dockerProvider) deleteInstanceResources(ctx context.Context, instanceName string) error {
+	if instanceName == "" {
+		return nil
+	}
+	if p.PodNetworks {
+		if err := deleteNetwork(ctx, p.Client, instanceName, p.PodNetworkPeer); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(p.instanceDir(instanceName))
+}
+
+// instanceDir returns the private data directory of a pod VM
+func (p *dockerProvider) instanceDir(instanceName string) string {
+	return filepath.Join(p.DataDir, instanceName)
+}
+
 func (p *dockerProvider) Teardown() error {
 	return nil
 }
@@ -5,47 +5,91 @@ package docker
 
 import (
 	"context"
+	"fmt"
 	"net/netip"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // Mock Docker client for testing
-type mockDockerClient struct{}
+type mockDockerClient struct {
+	nextID     int
+	containers map[string]*mockContainer
+	// networks maps the names of networks to the containers connected to them, other than pod VMs
+	networks map[string][]string
+}
+
+type mockContainer struct {
+	name       string
+	config     *container.Config
+	hostConfig *container.HostConfig
+	network    string
+}
 
 // Return a new mock Docker client
 func newMockDockerClient() *mockDockerClient {
-	return &mockDockerClient{}
+	return &mockDockerClient{
+		nextID:     12345,
+		containers: map[string]*mockContainer{},
+		networks:   map[string][]string{"bridge": nil},
+	}
 }
 
 // Create a mock Docker ContainerCreate method
-func (m mockDockerClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+func (m *mockDockerClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+	for _, c := range m.containers {
+		if c.name == containerName {
+			return container.CreateResponse{}, fmt.Errorf("container name %s is already in use", containerName)
+		}
+	}
+	var networkName string
+	for name := range networkingConfig.EndpointsConfig {
+		networkName = name
+	}
+	if _, ok := m.networks[networkName]; !ok {
+		return container.CreateResponse{}, cerrdefs.ErrNotFound.WithMessage("network " + networkName + " not found")
+	}
+
+	id := fmt.Sprintf("mock-container-id-%d", m.nextID)
+	m.nextID++
+	m.containers[id] = &mockContainer{name: containerName, config: config, hostConfig: hostConfig, network: networkName}
 	return container.CreateResponse{
-		ID: "mock-container-id-12345",
+		ID: id,
 	}, nil
 }
 
 // Create a mock Docker ContainerStart method
-func (m mockDockerClient) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+func (m *mockDockerClient) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
 	return nil
 }
 
 // Create a mock Docker ContainerInspect method
-func (m mockDockerClient) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+func (m *mockDockerClient) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	c, ok := m.containers[containerID]
+	if !ok {
+		return container.InspectResponse{}, cerrdefs.ErrNotFound.WithMessage("no such container: " + containerID)
+	}
 	return container.InspectResponse{
 		ContainerJSONBase: &container.ContainerJSONBase{
-			ID: containerID,
+			ID:   containerID,
+			Name: "/" + c.name,
 		},
+		Config: c.config,
 		NetworkSettings: &container.NetworkSettings{
 			Networks: map[string]*network.EndpointSettings{
-				"bridge": {
+				c.network: {
 					IPAddress: "172.17.0.2",
 				},
 			},
@@ -53,13 +97,80 @@ func (m mockDockerClient) ContainerInspect(ctx context.Context, containerID stri
 	}, nil
 }
 
+// Create a mock Docker ContainerList method, filtering containers by label
+func (m *mockDockerClient) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	var list []container.Summary
+	for id, c := range m.containers {
+		match := true
+		for _, label := range options.Filters.Get("label") {
+			key, value, hasValue := strings.Cut(label, "=")
+			v, ok := c.config.Labels[key]
+			if !ok || hasValue && v != value {
+				match = false
+			}
+		}
+		if match {
+			list = append(list, container.Summary{ID: id, Names: []string{"/" + c.name}, Labels: c.config.Labels})
+		}
+	}
+	return list, nil
+}
+
 // Create a mock Docker ContainerRemove method
-func (m mockDockerClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+func (m *mockDockerClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	if _, ok := m.containers[containerID]; !ok {
+		return cerrdefs.ErrNotFound.WithMessage("no such container: " + containerID)
+	}
+	delete(m.containers, containerID)
+	return nil
+}
+
+// Create a mock Docker NetworkCreate method
+func (m *mockDockerClient) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	if _, ok := m.networks[name]; ok {
+		return network.CreateResponse{}, cerrdefs.ErrConflict.WithMessage("network " + name + " already exists")
+	}
+	m.networks[name] = nil
+	return network.CreateResponse{ID: name}, nil
+}
+
+// Create a mock Docker NetworkConnect method
+func (m *mockDockerClient) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	if _, ok := m.networks[networkID]; !ok {
+		return cerrdefs.ErrNotFound.WithMessage("network " + networkID + " not found")
+	}
+	m.networks[networkID] = append(m.networks[networkID], containerID)
+	return nil
+}
+
+// Create a mock Docker NetworkDisconnect method
+func (m *mockDockerClient) NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error {
+	if _, ok := m.networks[networkID]; !ok {
+		return cerrdefs.ErrNotFound.WithMessage("network " + networkID + " not found")
+	}
+	m.networks[networkID] = slices.DeleteFunc(m.networks[networkID], func(id string) bool { return id == containerID })
+	return nil
+}
+
+// Create a mock Docker NetworkRemove method
+func (m *mockDockerClient) NetworkRemove(ctx context.Context, networkID string) error {
+	if _, ok := m.networks[networkID]; !ok {
+		return cerrdefs.ErrNotFound.WithMessage("network " + networkID + " not found")
+	}
+	if len(m.networks[networkID]) > 0 {
+		return fmt.Errorf("network %s has active endpoints", networkID)
+	}
+	for _, c := range m.containers {
+		if c.network == networkID {
+			return fmt.Errorf("network %s has active endpoints", networkID)
+		}
+	}
+	delete(m.networks, networkID)
 	return nil
 }
 
 // Create a mock Docker Close method
-func (m mockDockerClient) Close() error {
+func (m *mockDockerClient) Close() error {
 	return nil
 }
 
@@ -157,3 +268,249 @@ func Test_dockerProvider_CreateInstance(t *testing.T) {
 		})
 	}
 }
+
+func newTestProvider(t *testing.T, client *mockDockerClient) *dockerProvider {
+	return &dockerProvider{
+		Client:           client,
+		DataDir:          t.TempDir(),
+		PodVMDockerImage: "quay.io/confidential-containers/podvm-docker-image",
+		NetworkName:      "bridge",
+		Tags:             map[string]string{"team": "peerpods"},
+	}
+}
+
+func TestCreateInstanceContainer(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+
+	defer func(f func() int) { numCPU = f }(numCPU)
+	numCPU = func() int { return 4 }
+
+	spec := provider.InstanceTypeSpec{
+		VCPUs:  2,
+		Memory: 4096,
+		Image:  "quay.io/example/podvm:test",
+		Tags:   map[string]string{provider.TagPodName: "nginx"},
+	}
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	c := client.containers[instance.ID]
+	if c.hostConfig.Resources.NanoCPUs != 2e9 || c.hostConfig.Resources.Memory != 4096<<20 {
+		t.Errorf("resources = %+v, want 2 CPUs and 4096 MiB", c.hostConfig.Resources)
+	}
+	if c.config.Image != spec.Image || p.PodVMDockerImage != "quay.io/confidential-containers/podvm-docker-image" {
+		t.Errorf("image = %s, configured image = %s", c.config.Image, p.PodVMDockerImage)
+	}
+	wantLabels := map[string]string{"team": "peerpods", provider.TagPodName: "nginx", instanceLabel: instance.Name}
+	if !reflect.DeepEqual(c.config.Labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", c.config.Labels, wantLabels)
+	}
+
+	instanceDir := filepath.Join(p.DataDir, instance.Name)
+	wantBinds := []string{
+		filepath.Join(instanceDir, instance.Name+"-userdata") + ":/media/cidata/user-data",
+		filepath.Join(instanceDir, "kata-containers") + ":/run/kata-containers",
+		"/lib/modules:/lib/modules:ro",
+		"/run/xtables.lock:/run/xtables.lock",
+		filepath.Join(instanceDir, "image") + ":/image",
+	}
+	if !reflect.DeepEqual(c.hostConfig.Binds, wantBinds) {
+		t.Errorf("binds = %v, want %v", c.hostConfig.Binds, wantBinds)
+	}
+
+	// Without resources in the spec the container is not limited
+	instance, err = p.CreateInstance(context.Background(), "nginx", "456", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if resources := client.containers[instance.ID].hostConfig.Resources; resources.NanoCPUs != 0 || resources.Memory != 0 {
+		t.Errorf("resources = %+v, want no limits", resources)
+	}
+
+	// The CPUs are limited to the ones of the host
+	instance, err = p.CreateInstance(context.Background(), "nginx", "789", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{VCPUs: 16})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if resources := client.containers[instance.ID].hostConfig.Resources; resources.NanoCPUs != 4e9 {
+		t.Errorf("resources = %+v, want 4 CPUs", resources)
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	instanceDir := filepath.Join(p.DataDir, instance.Name)
+	if _, err := os.Stat(instanceDir); err != nil {
+		t.Fatalf("data directory of the instance: %v", err)
+	}
+
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if len(client.containers) != 0 {
+		t.Errorf("containers = %v, want none", client.containers)
+	}
+	if _, err := os.Stat(instanceDir); !os.IsNotExist(err) {
+		t.Errorf("data directory of the instance is not deleted: %v", err)
+	}
+
+	// The container is already deleted
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Errorf("DeleteInstance() of a deleted container error = %v", err)
+	}
+}
+
+func TestCreateInstanceStale(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+
+	stale, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	other, err := p.CreateInstance(context.Background(), "nginx", "456", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	// The container of the same pod VM left by a previous attempt is replaced
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, ok := client.containers[stale.ID]; ok {
+		t.Errorf("stale container %s is not deleted", stale.ID)
+	}
+	if _, ok := client.containers[other.ID]; !ok {
+		t.Errorf("container %s of another pod VM is deleted", other.ID)
+	}
+
+	containers, err := listContainers(context.Background(), client, instance.Name)
+	if err != nil {
+		t.Fatalf("listContainers() error = %v", err)
+	}
+	if len(containers) != 1 || containers[0].ID != instance.ID || containerName(containers[0]) != instance.Name {
+		t.Errorf("listContainers() = %v, want container %s", containers, instance.ID)
+	}
+	if containers, _ := listContainers(context.Background(), client, ""); len(containers) != 2 {
+		t.Errorf("listContainers() = %v, want 2 containers", containers)
+	}
+}
+
+func TestCreateInstancePodNetworks(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+	p.PodNetworks = true
+	p.PodNetworkPeer = "kind-control-plane"
+
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if network := client.containers[instance.ID].network; network != instance.Name {
+		t.Errorf("container network = %s, want %s", network, instance.Name)
+	}
+	if peers := client.networks[instance.Name]; !reflect.DeepEqual(peers, []string{"kind-control-plane"}) {
+		t.Errorf("containers connected to the network = %v, want the peer", peers)
+	}
+
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, ok := client.networks[instance.Name]; ok {
+		t.Errorf("network %s is not deleted", instance.Name)
+	}
+	if _, ok := client.networks["bridge"]; !ok {
+		t.Errorf("network bridge is deleted")
+	}
+}
+
+func TestDeleteInstanceDeletedContainer(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+	p.PodNetworks = true
+
+	instance, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	// The container is deleted by other means, e.g. docker rm
+	delete(client.containers, instance.ID)
+
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, ok := client.networks[instance.Name]; ok {
+		t.Errorf("network %s is not deleted", instance.Name)
+	}
+	if _, err := os.Stat(filepath.Join(p.DataDir, instance.Name)); !os.IsNotExist(err) {
+		t.Errorf("data directory of the instance is not deleted: %v", err)
+	}
+}
+
+func TestDeleteOrphanedResources(t *testing.T) {
+	client := newMockDockerClient()
+	p := newTestProvider(t, client)
+	p.PodNetworks = true
+
+	orphan, err := p.CreateInstance(context.Background(), "nginx", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	running, err := p.CreateInstance(context.Background(), "nginx", "456", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	other := filepath.Join(p.DataDir, "other")
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The container is deleted while cloud-api-adaptor is not running
+	delete(client.containers, orphan.ID)
+	restarted := newTestProvider(t, client)
+	restarted.DataDir = p.DataDir
+	restarted.PodNetworks = true
+
+	// The resources are kept unless the deletion of orphans is enabled
+	if _, err := restarted.CreateInstance(context.Background(), "nginx", "789", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.DataDir, orphan.Name)); err != nil {
+		t.Errorf("data directory of %s is deleted without DeleteOrphans: %v", orphan.Name, err)
+	}
+
+	restarted = newTestProvider(t, client)
+	restarted.DataDir = p.DataDir
+	restarted.PodNetworks = true
+	restarted.DeleteOrphans = true
+	if _, err := restarted.CreateInstance(context.Background(), "nginx", "abc", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, ok := client.networks[orphan.Name]; ok {
+		t.Errorf("network %s is not deleted", orphan.Name)
+	}
+	if _, err := os.Stat(filepath.Join(p.DataDir, orphan.Name)); !os.IsNotExist(err) {
+		t.Errorf("data directory of %s is not deleted: %v", orphan.Name, err)
+	}
+
+	// The resources of running pod VMs and other directories are kept
+	if _, ok := client.networks[running.Name]; !ok {
+		t.Errorf("network %s is deleted", running.Name)
+	}
+	for _, dir := range []string{filepath.Join(p.DataDir, running.Name), other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("directory %s is deleted: %v", dir, err)
+		}
+	}
+}
@@ -3,12 +3,22 @@
 
 package docker
 
+import (
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
 type Config struct {
+	Backend          string
 	DockerHost       string
 	DockerAPIVersion string
 	DockerCertPath   string
 	DockerTLSVerify  bool
+	PodmanHost       string
 	DataDir          string
 	PodVMDockerImage string
 	NetworkName      string
+	PodNetworks      bool
+	PodNetworkPeer   string
+	DeleteOrphans    bool
+	Tags             provider.KeyValueFlag
 }
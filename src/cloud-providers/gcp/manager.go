@@ -22,6 +22,7 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 
 	// Flags with environment variable support
 	reg.StringWithEnv(&gcpcfg.GcpCredentials, "gcp-credentials", "", "GCP_CREDENTIALS", "Google Application Credentials", provider.Secret())
+	reg.StringWithEnv(&gcpcfg.WorkloadIdentityConfig, "gcp-workload-identity-config", "", "GCP_WORKLOAD_IDENTITY_CONFIG", "Credential configuration file of workload identity federation")
 	reg.StringWithEnv(&gcpcfg.ProjectID, "gcp-project-id", "", "GCP_PROJECT_ID", "GCP Project ID", provider.Required())
 	reg.StringWithEnv(&gcpcfg.Zone, "zone", "", "GCP_ZONE", "Zone", provider.Required())
 	reg.StringWithEnv(&gcpcfg.ImageName, "image-name", "", "PODVM_IMAGE_NAME", "Pod VM image name")
@@ -4,6 +4,7 @@
 package gcp
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -25,12 +26,15 @@ import (
 
 var logger = log.New(log.Writer(), "[adaptor/cloud/gcp] ", log.LstdFlags|log.Lmsgprefix)
 var computeScope = "https://www.googleapis.com/auth/compute"
+var cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
 
 const maxInstanceNameLen = 63
 
 type gcpProvider struct {
 	serviceConfig   *Config
 	instancesClient *compute.InstancesClient
+	// clientOptions are the options of the other clients, e.g. the credentials of workload identity federation
+	clientOptions []option.ClientOption
 }
 
 func (p *gcpProvider) ConfigVerifier() error {
@@ -43,7 +47,22 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		serviceConfig:   config,
 		instancesClient: nil,
 	}
-	if config.GcpCredentials != "" {
+	if config.WorkloadIdentityConfig != "" {
+		// The subject token of the credential configuration, e.g. a projected service account token,
+		// is read again each time an access token is requested
+		logger.Printf("using workload identity federation with %s", config.WorkloadIdentityConfig)
+		creds, err := credentials.NewCredentialsFromFile(credentials.ExternalAccount, config.WorkloadIdentityConfig, &credentials.DetectOptions{
+			Scopes: []string{cloudPlatformScope},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("configuration error when using workload identity federation: %s", err)
+		}
+		provider.clientOptions = []option.ClientOption{option.WithAuthCredentials(creds)}
+		provider.instancesClient, err = compute.NewInstancesRESTClient(context.TODO(), provider.clientOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("NewInstancesRESTClient with workload identity federation error: %s", err)
+		}
+	} else if config.GcpCredentials != "" {
 		creds, err := credentials.NewCredentialsFromJSON(credentials.ServiceAccount, []byte(config.GcpCredentials), &credentials.DetectOptions{
 			Scopes: []string{computeScope},
 		})
@@ -117,13 +136,13 @@ func getIPs(intfcs []*computepb.NetworkInterface, usePublicIPs bool) ([]netip.Ad
 }
 
 func (p *gcpProvider) ListAllTags(ctx context.Context) (map[string]map[string]*resourcemanagerpb.TagValue, error) {
-	tagKeysClient, err := crm.NewTagKeysClient(ctx)
+	tagKeysClient, err := crm.NewTagKeysClient(ctx, p.clientOptions...)
 	if err != nil {
 		return nil, err
 	}
 	defer tagKeysClient.Close()
 
-	tagValuesClient, err := crm.NewTagValuesClient(ctx)
+	tagValuesClient, err := crm.NewTagValuesClient(ctx, p.clientOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +174,7 @@ func (p *gcpProvider) ListAllTags(ctx context.Context) (map[string]map[string]*r
 }
 
 func (p *gcpProvider) getImageSizeGB(ctx context.Context, image string) (int64, error) {
-	client, err := compute.NewImagesRESTClient(ctx)
+	client, err := compute.NewImagesRESTClient(ctx, p.clientOptions...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create compute client: %w", err)
 	}
@@ -201,6 +220,11 @@ func (p *gcpProvider) getImageSizeGB(ctx context.Context, image string) (int64,
 	return img.GetDiskSizeGb(), nil
 }
 
+// diskType returns the URL of a disk type in the zone of the provider
+func (p *gcpProvider) diskType(name string) string {
+	return fmt.Sprintf("zones/%s/diskTypes/%s", p.serviceConfig.Zone, name)
+}
+
 // Select a machine type based on the memory, vcpu, and GPU requirements
 func (p *gcpProvider) selectMachineType(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
 	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.MachineTypeSpecList, p.serviceConfig.MachineTypes, p.serviceConfig.MachineType)
@@ -264,9 +288,9 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		return nil, fmt.Errorf("Failed to get image size: %w", err)
 	}
 
-	// If user provided RootVolumeSize, use the larger of the two
-	if p.serviceConfig.RootVolumeSize > 0 && int64(p.serviceConfig.RootVolumeSize) > imageSizeGB {
-		imageSizeGB = int64(p.serviceConfig.RootVolumeSize)
+	// If user provided RootVolumeSize, or the pod requested one, use the larger of it and the image size
+	if size := provider.RootVolumeSize(spec, p.serviceConfig.RootVolumeSize, int(imageSizeGB)); size > 0 {
+		imageSizeGB = int64(size)
 	}
 
 	// Format subnetwork: support both short names and full paths
@@ -308,20 +332,36 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		networkInterface.Subnetwork = subnetworkValue
 	}
 
-	instanceResource := &computepb.Instance{
-		Name: proto.String(instanceName),
-		Disks: []*computepb.AttachedDisk{
-			{
-				InitializeParams: &computepb.AttachedDiskInitializeParams{
-					DiskSizeGb:  proto.Int64(imageSizeGB),
-					SourceImage: srcImage,
-					DiskType:    proto.String(fmt.Sprintf("zones/%s/diskTypes/%s", p.serviceConfig.Zone, p.serviceConfig.DiskType)),
-				},
-				AutoDelete: proto.Bool(true),
-				Boot:       proto.Bool(true),
-				Type:       proto.String(computepb.AttachedDisk_PERSISTENT.String()),
-			},
+	bootDisk := &computepb.AttachedDisk{
+		InitializeParams: &computepb.AttachedDiskInitializeParams{
+			DiskSizeGb:  proto.Int64(imageSizeGB),
+			SourceImage: srcImage,
+			DiskType:    proto.String(p.diskType(cmp.Or(spec.RootVolumeType, p.serviceConfig.DiskType))),
 		},
+		AutoDelete: proto.Bool(true),
+		Boot:       proto.Bool(true),
+		Type:       proto.String(computepb.AttachedDisk_PERSISTENT.String()),
+	}
+	if spec.RootVolumeIOPS > 0 {
+		bootDisk.InitializeParams.ProvisionedIops = proto.Int64(int64(spec.RootVolumeIOPS))
+	}
+
+	disks := []*computepb.AttachedDisk{bootDisk}
+	for i, disk := range spec.DataDisks {
+		disks = append(disks, &computepb.AttachedDisk{
+			InitializeParams: &computepb.AttachedDiskInitializeParams{
+				DiskName:   proto.String(fmt.Sprintf("%s-data-%d", instanceName, i)),
+				DiskSizeGb: proto.Int64(int64(disk.Size)),
+				DiskType:   proto.String(p.diskType(cmp.Or(disk.Type, p.serviceConfig.DiskType))),
+			},
+			AutoDelete: proto.Bool(true),
+			Type:       proto.String(computepb.AttachedDisk_PERSISTENT.String()),
+		})
+	}
+
+	instanceResource := &computepb.Instance{
+		Name:  proto.String(instanceName),
+		Disks: disks,
 		Metadata: &computepb.Metadata{
 			Items: []*computepb.Items{
 				{
@@ -336,6 +376,7 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		},
 		MachineType:       proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", p.serviceConfig.Zone, machineType)),
 		NetworkInterfaces: []*computepb.NetworkInterface{networkInterface},
+		Labels:            labels(spec.Tags),
 	}
 
 	// Check if OnHostMaintenance needs to be set to TERMINATE
@@ -405,9 +446,9 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	// Binding all the tagValues to the instance that was already created
 	// Specific endpoint is needed for tag bindings because global endpoint
 	// doesn't work for zonal resources.
-	tagBindingsClient, err := crm.NewTagBindingsClient(ctx,
+	tagBindingsClient, err := crm.NewTagBindingsClient(ctx, append([]option.ClientOption{
 		option.WithEndpoint(fmt.Sprintf("%s-cloudresourcemanager.googleapis.com:443", p.serviceConfig.Zone)),
-	)
+	}, p.clientOptions...)...)
 	if err != nil {
 		return instance, fmt.Errorf("failed to create bind client: %w", err)
 	}
@@ -483,3 +524,25 @@ func hasAnyPrefix(s string, prefixes ...string) bool {
 	}
 	return false
 }
+
+// labels converts the tags of a pod VM to instance labels. The values of labels are limited to 63 lowercase
+// letters, digits, underscores and dashes, so other characters are replaced with dashes.
+func labels(tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		value := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return r - 'A' + 'a'
+			}
+			return '-'
+		}, v)
+		if len(value) > 63 {
+			value = value[:63]
+		}
+		labels[k] = value
+	}
+	return labels
+}
@@ -26,21 +26,22 @@ func (m *machineTypes) Set(value string) error {
 }
 
 type Config struct {
-	GcpCredentials      string
-	ProjectID           string
-	Zone                string
-	ImageName           string
-	MachineType         string
-	Network             string
-	Subnetwork          string
-	DiskType            string
-	DisableCVM          bool
-	ConfidentialType    string
-	RootVolumeSize      int
-	Tags                provider.KeyValueFlag
-	UsePublicIP         bool
-	MachineTypes        machineTypes
-	MachineTypeSpecList []provider.InstanceTypeSpec
+	GcpCredentials         string
+	WorkloadIdentityConfig string
+	ProjectID              string
+	Zone                   string
+	ImageName              string
+	MachineType            string
+	Network                string
+	Subnetwork             string
+	DiskType               string
+	DisableCVM             bool
+	ConfidentialType       string
+	RootVolumeSize         int
+	Tags                   provider.KeyValueFlag
+	UsePublicIP            bool
+	MachineTypes           machineTypes
+	MachineTypeSpecList    []provider.InstanceTypeSpec
 }
 
 func (c Config) Redact() Config {
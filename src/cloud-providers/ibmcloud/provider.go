@@ -4,13 +4,16 @@
 package ibmcloud
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/netip"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
@@ -38,6 +41,9 @@ var errNotReady = errors.New("address not ready")
 
 const maxInstanceNameLen = 63
 
+// defaultVolumeProfile is the profile of the volumes of pod VMs, unless requested otherwise
+const defaultVolumeProfile = "general-purpose"
+
 type vpcV1 interface {
 	CreateInstanceWithContext(context.Context, *vpcv1.CreateInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
 	GetInstanceWithContext(context.Context, *vpcv1.GetInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
@@ -333,12 +339,16 @@ func pickIDInZone(ids []string, zoneName string, getZone func(string) (string, e
 	return selected, nil
 }
 
-func (p *ibmcloudVPCProvider) getAttachTagOptions(vpcInstanceCRN *string) (*globaltaggingv1.AttachTagOptions, error) {
+func (p *ibmcloudVPCProvider) getAttachTagOptions(vpcInstanceCRN *string, spec provider.InstanceTypeSpec) (*globaltaggingv1.AttachTagOptions, error) {
 	if vpcInstanceCRN == nil {
 		return nil, fmt.Errorf("missing vpc instance crn, can't create attach tag options")
 	}
 
 	tagNames := append([]string{"coco-pod-vm:" + p.serviceConfig.ClusterID}, p.serviceConfig.Tags...)
+	// The tags of the pod VM are attached as key:value tags
+	for _, k := range slices.Sorted(maps.Keys(spec.Tags)) {
+		tagNames = append(tagNames, k+":"+spec.Tags[k])
+	}
 
 	options := &globaltaggingv1.AttachTagOptions{
 		Resources: []globaltaggingv1.Resource{{ResourceID: vpcInstanceCRN}},
@@ -418,6 +428,45 @@ func (p *ibmcloudVPCProvider) getInstancePrototype(instanceName, userData, insta
 	return prototype
 }
 
+// setVolumes sets the boot volume and the data volumes of an instance as requested for the pod
+func (p *ibmcloudVPCProvider) setVolumes(ctx context.Context, prototype *vpcv1.InstancePrototype, imageID string, spec provider.InstanceTypeSpec) error {
+	if spec.RootVolumeSize > 0 || spec.RootVolumeType != "" || spec.RootVolumeIOPS > 0 {
+		volume := &vpcv1.VolumePrototypeInstanceByImageContext{
+			Profile: &vpcv1.VolumeProfileIdentityByName{Name: core.StringPtr(cmp.Or(spec.RootVolumeType, defaultVolumeProfile))},
+		}
+		if spec.RootVolumeSize > 0 {
+			image, _, err := p.vpc.GetImageWithContext(ctx, &vpcv1.GetImageOptions{ID: &imageID})
+			if err != nil {
+				return fmt.Errorf("failed to get image %s: %w", imageID, err)
+			}
+			var imageSize int
+			if image.MinimumProvisionedSize != nil {
+				imageSize = int(*image.MinimumProvisionedSize)
+			}
+			volume.Capacity = core.Int64Ptr(int64(provider.RootVolumeSize(spec, 0, imageSize)))
+		}
+		if spec.RootVolumeIOPS > 0 {
+			volume.Iops = core.Int64Ptr(int64(spec.RootVolumeIOPS))
+		}
+		prototype.BootVolumeAttachment = &vpcv1.VolumeAttachmentPrototypeInstanceByImageContext{
+			DeleteVolumeOnInstanceDelete: core.BoolPtr(true),
+			Volume:                       volume,
+		}
+	}
+
+	for _, disk := range spec.DataDisks {
+		prototype.VolumeAttachments = append(prototype.VolumeAttachments, vpcv1.VolumeAttachmentPrototype{
+			DeleteVolumeOnInstanceDelete: core.BoolPtr(true),
+			Volume: &vpcv1.VolumeAttachmentPrototypeVolumeVolumePrototypeInstanceContextVolumePrototypeInstanceContextVolumeByCapacity{
+				Profile:  &vpcv1.VolumeProfileIdentityByName{Name: core.StringPtr(cmp.Or(disk.Type, defaultVolumeProfile))},
+				Capacity: core.Int64Ptr(int64(disk.Size)),
+			},
+		})
+	}
+
+	return nil
+}
+
 func getIPs(instance *vpcv1.Instance, instanceID string, numInterfaces int) ([]netip.Addr, error) {
 
 	interfaces := []*vpcv1.NetworkInterfaceInstanceContextReference{instance.PrimaryNetworkInterface}
@@ -481,6 +530,10 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 
 	prototype := p.getInstancePrototype(instanceName, userData, instanceProfile, imageID)
 
+	if err := p.setVolumes(ctx, prototype, imageID, spec); err != nil {
+		return nil, err
+	}
+
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
 	vpcInstance, err := p.createInstanceWithFallback(ctx, prototype)
@@ -522,7 +575,7 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 
 	instance.IPs = ips
 
-	options, err := p.getAttachTagOptions(vpcInstance.CRN)
+	options, err := p.getAttachTagOptions(vpcInstance.CRN, spec)
 	if err != nil {
 		return instance, fmt.Errorf("failed to get attach tag options: %w", err)
 	}
@@ -111,6 +111,7 @@ func (v *mockVPC) GetImageWithContext(context context.Context, options *vpcv1.Ge
 	os := "ubuntu"
 
 	return &vpcv1.Image{
+		MinimumProvisionedSize: core.Int64Ptr(100),
 		OperatingSystem: &vpcv1.OperatingSystem{
 			Architecture: &arch,
 			Name:         &os,
@@ -470,3 +471,45 @@ func TestConfigVerifier(t *testing.T) {
 		})
 	}
 }
+
+func TestSetVolumes(t *testing.T) {
+	p := &ibmcloudVPCProvider{
+		vpc:           &mockVPC{},
+		serviceConfig: &Config{},
+	}
+
+	prototype := &vpcv1.InstancePrototype{}
+	err := p.setVolumes(context.Background(), prototype, "image-id", provider.InstanceTypeSpec{})
+	assert.NoError(t, err)
+	assert.Nil(t, prototype.BootVolumeAttachment)
+	assert.Empty(t, prototype.VolumeAttachments)
+
+	spec := provider.InstanceTypeSpec{
+		RootVolumeSize: 200,
+		RootVolumeIOPS: 3000,
+		DataDisks:      []provider.DataDisk{{Size: 50}, {Size: 20, Type: "5iops-tier"}},
+	}
+	err = p.setVolumes(context.Background(), prototype, "image-id", spec)
+	assert.NoError(t, err)
+	volume := prototype.BootVolumeAttachment.Volume
+	assert.Equal(t, int64(200), *volume.Capacity)
+	assert.Equal(t, int64(3000), *volume.Iops)
+	assert.Equal(t, defaultVolumeProfile, *volume.Profile.(*vpcv1.VolumeProfileIdentityByName).Name)
+	assert.True(t, *prototype.BootVolumeAttachment.DeleteVolumeOnInstanceDelete)
+
+	assert.Len(t, prototype.VolumeAttachments, 2)
+	data := prototype.VolumeAttachments[1].Volume.(*vpcv1.VolumeAttachmentPrototypeVolumeVolumePrototypeInstanceContextVolumePrototypeInstanceContextVolumeByCapacity)
+	assert.Equal(t, int64(20), *data.Capacity)
+	assert.Equal(t, "5iops-tier", *data.Profile.(*vpcv1.VolumeProfileIdentityByName).Name)
+	assert.True(t, *prototype.VolumeAttachments[1].DeleteVolumeOnInstanceDelete)
+
+	// The boot volume is not smaller than the image
+	prototype = &vpcv1.InstancePrototype{}
+	err = p.setVolumes(context.Background(), prototype, "image-id", provider.InstanceTypeSpec{RootVolumeSize: 50, RootVolumeType: "10iops-tier"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), *prototype.BootVolumeAttachment.Volume.Capacity)
+	assert.Equal(t, "10iops-tier", *prototype.BootVolumeAttachment.Volume.Profile.(*vpcv1.VolumeProfileIdentityByName).Name)
+
+	err = p.setVolumes(context.Background(), prototype, "notfound-image", provider.InstanceTypeSpec{RootVolumeSize: 50})
+	assert.Error(t, err)
+}
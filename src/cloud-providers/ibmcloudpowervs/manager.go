@@ -22,7 +22,11 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg := provider.NewFlagRegistrar(flags)
 
 	// Flags with environment variable support
-	reg.StringWithEnv(&ibmcloudPowerVSConfig.APIKey, "api-key", "", "IBMCLOUD_API_KEY", "IBM Cloud API key", provider.Secret(), provider.Required())
+	reg.StringWithEnv(&ibmcloudPowerVSConfig.APIKey, "api-key", "", "IBMCLOUD_API_KEY", "IBM Cloud API key", provider.Secret())
+	reg.StringWithEnv(&ibmcloudPowerVSConfig.APIKeyFile, "api-key-file", "", "IBMCLOUD_API_KEY_FILE", "IBM Cloud API key file, read again when it changes")
+	reg.StringWithEnv(&ibmcloudPowerVSConfig.IAMProfileID, "iam-profile-id", "", "IBMCLOUD_IAM_PROFILE_ID", "ID of the trusted profile used with the compute resource token")
+	reg.StringWithEnv(&ibmcloudPowerVSConfig.CRTokenFile, "cr-token-file", "", "IBMCLOUD_CR_TOKEN_FILE", "Compute resource token file, e.g. a projected service account token")
+	reg.StringWithEnv(&ibmcloudPowerVSConfig.AccountID, "account-id", "", "IBMCLOUD_ACCOUNT_ID", "IBM Cloud account ID, required with a trusted profile")
 	reg.StringWithEnv(&ibmcloudPowerVSConfig.Zone, "zone", "", "POWERVS_ZONE", "PowerVS zone name", provider.Required())
 	reg.StringWithEnv(&ibmcloudPowerVSConfig.ServiceInstanceID, "service-instance-id", "", "POWERVS_SERVICE_INSTANCE_ID", "ID of the PowerVS Service Instance", provider.Required())
 	reg.StringWithEnv(&ibmcloudPowerVSConfig.NetworkID, "network-id", "", "POWERVS_NETWORK_ID", "ID of the network instance", provider.Required())
@@ -34,6 +38,10 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg.Float64WithEnv(&ibmcloudPowerVSConfig.Processors, "cpu", 0.5, "POWERVS_PROCESSORS", "Number of processors allocated")
 	reg.BoolWithEnv(&ibmcloudPowerVSConfig.UsePublicIP, "use-public-ip", false, "USE_PUBLIC_IP", "Use Public IP for connecting to the agent-protocol-forwarder inside the Pod VM")
 	reg.DurationWithEnv(&ibmcloudPowerVSConfig.BuildTimeout, "build-timeout", 150*time.Second, "POWERVS_BUILD_TIMEOUT", "Maximum timeout to build the VM")
+
+	// Custom flag types (comma-separated lists)
+	reg.CustomTypeWithEnv(&ibmcloudPowerVSConfig.InstanceTypes, "instance-types", "", "PODVM_INSTANCE_TYPES", "Instance types to be used for the Pod VMs, as <system type>-<processors>x<memory in GB>, comma separated")
+	reg.CustomTypeWithEnv(&ibmcloudPowerVSConfig.Tags, "tags", "", "TAGS", "List of tags to attach to the Pod VMs, comma separated")
 }
 
 func (*Manager) LoadEnv() {
@@ -5,11 +5,15 @@ package ibmcloudpowervs
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/IBM-Cloud/power-go-client/clients/instance"
 	"github.com/IBM-Cloud/power-go-client/ibmpisession"
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/IBM/platform-services-go-sdk/iamidentityv1"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
 type powervsService struct {
@@ -17,22 +21,31 @@ type powervsService struct {
 	serviceInstanceID string
 }
 
-func newPowervsClient(apikey, serviceinstanceID, zone string) (*powervsService, error) {
-	options := &ibmpisession.IBMPIOptions{}
-	options.Authenticator = &core.IamAuthenticator{
-		ApiKey: apikey,
-	}
-	ic, err := newIdentityClient(options.Authenticator)
+func newPowervsClient(config *Config) (*powervsService, error) {
+	auth, err := newAuthenticator(config)
 	if err != nil {
 		return nil, err
 	}
 
-	account, err := getAccount(apikey, ic)
-	if err != nil {
-		return nil, err
+	options := &ibmpisession.IBMPIOptions{}
+	options.Authenticator = auth
+
+	account := config.AccountID
+	if account == "" {
+		key := currentAPIKey(config, auth)
+		ic, err := newIdentityClient(options.Authenticator)
+		if err != nil {
+			return nil, err
+		}
+
+		accountID, err := getAccount(key, ic)
+		if err != nil {
+			return nil, err
+		}
+		account = *accountID
 	}
-	options.UserAccount = *account
-	options.Zone = zone
+	options.UserAccount = account
+	options.Zone = config.Zone
 
 	piSession, err := ibmpisession.NewIBMPISession(options)
 	if err != nil {
@@ -41,10 +54,71 @@ func newPowervsClient(apikey, serviceinstanceID, zone string) (*powervsService,
 
 	return &powervsService{
 		session:           piSession,
-		serviceInstanceID: serviceinstanceID,
+		serviceInstanceID: config.ServiceInstanceID,
 	}, nil
 }
 
+// newAuthenticator returns the authenticator of an API key, an API key file, or a trusted profile
+func newAuthenticator(config *Config) (core.Authenticator, error) {
+	switch {
+	case config.APIKey != "":
+		return &core.IamAuthenticator{
+			ApiKey: config.APIKey,
+		}, nil
+	case config.APIKeyFile != "":
+		logger.Printf("using API key file %s", config.APIKeyFile)
+		return newAPIKeyFileAuthenticator(config.APIKeyFile)
+	case config.IAMProfileID != "":
+		if config.AccountID == "" {
+			return nil, fmt.Errorf("the account ID is required with a trusted profile")
+		}
+		logger.Printf("using trusted profile %s", config.IAMProfileID)
+		// The compute resource token file is read again each time a token is requested
+		return core.NewContainerAuthenticatorBuilder().
+			SetIAMProfileID(config.IAMProfileID).
+			SetCRTokenFilename(config.CRTokenFile).
+			Build()
+	default:
+		return nil, fmt.Errorf("an API key, an API key file or a trusted profile is required")
+	}
+}
+
+// currentAPIKey returns the API key used by an authenticator
+func currentAPIKey(config *Config, auth core.Authenticator) string {
+	if a, ok := auth.(*apiKeyFileAuthenticator); ok {
+		return a.iam.Get().ApiKey
+	}
+	return config.APIKey
+}
+
+// apiKeyFileAuthenticator is an IAM authenticator with the API key read from a file, e.g. mounted
+// from a Secret. The authenticator is created again when the API key is rotated.
+type apiKeyFileAuthenticator struct {
+	iam *util.SecretFileValue[*core.IamAuthenticator]
+}
+
+func newAPIKeyFileAuthenticator(path string) (*apiKeyFileAuthenticator, error) {
+	iam, err := util.NewSecretFileValue(path, func(data []byte) (*core.IamAuthenticator, error) {
+		return core.NewIamAuthenticatorBuilder().SetApiKey(strings.TrimSpace(string(data))).Build()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &apiKeyFileAuthenticator{iam: iam}, nil
+}
+
+func (a *apiKeyFileAuthenticator) AuthenticationType() string {
+	return core.AUTHTYPE_IAM
+}
+
+func (a *apiKeyFileAuthenticator) Authenticate(request *http.Request) error {
+	return a.iam.Get().Authenticate(request)
+}
+
+func (a *apiKeyFileAuthenticator) Validate() error {
+	return a.iam.Get().Validate()
+}
+
 func (s *powervsService) instanceClient(ctx context.Context) *instance.IBMPIInstanceClient {
 	return instance.NewIBMPIInstanceClient(ctx, s.session, s.serviceInstanceID)
 }
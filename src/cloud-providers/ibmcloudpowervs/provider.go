@@ -8,9 +8,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"maps"
+	"math"
 	"net/netip"
-	"strconv"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/IBM-Cloud/power-go-client/power/models"
@@ -34,15 +35,21 @@ func NewProvider(config *Config) (provider.Provider, error) {
 
 	logger.Printf("ibmcloud-powervs config: %#v", config.Redact())
 
-	powervs, err := newPowervsClient(config.APIKey, config.ServiceInstanceID, config.Zone)
+	powervs, err := newPowervsClient(config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ibmcloudPowerVSProvider{
+	provider := &ibmcloudPowerVSProvider{
 		powervsService: *powervs,
 		serviceConfig:  config,
-	}, nil
+	}
+
+	if err := provider.updateInstanceTypeSpecList(); err != nil {
+		return nil, fmt.Errorf("failed to update instance type spec list: %w", err)
+	}
+
+	return provider, nil
 }
 
 func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
@@ -61,34 +68,14 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 		imageID = spec.Image
 	}
 
-	memory := p.serviceConfig.Memory
-	processors := p.serviceConfig.Processors
-	systemType := p.serviceConfig.SystemType
-
-	// If vCPU and memory are set in annotations then use it
-	// If machine type is set in annotations then use it (ie. shape <system_type>-<cpu>x<memoery>)
-	// vCPU and Memory gets higher priority than instance type from annotation
-	if spec.VCPUs != 0 && spec.Memory != 0 {
-		memory = float64(spec.Memory / 1024)
-		processors = float64(spec.VCPUs)
-		logger.Printf("Instance type selected by the cloud provider based on vCPU and memory annotations: %s-%gx%g", systemType, processors, memory)
-	} else if spec.InstanceType != "" {
-		typeAndSize := strings.Split(spec.InstanceType, "-")
-		systemType = typeAndSize[0]
-		size := strings.Split(typeAndSize[1], "x")
-		f, err := strconv.Atoi(size[0])
-		if err != nil {
-			return nil, err
-		}
-		processors = float64(f)
-		m, err := strconv.Atoi(size[1])
-		if err != nil {
-			return nil, err
-		}
-		memory = float64(m)
-		logger.Printf("Instance type selected by the cloud provider based on instance type annotation: %s", spec.InstanceType)
-	} else {
-		logger.Printf("Instance type selected by the cloud provider based on config: %s-%gx%g", systemType, processors, memory)
+	instanceType, err := p.selectInstanceType(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	systemType, processors, memory, err := parseInstanceType(instanceType)
+	if err != nil {
+		return nil, err
 	}
 
 	body := &models.PVMInstanceCreate{
@@ -104,6 +91,7 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 		ProcType:   core.StringPtr(p.serviceConfig.ProcessorType),
 		SysType:    systemType,
 		UserData:   base64.StdEncoding.EncodeToString([]byte(userData)),
+		UserTags:   p.userTags(spec),
 	}
 
 	logger.Printf("CreateInstance: name: %q", instanceName)
@@ -202,6 +190,62 @@ func (p *ibmcloudPowerVSProvider) ConfigVerifier() error {
 	return nil
 }
 
+// userTags returns the configured tags with the tags of the pod VM as key:value tags
+func (p *ibmcloudPowerVSProvider) userTags(spec provider.InstanceTypeSpec) models.Tags {
+	userTags := slices.Clone(p.serviceConfig.Tags)
+	for _, k := range slices.Sorted(maps.Keys(spec.Tags)) {
+		userTags = append(userTags, k+":"+spec.Tags[k])
+	}
+	return models.Tags(userTags)
+}
+
+// selectInstanceType selects the shape of a Pod VM from the instance type annotation, or from the vCPU
+// and memory annotations. Without PODVM_INSTANCE_TYPES, any shape is allowed, and the vCPU and memory
+// annotations are used as the processors and memory of the configured system type.
+func (p *ibmcloudPowerVSProvider) selectInstanceType(_ context.Context, spec provider.InstanceTypeSpec) (string, error) {
+
+	if len(p.serviceConfig.InstanceTypes) > 0 {
+		return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceTypeSpecList, p.serviceConfig.InstanceTypes, p.serviceConfig.defaultInstanceType())
+	}
+
+	switch {
+	case spec.VCPUs != 0 && spec.Memory != 0:
+		// The memory annotation is in MiB, and the memory of a shape in GB
+		instanceType := formatInstanceType(p.serviceConfig.SystemType, float64(spec.VCPUs), math.Ceil(float64(spec.Memory)/1024))
+		logger.Printf("Instance type selected by the cloud provider based on vCPU and memory annotations: %s", instanceType)
+		return instanceType, nil
+	case spec.InstanceType != "":
+		if _, _, _, err := parseInstanceType(spec.InstanceType); err != nil {
+			return "", err
+		}
+		logger.Printf("Instance type selected by the cloud provider based on instance type annotation: %s", spec.InstanceType)
+		return spec.InstanceType, nil
+	default:
+		return p.serviceConfig.defaultInstanceType(), nil
+	}
+}
+
+// updateInstanceTypeSpecList populates InstanceTypeSpecList from the shapes of the allowed instance types, if any.
+// A processor is counted as a vCPU, rounded up for fractional processors.
+func (p *ibmcloudPowerVSProvider) updateInstanceTypeSpecList() error {
+	var instanceTypeSpecList []provider.InstanceTypeSpec
+	for _, instanceType := range p.serviceConfig.InstanceTypes {
+		_, processors, memory, err := parseInstanceType(instanceType)
+		if err != nil {
+			return err
+		}
+		instanceTypeSpecList = append(instanceTypeSpecList, provider.InstanceTypeSpec{
+			InstanceType: instanceType,
+			VCPUs:        int64(math.Ceil(processors)),
+			Memory:       int64(memory * 1024),
+		})
+	}
+
+	p.serviceConfig.InstanceTypeSpecList = provider.SortInstanceTypesOnResources(instanceTypeSpecList)
+	logger.Printf("InstanceTypeSpecList (%v)", p.serviceConfig.InstanceTypeSpecList)
+	return nil
+}
+
 func (p *ibmcloudPowerVSProvider) getVMIPs(ctx context.Context, instanceID string) ([]netip.Addr, error) {
 	var ips []netip.Addr
 	ins, err := p.powervsService.instanceClient(ctx).Get(instanceID)
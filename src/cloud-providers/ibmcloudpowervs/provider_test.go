@@ -0,0 +1,157 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ibmcloudpowervs
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestParseInstanceType(t *testing.T) {
+	for instanceType, want := range map[string]struct {
+		systemType         string
+		processors, memory float64
+	}{
+		"s922-0.5x2": {"s922", 0.5, 2},
+		"e980-4x32":  {"e980", 4, 32},
+	} {
+		systemType, processors, memory, err := parseInstanceType(instanceType)
+		if err != nil {
+			t.Errorf("parseInstanceType(%q): %v", instanceType, err)
+			continue
+		}
+		if systemType != want.systemType || processors != want.processors || memory != want.memory {
+			t.Errorf("parseInstanceType(%q) = %s, %g, %g, want %s, %g, %g", instanceType, systemType, processors, memory, want.systemType, want.processors, want.memory)
+		}
+	}
+
+	for _, instanceType := range []string{"", "s922", "s922-2", "-2x4", "s922-0x4", "s922-2x-4", "s922-ax4", "s922-NaNx4"} {
+		if _, _, _, err := parseInstanceType(instanceType); err == nil {
+			t.Errorf("parseInstanceType(%q) succeeded, want an error", instanceType)
+		}
+	}
+}
+
+func TestSelectInstanceType(t *testing.T) {
+	p := &ibmcloudPowerVSProvider{
+		serviceConfig: &Config{
+			SystemType:    "s922",
+			Processors:    0.5,
+			Memory:        2,
+			InstanceTypes: instanceTypes{"s922-0.5x2", "s922-4x16", "s922-2x8"},
+		},
+	}
+	if err := p.updateInstanceTypeSpecList(); err != nil {
+		t.Fatalf("updateInstanceTypeSpecList: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		spec    provider.InstanceTypeSpec
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "s922-0.5x2"},
+		{name: "annotation", spec: provider.InstanceTypeSpec{InstanceType: "s922-4x16"}, want: "s922-4x16"},
+		{name: "annotation not allowed", spec: provider.InstanceTypeSpec{InstanceType: "s922-8x64"}, wantErr: true},
+		{name: "annotation invalid", spec: provider.InstanceTypeSpec{InstanceType: "s922"}, wantErr: true},
+		{name: "best fit", spec: provider.InstanceTypeSpec{VCPUs: 2, Memory: 6144}, want: "s922-2x8"},
+		{name: "fractional best fit", spec: provider.InstanceTypeSpec{VCPUs: 1, Memory: 2048}, want: "s922-0.5x2"},
+		{name: "no fit", spec: provider.InstanceTypeSpec{VCPUs: 8, Memory: 8192}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.selectInstanceType(context.Background(), tc.spec)
+			if err == nil {
+				// An allowed instance type must also be a valid shape
+				_, _, _, err = parseInstanceType(got)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("selectInstanceType() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectInstanceType(): %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("selectInstanceType() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelectInstanceTypeFreeForm(t *testing.T) {
+	p := &ibmcloudPowerVSProvider{
+		serviceConfig: &Config{
+			SystemType: "s922",
+			Processors: 0.5,
+			Memory:     2,
+		},
+	}
+	if err := p.updateInstanceTypeSpecList(); err != nil {
+		t.Fatalf("updateInstanceTypeSpecList: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		spec    provider.InstanceTypeSpec
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "s922-0.5x2"},
+		{name: "annotation", spec: provider.InstanceTypeSpec{InstanceType: "e980-8x64"}, want: "e980-8x64"},
+		{name: "annotation invalid", spec: provider.InstanceTypeSpec{InstanceType: "s922"}, wantErr: true},
+		{name: "vCPU and memory", spec: provider.InstanceTypeSpec{VCPUs: 8, Memory: 32768}, want: "s922-8x32"},
+		{name: "memory rounded up", spec: provider.InstanceTypeSpec{VCPUs: 1, Memory: 512}, want: "s922-1x1"},
+		{name: "vCPU and memory over annotation", spec: provider.InstanceTypeSpec{InstanceType: "e980-8x64", VCPUs: 2, Memory: 4096}, want: "s922-2x4"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.selectInstanceType(context.Background(), tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("selectInstanceType() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectInstanceType(): %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("selectInstanceType() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateInstanceTypeSpecListInvalid(t *testing.T) {
+	p := &ibmcloudPowerVSProvider{
+		serviceConfig: &Config{
+			SystemType:    "s922",
+			Processors:    0.5,
+			Memory:        2,
+			InstanceTypes: instanceTypes{"s922-2x8", "2x8"},
+		},
+	}
+	if err := p.updateInstanceTypeSpecList(); err == nil {
+		t.Errorf("updateInstanceTypeSpecList() succeeded with an invalid instance type, want an error")
+	}
+}
+
+func TestUserTags(t *testing.T) {
+	p := &ibmcloudPowerVSProvider{serviceConfig: &Config{Tags: tags{"team-a"}}}
+	spec := provider.InstanceTypeSpec{Tags: map[string]string{provider.TagPodName: "nginx", provider.TagPodNamespace: "default"}}
+
+	got := p.userTags(spec)
+	want := []string{"team-a", "peerpods-pod-name:nginx", "peerpods-pod-namespace:default"}
+	if !slices.Equal(got, want) {
+		t.Errorf("userTags() = %v, want %v", got, want)
+	}
+	if len(p.serviceConfig.Tags) != 1 {
+		t.Errorf("userTags() changed the configured tags: %v", p.serviceConfig.Tags)
+	}
+}
@@ -4,26 +4,94 @@
 package ibmcloudpowervs
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
+type instanceTypes []string
+
+func (i *instanceTypes) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *instanceTypes) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(instanceTypes, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type tags []string
+
+func (i *tags) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *tags) Set(value string) error {
+	if len(value) > 0 {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
 type Config struct {
-	APIKey            string
-	Zone              string
-	ServiceInstanceID string
-	NetworkID         string
-	ImageID           string
-	SSHKey            string
-	Memory            float64
-	Processors        float64
-	ProcessorType     string
-	SystemType        string
-	UsePublicIP       bool
-	BuildTimeout      time.Duration
+	APIKey               string
+	APIKeyFile           string
+	IAMProfileID         string
+	CRTokenFile          string
+	AccountID            string
+	Zone                 string
+	ServiceInstanceID    string
+	NetworkID            string
+	ImageID              string
+	SSHKey               string
+	Memory               float64
+	Processors           float64
+	ProcessorType        string
+	SystemType           string
+	InstanceTypes        instanceTypes
+	InstanceTypeSpecList []provider.InstanceTypeSpec
+	Tags                 tags
+	UsePublicIP          bool
+	BuildTimeout         time.Duration
 }
 
 func (c Config) Redact() Config {
 	return *util.RedactStruct(&c, "APIKey").(*Config)
 }
+
+// defaultInstanceType returns the shape of the configured system type, processors and memory
+func (c *Config) defaultInstanceType() string {
+	return formatInstanceType(c.SystemType, c.Processors, c.Memory)
+}
+
+// formatInstanceType returns the shape <system type>-<processors>x<memory in GB>, e.g. s922-0.5x2
+func formatInstanceType(systemType string, processors, memory float64) string {
+	return fmt.Sprintf("%s-%gx%g", systemType, processors, memory)
+}
+
+// parseInstanceType parses a shape of the form <system type>-<processors>x<memory in GB>
+func parseInstanceType(instanceType string) (systemType string, processors, memory float64, err error) {
+	systemType, size, ok := strings.Cut(instanceType, "-")
+	var processorsStr, memoryStr string
+	if ok {
+		processorsStr, memoryStr, ok = strings.Cut(size, "x")
+	}
+	if ok {
+		processors, err = strconv.ParseFloat(processorsStr, 64)
+		if err == nil {
+			memory, err = strconv.ParseFloat(memoryStr, 64)
+		}
+	}
+	if !ok || err != nil || systemType == "" || !(processors > 0 && memory > 0) {
+		return "", 0, 0, fmt.Errorf("invalid instance type %q, expected <system type>-<processors>x<memory in GB>, e.g. s922-0.5x2", instanceType)
+	}
+	return systemType, processors, memory, nil
+}
@@ -0,0 +1,40 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	CR "crypto/rand"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"libvirt.org/go/libvirtxml"
+)
+
+func TestInMemoryCopier(t *testing.T) {
+	// generate some test data
+	size := rand.Intn(1000) + 1000
+	buf := make([]byte, size)
+	_, err := CR.Read(buf)
+	require.NoError(t, err)
+	// build the image abstraction
+	img, err := newImageFromBytes(buf)
+	require.NoError(t, err)
+
+	sizeFromImg, err := img.size()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(size), sizeFromImg)
+
+	var otherBuf []byte
+	err = img.importImage(func(rdr io.Reader) error {
+		bufRead, err := io.ReadAll(rdr)
+		otherBuf = bufRead
+		return err
+	}, libvirtxml.StorageVolume{})
+	require.NoError(t, err)
+
+	assert.Equal(t, buf, otherBuf)
+}
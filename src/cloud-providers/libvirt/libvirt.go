@@ -10,13 +10,17 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"maps"
 	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
 	retry "github.com/avast/retry-go/v4"
 	libvirt "libvirt.org/go/libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 const (
@@ -24,6 +28,10 @@ const (
 	archS390x = "s390x"
 	// architecutre value for aarch64/arm64
 	archAArch64 = "aarch64"
+	// architecture value for x86_64
+	archX86_64 = "x86_64"
+	// namespace of the metadata element of the tags of domains
+	tagsNamespace = "urn:confidential-containers:peerpods"
 	// hvm indicates that the OS is one designed to run on bare metal, so requires full virtualization.
 	typeHardwareVirtualMachine = "hvm"
 	// The amount of retries to get the domain IP addresses
@@ -32,6 +40,13 @@ const (
 	GetDomainIPsSleep = time.Second * 3
 )
 
+const (
+	// SEV-SNP guest policy: SMT allowed, and the reserved bit 17 that must be set
+	sevSNPPolicy uint64 = 0x30000
+	// TDX guest policy: EPT violations are not converted to #VE exceptions (SEPT_VE_DISABLE)
+	tdxPolicy uint = 0x10000000
+)
+
 type domainConfig struct {
 	name        string
 	cpu         uint
@@ -39,16 +54,57 @@ type domainConfig struct {
 	networkName string
 	bootDisk    string
 	cidataDisk  string
+	dataDisks   []string
+	// networks of the interfaces after the first one
+	extraNetworks []string
 }
 
-// createCloudInitISO creates an ISO file with a userdata and a metadata file. The ISO image will be created in-memory since it is small
-func createCloudInitISO(v *vmConfig) ([]byte, error) {
+// appendDataDisks appends the data volumes of a domain to its disks as virtio disks,
+// skipping the device names that are already in use
+func appendDataDisks(disks []libvirtxml.DomainDisk, cfg *domainConfig) []libvirtxml.DomainDisk {
+	used := map[string]bool{}
+	for _, disk := range disks {
+		if disk.Target != nil {
+			used[disk.Target.Dev] = true
+		}
+	}
+
+	dev := 'a'
+	for _, path := range cfg.dataDisks {
+		for used[fmt.Sprintf("vd%c", dev)] {
+			dev++
+		}
+		name := fmt.Sprintf("vd%c", dev)
+		used[name] = true
+		disks = append(disks, libvirtxml.DomainDisk{
+			Device: "disk",
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "qcow2"},
+			Source: &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{File: path},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: name, Bus: "virtio"},
+		})
+	}
+	return disks
+}
+
+// createCloudInitISO creates an ISO file with a userdata and a metadata file, and a network-config file for VMs with a
+// static IP address. The ISO image will be created in-memory since it is small
+func createCloudInitISO(v *vmConfig, staticIPs *staticIPConfig) ([]byte, error) {
 	logger.Println("Create cloudInit iso")
 
 	userData := v.userData
 	metaData := fmt.Sprintf("local-hostname: %s", v.name)
 
-	return createCloudInit([]byte(userData), []byte(metaData))
+	if !v.staticIP.IsValid() || staticIPs == nil {
+		return cloudinit.NoCloudISO([]byte(userData), []byte(metaData))
+	}
+
+	networkConfig, err := createNetworkConfig(v, staticIPs.gateway)
+	if err != nil {
+		return nil, fmt.Errorf("creating network config: %w", err)
+	}
+	return cloudinit.NoCloudISOWithNetworkConfig([]byte(userData), []byte(metaData), networkConfig)
 }
 
 func checkDomainExistsByName(name string, libvirtClient *libvirtClient) (exist bool, err error) {
@@ -241,10 +297,7 @@ func createDomainXMLs390x(client *libvirtClient, cfg *domainConfig, vm *vmConfig
 			Offset: "utc",
 		},
 		Devices: &libvirtxml.DomainDeviceList{
-			Disks: []libvirtxml.DomainDisk{
-				bootDisk,
-				cloudInitDisk,
-			},
+			Disks:    appendDataDisks([]libvirtxml.DomainDisk{bootDisk, cloudInitDisk}, cfg),
 			Emulator: guest.Arch.Emulator,
 			MemBalloon: &libvirtxml.DomainMemBalloon{
 				Model: "none",
@@ -351,7 +404,9 @@ func createDomainXMLx86_64(client *libvirtClient, cfg *domainConfig, vm *vmConfi
 		},
 	}
 
-	if vm.firmware != "" {
+	confidential := vm.launchSecurityType == SEVSNP || vm.launchSecurityType == TDX
+
+	if vm.firmware != "" && !confidential {
 		domain.OS.Loader = &libvirtxml.DomainLoader{
 			Path:     vm.firmware,
 			Readonly: "yes",
@@ -359,9 +414,12 @@ func createDomainXMLx86_64(client *libvirtClient, cfg *domainConfig, vm *vmConfi
 		}
 
 		domain.OS.Firmware = "efi"
+	}
 
-		// TODO - IDE seems to only work with packer builds and sata only with mkosi,
-		// so we temporarily use the firmware being non-blank to assume this is mkosi
+	// TODO - IDE seems to only work with packer builds and sata only with mkosi,
+	// so we temporarily use the firmware being non-blank to assume this is mkosi.
+	// Confidential VMs use the q35 machine, which has no IDE controller.
+	if vm.firmware != "" || confidential {
 		cidataDiskIndex := 1
 		var cidataDiskAddr uint = 1
 		domain.Devices.Disks[cidataDiskIndex].Target.Bus = "sata"
@@ -369,15 +427,118 @@ func createDomainXMLx86_64(client *libvirtClient, cfg *domainConfig, vm *vmConfi
 		domain.Devices.Disks[cidataDiskIndex].Address.Drive.Unit = &cidataDiskAddr
 	}
 
+	domain.Devices.Disks = appendDataDisks(domain.Devices.Disks, cfg)
+
 	switch l := vm.launchSecurityType; l {
 	case NoLaunchSecurity:
 		return domain, nil
+	case SEVSNP, TDX:
+		launchSecurity, err := launchSecurityx86_64(client.domainCaps, vm)
+		if err != nil {
+			return nil, err
+		}
+		setConfidentialx86_64(domain, vm)
+		domain.LaunchSecurity = launchSecurity
+		return domain, nil
 	default:
 		return nil, fmt.Errorf("launch Security type is not supported for this domain: %s", l)
 	}
 
 }
 
+// launchSecurityx86_64 returns the launchSecurity element of SEV-SNP and TDX domains, with the
+// C-bit position of SEV-SNP read from the domain capabilities of the host
+func launchSecurityx86_64(caps *libvirtxml.DomainCaps, vm *vmConfig) (*libvirtxml.DomainLaunchSecurity, error) {
+	if caps == nil || caps.Features == nil {
+		return nil, fmt.Errorf("%s requires the domain capabilities of the host", vm.launchSecurityType)
+	}
+
+	switch vm.launchSecurityType {
+	case SEVSNP:
+		sev := caps.Features.SEV
+		if sev == nil || sev.Supported != "yes" {
+			return nil, fmt.Errorf("SEV is not supported by the host")
+		}
+		policy := sevSNPPolicy
+		launchSecurity := &libvirtxml.DomainLaunchSecuritySEVSNP{
+			CBitPos:         &sev.CBitPos,
+			ReducedPhysBits: &sev.ReducedPhysBits,
+			Policy:          &policy,
+		}
+		if vm.kernel != "" {
+			// The hashes of the kernel, initrd and command line are part of the launch measurement
+			launchSecurity.KernelHashes = "yes"
+		}
+		return &libvirtxml.DomainLaunchSecurity{SEVSNP: launchSecurity}, nil
+	case TDX:
+		if launchSecurityFromDomainCaps(caps) != TDX {
+			return nil, fmt.Errorf("TDX is not supported by the host")
+		}
+		policy := tdxPolicy
+		return &libvirtxml.DomainLaunchSecurity{
+			TDX: &libvirtxml.DomainLaunchSecurityTDX{
+				Policy: &policy,
+				// The default socket of the quote generation service of the host, for attestation
+				QuoteGenerationService: &libvirtxml.DomainLaunchSecurityTDXQGS{},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("launch Security type is not supported for this domain: %s", vm.launchSecurityType)
+	}
+}
+
+// setConfidentialx86_64 adapts an x86_64 domain to SEV-SNP and TDX: q35 machine, stateless firmware,
+// optional direct kernel boot, and no device that requires access to the memory of the guest
+func setConfidentialx86_64(domain *libvirtxml.Domain, vm *vmConfig) {
+	domain.OS.Type.Machine = "q35"
+
+	if vm.firmware != "" {
+		domain.OS.Loader = &libvirtxml.DomainLoader{
+			Path:      vm.firmware,
+			Type:      "rom",
+			Stateless: "yes",
+		}
+	} else {
+		// libvirt selects a firmware supporting the launch security of the domain
+		domain.OS.Firmware = "efi"
+	}
+
+	if vm.kernel != "" {
+		domain.OS.Kernel = vm.kernel
+		domain.OS.Initrd = vm.initrd
+		domain.OS.Cmdline = vm.kernelCmdline
+	}
+
+	if vm.launchSecurityType == TDX {
+		domain.Features.IOAPIC = &libvirtxml.DomainFeatureIOAPIC{Driver: "qemu"}
+	}
+
+	// The memory of the guest is encrypted, so it is neither dumped nor ballooned, and the virtio devices
+	// use the swiotlb of the guest: the interfaces, the data disks, and the virtio-serial controller of the
+	// guest agent channel
+	domain.Memory.DumpCore = "off"
+	domain.Devices.MemBalloon = &libvirtxml.DomainMemBalloon{Model: "none"}
+	for i := range domain.Devices.Interfaces {
+		domain.Devices.Interfaces[i].Driver = &libvirtxml.DomainInterfaceDriver{IOMMU: "on"}
+	}
+	for i, disk := range domain.Devices.Disks {
+		if disk.Target == nil || disk.Target.Bus != "virtio" {
+			continue
+		}
+		if disk.Driver == nil {
+			domain.Devices.Disks[i].Driver = &libvirtxml.DomainDiskDriver{}
+		}
+		domain.Devices.Disks[i].Driver.IOMMU = "on"
+	}
+	domain.Devices.Controllers = append(domain.Devices.Controllers, libvirtxml.DomainController{
+		Type:   "virtio-serial",
+		Driver: &libvirtxml.DomainControllerDriver{IOMMU: "on"},
+	})
+
+	// Confidential VMs cannot be reset
+	domain.OnReboot = "destroy"
+}
+
 func createDomainXMLaarch64(client *libvirtClient, cfg *domainConfig, vm *vmConfig) (*libvirtxml.Domain, error) {
 
 	guest, err := getGuestForArchType(client.caps, archAArch64, typeHardwareVirtualMachine)
@@ -447,10 +608,7 @@ func createDomainXMLaarch64(client *libvirtClient, cfg *domainConfig, vm *vmConf
 		VCPU:   &libvirtxml.DomainVCPU{Value: cfg.cpu},
 		CPU:    &libvirtxml.DomainCPU{Mode: "host-passthrough"},
 		Devices: &libvirtxml.DomainDeviceList{
-			Disks: []libvirtxml.DomainDisk{
-				bootDisk,
-				cloudInitDisk,
-			},
+			Disks: appendDataDisks([]libvirtxml.DomainDisk{bootDisk, cloudInitDisk}, cfg),
 			// scsi target device for readonly ROM device
 			// virtio-scsi controller for better compatibility
 			Controllers: []libvirtxml.DomainController{
@@ -489,46 +647,159 @@ func createDomainXMLaarch64(client *libvirtClient, cfg *domainConfig, vm *vmConf
 
 // createDomainXML detects the machine type of the libvirt host and will return a libvirt XML for that machine type
 func createDomainXML(client *libvirtClient, cfg *domainConfig, vm *vmConfig) (*libvirtxml.Domain, error) {
+	var domain *libvirtxml.Domain
+	var err error
 	switch client.nodeInfo.Model {
 	case archS390x:
-		return createDomainXMLs390x(client, cfg, vm)
+		domain, err = createDomainXMLs390x(client, cfg, vm)
 	case archAArch64:
-		return createDomainXMLaarch64(client, cfg, vm)
+		domain, err = createDomainXMLaarch64(client, cfg, vm)
 	default:
-		return createDomainXMLx86_64(client, cfg, vm)
+		domain, err = createDomainXMLx86_64(client, cfg, vm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	domain.Devices.Interfaces = appendNetworkInterfaces(domain.Devices.Interfaces, cfg)
+	for i, mac := range vm.macAddresses {
+		if i < len(domain.Devices.Interfaces) {
+			domain.Devices.Interfaces[i].MAC = &libvirtxml.DomainInterfaceMAC{Address: mac}
+		}
+	}
+	domain.Devices.Channels = append(domain.Devices.Channels, guestAgentDevice())
+
+	var metadata string
+	if len(vm.tags) > 0 {
+		metadata += tagsMetadata(vm.tags)
 	}
+	if vm.staticIP.IsValid() {
+		metadata += staticIPMetadata(vm.staticIP.Addr())
+	}
+	if metadata != "" {
+		domain.Metadata = &libvirtxml.DomainMetadata{XML: metadata}
+	}
+	return domain, nil
 }
 
-// getDomainIPs get all IP addresses of all domain network interfaces
-//
-// Note that at the time this function is called the domain might
-// not get IP addresses yet, so the list will be empty and none
-// error is returned.
-func getDomainIPs(dom *libvirt.Domain) ([]netip.Addr, error) {
-	ips := []netip.Addr{}
+// tagsMetadata returns the metadata element of the tags of a domain, e.g.
+// <peerpods:tags xmlns:peerpods="urn:confidential-containers:peerpods"><peerpods:tag key="k">v</peerpods:tag></peerpods:tags>
+func tagsMetadata(tags map[string]string) string {
+	var metadata strings.Builder
+	fmt.Fprintf(&metadata, `<peerpods:tags xmlns:peerpods="%s">`, tagsNamespace)
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		metadata.WriteString(`<peerpods:tag key="`)
+		_ = xml.EscapeText(&metadata, []byte(k))
+		metadata.WriteString(`">`)
+		_ = xml.EscapeText(&metadata, []byte(tags[k]))
+		metadata.WriteString(`</peerpods:tag>`)
+	}
+	metadata.WriteString(`</peerpods:tags>`)
+	return metadata.String()
+}
 
+// getDomainIPs get all IP addresses of all domain network interfaces, from the DHCP leases of libvirt, or
+// from the qemu guest agent on networks without DHCP server of libvirt
+func getDomainIPs(dom *libvirt.Domain) ([]netip.Addr, error) {
 	domIfList, err := dom.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE)
 	if err != nil {
 		domName, _ := dom.GetName()
 		return nil, fmt.Errorf("Failed to get domain %s interfaces: %s", domName, err)
 	}
 
-	for _, domIf := range domIfList {
-		for _, addr := range domIf.Addrs {
-			parsedAddr, err := netip.ParseAddr(addr.Addr)
+	ips, err := interfaceAddrs(domIfList)
+	if err != nil || len(ips) > 0 {
+		return ips, err
+	}
+
+	domIfList, err = dom.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT)
+	if err != nil {
+		// The guest agent is not running yet, or not installed in the pod VM image
+		return ips, nil
+	}
+	return interfaceAddrs(domIfList)
+}
+
+// defineDomain allocates a static IP address to a VM, if configured, uploads its cloud-init ISO, and defines
+// its domain. The static IP address is reserved by the metadata of the domain, once it is defined.
+func defineDomain(libvirtClient *libvirtClient, cfg *domainConfig, v *vmConfig, isoVolName string) (*libvirt.Domain, error) {
+	if libvirtClient.staticIPs != nil {
+		libvirtClient.staticIPMutex.Lock()
+		defer libvirtClient.staticIPMutex.Unlock()
+
+		used, err := usedStaticIPs(libvirtClient.connection)
+		if err != nil {
+			return nil, err
+		}
+		start, err := libvirtClient.staticIPs.randomAddr()
+		if err != nil {
+			return nil, err
+		}
+		if v.staticIP, err = libvirtClient.staticIPs.allocate(used, start); err != nil {
+			return nil, err
+		}
+		logger.Printf("Allocated static IP %s to '%s'", v.staticIP, v.name)
+
+		// The network configuration matches the interfaces by MAC address
+		v.macAddresses = nil
+		for range 1 + len(v.extraNetworks) {
+			mac, err := randomMACAddress()
 			if err != nil {
-				return nil, fmt.Errorf("Failed to parse address: %s", err)
+				return nil, err
 			}
-			ips = append(ips, parsedAddr)
+			v.macAddresses = append(v.macAddresses, mac)
 		}
 	}
 
-	return ips, nil
+	cloudInitIso, err := createCloudInitISO(v, libvirtClient.staticIPs)
+	if err != nil {
+		return nil, fmt.Errorf("error in creating cloud init ISO file, cause: %w", err)
+	}
+
+	cfg.cidataDisk, err = uploadIso(cloudInitIso, isoVolName, libvirtClient)
+	if err != nil {
+		return nil, fmt.Errorf("Error in uploading iso volume: %s", err)
+	}
+
+	domCfg, err := createDomainXML(libvirtClient, cfg, v)
+	if err != nil {
+		return nil, fmt.Errorf("error building the libvirt XML, cause: %w", err)
+	}
+
+	logger.Printf("Create XML for '%s'", v.name)
+	domXML, err := domCfg.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create domain xml: %s", err)
+	}
+
+	logger.Printf("Creating VM '%s'", v.name)
+	dom, err := libvirtClient.connection.DomainDefineXML(domXML)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to define domain: %s", err)
+	}
+	return dom, nil
+}
+
+// undefineDomain undefines a domain that was not started, and deletes its cloud-init ISO volume
+func undefineDomain(libvirtClient *libvirtClient, dom *libvirt.Domain, isoVolName string) error {
+	defer func() {
+		_ = dom.Free()
+	}()
+	if err := dom.Undefine(); err != nil {
+		return fmt.Errorf("Failed to undefine domain: %s", err)
+	}
+	if err := deleteVolume(libvirtClient, isoVolName); err != nil {
+		return fmt.Errorf("Error in deleting iso volume: %s", err)
+	}
+	return nil
 }
 
 func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig) (result *createDomainOutput, err error) {
 
-	v.rootDiskSize = uint64(10)
+	if v.rootDiskSize == 0 {
+		// The root volume is never smaller than the image, see createVolume
+		v.rootDiskSize = uint64(10)
+	}
 
 	exists, err := checkDomainExistsByName(v.name, libvirtClient)
 	if err != nil {
@@ -547,17 +818,6 @@ func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig
 		return nil, fmt.Errorf("Error in creating volume: %s", err)
 	}
 
-	cloudInitIso, err := createCloudInitISO(v)
-	if err != nil {
-		return nil, fmt.Errorf("error in creating cloud init ISO file, cause: %w", err)
-	}
-
-	isoVolName := v.name + "-cloudinit.iso"
-	isoVolFile, err := uploadIso(cloudInitIso, isoVolName, libvirtClient)
-	if err != nil {
-		return nil, fmt.Errorf("Error in uploading iso volume: %s", err)
-	}
-
 	rootVol, err := getVolume(libvirtClient, rootVolName)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving volume: %s", err)
@@ -574,24 +834,65 @@ func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig
 		mem:         v.mem,
 		networkName: libvirtClient.networkName,
 		bootDisk:    rootVolFile,
-		cidataDisk:  isoVolFile,
+
+		extraNetworks: v.extraNetworks,
 	}
 
-	domCfg, err := createDomainXML(libvirtClient, &domainCfg, v)
-	if err != nil {
-		return nil, fmt.Errorf("error building the libvirt XML, cause: %w", err)
+	volNames := []string{rootVolName}
+	for i, size := range v.dataDiskSizes {
+		dataVolName := fmt.Sprintf("%s-data-%d.qcow2", v.name, i)
+		dataVolFile, err := createEmptyVolume(dataVolName, size, libvirtClient)
+		if err != nil {
+			return nil, fmt.Errorf("Error in creating data volume: %s", err)
+		}
+		volNames = append(volNames, dataVolName)
+		domainCfg.dataDisks = append(domainCfg.dataDisks, dataVolFile)
 	}
 
-	logger.Printf("Create XML for '%s'", v.name)
-	domXML, err := domCfg.Marshal()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create domain xml: %s", err)
+	// The volumes are not deleted with a domain that is not defined
+	deleteVolumes := func() {
+		for _, name := range volNames {
+			if err := deleteVolume(libvirtClient, name); err != nil {
+				logger.Printf("Deleting volume (%s) returned error: %s", name, err)
+			}
+		}
 	}
 
-	logger.Printf("Creating VM '%s'", v.name)
-	dom, err := libvirtClient.connection.DomainDefineXML(domXML)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to define domain: %s", err)
+	isoVolName := v.name + "-cloudinit.iso"
+	var dom *libvirt.Domain
+	for attempt := 1; ; attempt++ {
+		if dom, err = defineDomain(libvirtClient, &domainCfg, v, isoVolName); err != nil {
+			deleteVolumes()
+			return nil, err
+		}
+		if libvirtClient.staticIPs == nil {
+			break
+		}
+
+		// Another cloud-api-adaptor instance sharing the static IP range may have allocated the same address
+		// before the domain was defined. Every domain that sees the duplicate gives the address up, so that
+		// at most one keeps it.
+		duplicate, err := isDuplicateStaticIP(libvirtClient.connection, v.staticIP.Addr())
+		if err != nil {
+			// The metadata of a defined domain would keep the static IP address allocated
+			if undefineErr := undefineDomain(libvirtClient, dom, isoVolName); undefineErr != nil {
+				logger.Printf("Failed to clean up domain '%s': %s", v.name, undefineErr)
+			}
+			deleteVolumes()
+			return nil, err
+		}
+		if !duplicate {
+			break
+		}
+		logger.Printf("Static IP %s of '%s' is also allocated to another domain", v.staticIP, v.name)
+		if err := undefineDomain(libvirtClient, dom, isoVolName); err != nil {
+			deleteVolumes()
+			return nil, err
+		}
+		if attempt == maxStaticIPAttempts {
+			deleteVolumes()
+			return nil, fmt.Errorf("failed to allocate a static IP address to '%s' in %d attempts", v.name, attempt)
+		}
 	}
 
 	// Start Domain.
@@ -613,6 +914,14 @@ func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig
 	v.instanceID = uuid
 	logger.Printf("VM created: name=%s, uuid=%s", v.name, uuid)
 
+	if v.staticIP.IsValid() {
+		v.ips = []netip.Addr{v.staticIP.Addr()}
+		logger.Printf("Instance created successfully")
+		return &createDomainOutput{
+			instance: v,
+		}, nil
+	}
+
 	// Wait for sometime for the IP to be visible
 	if err := retry.Do(
 		func() error {
@@ -761,6 +1070,20 @@ func NewLibvirtClient(libvirtCfg Config) (*libvirtClient, error) {
 		return nil, err
 	}
 
+	// The domain capabilities provide the parameters of SEV-SNP and TDX domains
+	var domainCaps *libvirtxml.DomainCaps
+	if node.Model == archX86_64 {
+		domainCaps, err = GetDomainCapabilities(conn, "", archX86_64, "q35", "kvm", 0)
+		if err != nil {
+			logger.Printf("unable to get the domain capabilities, confidential VMs are not supported: %v", err)
+		}
+	}
+
+	staticIPs, err := parseStaticIPConfig(&libvirtCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Println("Created libvirt connection")
 
 	return &libvirtClient{
@@ -772,6 +1095,8 @@ func NewLibvirtClient(libvirtCfg Config) (*libvirtClient, error) {
 		volName:     libvirtCfg.VolName,
 		nodeInfo:    node,
 		caps:        caps,
+		domainCaps:  domainCaps,
+		staticIPs:   staticIPs,
 	}, nil
 }
 
@@ -786,12 +1111,13 @@ func freeDomain(domain *libvirt.Domain, errCtx *error) {
 }
 
 // Attempts to determine launchSecurity Type from domain capabilities and hardware
-// Currently only supports S390PV
+// Supports S390PV, SEV-SNP and TDX
 func GetLaunchSecurityType(uri string) (LaunchSecurityType, error) {
 	conn, err := libvirt.NewConnect(uri)
 	if err != nil {
 		return NoLaunchSecurity, fmt.Errorf("unable to get libvirt connection [%v]", err)
 	}
+	defer conn.Close()
 
 	nodeInfo, err := conn.GetNodeInfo()
 	if err != nil {
@@ -801,9 +1127,40 @@ func GetLaunchSecurityType(uri string) (LaunchSecurityType, error) {
 	switch nodeInfo.Model {
 	case archS390x:
 		return S390PV, nil
-	case "x86_64":
-		return NoLaunchSecurity, nil
+	case archX86_64:
+		// Hosts whose libvirt cannot report the capabilities of q35 domains run VMs without launch security
+		caps, err := GetDomainCapabilities(conn, "", archX86_64, "q35", "kvm", 0)
+		if err != nil {
+			logger.Printf("unable to get the domain capabilities, using no launch security: %v", err)
+			return NoLaunchSecurity, nil
+		}
+		return launchSecurityFromDomainCaps(caps), nil
 	default:
 		return NoLaunchSecurity, nil
 	}
 }
+
+// launchSecurityFromDomainCaps returns the launch security type supported by x86_64 domains, SEV-SNP or TDX
+func launchSecurityFromDomainCaps(caps *libvirtxml.DomainCaps) LaunchSecurityType {
+	if caps == nil || caps.Features == nil {
+		return NoLaunchSecurity
+	}
+	// libvirt 10.5 and later report the supported types of the launchSecurity element
+	if ls := caps.Features.LaunchSecurity; ls != nil && ls.Supported == "yes" {
+		for _, enum := range ls.Enums {
+			if enum.Name != "sectype" {
+				continue
+			}
+			if slices.Contains(enum.Values, "sev-snp") {
+				return SEVSNP
+			}
+			if slices.Contains(enum.Values, "tdx") {
+				return TDX
+			}
+		}
+	}
+	if tdx := caps.Features.TDX; tdx != nil && tdx.Supported == "yes" {
+		return TDX
+	}
+	return NoLaunchSecurity
+}
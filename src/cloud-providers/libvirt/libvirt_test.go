@@ -4,11 +4,13 @@
 package libvirt
 
 import (
+	"encoding/xml"
 	"fmt"
 	"testing"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/stretchr/testify/assert"
+	libvirt "libvirt.org/go/libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
 )
 
@@ -283,6 +285,16 @@ func TestConfigVerifier(t *testing.T) {
 			},
 			expectedError: "Memory must be greater than zero",
 		},
+		{
+			name: "static IP range without gateway fails",
+			provider: &libvirtProvider{
+				serviceConfig: newConfig(func(c *Config) {
+					c.StaticIPRange = "192.168.122.200-192.168.122.250"
+					c.StaticIPPrefixLength = 24
+				}),
+			},
+			expectedError: "static IP gateway is required with a static IP range",
+		},
 		{
 			name: "valid config passes",
 			provider: &libvirtProvider{
@@ -303,3 +315,214 @@ func TestConfigVerifier(t *testing.T) {
 		})
 	}
 }
+
+func TestAppendDataDisks(t *testing.T) {
+	cfg := &domainConfig{dataDisks: []string{"/var/lib/libvirt/images/data-0.qcow2", "/var/lib/libvirt/images/data-1.qcow2"}}
+	disks := []libvirtxml.DomainDisk{
+		{Device: "disk", Target: &libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"}},
+		{Device: "cdrom", Target: &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "scsi"}},
+	}
+
+	disks = appendDataDisks(disks, cfg)
+	assert.Len(t, disks, 4)
+	assert.Equal(t, "vdb", disks[2].Target.Dev)
+	assert.Equal(t, cfg.dataDisks[0], disks[2].Source.File.File)
+	assert.Equal(t, "vdc", disks[3].Target.Dev)
+	assert.Equal(t, cfg.dataDisks[1], disks[3].Source.File.File)
+
+	assert.Len(t, appendDataDisks(nil, &domainConfig{}), 0)
+}
+
+func TestTagsMetadata(t *testing.T) {
+	metadata := tagsMetadata(map[string]string{provider.TagPodName: "nginx", "note": `a<b & "c"`})
+
+	var tags struct {
+		XMLName xml.Name `xml:"urn:confidential-containers:peerpods tags"`
+		Tags    []struct {
+			Key   string `xml:"key,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"urn:confidential-containers:peerpods tag"`
+	}
+	assert.NoError(t, xml.Unmarshal([]byte(metadata), &tags))
+	assert.Len(t, tags.Tags, 2)
+	assert.Equal(t, "note", tags.Tags[0].Key)
+	assert.Equal(t, `a<b & "c"`, tags.Tags[0].Value)
+	assert.Equal(t, provider.TagPodName, tags.Tags[1].Key)
+	assert.Equal(t, "nginx", tags.Tags[1].Value)
+
+	// The metadata is kept in the domain XML
+	domain := libvirtxml.Domain{Name: "podvm", Metadata: &libvirtxml.DomainMetadata{XML: metadata}}
+	domainXML, err := domain.Marshal()
+	assert.NoError(t, err)
+	assert.Contains(t, domainXML, metadata)
+}
+
+// Domain capabilities of x86_64 hosts, as reported by virsh domcapabilities
+const (
+	sevSNPDomainCaps = `<domainCapabilities><path>/usr/bin/qemu-system-x86_64</path><domain>kvm</domain><machine>pc-q35-9.2</machine><arch>x86_64</arch>
+<features>
+  <sev supported='yes'><cbitpos>51</cbitpos><reducedPhysBits>1</reducedPhysBits><maxGuests>0</maxGuests><maxESGuests>0</maxESGuests></sev>
+  <launchSecurity supported='yes'><enum name='sectype'><value>sev</value><value>sev-snp</value></enum></launchSecurity>
+</features></domainCapabilities>`
+	tdxDomainCaps = `<domainCapabilities><arch>x86_64</arch>
+<features>
+  <sev supported='no'/>
+  <tdx supported='yes'/>
+  <launchSecurity supported='yes'><enum name='sectype'><value>tdx</value></enum></launchSecurity>
+</features></domainCapabilities>`
+	noCVMDomainCaps = `<domainCapabilities><arch>x86_64</arch>
+<features><sev supported='no'/><launchSecurity supported='no'/></features></domainCapabilities>`
+)
+
+func parseDomainCaps(t *testing.T, capsXML string) *libvirtxml.DomainCaps {
+	caps := &libvirtxml.DomainCaps{}
+	if err := caps.Unmarshal(capsXML); err != nil {
+		t.Fatalf("parsing domain capabilities: %v", err)
+	}
+	return caps
+}
+
+func TestLaunchSecurityFromDomainCaps(t *testing.T) {
+	assert.Equal(t, SEVSNP, launchSecurityFromDomainCaps(parseDomainCaps(t, sevSNPDomainCaps)))
+	assert.Equal(t, TDX, launchSecurityFromDomainCaps(parseDomainCaps(t, tdxDomainCaps)))
+	assert.Equal(t, NoLaunchSecurity, launchSecurityFromDomainCaps(parseDomainCaps(t, noCVMDomainCaps)))
+	assert.Equal(t, NoLaunchSecurity, launchSecurityFromDomainCaps(nil))
+
+	// SEV without SNP is not supported
+	sevCaps := parseDomainCaps(t, sevSNPDomainCaps)
+	sevCaps.Features.LaunchSecurity.Enums[0].Values = []string{"sev"}
+	assert.Equal(t, NoLaunchSecurity, launchSecurityFromDomainCaps(sevCaps))
+}
+
+func TestParseLaunchSecurity(t *testing.T) {
+	for setting, want := range map[string]LaunchSecurityType{"s390-pv": S390PV, "sev-snp": SEVSNP, "tdx": TDX} {
+		got, err := parseLaunchSecurity(setting)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := parseLaunchSecurity("sev")
+	assert.Error(t, err)
+}
+
+func TestCreateDomainXMLx86_64LaunchSecurity(t *testing.T) {
+	cfg := &domainConfig{
+		name:        "podvm-test",
+		cpu:         2,
+		mem:         4096,
+		networkName: "default",
+		bootDisk:    "/var/lib/libvirt/images/root.qcow2",
+		cidataDisk:  "/var/lib/libvirt/images/cidata.iso",
+	}
+
+	// newDomain returns the domain of a VM without launch security, adapted to a confidential VM
+	// with the q35 machine and the cidata disk on the SATA bus
+	newDomain := func(t *testing.T) *libvirtxml.Domain {
+		domain, err := createDomainXMLx86_64(&libvirtClient{}, cfg, &vmConfig{})
+		if err != nil {
+			t.Fatalf("createDomainXMLx86_64() error = %v", err)
+		}
+		var cidataDiskAddr uint = 1
+		domain.OS.Type.Machine = "q35"
+		domain.Memory.DumpCore = "off"
+		domain.OnReboot = "destroy"
+		domain.Devices.Disks[1].Target = &libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "sata"}
+		domain.Devices.Disks[1].Address.Drive.Unit = &cidataDiskAddr
+		domain.Devices.MemBalloon = &libvirtxml.DomainMemBalloon{Model: "none"}
+		domain.Devices.Interfaces[0].Driver = &libvirtxml.DomainInterfaceDriver{IOMMU: "on"}
+		domain.Devices.Controllers = []libvirtxml.DomainController{
+			{Type: "virtio-serial", Driver: &libvirtxml.DomainControllerDriver{IOMMU: "on"}},
+		}
+		return domain
+	}
+
+	t.Run("sev-snp", func(t *testing.T) {
+		client := &libvirtClient{domainCaps: parseDomainCaps(t, sevSNPDomainCaps)}
+		vm := &vmConfig{
+			launchSecurityType: SEVSNP,
+			firmware:           "/usr/share/ovmf/OVMF.amdsev.fd",
+			kernel:             "/var/lib/peerpods/vmlinuz",
+			initrd:             "/var/lib/peerpods/initrd.img",
+			kernelCmdline:      "root=/dev/sda1 console=ttyS0",
+		}
+		got, err := createDomainXMLx86_64(client, cfg, vm)
+		assert.NoError(t, err)
+
+		want := newDomain(t)
+		cbitpos, reducedPhysBits, policy := uint(51), uint(1), uint64(0x30000)
+		want.OS.Loader = &libvirtxml.DomainLoader{Path: "/usr/share/ovmf/OVMF.amdsev.fd", Type: "rom", Stateless: "yes"}
+		want.OS.Kernel = "/var/lib/peerpods/vmlinuz"
+		want.OS.Initrd = "/var/lib/peerpods/initrd.img"
+		want.OS.Cmdline = "root=/dev/sda1 console=ttyS0"
+		want.LaunchSecurity = &libvirtxml.DomainLaunchSecurity{
+			SEVSNP: &libvirtxml.DomainLaunchSecuritySEVSNP{
+				KernelHashes:    "yes",
+				CBitPos:         &cbitpos,
+				ReducedPhysBits: &reducedPhysBits,
+				Policy:          &policy,
+			},
+		}
+		assert.Equal(t, want, got)
+
+		// The launch security element is valid XML for libvirt
+		domainXML, err := got.Marshal()
+		assert.NoError(t, err)
+		assert.Contains(t, domainXML, `<launchSecurity type="sev-snp" kernelHashes="yes">`)
+	})
+
+	t.Run("sev-snp with data disks", func(t *testing.T) {
+		client := &libvirtClient{domainCaps: parseDomainCaps(t, sevSNPDomainCaps), nodeInfo: &libvirt.NodeInfo{Model: archX86_64}}
+		cfg := *cfg
+		cfg.dataDisks = []string{"/var/lib/libvirt/images/data-0.qcow2", "/var/lib/libvirt/images/data-1.qcow2"}
+		got, err := createDomainXML(client, &cfg, &vmConfig{launchSecurityType: SEVSNP})
+		assert.NoError(t, err)
+
+		// The data disks and the virtio-serial controller of the guest agent channel use the swiotlb
+		disks := got.Devices.Disks
+		assert.Len(t, disks, 4)
+		for _, disk := range disks[2:] {
+			assert.Equal(t, "virtio", disk.Target.Bus)
+			assert.Equal(t, "on", disk.Driver.IOMMU, disk.Target.Dev)
+		}
+		assert.Empty(t, disks[0].Driver.IOMMU)
+		assert.Equal(t, []libvirtxml.DomainController{
+			{Type: "virtio-serial", Driver: &libvirtxml.DomainControllerDriver{IOMMU: "on"}},
+		}, got.Devices.Controllers)
+		assert.Len(t, got.Devices.Channels, 1)
+
+		domainXML, err := got.Marshal()
+		assert.NoError(t, err)
+		assert.Contains(t, domainXML, `<driver name="qemu" type="qcow2" iommu="on"></driver>`)
+		assert.Contains(t, domainXML, `<controller type="virtio-serial">`)
+	})
+
+	t.Run("tdx", func(t *testing.T) {
+		client := &libvirtClient{domainCaps: parseDomainCaps(t, tdxDomainCaps)}
+		got, err := createDomainXMLx86_64(client, cfg, &vmConfig{launchSecurityType: TDX})
+		assert.NoError(t, err)
+
+		want := newDomain(t)
+		policy := uint(0x10000000)
+		// libvirt selects the firmware
+		want.OS.Firmware = "efi"
+		want.Features.IOAPIC = &libvirtxml.DomainFeatureIOAPIC{Driver: "qemu"}
+		want.LaunchSecurity = &libvirtxml.DomainLaunchSecurity{
+			TDX: &libvirtxml.DomainLaunchSecurityTDX{
+				Policy:                 &policy,
+				QuoteGenerationService: &libvirtxml.DomainLaunchSecurityTDXQGS{},
+			},
+		}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("unsupported by the host", func(t *testing.T) {
+		client := &libvirtClient{domainCaps: parseDomainCaps(t, noCVMDomainCaps)}
+		for _, l := range []LaunchSecurityType{SEVSNP, TDX} {
+			_, err := createDomainXMLx86_64(client, cfg, &vmConfig{launchSecurityType: l})
+			assert.Error(t, err, l.String())
+			_, err = createDomainXMLx86_64(&libvirtClient{}, cfg, &vmConfig{launchSecurityType: l})
+			assert.Error(t, err, l.String())
+		}
+		_, err := createDomainXMLx86_64(client, cfg, &vmConfig{launchSecurityType: S390PV})
+		assert.Error(t, err)
+	})
+}
@@ -38,11 +38,23 @@ func (*Manager) ParseCmd(flags *flag.FlagSet) {
 	reg.StringWithEnv(&libvirtcfg.URI, "uri", defaultURI, "LIBVIRT_URI", "libvirt URI")
 	reg.StringWithEnv(&libvirtcfg.PoolName, "pool-name", defaultPoolName, "LIBVIRT_POOL", "libvirt storage pool")
 	reg.StringWithEnv(&libvirtcfg.NetworkName, "network-name", defaultNetworkName, "LIBVIRT_NET", "libvirt network pool")
+	reg.StringWithEnv(&libvirtcfg.SecondaryNetworkName, "secondary-network-name", "", "LIBVIRT_SECONDARY_NET", "libvirt network of the second interface of the Pod VMs with external network connectivity")
+	reg.StringWithEnv(&libvirtcfg.StaticIPRange, "static-ip-range", "", "LIBVIRT_STATIC_IP_RANGE", "Range of static IP addresses of the Pod VMs, e.g. 192.168.122.200-192.168.122.250, instead of DHCP")
+	reg.UintWithEnv(&libvirtcfg.StaticIPPrefixLength, "static-ip-prefix-length", 24, "LIBVIRT_STATIC_IP_PREFIX_LENGTH", "Prefix length of the network of the static IP addresses")
+	reg.StringWithEnv(&libvirtcfg.StaticIPGateway, "static-ip-gateway", "", "LIBVIRT_STATIC_IP_GATEWAY", "Gateway and DNS server of the Pod VMs with static IP addresses")
 	reg.StringWithEnv(&libvirtcfg.VolName, "vol-name", defaultVolName, "LIBVIRT_VOL_NAME", "libvirt volume name")
-	reg.StringWithEnv(&libvirtcfg.LaunchSecurity, "launch-security", defaultLaunchSecurity, "LIBVIRT_LAUNCH_SECURITY", "Libvirt's LaunchSecurity element for Confidential VMs: s390-pv. If omitted, will automatically determine.")
+	reg.StringWithEnv(&libvirtcfg.LaunchSecurity, "launch-security", defaultLaunchSecurity, "LIBVIRT_LAUNCH_SECURITY", "Libvirt's LaunchSecurity element for Confidential VMs: s390-pv, sev-snp or tdx. If omitted, will automatically determine.")
 	reg.StringWithEnv(&libvirtcfg.Firmware, "firmware", defaultFirmware, "LIBVIRT_EFI_FIRMWARE", "Path to OVMF")
+	reg.StringWithEnv(&libvirtcfg.CVMFirmware, "cvm-firmware", "", "LIBVIRT_CVM_FIRMWARE", "Path to the stateless OVMF of SEV-SNP and TDX Pod VMs, e.g. /usr/share/ovmf/OVMF.amdsev.fd. If omitted, libvirt selects it")
+	reg.StringWithEnv(&libvirtcfg.Kernel, "kernel", "", "LIBVIRT_KERNEL", "Path to the kernel booted directly by SEV-SNP and TDX Pod VMs, which SEV-SNP measures with its initrd and command line")
+	reg.StringWithEnv(&libvirtcfg.Initrd, "initrd", "", "LIBVIRT_INITRD", "Path to the initrd of the kernel booted directly by SEV-SNP and TDX Pod VMs")
+	reg.StringWithEnv(&libvirtcfg.KernelCmdline, "kernel-cmdline", "", "LIBVIRT_KERNEL_CMDLINE", "Command line of the kernel booted directly by SEV-SNP and TDX Pod VMs")
 	reg.UintWithEnv(&libvirtcfg.CPU, "cpu", 2, "LIBVIRT_CPU", "Number of processors allocated")
 	reg.UintWithEnv(&libvirtcfg.Memory, "memory", 8192, "LIBVIRT_MEMORY", "Amount of memory in MiB")
+	reg.IntWithEnv(&libvirtcfg.RootVolumeSize, "root-volume-size", 0, "ROOT_VOLUME_SIZE", "Root volume size (in GiB) for the Pod VMs, 0 keeps the size of the image")
+
+	// Custom flag types (comma-separated lists)
+	reg.CustomTypeWithEnv(&libvirtcfg.Tags, "tags", "", "TAGS", "Custom tags (key=value pairs) to be kept in the metadata of the Pod VM domains, comma separated")
 
 	// Flags without environment variable support (pass empty string for envVarName)
 	reg.StringWithEnv(&libvirtcfg.DataDir, "data-dir", defaultDataDir, "", "libvirt storage dir")
@@ -0,0 +1,293 @@
+//go:build cgo
+
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	libvirt "libvirt.org/go/libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+)
+
+const (
+	// namespace of the metadata element of the static IP address of domains
+	staticIPNamespace = "urn:confidential-containers:peerpods:static-ip"
+	// name of the virtio channel of the qemu guest agent
+	guestAgentChannel = "org.qemu.guest_agent.0"
+	// maxStaticIPAttempts bounds the static IP addresses allocated to a domain when they are duplicates
+	maxStaticIPAttempts = 5
+)
+
+// staticIPConfig is the static IP configuration of the primary interface of the pod VMs, with addresses
+// allocated from a range
+type staticIPConfig struct {
+	first, last netip.Addr
+	prefixLen   int
+	gateway     netip.Addr
+}
+
+// parseStaticIPConfig returns the static IP configuration of a Config, or nil if no range is configured
+func parseStaticIPConfig(config *Config) (*staticIPConfig, error) {
+	if config.StaticIPRange == "" {
+		return nil, nil
+	}
+
+	firstStr, lastStr, ok := strings.Cut(config.StaticIPRange, "-")
+	if !ok {
+		return nil, fmt.Errorf("static IP range %q is not first-last", config.StaticIPRange)
+	}
+	first, err := netip.ParseAddr(strings.TrimSpace(firstStr))
+	if err != nil {
+		return nil, fmt.Errorf("static IP range %q: %w", config.StaticIPRange, err)
+	}
+	last, err := netip.ParseAddr(strings.TrimSpace(lastStr))
+	if err != nil {
+		return nil, fmt.Errorf("static IP range %q: %w", config.StaticIPRange, err)
+	}
+	if first.BitLen() != last.BitLen() || last.Less(first) {
+		return nil, fmt.Errorf("static IP range %q is empty", config.StaticIPRange)
+	}
+
+	if config.StaticIPGateway == "" {
+		return nil, fmt.Errorf("static IP gateway is required with a static IP range")
+	}
+	gateway, err := netip.ParseAddr(config.StaticIPGateway)
+	if err != nil {
+		return nil, fmt.Errorf("static IP gateway %q: %w", config.StaticIPGateway, err)
+	}
+
+	prefix, err := gateway.Prefix(int(config.StaticIPPrefixLength))
+	if err != nil || config.StaticIPPrefixLength == 0 {
+		return nil, fmt.Errorf("invalid static IP prefix length %d", config.StaticIPPrefixLength)
+	}
+	if !prefix.Contains(first) || !prefix.Contains(last) {
+		return nil, fmt.Errorf("static IP range %q is not in the network %s of the gateway", config.StaticIPRange, prefix)
+	}
+
+	return &staticIPConfig{first: first, last: last, prefixLen: int(config.StaticIPPrefixLength), gateway: gateway}, nil
+}
+
+// allocate returns the first address of the range from start, wrapping around to the first address of
+// the range, that is neither used nor the gateway
+func (c *staticIPConfig) allocate(used map[netip.Addr]bool, start netip.Addr) (netip.Prefix, error) {
+	if start.Less(c.first) || c.last.Less(start) {
+		start = c.first
+	}
+	free := func(from, to netip.Addr) (netip.Addr, bool) {
+		for addr := from; addr.IsValid() && !to.Less(addr); addr = addr.Next() {
+			if !used[addr] && addr != c.gateway {
+				return addr, true
+			}
+		}
+		return netip.Addr{}, false
+	}
+	if addr, ok := free(start, c.last); ok {
+		return netip.PrefixFrom(addr, c.prefixLen), nil
+	}
+	if start != c.first {
+		if addr, ok := free(c.first, start.Prev()); ok {
+			return netip.PrefixFrom(addr, c.prefixLen), nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("no free address in the static IP range %s-%s", c.first, c.last)
+}
+
+// randomAddr returns a random address of the range. Allocating from it instead of the first address makes
+// cloud-api-adaptor instances sharing the range unlikely to allocate the same address at the same time.
+func (c *staticIPConfig) randomAddr() (netip.Addr, error) {
+	first, last := c.first.As16(), c.last.As16()
+	firstInt, lastInt := new(big.Int).SetBytes(first[:]), new(big.Int).SetBytes(last[:])
+	size := new(big.Int).Sub(lastInt, firstInt)
+	size.Add(size, big.NewInt(1))
+	offset, err := rand.Int(rand.Reader, size)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var b [16]byte
+	offset.Add(offset, firstInt).FillBytes(b[:])
+	addr := netip.AddrFrom16(b)
+	if c.first.Is4() {
+		addr = addr.Unmap()
+	}
+	return addr, nil
+}
+
+// staticIPMetadata returns the metadata element of the static IP address of a domain, e.g.
+// <peerpods-ip:address xmlns:peerpods-ip="urn:confidential-containers:peerpods:static-ip">192.168.122.200</peerpods-ip:address>
+func staticIPMetadata(addr netip.Addr) string {
+	return fmt.Sprintf(`<peerpods-ip:address xmlns:peerpods-ip="%s">%s</peerpods-ip:address>`, staticIPNamespace, addr)
+}
+
+// parseStaticIPMetadata returns the static IP address of a metadata element created by staticIPMetadata
+func parseStaticIPMetadata(metadata string) (netip.Addr, error) {
+	var address struct {
+		XMLName xml.Name `xml:"urn:confidential-containers:peerpods:static-ip address"`
+		Addr    string   `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte(metadata), &address); err != nil {
+		return netip.Addr{}, err
+	}
+	return netip.ParseAddr(strings.TrimSpace(address.Addr))
+}
+
+// usedStaticIPs returns the static IP addresses of the domains of the libvirt host. Other cloud-api-adaptor
+// instances may allocate an address before their domain is defined, see isDuplicateStaticIP.
+func usedStaticIPs(conn *libvirt.Connect) (map[netip.Addr]bool, error) {
+	addrs, err := staticIPsOfDomains(conn)
+	if err != nil {
+		return nil, err
+	}
+	used := map[netip.Addr]bool{}
+	for _, addr := range addrs {
+		used[addr] = true
+	}
+	return used, nil
+}
+
+// isDuplicateStaticIP returns whether a static IP address is in the metadata of several domains
+func isDuplicateStaticIP(conn *libvirt.Connect, addr netip.Addr) (bool, error) {
+	addrs, err := staticIPsOfDomains(conn)
+	if err != nil {
+		return false, err
+	}
+	n := 0
+	for _, a := range addrs {
+		if a == addr {
+			n++
+		}
+	}
+	return n > 1, nil
+}
+
+// staticIPsOfDomains returns the static IP addresses in the metadata of the domains of the libvirt host,
+// once per domain
+func staticIPsOfDomains(conn *libvirt.Connect) ([]netip.Addr, error) {
+	domains, err := conn.ListAllDomains(0)
+	if err != nil {
+		return nil, fmt.Errorf("listing domains: %w", err)
+	}
+
+	var addrs []netip.Addr
+	for i := range domains {
+		metadata, err := domains[i].GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, staticIPNamespace, libvirt.DOMAIN_AFFECT_CONFIG)
+		_ = domains[i].Free()
+		var libvirtErr libvirt.Error
+		// A domain may be undefined since it was listed
+		if errors.As(err, &libvirtErr) && (libvirtErr.Code == libvirt.ERR_NO_DOMAIN_METADATA || libvirtErr.Code == libvirt.ERR_NO_DOMAIN) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting metadata of domain: %w", err)
+		}
+		if addr, err := parseStaticIPMetadata(metadata); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// randomMACAddress returns a random MAC address with the prefix of the MAC addresses generated by libvirt
+func randomMACAddress() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", b[0], b[1], b[2]), nil
+}
+
+// networkConfig is a cloud-init network configuration, version 2
+type networkConfig struct {
+	Version   int                              `yaml:"version"`
+	Ethernets map[string]networkConfigEthernet `yaml:"ethernets"`
+}
+
+type networkConfigEthernet struct {
+	Match       map[string]string   `yaml:"match"`
+	DHCP4       bool                `yaml:"dhcp4,omitempty"`
+	Addresses   []string            `yaml:"addresses,omitempty"`
+	Routes      []map[string]string `yaml:"routes,omitempty"`
+	Nameservers map[string][]string `yaml:"nameservers,omitempty"`
+}
+
+// createNetworkConfig returns the cloud-init network configuration of a VM with a static IP address on
+// its primary interface, and DHCP on the others. The interfaces are matched by MAC address.
+func createNetworkConfig(v *vmConfig, gateway netip.Addr) ([]byte, error) {
+	config := networkConfig{Version: 2, Ethernets: map[string]networkConfigEthernet{}}
+	for i, mac := range v.macAddresses {
+		ethernet := networkConfigEthernet{Match: map[string]string{"macaddress": mac}}
+		if i == 0 {
+			ethernet.Addresses = []string{v.staticIP.String()}
+			ethernet.Routes = []map[string]string{{"to": "default", "via": gateway.String()}}
+			// The gateway of libvirt networks is also their DNS server
+			ethernet.Nameservers = map[string][]string{"addresses": {gateway.String()}}
+		} else {
+			ethernet.DHCP4 = true
+		}
+		config.Ethernets[fmt.Sprintf("eth%d", i)] = ethernet
+	}
+	return yaml.Marshal(config)
+}
+
+// interfaceAddrs returns the addresses of the interfaces of a domain, except the loopback and link-local
+// addresses reported by the guest agent
+func interfaceAddrs(ifaces []libvirt.DomainInterface) ([]netip.Addr, error) {
+	ips := []netip.Addr{}
+	for _, domIf := range ifaces {
+		for _, addr := range domIf.Addrs {
+			parsedAddr, err := netip.ParseAddr(addr.Addr)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse address: %s", err)
+			}
+			if parsedAddr.IsLoopback() || parsedAddr.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, parsedAddr)
+		}
+	}
+	return ips, nil
+}
+
+// guestAgentDevice returns the virtio channel of the qemu guest agent, used to get the IP addresses
+// of domains without DHCP lease
+func guestAgentDevice() libvirtxml.DomainChannel {
+	return libvirtxml.DomainChannel{
+		Source: &libvirtxml.DomainChardevSource{
+			UNIX: &libvirtxml.DomainChardevSourceUNIX{Mode: "bind"},
+		},
+		Target: &libvirtxml.DomainChannelTarget{
+			VirtIO: &libvirtxml.DomainChannelTargetVirtIO{Name: guestAgentChannel},
+		},
+	}
+}
+
+// appendNetworkInterfaces appends the interfaces of the extra networks of a domain, with the model and
+// driver of its first interface
+func appendNetworkInterfaces(interfaces []libvirtxml.DomainInterface, cfg *domainConfig) []libvirtxml.DomainInterface {
+	if len(interfaces) == 0 {
+		return interfaces
+	}
+	for _, network := range cfg.extraNetworks {
+		iface := libvirtxml.DomainInterface{
+			Source: &libvirtxml.DomainInterfaceSource{Network: &libvirtxml.DomainInterfaceSourceNetwork{Network: network}},
+		}
+		if model := interfaces[0].Model; model != nil {
+			iface.Model = &libvirtxml.DomainInterfaceModel{Type: model.Type}
+		}
+		if driver := interfaces[0].Driver; driver != nil {
+			iface.Driver = &libvirtxml.DomainInterfaceDriver{IOMMU: driver.IOMMU}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
@@ -0,0 +1,226 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/kdomanski/iso9660"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	libvirt "libvirt.org/go/libvirt"
+)
+
+func TestParseStaticIPConfig(t *testing.T) {
+	staticIPs, err := parseStaticIPConfig(&Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, staticIPs)
+
+	staticIPs, err = parseStaticIPConfig(&Config{
+		StaticIPRange:        "192.168.122.200 - 192.168.122.250",
+		StaticIPPrefixLength: 24,
+		StaticIPGateway:      "192.168.122.1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &staticIPConfig{
+		first:     netip.MustParseAddr("192.168.122.200"),
+		last:      netip.MustParseAddr("192.168.122.250"),
+		prefixLen: 24,
+		gateway:   netip.MustParseAddr("192.168.122.1"),
+	}, staticIPs)
+
+	for _, cfg := range []Config{
+		{StaticIPRange: "192.168.122.200", StaticIPPrefixLength: 24, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.250-192.168.122.200", StaticIPPrefixLength: 24, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.200-fd00::1", StaticIPPrefixLength: 24, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.200-192.168.122.x", StaticIPPrefixLength: 24, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.200-192.168.122.250", StaticIPPrefixLength: 24},
+		{StaticIPRange: "192.168.122.200-192.168.122.250", StaticIPPrefixLength: 0, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.200-192.168.122.250", StaticIPPrefixLength: 33, StaticIPGateway: "192.168.122.1"},
+		{StaticIPRange: "192.168.122.200-192.168.123.250", StaticIPPrefixLength: 24, StaticIPGateway: "192.168.122.1"},
+	} {
+		_, err := parseStaticIPConfig(&cfg)
+		assert.Error(t, err, cfg.StaticIPRange)
+	}
+}
+
+func TestStaticIPAllocate(t *testing.T) {
+	staticIPs := &staticIPConfig{
+		first:     netip.MustParseAddr("192.168.122.1"),
+		last:      netip.MustParseAddr("192.168.122.4"),
+		prefixLen: 24,
+		gateway:   netip.MustParseAddr("192.168.122.1"),
+	}
+
+	// The gateway and the used addresses are skipped
+	used := map[netip.Addr]bool{netip.MustParseAddr("192.168.122.2"): true}
+	addr, err := staticIPs.allocate(used, staticIPs.first)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("192.168.122.3/24"), addr)
+
+	// The allocation wraps around to the first address of the range
+	addr, err = staticIPs.allocate(map[netip.Addr]bool{}, staticIPs.last)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("192.168.122.4/24"), addr)
+	addr, err = staticIPs.allocate(used, netip.MustParseAddr("192.168.122.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("192.168.122.4/24"), addr)
+	used[addr.Addr()] = true
+	addr, err = staticIPs.allocate(used, netip.MustParseAddr("192.168.122.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("192.168.122.3/24"), addr)
+
+	used[addr.Addr()] = true
+	_, err = staticIPs.allocate(used, netip.MustParseAddr("192.168.122.2"))
+	assert.Error(t, err)
+}
+
+func TestStaticIPRandomAddr(t *testing.T) {
+	for _, staticIPs := range []*staticIPConfig{
+		{first: netip.MustParseAddr("192.168.122.200"), last: netip.MustParseAddr("192.168.122.203")},
+		{first: netip.MustParseAddr("192.168.122.200"), last: netip.MustParseAddr("192.168.122.200")},
+		{first: netip.MustParseAddr("fd00::fffe"), last: netip.MustParseAddr("fd00::1:1")},
+	} {
+		for range 20 {
+			addr, err := staticIPs.randomAddr()
+			assert.NoError(t, err)
+			assert.Equal(t, staticIPs.first.BitLen(), addr.BitLen(), addr.String())
+			assert.False(t, addr.Less(staticIPs.first) || staticIPs.last.Less(addr), addr.String())
+		}
+	}
+}
+
+func TestStaticIPMetadata(t *testing.T) {
+	addr := netip.MustParseAddr("192.168.122.200")
+	got, err := parseStaticIPMetadata(staticIPMetadata(addr))
+	assert.NoError(t, err)
+	assert.Equal(t, addr, got)
+
+	// The metadata of other namespaces is rejected
+	_, err = parseStaticIPMetadata(tagsMetadata(map[string]string{"key": "192.168.122.200"}))
+	assert.Error(t, err)
+}
+
+func TestCreateNetworkConfig(t *testing.T) {
+	vm := &vmConfig{
+		staticIP:     netip.MustParsePrefix("192.168.122.200/24"),
+		macAddresses: []string{"52:54:00:00:00:01", "52:54:00:00:00:02"},
+	}
+	data, err := createNetworkConfig(vm, netip.MustParseAddr("192.168.122.1"))
+	assert.NoError(t, err)
+
+	var got networkConfig
+	assert.NoError(t, yaml.Unmarshal(data, &got))
+	assert.Equal(t, networkConfig{
+		Version: 2,
+		Ethernets: map[string]networkConfigEthernet{
+			"eth0": {
+				Match:       map[string]string{"macaddress": "52:54:00:00:00:01"},
+				Addresses:   []string{"192.168.122.200/24"},
+				Routes:      []map[string]string{{"to": "default", "via": "192.168.122.1"}},
+				Nameservers: map[string][]string{"addresses": {"192.168.122.1"}},
+			},
+			"eth1": {
+				Match: map[string]string{"macaddress": "52:54:00:00:00:02"},
+				DHCP4: true,
+			},
+		},
+	}, got)
+}
+
+func TestCreateCloudInitISO(t *testing.T) {
+	staticIPs := &staticIPConfig{gateway: netip.MustParseAddr("192.168.122.1")}
+	vm := &vmConfig{
+		name:         "podvm-test",
+		userData:     "#cloud-config",
+		macAddresses: []string{"52:54:00:00:00:01"},
+	}
+
+	// readISO returns the files of a cloud-init ISO image
+	readISO := func(t *testing.T, isoData []byte) map[string]string {
+		isoImg, err := iso9660.OpenImage(bytes.NewReader(isoData))
+		assert.NoError(t, err)
+		root, err := isoImg.RootDir()
+		assert.NoError(t, err)
+		children, err := root.GetChildren()
+		assert.NoError(t, err)
+
+		files := map[string]string{}
+		for _, child := range children {
+			data, err := io.ReadAll(child.Reader())
+			assert.NoError(t, err)
+			files[child.Name()] = string(data)
+		}
+		return files
+	}
+
+	isoData, err := createCloudInitISO(vm, staticIPs)
+	assert.NoError(t, err)
+	files := readISO(t, isoData)
+	assert.Equal(t, "local-hostname: podvm-test", files[cloudinit.NoCloudMetaData])
+	assert.NotContains(t, files, cloudinit.NoCloudNetworkConfig)
+
+	vm.staticIP = netip.MustParsePrefix("192.168.122.200/24")
+	isoData, err = createCloudInitISO(vm, staticIPs)
+	assert.NoError(t, err)
+	files = readISO(t, isoData)
+	assert.Equal(t, "#cloud-config", files[cloudinit.NoCloudUserData])
+	assert.Contains(t, files[cloudinit.NoCloudNetworkConfig], "192.168.122.200/24")
+}
+
+func TestCreateDomainXMLNetworks(t *testing.T) {
+	client := &libvirtClient{nodeInfo: &libvirt.NodeInfo{Model: "x86_64"}}
+	cfg := &domainConfig{
+		name:          "podvm-test",
+		cpu:           2,
+		mem:           4096,
+		networkName:   "default",
+		bootDisk:      "/var/lib/libvirt/images/root.qcow2",
+		cidataDisk:    "/var/lib/libvirt/images/cidata.iso",
+		extraNetworks: []string{"external"},
+	}
+	vm := &vmConfig{
+		staticIP:     netip.MustParsePrefix("192.168.122.200/24"),
+		macAddresses: []string{"52:54:00:00:00:01", "52:54:00:00:00:02"},
+	}
+
+	domain, err := createDomainXML(client, cfg, vm)
+	assert.NoError(t, err)
+
+	interfaces := domain.Devices.Interfaces
+	assert.Len(t, interfaces, 2)
+	assert.Equal(t, "default", interfaces[0].Source.Network.Network)
+	assert.Equal(t, "external", interfaces[1].Source.Network.Network)
+	assert.Equal(t, interfaces[0].Model, interfaces[1].Model)
+	assert.Equal(t, "52:54:00:00:00:01", interfaces[0].MAC.Address)
+	assert.Equal(t, "52:54:00:00:00:02", interfaces[1].MAC.Address)
+
+	assert.Contains(t, domain.Devices.Channels, guestAgentDevice())
+	assert.Equal(t, staticIPMetadata(vm.staticIP.Addr()), domain.Metadata.XML)
+
+	// Without static IP address, libvirt generates the MAC addresses
+	domain, err = createDomainXML(client, &domainConfig{name: "podvm-test", networkName: "default"}, &vmConfig{})
+	assert.NoError(t, err)
+	assert.Len(t, domain.Devices.Interfaces, 1)
+	assert.Nil(t, domain.Devices.Interfaces[0].MAC)
+	assert.Nil(t, domain.Metadata)
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	ifaces := []libvirt.DomainInterface{
+		{Name: "lo", Addrs: []libvirt.DomainIPAddress{{Addr: "127.0.0.1"}, {Addr: "::1"}}},
+		{Name: "eth0", Addrs: []libvirt.DomainIPAddress{{Addr: "192.168.122.200"}, {Addr: "fe80::5054:ff:fe00:1"}}},
+		{Name: "eth1", Addrs: []libvirt.DomainIPAddress{{Addr: "10.0.0.5"}}},
+	}
+	ips, err := interfaceAddrs(ifaces)
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.168.122.200"), netip.MustParseAddr("10.0.0.5")}, ips)
+
+	_, err = interfaceAddrs([]libvirt.DomainInterface{{Addrs: []libvirt.DomainIPAddress{{Addr: "invalid"}}}})
+	assert.Error(t, err)
+}
@@ -72,15 +72,31 @@ func (p *libvirtProvider) CreateInstance(ctx context.Context, podName, sandboxID
 
 	// TODO: Specify the maximum instance name length in Libvirt
 	vm := &vmConfig{name: instanceName, cpu: instanceVCPUs, mem: instanceMemory, userData: userData, firmware: p.serviceConfig.Firmware}
+	vm.tags = provider.MergeTags(p.serviceConfig.Tags, spec)
+
+	// The root volume is raised to the size of the image when it is smaller
+	vm.rootDiskSize = uint64(provider.RootVolumeSize(spec, p.serviceConfig.RootVolumeSize, 0)) << 30
+	for _, disk := range spec.DataDisks {
+		vm.dataDiskSizes = append(vm.dataDiskSizes, uint64(disk.Size)<<30)
+	}
+	if spec.MultiNic {
+		// Pods with external network connectivity get a second interface
+		if p.serviceConfig.SecondaryNetworkName != "" {
+			vm.extraNetworks = []string{p.serviceConfig.SecondaryNetworkName}
+		} else {
+			logger.Printf("Ignoring the request of a second interface, no secondary network is configured")
+		}
+	}
+	if spec.RootVolumeType != "" || spec.RootVolumeIOPS != 0 {
+		logger.Printf("Ignoring the root volume type and IOPS, which are not supported by libvirt")
+	}
 
 	if p.serviceConfig.DisableCVM {
 		vm.launchSecurityType = NoLaunchSecurity
 	} else if p.serviceConfig.LaunchSecurity != "" {
-		switch p.serviceConfig.LaunchSecurity {
-		case "s390-pv":
-			vm.launchSecurityType = S390PV
-		default:
-			return nil, fmt.Errorf("[%s] is not a known launch security setting", p.serviceConfig.LaunchSecurity)
+		vm.launchSecurityType, err = parseLaunchSecurity(p.serviceConfig.LaunchSecurity)
+		if err != nil {
+			return nil, err
 		}
 	} else {
 		vm.launchSecurityType, err = GetLaunchSecurityType(p.serviceConfig.URI)
@@ -91,6 +107,14 @@ func (p *libvirtProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 	logger.Printf("LaunchSecurityType: %s", vm.launchSecurityType.String())
 
+	if vm.launchSecurityType == SEVSNP || vm.launchSecurityType == TDX {
+		// Confidential VMs boot a stateless OVMF, selected by libvirt if not configured
+		vm.firmware = p.serviceConfig.CVMFirmware
+		vm.kernel = p.serviceConfig.Kernel
+		vm.initrd = p.serviceConfig.Initrd
+		vm.kernelCmdline = p.serviceConfig.KernelCmdline
+	}
+
 	if spec.Image != "" {
 		logger.Printf("Choosing %s as libvirt volume for the PodVM image", spec.Image)
 		p.libvirtClient.volName = spec.Image
@@ -184,5 +208,9 @@ func (p *libvirtProvider) ConfigVerifier() error {
 		return fmt.Errorf("Memory must be greater than zero")
 	}
 
+	if _, err := parseStaticIPConfig(config); err != nil {
+		return err
+	}
+
 	return nil
 }
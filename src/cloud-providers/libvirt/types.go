@@ -6,35 +6,56 @@
 package libvirt
 
 import (
+	"fmt"
 	"net/netip"
+	"sync"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	libvirt "libvirt.org/go/libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
 )
 
 type Config struct {
-	URI            string
-	PoolName       string
-	NetworkName    string
-	DataDir        string
-	DisableCVM     bool
-	VolName        string
-	LaunchSecurity string
-	Firmware       string
-	CPU            uint
-	Memory         uint // It stores the value in MiB
+	URI                  string
+	PoolName             string
+	NetworkName          string
+	SecondaryNetworkName string
+	StaticIPRange        string
+	StaticIPPrefixLength uint
+	StaticIPGateway      string
+	DataDir              string
+	DisableCVM           bool
+	VolName              string
+	LaunchSecurity       string
+	Firmware             string
+	CVMFirmware          string
+	Kernel               string
+	Initrd               string
+	KernelCmdline        string
+	CPU                  uint
+	Memory               uint // It stores the value in MiB
+	RootVolumeSize       int  // It stores the value in GiB
+	Tags                 provider.KeyValueFlag
 }
 
 type vmConfig struct {
 	name               string
 	cpu                uint
-	mem                uint // It stores the value in MiB
-	rootDiskSize       uint64
+	mem                uint     // It stores the value in MiB
+	rootDiskSize       uint64   // It stores the value in bytes
+	dataDiskSizes      []uint64 // It stores the values in bytes
 	userData           string
 	ips                []netip.Addr
 	instanceID         string // Domain UUID - keeping it consistent with sandbox.vsi
 	launchSecurityType LaunchSecurityType
 	firmware           string
+	kernel             string // Direct kernel boot, measured with SEV-SNP
+	initrd             string
+	kernelCmdline      string
+	tags               map[string]string // Kept in the metadata of the domain
+	extraNetworks      []string          // Networks of the interfaces after the first one
+	staticIP           netip.Prefix      // Static IP address of the first interface, allocated by CreateDomain
+	macAddresses       []string          // MAC addresses of the interfaces, matched by the network configuration
 }
 
 type createDomainOutput struct {
@@ -61,6 +82,15 @@ type libvirtClient struct {
 
 	// host capabilities
 	caps *libvirtxml.Caps
+
+	// capabilities of x86_64 KVM domains, nil on other architectures
+	domainCaps *libvirtxml.DomainCaps
+
+	// static IP configuration, nil when the addresses come from DHCP
+	staticIPs *staticIPConfig
+	// serializes the allocation of static IP addresses of this instance until their domains are defined,
+	// the domains defined with a duplicate address by other instances are checked after their definition
+	staticIPMutex sync.Mutex
 }
 
 type LaunchSecurityType int
@@ -68,6 +98,8 @@ type LaunchSecurityType int
 const (
 	NoLaunchSecurity LaunchSecurityType = iota
 	S390PV
+	SEVSNP
+	TDX
 )
 
 func (l LaunchSecurityType) String() string {
@@ -76,7 +108,25 @@ func (l LaunchSecurityType) String() string {
 		return "None"
 	case S390PV:
 		return "S390PV"
+	case SEVSNP:
+		return "SEV-SNP"
+	case TDX:
+		return "TDX"
 	default:
 		return "unknown"
 	}
 }
+
+// parseLaunchSecurity returns the launch security type of a LIBVIRT_LAUNCH_SECURITY setting
+func parseLaunchSecurity(s string) (LaunchSecurityType, error) {
+	switch s {
+	case "s390-pv":
+		return S390PV, nil
+	case "sev-snp":
+		return SEVSNP, nil
+	case "tdx":
+		return TDX, nil
+	default:
+		return NoLaunchSecurity, fmt.Errorf("[%s] is not a known launch security setting", s)
+	}
+}
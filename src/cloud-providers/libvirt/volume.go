@@ -243,6 +243,32 @@ func createVolume(volName string, volSize uint64, baseVolName string, libvirtCli
 
 }
 
+// createEmptyVolume creates a blank qcow2 volume of volSize bytes and returns its path
+func createEmptyVolume(volName string, volSize uint64, libvirtClient *libvirtClient) (path string, err error) {
+	volumeDef := newDefVolume(volName)
+	volumeDef.Capacity.Value = volSize
+
+	volumeDefXML, err := xml.Marshal(volumeDef)
+	if err != nil {
+		return "", fmt.Errorf("Error serializing libvirt volume: %s", err)
+	}
+
+	err = waitForSuccess("error refreshing pool for volume", func() error {
+		return libvirtClient.pool.Refresh(0)
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't find storage pool '%s'", libvirtClient.poolName)
+	}
+
+	volume, err := libvirtClient.pool.StorageVolCreateXML(string(volumeDefXML), 0)
+	if err != nil {
+		return "", fmt.Errorf("Error creating libvirt volume: %s", err)
+	}
+	defer freeVolume(volume, &err)
+
+	return volume.GetPath()
+}
+
 func getVolume(libvirtClient *libvirtClient, volumeName string) (*libvirt.StorageVol, error) {
 	// Check whether the storage volume exists. Its name needs to be
 	// unique.
@@ -0,0 +1,58 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"flag"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+var openstackCfg Config
+
+type Manager struct{}
+
+func init() {
+	provider.AddCloudProvider("openstack", &Manager{})
+}
+
+func (*Manager) ParseCmd(flags *flag.FlagSet) {
+	reg := provider.NewFlagRegistrar(flags)
+
+	// Flags with environment variable support
+	reg.StringWithEnv(&openstackCfg.AuthURL, "openstack-auth-url", "", "OS_AUTH_URL", "Identity (Keystone) endpoint", provider.Required())
+	reg.StringWithEnv(&openstackCfg.Username, "openstack-username", "", "OS_USERNAME", "User name")
+	reg.StringWithEnv(&openstackCfg.Password, "openstack-password", "", "OS_PASSWORD", "Password", provider.Secret())
+	reg.StringWithEnv(&openstackCfg.UserDomainName, "openstack-user-domain-name", "Default", "OS_USER_DOMAIN_NAME", "Domain of the user")
+	reg.StringWithEnv(&openstackCfg.ApplicationCredentialID, "openstack-application-credential-id", "", "OS_APPLICATION_CREDENTIAL_ID", "Application credential ID, used instead of the user name and password")
+	reg.StringWithEnv(&openstackCfg.ApplicationCredentialSecret, "openstack-application-credential-secret", "", "OS_APPLICATION_CREDENTIAL_SECRET", "Application credential secret", provider.Secret())
+	reg.StringWithEnv(&openstackCfg.ProjectID, "openstack-project-id", "", "OS_PROJECT_ID", "Project ID")
+	reg.StringWithEnv(&openstackCfg.ProjectName, "openstack-project-name", "", "OS_PROJECT_NAME", "Project name")
+	reg.StringWithEnv(&openstackCfg.ProjectDomainName, "openstack-project-domain-name", "", "OS_PROJECT_DOMAIN_NAME", "Domain of the project, the domain of the user if not set")
+	reg.StringWithEnv(&openstackCfg.Region, "openstack-region", "", "OS_REGION_NAME", "Region")
+	reg.StringWithEnv(&openstackCfg.ImageID, "imageid", "", "PODVM_IMAGE_ID", "Pod VM image id", provider.Required())
+	reg.StringWithEnv(&openstackCfg.Flavor, "flavor", "m1.small", "PODVM_INSTANCE_TYPE", "Pod VM flavor")
+	reg.StringWithEnv(&openstackCfg.KeyName, "keyname", "", "SSH_KP_NAME", "SSH Keypair name to be used with the Pod VM")
+	reg.StringWithEnv(&openstackCfg.AvailabilityZone, "openstack-availability-zone", "", "OPENSTACK_AVAILABILITY_ZONE", "Availability zone of the Pod VMs")
+	reg.BoolWithEnv(&openstackCfg.ConfigDrive, "openstack-config-drive", false, "OPENSTACK_CONFIG_DRIVE", "Pass the user data on a config drive instead of the metadata service")
+	reg.IntWithEnv(&openstackCfg.RootVolumeSize, "root-volume-size", 0, "ROOT_VOLUME_SIZE", "Root volume size (in GiB) for the Pod VMs, booting them from a volume if set")
+
+	// Custom flag types (comma-separated lists)
+	reg.CustomTypeWithEnv(&openstackCfg.Networks, "openstack-network-ids", "", "OPENSTACK_NETWORK_IDS", "Network IDs of the Pod VMs, comma separated. The first network is the pod network, the others are attached to pods with external network connectivity", provider.Required())
+	reg.CustomTypeWithEnv(&openstackCfg.SecurityGroups, "openstack-security-groups", "", "OPENSTACK_SECURITY_GROUPS", "Security groups to be used for the Pod VMs, comma separated")
+	reg.CustomTypeWithEnv(&openstackCfg.Flavors, "flavors", "", "PODVM_INSTANCE_TYPES", "Flavors to be used for the Pod VMs, comma separated")
+	reg.CustomTypeWithEnv(&openstackCfg.Metadata, "tags", "", "TAGS", "Custom metadata (key=value pairs) to be used for the Pod VMs, comma separated")
+}
+
+func (*Manager) LoadEnv() {
+	// No longer needed - environment variables are handled in ParseCmd
+}
+
+func (*Manager) NewProvider() (provider.Provider, error) {
+	return NewProvider(&openstackCfg)
+}
+
+func (*Manager) GetConfig() (config *Config) {
+	return &openstackCfg
+}
@@ -0,0 +1,419 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/attachinterfaces"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/keypairs"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+var (
+	logger = log.New(log.Writer(), "[adaptor/cloud/openstack] ", log.LstdFlags|log.Lmsgprefix)
+
+	errNoImageID  = errors.New("ImageId is empty")
+	errNoNetworks = errors.New("no networks configured")
+
+	// pollInterval is how often the status of a new server is checked
+	pollInterval = 2 * time.Second
+)
+
+const (
+	maxInstanceNameLen = 63
+	maxWaitTime        = 5 * time.Minute
+)
+
+type openstackProvider struct {
+	computeClient *gophercloud.ServiceClient
+	imageClient   *gophercloud.ServiceClient
+	serviceConfig *Config
+	// flavorIDs maps the names of the configured flavors to their IDs
+	flavorIDs map[string]string
+}
+
+func NewProvider(config *Config) (provider.Provider, error) {
+	logger.Printf("openstack config: %#v", config.Redact())
+
+	computeClient, imageClient, err := newClients(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return newProvider(context.Background(), config, computeClient, imageClient)
+}
+
+func newProvider(ctx context.Context, config *Config, computeClient, imageClient *gophercloud.ServiceClient) (*openstackProvider, error) {
+	p := &openstackProvider{
+		computeClient: computeClient,
+		imageClient:   imageClient,
+		serviceConfig: config,
+	}
+
+	if err := p.updateInstanceTypeSpecList(ctx); err != nil {
+		return nil, fmt.Errorf("failed to update instance type spec list: %w", err)
+	}
+
+	return p, nil
+}
+
+// newClients authenticates with an application credential, or a user name and password,
+// and returns clients of the compute and image services of the region. The token is renewed when it expires.
+func newClients(ctx context.Context, config *Config) (*gophercloud.ServiceClient, *gophercloud.ServiceClient, error) {
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: config.AuthURL,
+		AllowReauth:      true,
+	}
+	if config.ApplicationCredentialID != "" {
+		logger.Printf("using application credential %s", config.ApplicationCredentialID)
+		opts.ApplicationCredentialID = config.ApplicationCredentialID
+		opts.ApplicationCredentialSecret = config.ApplicationCredentialSecret
+	} else {
+		opts.Username = config.Username
+		opts.Password = config.Password
+		opts.DomainName = config.UserDomainName
+		opts.Scope = &gophercloud.AuthScope{
+			ProjectID:   config.ProjectID,
+			ProjectName: config.ProjectName,
+		}
+		if config.ProjectID == "" {
+			opts.Scope.DomainName = cmp.Or(config.ProjectDomainName, config.UserDomainName)
+		}
+	}
+
+	providerClient, err := openstack.AuthenticatedClient(ctx, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to authenticate to %s: %w", config.AuthURL, err)
+	}
+
+	computeClient, err := openstack.NewComputeV2(providerClient, gophercloud.EndpointOpts{Region: config.Region})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create a compute client: %w", err)
+	}
+	imageClient, err := openstack.NewImageV2(providerClient, gophercloud.EndpointOpts{Region: config.Region})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create an image client: %w", err)
+	}
+	return computeClient, imageClient, nil
+}
+
+func (p *openstackProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+
+	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
+
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	flavor, err := provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceTypeSpecList, p.serviceConfig.Flavors, p.serviceConfig.Flavor)
+	if err != nil {
+		return nil, err
+	}
+	flavorID, ok := p.flavorIDs[flavor]
+	if !ok {
+		return nil, fmt.Errorf("flavor %q is not found", flavor)
+	}
+
+	imageID := p.serviceConfig.ImageID
+	if spec.Image != "" {
+		logger.Printf("Choosing %s from annotation as the OpenStack image for the PodVM image", spec.Image)
+		imageID = spec.Image
+	}
+
+	// Cinder rejects volumes smaller than the image, so look up the image size when a root volume size is set
+	imageSize := 0
+	if spec.RootVolumeSize > 0 || p.serviceConfig.RootVolumeSize > 0 {
+		imageSize, err = p.getImageSize(ctx, imageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image size: %w", err)
+		}
+	}
+
+	networks := p.networks(spec)
+	var serverNetworks []servers.Network
+	for _, network := range networks {
+		serverNetworks = append(serverNetworks, servers.Network{UUID: network})
+	}
+
+	opts := servers.CreateOpts{
+		Name:             instanceName,
+		ImageRef:         imageID,
+		FlavorRef:        flavorID,
+		SecurityGroups:   p.serviceConfig.SecurityGroups,
+		UserData:         []byte(userData),
+		AvailabilityZone: p.serviceConfig.AvailabilityZone,
+		Networks:         serverNetworks,
+		Metadata:         provider.MergeTags(p.serviceConfig.Metadata, spec),
+		BlockDevice:      blockDevices(imageID, spec, p.serviceConfig.RootVolumeSize, imageSize),
+	}
+	if p.serviceConfig.ConfigDrive {
+		opts.ConfigDrive = &p.serviceConfig.ConfigDrive
+	}
+	if len(opts.BlockDevice) > 0 && opts.BlockDevice[0].BootIndex == 0 {
+		// The server boots from a volume created from the image
+		opts.ImageRef = ""
+	}
+
+	createOpts := keypairs.CreateOptsExt{CreateOptsBuilder: opts, KeyName: p.serviceConfig.KeyName}
+
+	logger.Printf("CreateInstance: name: %q, flavor: %s", instanceName, flavor)
+
+	server, err := servers.Create(ctx, p.computeClient, createOpts, nil).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("creating server: %w", err)
+	}
+	logger.Printf("created a server %s for sandbox %s", server.ID, sandboxID)
+
+	// Create partial instance to return on error (allows caller to cleanup)
+	instance := &provider.Instance{
+		ID:   server.ID,
+		Name: instanceName,
+	}
+
+	if err := p.waitForActive(ctx, server.ID); err != nil {
+		return instance, err
+	}
+
+	ips, err := p.getIPs(ctx, server.ID, networks)
+	if err != nil {
+		return instance, err
+	}
+	instance.IPs = ips
+
+	return instance, nil
+}
+
+// networks returns the networks of a pod VM. Pods with external network connectivity get all the
+// configured networks, the others only the first one, the pod network.
+func (p *openstackProvider) networks(spec provider.InstanceTypeSpec) []string {
+	if len(p.serviceConfig.Networks) == 0 {
+		return nil
+	}
+	if spec.MultiNic {
+		return p.serviceConfig.Networks
+	}
+	return p.serviceConfig.Networks[:1]
+}
+
+// getImageSize returns the size in GiB of the smallest volume an image can be written to
+func (p *openstackProvider) getImageSize(ctx context.Context, imageID string) (int, error) {
+	image, err := images.Get(ctx, p.imageClient, imageID).Extract()
+	if err != nil {
+		return 0, fmt.Errorf("getting image %s: %w", imageID, err)
+	}
+	size := max(image.VirtualSize, image.SizeBytes)
+	return max(int((size+1<<30-1)>>30), image.MinDiskGigabytes), nil
+}
+
+// blockDevices returns the block device mappings of a pod VM. Pod VMs boot from a volume when a root volume
+// size is set, and data disks are attached as volumes. All the volumes are deleted with the server.
+func blockDevices(imageID string, spec provider.InstanceTypeSpec, rootVolumeSize, imageSize int) []servers.BlockDevice {
+	var devices []servers.BlockDevice
+
+	if size := provider.RootVolumeSize(spec, rootVolumeSize, imageSize); size > 0 {
+		devices = append(devices, servers.BlockDevice{
+			SourceType:          servers.SourceImage,
+			UUID:                imageID,
+			DestinationType:     servers.DestinationVolume,
+			VolumeSize:          size,
+			VolumeType:          spec.RootVolumeType,
+			BootIndex:           0,
+			DeleteOnTermination: true,
+		})
+	} else if spec.RootVolumeType != "" {
+		logger.Printf("Ignoring root volume type %s, pod VMs boot from a volume only when a root volume size is set", spec.RootVolumeType)
+	}
+	if spec.RootVolumeIOPS > 0 {
+		logger.Printf("Ignoring root volume IOPS %d, the IOPS of Cinder volumes are set by their volume type", spec.RootVolumeIOPS)
+	}
+
+	for _, disk := range spec.DataDisks {
+		devices = append(devices, servers.BlockDevice{
+			SourceType:          servers.SourceBlank,
+			DestinationType:     servers.DestinationVolume,
+			VolumeSize:          disk.Size,
+			VolumeType:          disk.Type,
+			BootIndex:           -1,
+			DeleteOnTermination: true,
+		})
+	}
+	return devices
+}
+
+// waitForActive waits until a server is active, or fails to build
+func (p *openstackProvider) waitForActive(ctx context.Context, serverID string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	for {
+		server, err := servers.Get(ctx, p.computeClient, serverID).Extract()
+		if err != nil {
+			return fmt.Errorf("getting server %s: %w", serverID, err)
+		}
+		switch server.Status {
+		case "ACTIVE":
+			logger.Printf("server %s is active", serverID)
+			return nil
+		case "ERROR":
+			return fmt.Errorf("server %s failed to build: %s", serverID, server.Fault.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for server %s to be active, status %s: %w", serverID, server.Status, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// getIPs returns the fixed IP addresses of a server in the order of its networks, so that the address on the
+// pod network is the first one
+func (p *openstackProvider) getIPs(ctx context.Context, serverID string, networks []string) ([]netip.Addr, error) {
+	pages, err := attachinterfaces.List(p.computeClient, serverID).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing interfaces of server %s: %w", serverID, err)
+	}
+	interfaces, err := attachinterfaces.ExtractInterfaces(pages)
+	if err != nil {
+		return nil, fmt.Errorf("listing interfaces of server %s: %w", serverID, err)
+	}
+
+	var ips []netip.Addr
+	for _, network := range networks {
+		for _, iface := range interfaces {
+			if iface.NetID != network {
+				continue
+			}
+			for _, fixedIP := range iface.FixedIPs {
+				ip, err := netip.ParseAddr(fixedIP.IPAddress)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse pod node IP %q: %w", fixedIP.IPAddress, err)
+				}
+				logger.Printf("podNodeIP[%d]=%s", len(ips), ip)
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("server %s has no IP address", serverID)
+	}
+	return ips, nil
+}
+
+func (p *openstackProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	err := servers.Delete(ctx, p.computeClient, instanceID).ExtractErr()
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			logger.Printf("server %s is not found", instanceID)
+			return nil
+		}
+		logger.Printf("failed to delete server %s: %v", instanceID, err)
+		return err
+	}
+
+	logger.Printf("deleted server %s", instanceID)
+	return nil
+}
+
+func (p *openstackProvider) Teardown() error {
+	return nil
+}
+
+func (p *openstackProvider) ConfigVerifier() error {
+	if len(p.serviceConfig.ImageID) == 0 {
+		return errNoImageID
+	}
+	if len(p.serviceConfig.Networks) == 0 {
+		return errNoNetworks
+	}
+	return nil
+}
+
+// updateInstanceTypeSpecList looks up the configured flavors, and populates InstanceTypeSpecList
+func (p *openstackProvider) updateInstanceTypeSpecList(ctx context.Context) error {
+	flavorNames := p.serviceConfig.Flavors
+	if len(flavorNames) == 0 {
+		flavorNames = []string{p.serviceConfig.Flavor}
+	}
+
+	pages, err := flavors.ListDetail(p.computeClient, flavors.ListOpts{AccessType: flavors.AllAccess}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("listing flavors: %w", err)
+	}
+	allFlavors, err := flavors.ExtractFlavors(pages)
+	if err != nil {
+		return fmt.Errorf("listing flavors: %w", err)
+	}
+
+	p.flavorIDs = make(map[string]string)
+	var instanceTypeSpecList []provider.InstanceTypeSpec
+	for _, name := range flavorNames {
+		var flavor *flavors.Flavor
+		for i := range allFlavors {
+			if allFlavors[i].Name == name || allFlavors[i].ID == name {
+				flavor = &allFlavors[i]
+				break
+			}
+		}
+		if flavor == nil {
+			return fmt.Errorf("flavor %q is not found", name)
+		}
+
+		extraSpecs, err := flavors.ListExtraSpecs(ctx, p.computeClient, flavor.ID).Extract()
+		if err != nil {
+			return fmt.Errorf("getting extra specs of flavor %q: %w", name, err)
+		}
+
+		p.flavorIDs[name] = flavor.ID
+		instanceTypeSpecList = append(instanceTypeSpecList, provider.InstanceTypeSpec{
+			InstanceType: name,
+			VCPUs:        int64(flavor.VCPUs),
+			Memory:       int64(flavor.RAM),
+			GPUs:         flavorGPUs(extraSpecs),
+		})
+	}
+
+	p.serviceConfig.InstanceTypeSpecList = provider.SortInstanceTypesOnResources(instanceTypeSpecList)
+	logger.Printf("InstanceTypeSpecList (%v)", p.serviceConfig.InstanceTypeSpecList)
+	return nil
+}
+
+// flavorGPUs returns the number of GPUs of a flavor, requested as vGPUs ("resources:VGPU") or
+// PCI passthrough devices ("pci_passthrough:alias", e.g. "a100:2")
+func flavorGPUs(extraSpecs map[string]string) int64 {
+	if n, err := strconv.ParseInt(extraSpecs["resources:VGPU"], 10, 64); err == nil {
+		return n
+	}
+
+	var gpus int64
+	if aliases := extraSpecs["pci_passthrough:alias"]; aliases != "" {
+		for _, alias := range strings.Split(aliases, ",") {
+			_, count, _ := strings.Cut(alias, ":")
+			n, err := strconv.ParseInt(cmp.Or(count, "1"), 10, 64)
+			if err != nil {
+				continue
+			}
+			gpus += n
+		}
+	}
+	return gpus
+}
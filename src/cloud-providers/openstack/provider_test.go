@@ -0,0 +1,315 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+const (
+	testServerID = "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	podNetwork   = "7e7b3a36-1b36-4fa2-9ac0-2d5c7c7b2f54"
+	extNetwork   = "b9b1a0f2-4c4c-4f8f-a5bb-4c6d2e0d2a11"
+)
+
+// fakeCompute is a fake compute service with the flavors of a cloud. It records the server create requests,
+// and builds the servers with an address on each of their networks.
+type fakeCompute struct {
+	th.FakeServer
+
+	mutex    sync.Mutex
+	requests []map[string]any
+	networks []string
+	deleted  []string
+	status   string
+}
+
+func newFakeCompute(t *testing.T) *fakeCompute {
+	f := &fakeCompute{FakeServer: th.SetupHTTP(), status: "ACTIVE"}
+	t.Cleanup(f.Teardown)
+
+	f.Mux.HandleFunc("/flavors/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		writeJSON(w, http.StatusOK, `{"flavors": [
+			{"id": "1", "name": "m1.small", "vcpus": 1, "ram": 2048, "disk": 20},
+			{"id": "2", "name": "m1.large", "vcpus": 4, "ram": 8192, "disk": 80},
+			{"id": "3", "name": "g1.large", "vcpus": 8, "ram": 16384, "disk": 80}
+		]}`)
+	})
+	f.Mux.HandleFunc("/flavors/{id}/os-extra_specs", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		if r.PathValue("id") == "3" {
+			writeJSON(w, http.StatusOK, `{"extra_specs": {"pci_passthrough:alias": "a100:2"}}`)
+			return
+		}
+		writeJSON(w, http.StatusOK, `{"extra_specs": {}}`)
+	})
+	f.Mux.HandleFunc("POST /servers", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding server create request: %v", err)
+		}
+		server := req["server"].(map[string]any)
+
+		f.mutex.Lock()
+		f.requests = append(f.requests, server)
+		f.networks = nil
+		for _, network := range server["networks"].([]any) {
+			f.networks = append(f.networks, network.(map[string]any)["uuid"].(string))
+		}
+		f.mutex.Unlock()
+
+		writeJSON(w, http.StatusAccepted, fmt.Sprintf(`{"server": {"id": %q}}`, testServerID))
+	})
+	f.Mux.HandleFunc("GET /servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		writeJSON(w, http.StatusOK, fmt.Sprintf(`{"server": {"id": %q, "status": %q, "fault": {"message": "No valid host was found"}}}`,
+			r.PathValue("id"), f.status))
+	})
+	f.Mux.HandleFunc("/servers/{id}/os-interface", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		// The interfaces are listed in a different order than the networks of the server
+		var interfaces []map[string]any
+		for i := len(f.networks) - 1; i >= 0; i-- {
+			interfaces = append(interfaces, map[string]any{
+				"net_id":    f.networks[i],
+				"fixed_ips": []map[string]string{{"ip_address": fmt.Sprintf("10.0.%d.5", i)}},
+			})
+		}
+		data, _ := json.Marshal(map[string]any{"interfaceAttachments": interfaces})
+		writeJSON(w, http.StatusOK, string(data))
+	})
+	f.Mux.HandleFunc("GET /images/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// The image service shares the fake server, images are 10 GiB and a byte
+		writeJSON(w, http.StatusOK, fmt.Sprintf(`{"id": %q, "min_disk": 2, "size": 1073741824, "virtual_size": 10737418241}`, r.PathValue("id")))
+	})
+	f.Mux.HandleFunc("DELETE /servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != testServerID {
+			writeJSON(w, http.StatusNotFound, `{"itemNotFound": {"message": "Instance could not be found"}}`)
+			return
+		}
+		f.mutex.Lock()
+		f.deleted = append(f.deleted, r.PathValue("id"))
+		f.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+func newTestProvider(t *testing.T, f *fakeCompute, config *Config) *openstackProvider {
+	p, err := newProvider(context.Background(), config, fakeclient.ServiceClient(f.FakeServer), fakeclient.ServiceClient(f.FakeServer))
+	if err != nil {
+		t.Fatalf("newProvider() error = %v", err)
+	}
+	return p
+}
+
+func TestUpdateInstanceTypeSpecList(t *testing.T) {
+	f := newFakeCompute(t)
+	p := newTestProvider(t, f, &Config{Flavor: "m1.small", Flavors: stringList{"g1.large", "m1.large", "m1.small"}})
+
+	want := []provider.InstanceTypeSpec{
+		{InstanceType: "m1.small", VCPUs: 1, Memory: 2048},
+		{InstanceType: "m1.large", VCPUs: 4, Memory: 8192},
+		{InstanceType: "g1.large", VCPUs: 8, Memory: 16384, GPUs: 2},
+	}
+	if !reflect.DeepEqual(p.serviceConfig.InstanceTypeSpecList, want) {
+		t.Errorf("InstanceTypeSpecList = %v, want %v", p.serviceConfig.InstanceTypeSpecList, want)
+	}
+
+	if _, err := newProvider(context.Background(), &Config{Flavor: "m1.xlarge"}, fakeclient.ServiceClient(f.FakeServer), fakeclient.ServiceClient(f.FakeServer)); err == nil {
+		t.Error("newProvider() expected an error for an unknown flavor")
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	f := newFakeCompute(t)
+	p := newTestProvider(t, f, &Config{
+		ImageID:        "podvm-image",
+		Flavor:         "m1.small",
+		Flavors:        stringList{"m1.small", "m1.large"},
+		Networks:       stringList{podNetwork, extNetwork},
+		SecurityGroups: stringList{"peerpods"},
+		KeyName:        "peerpods-key",
+		ConfigDrive:    true,
+	})
+
+	tests := []struct {
+		name        string
+		spec        provider.InstanceTypeSpec
+		wantFlavor  string
+		wantNetwork []any
+		wantIPs     []netip.Addr
+	}{
+		{
+			name:        "default flavor",
+			spec:        provider.InstanceTypeSpec{},
+			wantFlavor:  "1",
+			wantNetwork: []any{map[string]any{"uuid": podNetwork}},
+			wantIPs:     []netip.Addr{netip.MustParseAddr("10.0.0.5")},
+		},
+		{
+			name:        "best fit flavor with external network connectivity",
+			spec:        provider.InstanceTypeSpec{VCPUs: 2, Memory: 4096, MultiNic: true},
+			wantFlavor:  "2",
+			wantNetwork: []any{map[string]any{"uuid": podNetwork}, map[string]any{"uuid": extNetwork}},
+			wantIPs:     []netip.Addr{netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("10.0.1.5")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, tt.spec)
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if instance.ID != testServerID || !reflect.DeepEqual(instance.IPs, tt.wantIPs) {
+				t.Errorf("CreateInstance() = %+v, want ID %s and IPs %v", instance, testServerID, tt.wantIPs)
+			}
+
+			req := f.requests[len(f.requests)-1]
+			if req["flavorRef"] != tt.wantFlavor || req["imageRef"] != "podvm-image" {
+				t.Errorf("flavorRef, imageRef = %v, %v, want %s, podvm-image", req["flavorRef"], req["imageRef"], tt.wantFlavor)
+			}
+			if !reflect.DeepEqual(req["networks"], tt.wantNetwork) {
+				t.Errorf("networks = %v, want %v", req["networks"], tt.wantNetwork)
+			}
+			if req["config_drive"] != true || req["key_name"] != "peerpods-key" || req["user_data"] != "Y2xvdWQgY29uZmln" {
+				t.Errorf("config_drive, key_name, user_data = %v, %v, %v", req["config_drive"], req["key_name"], req["user_data"])
+			}
+			wantSecurityGroups := []any{map[string]any{"name": "peerpods"}}
+			if !reflect.DeepEqual(req["security_groups"], wantSecurityGroups) {
+				t.Errorf("security_groups = %v, want %v", req["security_groups"], wantSecurityGroups)
+			}
+		})
+	}
+
+	if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{},
+		provider.InstanceTypeSpec{InstanceType: "g1.large"}); err == nil {
+		t.Error("CreateInstance() expected an error for a flavor that is not in the flavors list")
+	}
+}
+
+func TestCreateInstanceBuildError(t *testing.T) {
+	pollInterval = time.Millisecond
+	f := newFakeCompute(t)
+	f.status = "ERROR"
+	p := newTestProvider(t, f, &Config{ImageID: "podvm-image", Flavor: "m1.small", Networks: stringList{podNetwork}})
+
+	instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{})
+	if err == nil {
+		t.Fatal("CreateInstance() expected an error")
+	}
+	// The server is returned so that it is deleted
+	if instance == nil || instance.ID != testServerID {
+		t.Errorf("CreateInstance() = %+v, want the server %s", instance, testServerID)
+	}
+}
+
+func TestCreateInstanceRootVolume(t *testing.T) {
+	f := newFakeCompute(t)
+	p := newTestProvider(t, f, &Config{ImageID: "podvm-image", Flavor: "m1.small", Networks: stringList{podNetwork}, RootVolumeSize: 5})
+
+	tests := []struct {
+		name     string
+		spec     provider.InstanceTypeSpec
+		wantSize float64
+	}{
+		{name: "configured size smaller than the image", wantSize: 11},
+		{name: "requested size", spec: provider.InstanceTypeSpec{RootVolumeSize: 30}, wantSize: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, tt.spec); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			req := f.requests[len(f.requests)-1]
+			devices, _ := req["block_device_mapping_v2"].([]any)
+			if len(devices) != 1 {
+				t.Fatalf("block_device_mapping_v2 = %v, want the root volume", req["block_device_mapping_v2"])
+			}
+			if size := devices[0].(map[string]any)["volume_size"]; size != tt.wantSize {
+				t.Errorf("volume_size = %v, want %v", size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestBlockDevices(t *testing.T) {
+	spec := provider.InstanceTypeSpec{
+		RootVolumeSize: 50,
+		RootVolumeType: "ssd",
+		DataDisks:      []provider.DataDisk{{Size: 100}, {Size: 10, Type: "hdd"}},
+	}
+	devices := blockDevices("podvm-image", spec, 20, 10)
+	if len(devices) != 3 {
+		t.Fatalf("blockDevices() = %+v, want 3 devices", devices)
+	}
+	if root := devices[0]; root.UUID != "podvm-image" || root.BootIndex != 0 || root.VolumeSize != 50 || root.VolumeType != "ssd" || !root.DeleteOnTermination {
+		t.Errorf("root volume = %+v", root)
+	}
+	if disk := devices[2]; disk.BootIndex != -1 || disk.VolumeSize != 10 || disk.VolumeType != "hdd" || !disk.DeleteOnTermination {
+		t.Errorf("data disk = %+v", disk)
+	}
+
+	// Pod VMs boot from the image without a root volume size
+	if devices := blockDevices("podvm-image", provider.InstanceTypeSpec{RootVolumeType: "ssd"}, 0, 10); len(devices) != 0 {
+		t.Errorf("blockDevices() = %+v, want none", devices)
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	f := newFakeCompute(t)
+	p := newTestProvider(t, f, &Config{Flavor: "m1.small"})
+
+	if err := p.DeleteInstance(context.Background(), testServerID); err != nil {
+		t.Errorf("DeleteInstance() error = %v", err)
+	}
+	if !reflect.DeepEqual(f.deleted, []string{testServerID}) {
+		t.Errorf("deleted servers = %v, want %s", f.deleted, testServerID)
+	}
+
+	// Deleting a server that is already deleted succeeds
+	if err := p.DeleteInstance(context.Background(), "unknown"); err != nil {
+		t.Errorf("DeleteInstance() error = %v for a deleted server", err)
+	}
+}
+
+func TestConfigVerifier(t *testing.T) {
+	p := &openstackProvider{serviceConfig: &Config{ImageID: "podvm-image"}}
+	if err := p.ConfigVerifier(); err != errNoNetworks {
+		t.Errorf("ConfigVerifier() = %v, want %v", err, errNoNetworks)
+	}
+	p.serviceConfig.Networks = stringList{podNetwork}
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() = %v", err)
+	}
+}
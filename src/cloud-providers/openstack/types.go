@@ -0,0 +1,55 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+// stringList is a comma separated list flag
+type stringList []string
+
+func (i *stringList) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *stringList) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(stringList, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type Config struct {
+	AuthURL                     string
+	Username                    string
+	Password                    string
+	UserDomainName              string
+	ApplicationCredentialID     string
+	ApplicationCredentialSecret string
+	ProjectID                   string
+	ProjectName                 string
+	ProjectDomainName           string
+	Region                      string
+	ImageID                     string
+	Flavor                      string
+	Flavors                     stringList
+	InstanceTypeSpecList        []provider.InstanceTypeSpec
+	Networks                    stringList
+	SecurityGroups              stringList
+	KeyName                     string
+	AvailabilityZone            string
+	ConfigDrive                 bool
+	RootVolumeSize              int
+	Metadata                    provider.KeyValueFlag
+}
+
+func (c Config) Redact() Config {
+	return *util.RedactStruct(&c, "Password", "ApplicationCredentialSecret").(*Config)
+}
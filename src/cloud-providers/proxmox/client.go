@@ -0,0 +1,220 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// taskPollInterval is how often the status of a Proxmox task is checked
+var taskPollInterval = time.Second
+
+// apiError is an error response of the Proxmox API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("proxmox API error %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotExist returns whether an error reports a VM or a volume that does not exist
+func isNotExist(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && (apiErr.StatusCode == http.StatusNotFound || strings.Contains(apiErr.Message, "does not exist"))
+}
+
+// isExist returns whether an error reports a VM ID that is already used, e.g. by a VM cloned by another client
+func isExist(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && strings.Contains(apiErr.Message, "already exists")
+}
+
+// client is a client of the Proxmox VE REST API, authenticated with an API token
+type client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func newClient(config *Config) (*client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CACertFile != "" {
+		caCert, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no CA certificate in %s", config.CACertFile)
+		}
+	}
+
+	baseURL := strings.TrimSuffix(config.APIURL, "/")
+	if !strings.HasSuffix(baseURL, "/api2/json") {
+		baseURL += "/api2/json"
+	}
+
+	return &client{
+		baseURL: baseURL,
+		token:   fmt.Sprintf("PVEAPIToken=%s=%s", config.TokenID, config.TokenSecret),
+		httpClient: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// do sends a request with form parameters, and decodes the data of the response into out, if not nil
+func (c *client) do(ctx context.Context, method, path string, params url.Values, out any) error {
+	var body io.Reader
+	reqURL := c.baseURL + path
+	if method == http.MethodGet || method == http.MethodDelete {
+		if len(params) > 0 {
+			reqURL += "?" + params.Encode()
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.send(req, out)
+}
+
+// upload uploads a file to a storage of a node
+func (c *client) upload(ctx context.Context, node, storage, content, filename string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.WriteField("content", content); err != nil {
+		return "", err
+	}
+	part, err := writer.CreateFormFile("filename", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("/nodes/%s/storage/%s/upload", url.PathEscape(node), url.PathEscape(storage))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var upid string
+	if err := c.send(req, &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+func (c *client) send(req *http.Request, out any) error {
+	req.Header.Set("Authorization", c.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Data    json.RawMessage   `json:"data"`
+		Message string            `json:"message"`
+		Errors  map[string]string `json:"errors"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &result); err != nil && resp.StatusCode < 300 {
+			return fmt.Errorf("decoding response of %s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+
+	if resp.StatusCode >= 300 {
+		// Proxmox reports errors in the status line, and the errors of parameters in the body
+		message := strings.TrimSpace(result.Message)
+		if message == "" {
+			message = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+		}
+		for param, paramErr := range result.Errors {
+			message += fmt.Sprintf(", %s: %s", param, strings.TrimSpace(paramErr))
+		}
+		return &apiError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if out == nil || len(result.Data) == 0 || string(result.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(result.Data, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// doTask sends a request starting a task, and waits for the task to finish. Requests that finish
+// without a task, e.g. synchronous configuration changes, return no task ID.
+func (c *client) doTask(ctx context.Context, method, path string, params url.Values, node string) error {
+	var upid string
+	if err := c.do(ctx, method, path, params, &upid); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(upid, "UPID:") {
+		return nil
+	}
+	return c.waitTask(ctx, node, upid)
+}
+
+// waitTask waits for a task to finish, and returns an error if it fails
+func (c *client) waitTask(ctx context.Context, node, upid string) error {
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/status", url.PathEscape(node), url.PathEscape(upid))
+	for {
+		var status struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, nil, &status); err != nil {
+			return fmt.Errorf("getting status of task %s: %w", upid, err)
+		}
+		if status.Status == "stopped" {
+			if status.ExitStatus != "OK" {
+				return fmt.Errorf("task %s failed: %s", upid, status.ExitStatus)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for task %s: %w", upid, ctx.Err())
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxmox
+
+import (
+	"flag"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+var proxmoxCfg Config
+
+type Manager struct{}
+
+func init() {
+	provider.AddCloudProvider("proxmox", &Manager{})
+}
+
+func (*Manager) ParseCmd(flags *flag.FlagSet) {
+	reg := provider.NewFlagRegistrar(flags)
+
+	// Flags with environment variable support
+	reg.StringWithEnv(&proxmoxCfg.APIURL, "proxmox-api-url", "", "PROXMOX_API_URL", "Proxmox VE API URL, e.g. https://pve.example.com:8006/api2/json", provider.Required())
+	reg.StringWithEnv(&proxmoxCfg.TokenID, "proxmox-token-id", "", "PROXMOX_TOKEN_ID", "API token ID, e.g. caa@pve!peerpods", provider.Required())
+	reg.StringWithEnv(&proxmoxCfg.TokenSecret, "proxmox-token-secret", "", "PROXMOX_TOKEN_SECRET", "API token secret", provider.Secret())
+	reg.StringWithEnv(&proxmoxCfg.CACertFile, "proxmox-ca-cert-file", "", "PROXMOX_CA_CERT_FILE", "CA certificate file of the Proxmox VE API")
+	reg.BoolWithEnv(&proxmoxCfg.InsecureSkipVerify, "proxmox-insecure-skip-verify", false, "PROXMOX_INSECURE_SKIP_VERIFY", "Skip TLS certificate verification of the Proxmox VE API - use it only for testing")
+	reg.StringWithEnv(&proxmoxCfg.Node, "proxmox-node", "", "PROXMOX_NODE", "Node creating the Pod VMs", provider.Required())
+	reg.StringWithEnv(&proxmoxCfg.TemplateID, "proxmox-template-id", "", "PODVM_TEMPLATE_ID", "VM ID of the Pod VM template", provider.Required())
+	reg.BoolWithEnv(&proxmoxCfg.FullClone, "proxmox-full-clone", false, "PROXMOX_FULL_CLONE", "Create full clones of the template instead of linked clones")
+	reg.StringWithEnv(&proxmoxCfg.Storage, "proxmox-storage", "local-lvm", "PROXMOX_STORAGE", "Storage of full clones and data disks")
+	reg.StringWithEnv(&proxmoxCfg.ISOStorage, "proxmox-iso-storage", "local", "PROXMOX_ISO_STORAGE", "Storage of the cloud-init ISO images of the Pod VMs")
+	reg.StringWithEnv(&proxmoxCfg.Pool, "proxmox-pool", "", "PROXMOX_POOL", "Resource pool of the Pod VMs")
+	reg.StringWithEnv(&proxmoxCfg.RootDisk, "proxmox-root-disk", "scsi0", "PROXMOX_ROOT_DISK", "Root disk of the template, resized to the root volume size")
+	reg.IntWithEnv(&proxmoxCfg.RootVolumeSize, "root-volume-size", 0, "ROOT_VOLUME_SIZE", "Root volume size (in GiB) for the Pod VMs, 0 keeps the size of the template")
+	reg.StringWithEnv(&proxmoxCfg.InstanceType, "instance-type", "2x4096", "PODVM_INSTANCE_TYPE", "Pod VM instance type, as <cores>x<memory in MiB>")
+
+	// Custom flag types (comma-separated lists)
+	reg.CustomTypeWithEnv(&proxmoxCfg.InstanceTypes, "instance-types", "", "PODVM_INSTANCE_TYPES", "Instance types to be used for the Pod VMs, comma separated")
+	reg.CustomTypeWithEnv(&proxmoxCfg.Tags, "tags", "", "TAGS", "Custom tags (key=value pairs) to be kept in the notes of the Pod VMs, comma separated")
+}
+
+func (*Manager) LoadEnv() {
+	// No longer needed - environment variables are handled in ParseCmd
+}
+
+func (*Manager) NewProvider() (provider.Provider, error) {
+	return NewProvider(&proxmoxCfg)
+}
+
+func (*Manager) GetConfig() (config *Config) {
+	return &proxmoxCfg
+}
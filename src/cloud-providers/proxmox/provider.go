@@ -0,0 +1,421 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+var (
+	logger = log.New(log.Writer(), "[adaptor/cloud/proxmox] ", log.LstdFlags|log.Lmsgprefix)
+
+	errNoTemplateID = errors.New("TemplateID is empty")
+
+	// cdromDevices are the devices the cloud-init ISO is attached to, unless the template has a cloud-init drive
+	cdromDevices = []string{"ide2", "ide3", "ide0", "ide1"}
+)
+
+const (
+	maxInstanceNameLen = 63
+	maxWaitTime        = 5 * time.Minute
+	maxSCSIDevices     = 31
+	// maxCloneAttempts bounds the clones retried when the VM ID is taken by another client
+	maxCloneAttempts = 5
+)
+
+type proxmoxProvider struct {
+	client        *client
+	serviceConfig *Config
+
+	// cloneMutex serializes the allocation of VM IDs, which are reserved only when a clone starts.
+	// Other clients of the cluster may still take an ID before the clone, which is then retried.
+	cloneMutex sync.Mutex
+}
+
+func NewProvider(config *Config) (provider.Provider, error) {
+	logger.Printf("proxmox config: %#v", config.Redact())
+
+	client, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return newProvider(config, client)
+}
+
+func newProvider(config *Config, client *client) (*proxmoxProvider, error) {
+	p := &proxmoxProvider{
+		client:        client,
+		serviceConfig: config,
+	}
+	if err := p.updateInstanceTypeSpecList(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *proxmoxProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+
+	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
+
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	instanceType, err := provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceTypeSpecList, p.serviceConfig.InstanceTypes, p.serviceConfig.InstanceType)
+	if err != nil {
+		return nil, err
+	}
+	cores, memory, err := parseInstanceType(instanceType)
+	if err != nil {
+		return nil, err
+	}
+
+	templateID := p.serviceConfig.TemplateID
+	if spec.Image != "" {
+		logger.Printf("Choosing template %s from annotation as the PodVM image", spec.Image)
+		templateID = spec.Image
+	}
+	if _, err := strconv.Atoi(templateID); err != nil {
+		return nil, fmt.Errorf("invalid template VM ID %q", templateID)
+	}
+
+	node := p.serviceConfig.Node
+
+	params := url.Values{
+		"name": {instanceName},
+		"full": {boolParam(p.serviceConfig.FullClone)},
+	}
+	if p.serviceConfig.FullClone && p.serviceConfig.Storage != "" {
+		params.Set("storage", p.serviceConfig.Storage)
+	}
+	if p.serviceConfig.Pool != "" {
+		params.Set("pool", p.serviceConfig.Pool)
+	}
+
+	var vmid, upid string
+	p.cloneMutex.Lock()
+	for attempt := 1; ; attempt++ {
+		vmid, err = p.nextID(ctx)
+		if err != nil {
+			break
+		}
+		params.Set("newid", vmid)
+		err = p.client.do(ctx, http.MethodPost, p.qemuPath(templateID, "/clone"), params, &upid)
+		if err == nil || !isExist(err) || attempt == maxCloneAttempts {
+			break
+		}
+		logger.Printf("VM ID %s was taken by another client, retrying the clone with a new ID", vmid)
+	}
+	p.cloneMutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("cloning template %s: %w", templateID, err)
+	}
+	logger.Printf("CreateInstance: name: %q, VM ID: %s, template: %s, instance type: %s", instanceName, vmid, templateID, instanceType)
+
+	// Create partial instance to return on error (allows caller to cleanup)
+	instance := &provider.Instance{
+		ID:   vmid,
+		Name: instanceName,
+	}
+
+	if err := p.client.waitTask(ctx, node, upid); err != nil {
+		return instance, fmt.Errorf("cloning template %s: %w", templateID, err)
+	}
+	logger.Printf("cloned template %s to VM %s for sandbox %s", templateID, vmid, sandboxID)
+
+	// The user data is passed on a NoCloud ISO image, as the API cannot upload cloud-init snippets
+	metaData := fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", instanceName, instanceName)
+	iso, err := cloudinit.NoCloudISO([]byte(userData), []byte(metaData))
+	if err != nil {
+		return instance, fmt.Errorf("creating cloud-init ISO: %w", err)
+	}
+	upid, err = p.client.upload(ctx, node, p.serviceConfig.ISOStorage, "iso", isoFileName(vmid), iso)
+	if err == nil {
+		err = p.client.waitTask(ctx, node, upid)
+	}
+	if err != nil {
+		return instance, fmt.Errorf("uploading cloud-init ISO: %w", err)
+	}
+
+	var vmConfig map[string]any
+	if err := p.client.do(ctx, http.MethodGet, p.qemuPath(vmid, "/config"), nil, &vmConfig); err != nil {
+		return instance, fmt.Errorf("getting configuration of VM %s: %w", vmid, err)
+	}
+	params, err = p.configParams(vmConfig, vmid, cores, memory, spec)
+	if err != nil {
+		return instance, err
+	}
+	if err := p.client.doTask(ctx, http.MethodPost, p.qemuPath(vmid, "/config"), params, node); err != nil {
+		return instance, fmt.Errorf("configuring VM %s: %w", vmid, err)
+	}
+
+	// Proxmox cannot shrink disks, so sizes up to the size of the root disk of the template keep it
+	imageSize := diskSize(vmConfig[p.serviceConfig.RootDisk])
+	if size := provider.RootVolumeSize(spec, p.serviceConfig.RootVolumeSize, imageSize); size > imageSize {
+		logger.Printf("Resizing disk %s of VM %s to %d GiB", p.serviceConfig.RootDisk, vmid, size)
+		params := url.Values{"disk": {p.serviceConfig.RootDisk}, "size": {fmt.Sprintf("%dG", size)}}
+		if err := p.client.doTask(ctx, http.MethodPut, p.qemuPath(vmid, "/resize"), params, node); err != nil {
+			return instance, fmt.Errorf("resizing disk %s of VM %s: %w", p.serviceConfig.RootDisk, vmid, err)
+		}
+	}
+	if spec.RootVolumeType != "" || spec.RootVolumeIOPS > 0 {
+		logger.Printf("Ignoring root volume type and IOPS, the root disk is on the storage of the template")
+	}
+
+	if err := p.client.doTask(ctx, http.MethodPost, p.qemuPath(vmid, "/status/start"), nil, node); err != nil {
+		return instance, fmt.Errorf("starting VM %s: %w", vmid, err)
+	}
+
+	ips, err := p.getIPs(ctx, vmid)
+	if err != nil {
+		return instance, err
+	}
+	instance.IPs = ips
+
+	return instance, nil
+}
+
+// configParams returns the configuration of a cloned VM: its CPU and memory, the cloud-init ISO replacing
+// any cloud-init drive of the template, and the data disks
+func (p *proxmoxProvider) configParams(vmConfig map[string]any, vmid string, cores, memory int64, spec provider.InstanceTypeSpec) (url.Values, error) {
+	params := url.Values{
+		"cores":  {strconv.FormatInt(cores, 10)},
+		"memory": {strconv.FormatInt(memory, 10)},
+		"agent":  {"1"},
+	}
+
+	// A cloud-init drive generated by Proxmox would have the same volume label as the ISO
+	var cloudInitDrives []string
+	for device, value := range vmConfig {
+		if s, ok := value.(string); ok && strings.Contains(s, "cloudinit") {
+			cloudInitDrives = append(cloudInitDrives, device)
+		}
+	}
+	slices.Sort(cloudInitDrives)
+
+	var cdrom string
+	if len(cloudInitDrives) > 0 {
+		cdrom, cloudInitDrives = cloudInitDrives[0], cloudInitDrives[1:]
+	} else {
+		for _, device := range cdromDevices {
+			if _, used := vmConfig[device]; !used {
+				cdrom = device
+				break
+			}
+		}
+		if cdrom == "" {
+			return nil, fmt.Errorf("no free IDE device for the cloud-init ISO of VM %s", vmid)
+		}
+	}
+	params.Set(cdrom, fmt.Sprintf("%s:iso/%s,media=cdrom", p.serviceConfig.ISOStorage, isoFileName(vmid)))
+	if len(cloudInitDrives) > 0 {
+		params.Set("delete", strings.Join(cloudInitDrives, ","))
+	}
+
+	// Proxmox restricts the characters of VM tags, so the tags are kept in the notes of the VM
+	tags := provider.MergeTags(p.serviceConfig.Tags, spec)
+	if len(tags) > 0 {
+		var description strings.Builder
+		for _, k := range slices.Sorted(maps.Keys(tags)) {
+			fmt.Fprintf(&description, "%s=%s\n", k, tags[k])
+		}
+		params.Set("description", description.String())
+	}
+
+	disks := spec.DataDisks
+	for i := 1; i < maxSCSIDevices && len(disks) > 0; i++ {
+		device := fmt.Sprintf("scsi%d", i)
+		if _, used := vmConfig[device]; used {
+			continue
+		}
+		storage := p.serviceConfig.Storage
+		if disks[0].Type != "" {
+			storage = disks[0].Type
+		}
+		params.Set(device, fmt.Sprintf("%s:%d", storage, disks[0].Size))
+		disks = disks[1:]
+	}
+	if len(disks) > 0 {
+		return nil, fmt.Errorf("no free SCSI device for %d data disks of VM %s", len(disks), vmid)
+	}
+
+	return params, nil
+}
+
+// diskSize returns the size in GiB of a disk of a VM configuration, e.g. local-lvm:vm-100-disk-0,size=10G,
+// rounded up, or 0 if it is unknown
+func diskSize(disk any) int {
+	value, _ := disk.(string)
+	for _, option := range strings.Split(value, ",") {
+		size, ok := strings.CutPrefix(option, "size=")
+		if !ok || size == "" {
+			continue
+		}
+		unit := int64(1)
+		switch size[len(size)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		n, err := strconv.ParseInt(strings.TrimRight(size, "KMGT"), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return int((n*unit + 1<<30 - 1) >> 30)
+	}
+	return 0
+}
+
+// nextID returns a free VM ID
+func (p *proxmoxProvider) nextID(ctx context.Context) (string, error) {
+	var vmid json.Number
+	if err := p.client.do(ctx, http.MethodGet, "/cluster/nextid", nil, &vmid); err != nil {
+		return "", fmt.Errorf("getting a free VM ID: %w", err)
+	}
+	return vmid.String(), nil
+}
+
+// getIPs waits for the guest agent of a VM, and returns the IPv4 addresses of its interfaces
+func (p *proxmoxProvider) getIPs(ctx context.Context, vmid string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	for {
+		var result struct {
+			Result []struct {
+				Name        string `json:"name"`
+				IPAddresses []struct {
+					IPAddress string `json:"ip-address"`
+				} `json:"ip-addresses"`
+			} `json:"result"`
+		}
+		err := p.client.do(ctx, http.MethodGet, p.qemuPath(vmid, "/agent/network-get-interfaces"), nil, &result)
+		if err == nil {
+			var ips []netip.Addr
+			for _, iface := range result.Result {
+				for _, addr := range iface.IPAddresses {
+					ip, err := netip.ParseAddr(addr.IPAddress)
+					if err != nil || !ip.Is4() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+						continue
+					}
+					logger.Printf("podNodeIP[%d]=%s", len(ips), ip)
+					ips = append(ips, ip)
+				}
+			}
+			if len(ips) > 0 {
+				return ips, nil
+			}
+		}
+
+		// The guest agent is not running until the VM has booted
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the IP address of VM %s: %w (last error: %v)", vmid, ctx.Err(), err)
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+func (p *proxmoxProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	if _, err := strconv.Atoi(instanceID); err != nil {
+		return fmt.Errorf("invalid VM ID %q", instanceID)
+	}
+	node := p.serviceConfig.Node
+
+	err := p.client.doTask(ctx, http.MethodPost, p.qemuPath(instanceID, "/status/stop"), nil, node)
+	if err == nil {
+		params := url.Values{"purge": {"1"}, "destroy-unreferenced-disks": {"1"}}
+		err = p.client.doTask(ctx, http.MethodDelete, p.qemuPath(instanceID, ""), params, node)
+	}
+	if err != nil && !isNotExist(err) {
+		logger.Printf("failed to delete VM %s: %v", instanceID, err)
+		return err
+	}
+	if err != nil {
+		logger.Printf("VM %s is not found", instanceID)
+	} else {
+		logger.Printf("deleted VM %s", instanceID)
+	}
+
+	storage := p.serviceConfig.ISOStorage
+	volume := fmt.Sprintf("%s:iso/%s", storage, isoFileName(instanceID))
+	path := fmt.Sprintf("/nodes/%s/storage/%s/content/%s", url.PathEscape(node), url.PathEscape(storage), url.PathEscape(volume))
+	if err := p.client.doTask(ctx, http.MethodDelete, path, nil, node); err != nil && !isNotExist(err) {
+		logger.Printf("failed to delete cloud-init ISO %s: %v", volume, err)
+	}
+
+	return nil
+}
+
+func (p *proxmoxProvider) Teardown() error {
+	return nil
+}
+
+func (p *proxmoxProvider) ConfigVerifier() error {
+	if len(p.serviceConfig.TemplateID) == 0 {
+		return errNoTemplateID
+	}
+	return nil
+}
+
+// updateInstanceTypeSpecList populates InstanceTypeSpecList with the cores and memory of the instance types
+func (p *proxmoxProvider) updateInstanceTypeSpecList() error {
+	instanceTypes := p.serviceConfig.InstanceTypes
+	if len(instanceTypes) == 0 {
+		instanceTypes = append(instanceTypes, p.serviceConfig.InstanceType)
+	}
+
+	var instanceTypeSpecList []provider.InstanceTypeSpec
+	for _, instanceType := range instanceTypes {
+		cores, memory, err := parseInstanceType(instanceType)
+		if err != nil {
+			return err
+		}
+		instanceTypeSpecList = append(instanceTypeSpecList,
+			provider.InstanceTypeSpec{InstanceType: instanceType, VCPUs: cores, Memory: memory})
+	}
+
+	p.serviceConfig.InstanceTypeSpecList = provider.SortInstanceTypesOnResources(instanceTypeSpecList)
+	logger.Printf("InstanceTypeSpecList (%v)", p.serviceConfig.InstanceTypeSpecList)
+	return nil
+}
+
+func (p *proxmoxProvider) qemuPath(vmid, path string) string {
+	return fmt.Sprintf("/nodes/%s/qemu/%s%s", url.PathEscape(p.serviceConfig.Node), vmid, path)
+}
+
+// isoFileName returns the file name of the cloud-init ISO of a VM
+func isoFileName(vmid string) string {
+	return fmt.Sprintf("caa-%s-cidata.iso", vmid)
+}
+
+func boolParam(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,446 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+const (
+	testNode  = "pve1"
+	testToken = "PVEAPIToken=caa@pve!peerpods=secret"
+)
+
+// fakeProxmox is an httptest stand-in for the Proxmox VE API of a node. Tasks finish immediately, and the
+// guest agent of a started VM reports an address.
+type fakeProxmox struct {
+	*httptest.Server
+
+	mutex   sync.Mutex
+	nextID  int
+	vms     map[string]map[string]any
+	running map[string]bool
+	isos    map[string][]byte
+	clones  []url.Values
+	configs []url.Values
+	resizes []url.Values
+	// failTasks makes the tasks of a type fail, e.g. qmclone
+	failTasks map[string]bool
+	// takenIDs is the number of clones whose new ID is taken by another client before the clone starts
+	takenIDs int
+}
+
+func newFakeProxmox(t *testing.T) *fakeProxmox {
+	f := &fakeProxmox{
+		nextID: 200,
+		vms: map[string]map[string]any{
+			"9000": {"name": "podvm", "scsi0": "local-lvm:base-9000-disk-0,size=10G", "ide2": "local-lvm:vm-9000-cloudinit,media=cdrom", "template": 1},
+			"9001": {"name": "podvm-gpu", "scsi0": "local-lvm:base-9001-disk-0,size=10G", "scsi1": "local-lvm:base-9001-disk-1,size=1G", "ide2": "none,media=cdrom", "template": 1},
+		},
+		running:   map[string]bool{},
+		isos:      map[string][]byte{},
+		failTasks: map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	base := "/api2/json/nodes/" + testNode
+	mux.HandleFunc("GET /api2/json/cluster/nextid", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		for f.vms[fmt.Sprint(f.nextID)] != nil {
+			f.nextID++
+		}
+		writeData(w, fmt.Sprint(f.nextID))
+	})
+	mux.HandleFunc("POST "+base+"/qemu/{vmid}/clone", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		template, ok := f.vms[r.PathValue("vmid")]
+		if !ok {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Configuration file 'nodes/pve1/qemu-server/%s.conf' does not exist", r.PathValue("vmid")))
+			return
+		}
+		r.ParseForm() //nolint:errcheck
+		newID := r.PostForm.Get("newid")
+		if f.takenIDs > 0 {
+			f.takenIDs--
+			f.vms[newID] = map[string]any{"name": "other"}
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("VM %s already exists on node '%s'", newID, testNode))
+			return
+		}
+		f.clones = append(f.clones, r.PostForm)
+		vm := map[string]any{}
+		for k, v := range template {
+			if k != "template" {
+				vm[k] = v
+			}
+		}
+		vm["name"] = r.PostForm.Get("name")
+		f.vms[newID] = vm
+		f.nextID++
+		writeData(w, f.upid("qmclone", newID))
+	})
+	mux.HandleFunc("GET "+base+"/qemu/{vmid}/config", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		writeData(w, f.vms[r.PathValue("vmid")])
+	})
+	mux.HandleFunc("POST "+base+"/qemu/{vmid}/config", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		r.ParseForm() //nolint:errcheck
+		f.configs = append(f.configs, r.PostForm)
+		writeData(w, f.upid("qmconfig", r.PathValue("vmid")))
+	})
+	mux.HandleFunc("PUT "+base+"/qemu/{vmid}/resize", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		r.ParseForm() //nolint:errcheck
+		f.resizes = append(f.resizes, r.PostForm)
+		writeData(w, nil)
+	})
+	mux.HandleFunc("POST "+base+"/qemu/{vmid}/status/start", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.running[r.PathValue("vmid")] = true
+		writeData(w, f.upid("qmstart", r.PathValue("vmid")))
+	})
+	mux.HandleFunc("POST "+base+"/qemu/{vmid}/status/stop", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if _, ok := f.vms[r.PathValue("vmid")]; !ok {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Configuration file 'nodes/pve1/qemu-server/%s.conf' does not exist", r.PathValue("vmid")))
+			return
+		}
+		f.running[r.PathValue("vmid")] = false
+		writeData(w, f.upid("qmstop", r.PathValue("vmid")))
+	})
+	mux.HandleFunc("DELETE "+base+"/qemu/{vmid}", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if f.running[r.PathValue("vmid")] {
+			writeError(w, http.StatusInternalServerError, "VM is running")
+			return
+		}
+		delete(f.vms, r.PathValue("vmid"))
+		writeData(w, f.upid("qmdestroy", r.PathValue("vmid")))
+	})
+	mux.HandleFunc("GET "+base+"/qemu/{vmid}/agent/network-get-interfaces", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if !f.running[r.PathValue("vmid")] {
+			writeError(w, http.StatusInternalServerError, "QEMU guest agent is not running")
+			return
+		}
+		writeData(w, map[string]any{"result": []map[string]any{
+			{"name": "lo", "ip-addresses": []map[string]any{{"ip-address-type": "ipv4", "ip-address": "127.0.0.1"}}},
+			{"name": "eth0", "ip-addresses": []map[string]any{
+				{"ip-address-type": "ipv4", "ip-address": "192.168.10.5"},
+				{"ip-address-type": "ipv6", "ip-address": "fe80::1"},
+			}},
+		}})
+	})
+	mux.HandleFunc("POST "+base+"/storage/{storage}/upload", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parsing upload: %v", err)
+		}
+		file, header, err := r.FormFile("filename")
+		if err != nil {
+			t.Errorf("upload without a file: %v", err)
+			writeError(w, http.StatusBadRequest, "Parameter verification failed.")
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if r.FormValue("content") != "iso" {
+			t.Errorf("upload content = %q, want iso", r.FormValue("content"))
+		}
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.isos[r.PathValue("storage")+":iso/"+header.Filename] = data
+		writeData(w, f.upid("imgcopy", ""))
+	})
+	mux.HandleFunc("DELETE "+base+"/storage/{storage}/content/{volume}", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if _, ok := f.isos[r.PathValue("volume")]; !ok {
+			writeError(w, http.StatusInternalServerError, "volume does not exist")
+			return
+		}
+		delete(f.isos, r.PathValue("volume"))
+		writeData(w, f.upid("imgdel", ""))
+	})
+	mux.HandleFunc("GET "+base+"/tasks/{upid}/status", func(w http.ResponseWriter, r *http.Request) {
+		taskType := strings.Split(r.PathValue("upid"), ":")[5]
+		exitStatus := "OK"
+		if f.failTasks[taskType] {
+			exitStatus = "unable to create VM: no space left on device"
+		}
+		writeData(w, map[string]any{"status": "stopped", "exitstatus": exitStatus})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		writeError(w, http.StatusNotImplemented, "Method not implemented")
+	})
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testToken {
+			writeError(w, http.StatusUnauthorized, "authentication failure")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeProxmox) upid(taskType, id string) string {
+	return fmt.Sprintf("UPID:%s:00001234:00005678:65A1B2C3:%s:%s:caa@pve!peerpods:", testNode, taskType, id)
+}
+
+func writeData(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": data}) //nolint:errcheck
+}
+
+// writeError writes an error the way Proxmox does, with a message next to the null data
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"data":null,"message":%q}`, message+"\n")
+}
+
+func newTestProvider(t *testing.T, f *fakeProxmox, config *Config) *proxmoxProvider {
+	config.APIURL = f.URL
+	config.TokenID = "caa@pve!peerpods"
+	config.TokenSecret = "secret"
+	config.Node = testNode
+	config.ISOStorage = "local"
+	config.Storage = "local-lvm"
+	config.RootDisk = "scsi0"
+	client, err := newClient(config)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	p, err := newProvider(config, client)
+	if err != nil {
+		t.Fatalf("newProvider() error = %v", err)
+	}
+	return p
+}
+
+func TestParseInstanceType(t *testing.T) {
+	cores, memory, err := parseInstanceType("4x8192")
+	if err != nil || cores != 4 || memory != 8192 {
+		t.Errorf("parseInstanceType() = %d, %d, %v, want 4, 8192", cores, memory, err)
+	}
+	for _, instanceType := range []string{"", "4", "x8192", "4x", "0x1024", "ax1024", "m1.large"} {
+		if _, _, err := parseInstanceType(instanceType); err == nil {
+			t.Errorf("parseInstanceType(%q) expected an error", instanceType)
+		}
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	p := newTestProvider(t, f, &Config{
+		TemplateID:    "9000",
+		InstanceType:  "2x4096",
+		InstanceTypes: instanceTypes{"2x4096", "4x8192"},
+		Pool:          "peerpods",
+		Tags:          provider.KeyValueFlag{"team": "peerpods"},
+	})
+
+	instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{},
+		provider.InstanceTypeSpec{VCPUs: 3, Memory: 2048, RootVolumeSize: 20, DataDisks: []provider.DataDisk{{Size: 50}, {Size: 10, Type: "ceph"}},
+			Tags: map[string]string{provider.TagPodName: "pod"}})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	wantIPs := []netip.Addr{netip.MustParseAddr("192.168.10.5")}
+	if instance.ID != "200" || !reflect.DeepEqual(instance.IPs, wantIPs) {
+		t.Errorf("CreateInstance() = %+v, want VM 200 with IPs %v", instance, wantIPs)
+	}
+
+	clone := f.clones[0]
+	if clone.Get("newid") != "200" || clone.Get("name") != instance.Name || clone.Get("full") != "0" || clone.Get("pool") != "peerpods" || clone.Has("storage") {
+		t.Errorf("clone parameters = %v", clone)
+	}
+
+	wantConfig := url.Values{
+		"cores":  {"4"},
+		"memory": {"8192"},
+		"agent":  {"1"},
+		// The cloud-init drive of the template is replaced
+		"ide2":  {"local:iso/caa-200-cidata.iso,media=cdrom"},
+		"scsi1": {"local-lvm:50"},
+		"scsi2": {"ceph:10"},
+		// The tags are kept in the notes
+		"description": {"peerpods-pod-name=pod\nteam=peerpods\n"},
+	}
+	if !reflect.DeepEqual(f.configs[0], wantConfig) {
+		t.Errorf("config parameters = %v, want %v", f.configs[0], wantConfig)
+	}
+	if want := (url.Values{"disk": {"scsi0"}, "size": {"20G"}}); !reflect.DeepEqual(f.resizes[0], want) {
+		t.Errorf("resize parameters = %v, want %v", f.resizes[0], want)
+	}
+	if _, ok := f.isos["local:iso/caa-200-cidata.iso"]; !ok {
+		t.Errorf("cloud-init ISO is not uploaded, ISOs: %v", f.isos)
+	}
+}
+
+func TestCreateInstanceTemplateFromAnnotation(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	p := newTestProvider(t, f, &Config{TemplateID: "9000", InstanceType: "2x4096", FullClone: true})
+
+	_, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{},
+		provider.InstanceTypeSpec{Image: "9001", DataDisks: []provider.DataDisk{{Size: 50}}})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if clone := f.clones[0]; clone.Get("full") != "1" || clone.Get("storage") != "local-lvm" {
+		t.Errorf("clone parameters = %v, want a full clone to local-lvm", clone)
+	}
+	// ide2 and scsi1 are used by the template
+	config := f.configs[0]
+	if config.Get("ide3") != "local:iso/caa-200-cidata.iso,media=cdrom" || config.Get("scsi2") != "local-lvm:50" || config.Has("scsi1") {
+		t.Errorf("config parameters = %v", config)
+	}
+	if len(f.resizes) != 0 {
+		t.Errorf("resize parameters = %v, want no resize", f.resizes)
+	}
+
+	if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{Image: "podvm"}); err == nil {
+		t.Error("CreateInstance() expected an error for an invalid template VM ID")
+	}
+	if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "8x16384"}); err == nil {
+		t.Error("CreateInstance() expected an error for an instance type that is not in the list")
+	}
+}
+
+func TestCreateInstanceTakenID(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	p := newTestProvider(t, f, &Config{TemplateID: "9000", InstanceType: "2x4096"})
+
+	// The clone is retried with the next free ID
+	f.takenIDs = 2
+	instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if instance.ID != "202" {
+		t.Errorf("CreateInstance() = %+v, want VM 202", instance)
+	}
+
+	// The retries are bounded
+	f.takenIDs = maxCloneAttempts
+	if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateInstance() error = %v, want the error of the last clone", err)
+	}
+}
+
+func TestCreateInstanceRootVolumeSmallerThanTemplate(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	p := newTestProvider(t, f, &Config{TemplateID: "9000", InstanceType: "2x4096", RootVolumeSize: 5})
+
+	if _, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	// The 10G root disk of the template is kept
+	if len(f.resizes) != 0 {
+		t.Errorf("resize parameters = %v, want no resize", f.resizes)
+	}
+}
+
+func TestDiskSize(t *testing.T) {
+	tests := []struct {
+		disk any
+		want int
+	}{
+		{disk: "local-lvm:vm-100-disk-0,size=10G", want: 10},
+		{disk: "local-lvm:vm-100-disk-0,iothread=1,size=2252M", want: 3},
+		{disk: "ceph:vm-100-disk-0,size=1T", want: 1024},
+		{disk: "local:100/vm-100-disk-0.qcow2,size=4294967296", want: 4},
+		{disk: "local-lvm:vm-100-disk-0", want: 0},
+		{disk: nil, want: 0},
+	}
+	for _, tt := range tests {
+		if got := diskSize(tt.disk); got != tt.want {
+			t.Errorf("diskSize(%v) = %d, want %d", tt.disk, got, tt.want)
+		}
+	}
+}
+
+func TestCreateInstanceTaskError(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	f.failTasks["qmclone"] = true
+	p := newTestProvider(t, f, &Config{TemplateID: "9000", InstanceType: "2x4096"})
+
+	instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{})
+	if err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		t.Fatalf("CreateInstance() error = %v, want the error of the clone task", err)
+	}
+	// The VM is returned so that it is deleted
+	if instance == nil || instance.ID != "200" {
+		t.Errorf("CreateInstance() = %+v, want VM 200", instance)
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	taskPollInterval = time.Millisecond
+	f := newFakeProxmox(t)
+	p := newTestProvider(t, f, &Config{TemplateID: "9000", InstanceType: "2x4096"})
+
+	instance, err := p.CreateInstance(context.Background(), "pod", "123456", &mockCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Errorf("DeleteInstance() error = %v", err)
+	}
+	if _, ok := f.vms[instance.ID]; ok || len(f.isos) != 0 {
+		t.Errorf("VM %s or its ISO are not deleted, ISOs: %v", instance.ID, f.isos)
+	}
+
+	// Deleting a VM that is already deleted succeeds
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Errorf("DeleteInstance() error = %v for a deleted VM", err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	f := newFakeProxmox(t)
+	client, err := newClient(&Config{APIURL: f.URL + "/api2/json/", TokenID: "caa@pve!peerpods", TokenSecret: "wrong"})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	err = client.do(context.Background(), http.MethodGet, "/cluster/nextid", nil, nil)
+	if apiErr, ok := err.(*apiError); !ok || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "authentication failure" {
+		t.Errorf("do() error = %v, want an authentication failure", err)
+	}
+}
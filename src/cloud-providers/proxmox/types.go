@@ -0,0 +1,68 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxmox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+type instanceTypes []string
+
+func (i *instanceTypes) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *instanceTypes) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(instanceTypes, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type Config struct {
+	APIURL               string
+	TokenID              string
+	TokenSecret          string
+	CACertFile           string
+	InsecureSkipVerify   bool
+	Node                 string
+	TemplateID           string
+	FullClone            bool
+	Storage              string
+	ISOStorage           string
+	Pool                 string
+	RootDisk             string
+	RootVolumeSize       int
+	InstanceType         string
+	InstanceTypes        instanceTypes
+	InstanceTypeSpecList []provider.InstanceTypeSpec
+	Tags                 provider.KeyValueFlag
+}
+
+func (c Config) Redact() Config {
+	return *util.RedactStruct(&c, "TokenSecret").(*Config)
+}
+
+// parseInstanceType parses an instance type of the form <cores>x<memory>, with the memory in MiB,
+// e.g. 2x4096
+func parseInstanceType(instanceType string) (cores, memory int64, err error) {
+	coresStr, memoryStr, ok := strings.Cut(instanceType, "x")
+	if ok {
+		cores, err = strconv.ParseInt(coresStr, 10, 64)
+		if err == nil {
+			memory, err = strconv.ParseInt(memoryStr, 10, 64)
+		}
+	}
+	if !ok || err != nil || cores <= 0 || memory <= 0 {
+		return 0, 0, fmt.Errorf("invalid instance type %q, expected <cores>x<memory in MiB>, e.g. 2x4096", instanceType)
+	}
+	return cores, memory, nil
+}
@@ -68,4 +68,35 @@ type InstanceTypeSpec struct {
 	GPUs         int64
 	Image        string
 	MultiNic     bool
+
+	// RootVolumeSize is the size of the root volume in GiB, overriding the size configured for the provider.
+	// The root volume is never smaller than the image.
+	RootVolumeSize int
+	// RootVolumeType is the provider specific type of the root volume, e.g. gp3 on AWS or pd-ssd on GCP
+	RootVolumeType string
+	// RootVolumeIOPS is the provisioned IOPS of the root volume, for the volume types that support it
+	RootVolumeIOPS int
+	// DataDisks are empty disks attached to the pod VM, and deleted with it
+	DataDisks []DataDisk
+	// Tags identify the owner of the pod VM, i.e. the cluster, the node and the pod, and are attached to
+	// the pod VM with the tags configured for the provider
+	Tags map[string]string
+}
+
+// Keys of the tags identifying the owner of a pod VM
+const (
+	TagClusterID    = "peerpods-cluster-id"
+	TagNodeName     = "peerpods-node-name"
+	TagPodNamespace = "peerpods-pod-namespace"
+	TagPodName      = "peerpods-pod-name"
+	TagSandboxID    = "peerpods-sandbox-id"
+	TagVersion      = "peerpods-caa-version"
+)
+
+// DataDisk is an ephemeral data disk of a pod VM
+type DataDisk struct {
+	// Size is the size of the disk in GiB
+	Size int
+	// Type is the provider specific type of the disk, empty for the provider default
+	Type string
 }
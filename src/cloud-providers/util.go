@@ -149,6 +149,53 @@ func GetBestFitInstanceTypeWithGPU(sortedInstanceTypeSpecList []InstanceTypeSpec
 	return sortedInstanceTypeSpecList[index].InstanceType, nil
 }
 
+// ParseDataDisks parses a comma separated list of data disks, each as SIZE or SIZE:TYPE with the size in GiB,
+// e.g. "100,50:gp3"
+func ParseDataDisks(s string) ([]DataDisk, error) {
+	var disks []DataDisk
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sizeStr, diskType, _ := strings.Cut(item, ":")
+		size, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid data disk %q: size must be a positive number of GiB", item)
+		}
+		disks = append(disks, DataDisk{Size: size, Type: strings.TrimSpace(diskType)})
+	}
+	return disks, nil
+}
+
+// RootVolumeSize returns the root volume size of a pod VM in GiB, that is the size requested for the pod if any,
+// or the size configured for the provider. A size smaller than the image is increased to the image size.
+// 0 means the image size.
+func RootVolumeSize(spec InstanceTypeSpec, configured, imageSize int) int {
+	size := configured
+	if spec.RootVolumeSize > 0 {
+		size = spec.RootVolumeSize
+	}
+	if size > 0 && size < imageSize {
+		logger.Printf("Root volume size %d GiB is less than the image size %d GiB, using the image size", size, imageSize)
+		size = imageSize
+	}
+	return size
+}
+
+// MergeTags returns the tags configured for a provider with the tags of a pod VM. The tags of the pod VM
+// take precedence, so that the owner of a pod VM cannot be overwritten.
+func MergeTags(configured map[string]string, spec InstanceTypeSpec) map[string]string {
+	tags := make(map[string]string, len(configured)+len(spec.Tags))
+	for k, v := range configured {
+		tags[k] = v
+	}
+	for k, v := range spec.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
 func DefaultToEnv(field *string, env, fallback string) {
 
 	if *field != "" {
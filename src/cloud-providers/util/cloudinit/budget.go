@@ -0,0 +1,293 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// UserDataLimits are the user data size limits of cloud providers in bytes, before any encoding done
+// by the provider. When the provider encodes user data in base64, the limit is three fourths of the
+// documented one. Providers not listed have no limit.
+var UserDataLimits = map[string]int{
+	"alibabacloud":    32 * 1024,
+	"aws":             16 * 1024,
+	"azure":           64 * 1024 * 3 / 4,
+	"gcp":             256 * 1024,
+	"ibmcloud":        64 * 1024,
+	"ibmcloudpowervs": 63 * 1024 * 3 / 4,
+	"openstack":       65535 / 4 * 3,
+}
+
+// ErrUserDataTooLarge is returned when user data does not fit in the limit even when compressed
+var ErrUserDataTooLarge = errors.New("user data is too large")
+
+// UserDataLimit returns the user data size limit of a cloud provider, or 0 if it has no limit
+func UserDataLimit(provider string) int {
+	return UserDataLimits[provider]
+}
+
+// UserData is user data generated in advance
+type UserData string
+
+func (u UserData) Generate() (string, error) {
+	return string(u), nil
+}
+
+// Budget fits cloud configs in a user data size limit
+type Budget struct {
+	// Limit is the maximum size of user data in bytes. A non-positive limit means no limit.
+	Limit int
+	// Seal, if set, is applied to a copy of the cloud config before measuring it, e.g. to encrypt sensitive files
+	Seal func(config *CloudConfig) error
+}
+
+// Fit returns user data generated from config within the limit. It is compressed if the plain cloud config is
+// too large. If the compressed one is still too large, the entries of overflowable paths are removed, and
+// returned to be delivered to the pod VM through another channel.
+func (b *Budget) Fit(config *CloudConfig, overflowable []string) (UserData, []WriteFile, error) {
+
+	userData, err := b.generate(config)
+	if err != nil {
+		return "", nil, err
+	}
+	if b.fits(userData) {
+		return userData, nil, nil
+	}
+
+	var remaining, overflow []WriteFile
+	for _, wf := range config.WriteFiles {
+		if slices.Contains(overflowable, wf.Path) {
+			overflow = append(overflow, wf)
+		} else {
+			remaining = append(remaining, wf)
+		}
+	}
+	if len(overflow) == 0 {
+		return "", nil, fmt.Errorf("%w: %d bytes exceed the limit of %d bytes", ErrUserDataTooLarge, len(userData), b.Limit)
+	}
+
+	reduced, err := b.generate(&CloudConfig{WriteFiles: remaining})
+	if err != nil {
+		return "", nil, err
+	}
+	if !b.fits(reduced) {
+		return "", nil, fmt.Errorf("%w: %d bytes exceed the limit of %d bytes without overflow files", ErrUserDataTooLarge, len(reduced), b.Limit)
+	}
+
+	return reduced, overflow, nil
+}
+
+func (b *Budget) fits(userData UserData) bool {
+	return b.Limit <= 0 || len(userData) <= b.Limit
+}
+
+// generate returns the plain cloud config if it fits, or the compressed one otherwise
+func (b *Budget) generate(config *CloudConfig) (UserData, error) {
+
+	config = &CloudConfig{WriteFiles: slices.Clone(config.WriteFiles)}
+	if b.Seal != nil {
+		if err := b.Seal(config); err != nil {
+			return "", err
+		}
+	}
+
+	plain, err := config.Generate()
+	if err != nil {
+		return "", err
+	}
+	if b.fits(UserData(plain)) {
+		return UserData(plain), nil
+	}
+
+	compressed, err := Compress(plain)
+	if err != nil {
+		return "", err
+	}
+	if len(compressed) < len(plain) {
+		return UserData(compressed), nil
+	}
+	return UserData(plain), nil
+}
+
+const (
+	gzipContentType        = "application/gzip"
+	cloudConfigContentType = "text/cloud-config"
+	base64LineLength       = 76
+)
+
+// gzipContentTypes are the content types cloud-init decompresses
+var gzipContentTypes = []string{
+	"application/gzip",
+	"application/gzip-compressed",
+	"application/gzipped",
+	"application/x-compress",
+	"application/x-compressed",
+	"application/x-gunzip",
+	"application/x-gzip",
+	"application/x-gzip-compressed",
+}
+
+// Compress returns userData as a MIME multipart message understood by cloud-init, with a single gzip compressed,
+// base64 encoded part
+func Compress(userData string) (string, error) {
+
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write([]byte(userData)); err != nil {
+		return "", fmt.Errorf("failed to compress user data: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress user data: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {gzipContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="cloud-config.gz"`},
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(compressed.Bytes())
+	for len(encoded) > 0 {
+		n := min(len(encoded), base64LineLength)
+		if _, err := io.WriteString(part, encoded[:n]+"\r\n"); err != nil {
+			return "", err
+		}
+		encoded = encoded[n:]
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	header := fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", mw.Boundary())
+	return header + body.String(), nil
+}
+
+// Decode returns the cloud config documents in user data. User data is either a cloud config, gzip compressed
+// or not, or a MIME multipart message of cloud config parts as generated by Compress.
+func Decode(userData []byte) ([][]byte, error) {
+
+	if !isMultipart(userData) {
+		doc, err := gunzipIfCompressed(userData)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{doc}, nil
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(userData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multipart user data: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse content type of user data: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unsupported content type of user data: %s", mediaType)
+	}
+
+	var docs [][]byte
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read a user data part: %w", err)
+		}
+		doc, err := decodePart(part)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+func isMultipart(userData []byte) bool {
+	for _, prefix := range []string{"Content-Type:", "MIME-Version:"} {
+		if len(userData) >= len(prefix) && strings.EqualFold(string(userData[:len(prefix)]), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodePart(part *multipart.Part) ([]byte, error) {
+
+	contentType := part.Header.Get("Content-Type")
+	mediaType := cloudConfigContentType
+	if contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("failed to parse content type of a user data part: %w", err)
+		}
+	}
+
+	var r io.Reader = part
+	switch encoding := strings.ToLower(part.Header.Get("Content-Transfer-Encoding")); encoding {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, part)
+	case "", "7bit", "8bit", "binary":
+		// quoted-printable is decoded by multipart.Reader
+	default:
+		return nil, fmt.Errorf("unsupported transfer encoding of a user data part: %s", encoding)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode a user data part: %w", err)
+	}
+
+	switch {
+	case slices.Contains(gzipContentTypes, mediaType):
+		return gunzipIfCompressed(data)
+	case mediaType == cloudConfigContentType:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type of a user data part: %s", mediaType)
+	}
+}
+
+func gunzipIfCompressed(data []byte) ([]byte, error) {
+
+	// gzip magic number
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress user data: %w", err)
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress user data: %w", err)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,179 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func randomContent(t *testing.T, size int) string {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data) + "\n"
+}
+
+func decodeCloudConfig(t *testing.T, userData UserData) *CloudConfig {
+	docs, err := Decode([]byte(userData))
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	var output CloudConfig
+	for _, doc := range docs {
+		var cc CloudConfig
+		if err := yaml.Unmarshal(doc, &cc); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		output.WriteFiles = append(output.WriteFiles, cc.WriteFiles...)
+	}
+	return &output
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: strings.Repeat("{\"key\": \"value\"}\n", 100)},
+			{Path: authJSONPath, Content: randomContent(t, 1000)},
+		},
+	}
+
+	plain, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	compressed, err := Compress(plain)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !strings.HasPrefix(compressed, "Content-Type: multipart/mixed;") {
+		t.Fatalf("Expect a multipart message, got %q", compressed[:40])
+	}
+	if len(compressed) >= len(plain) {
+		t.Fatalf("Expect compressed user data smaller than %d bytes, got %d bytes", len(plain), len(compressed))
+	}
+
+	if e, a := cloudConfig, decodeCloudConfig(t, UserData(compressed)); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+
+	// Plain cloud config
+	if e, a := cloudConfig, decodeCloudConfig(t, UserData(plain)); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+
+	// Gzip compressed cloud config
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(plain)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := cloudConfig, decodeCloudConfig(t, UserData(buf.String())); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+}
+
+func TestDecodeUnsupportedPart(t *testing.T) {
+	userData := "Content-Type: multipart/mixed; boundary=\"XYZ\"\r\nMIME-Version: 1.0\r\n\r\n" +
+		"--XYZ\r\nContent-Type: text/x-shellscript\r\n\r\n#!/bin/sh\r\n--XYZ--\r\n"
+
+	if _, err := Decode([]byte(userData)); err == nil {
+		t.Fatal("Expect an error for an unsupported part")
+	}
+}
+
+func TestBudgetFit(t *testing.T) {
+	apfJSON := strings.Repeat("{\"key\": \"value\"}\n", 100)
+	authJSON := randomContent(t, 6000)
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: apfJSON},
+			{Path: authJSONPath, Content: authJSON},
+		},
+	}
+	plain, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	// No limit
+	budget := &Budget{}
+	userData, overflow, err := budget.Fit(cloudConfig, []string{authJSONPath})
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if string(userData) != plain || overflow != nil {
+		t.Fatalf("Expect plain user data without overflow, got %d overflow files", len(overflow))
+	}
+
+	// Compressed
+	budget = &Budget{Limit: len(plain) - 100}
+	userData, overflow, err = budget.Fit(cloudConfig, []string{authJSONPath})
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !strings.HasPrefix(string(userData), "Content-Type:") || len(userData) > budget.Limit || overflow != nil {
+		t.Fatalf("Expect compressed user data within %d bytes without overflow, got %d bytes and %d overflow files", budget.Limit, len(userData), len(overflow))
+	}
+	if e, a := cloudConfig, decodeCloudConfig(t, userData); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+
+	// Overflow
+	budget = &Budget{Limit: 4096}
+	userData, overflow, err = budget.Fit(cloudConfig, []string{authJSONPath})
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if len(userData) > budget.Limit {
+		t.Fatalf("Expect user data within %d bytes, got %d bytes", budget.Limit, len(userData))
+	}
+	if e, a := []WriteFile{{Path: authJSONPath, Content: authJSON}}, overflow; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+	if e, a := []WriteFile{{Path: forwarderConfigPath, Content: apfJSON}}, decodeCloudConfig(t, userData).WriteFiles; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+
+	// Too large
+	budget = &Budget{Limit: 100}
+	if _, _, err = budget.Fit(cloudConfig, []string{authJSONPath}); !errors.Is(err, ErrUserDataTooLarge) {
+		t.Fatalf("Expect %v, got %v", ErrUserDataTooLarge, err)
+	}
+
+	// Sealing is applied to a copy
+	sealed := 0
+	budget = &Budget{
+		Limit: 4096,
+		Seal: func(config *CloudConfig) error {
+			sealed++
+			config.WriteFiles = append(config.WriteFiles, WriteFile{Path: EnvelopePath, Content: "{}"})
+			return nil
+		},
+	}
+	userData, _, err = budget.Fit(cloudConfig, []string{authJSONPath})
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if sealed != 2 || len(cloudConfig.WriteFiles) != 2 {
+		t.Fatalf("Expect sealing two copies, got %d seals and %d entries", sealed, len(cloudConfig.WriteFiles))
+	}
+	if e, a := EnvelopePath, decodeCloudConfig(t, userData).WriteFiles[1].Path; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+}
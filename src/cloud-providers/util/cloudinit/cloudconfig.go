@@ -11,10 +11,6 @@ import (
 	"text/template"
 )
 
-const (
-	DefaultAuthfileLimit = 12288 // TODO: use a whole userdata limit mechanism instead of limiting authfile
-)
-
 // https://cloudinit.readthedocs.io/en/latest/topics/format.html#cloud-config-data
 
 type CloudConfigGenerator interface {
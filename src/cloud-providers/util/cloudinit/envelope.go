@@ -0,0 +1,173 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// EnvelopePath is the path of the write_files entry holding encrypted files
+	EnvelopePath = "/run/peerpod/userdata.envelope"
+
+	// EnvelopeKeySize is the size of AES-256 keys encrypting envelopes
+	EnvelopeKeySize = 32
+
+	envelopeVersion = 1
+)
+
+// Envelope holds write_files entries encrypted with AES-256-GCM.
+//
+// KeyID tells the pod VM where to get the key:
+//   - file:///path/to/key is a key pre-provisioned in the pod VM image
+//   - kbs:///repository/type/tag is a KBS resource released to the pod VM after attestation
+type Envelope struct {
+	Version    int    `json:"version"`
+	KeyID      string `json:"kid"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// envelopeFile is the plaintext form of a write_files entry in an envelope
+type envelopeFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// ParseEnvelopeKey accepts a raw or base64 encoded AES-256 key
+func ParseEnvelopeKey(data []byte) ([]byte, error) {
+	if len(data) == EnvelopeKeySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != EnvelopeKeySize {
+		return nil, fmt.Errorf("envelope key must be %d bytes long, raw or base64 encoded", EnvelopeKeySize)
+	}
+	return key, nil
+}
+
+// LoadEnvelopeKey reads an AES-256 key from path
+func LoadEnvelopeKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read envelope key: %w", err)
+	}
+	return ParseEnvelopeKey(data)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds the version and key ID of an envelope to its ciphertext
+func (e *Envelope) additionalData() []byte {
+	return fmt.Appendf(nil, "%d:%s", e.Version, e.KeyID)
+}
+
+// SealFiles moves the write_files entries of paths into an envelope encrypted with key, identified by keyID.
+// The envelope is added as a write_files entry at EnvelopePath. It does nothing if no entry matches paths.
+func (config *CloudConfig) SealFiles(keyID string, key []byte, paths []string) error {
+	var sealed []envelopeFile
+	var remaining []WriteFile
+
+	for _, wf := range config.WriteFiles {
+		if !slices.Contains(paths, wf.Path) {
+			remaining = append(remaining, wf)
+			continue
+		}
+		if wf.Encoding != "" || wf.Append != "" || wf.Owner != "" || wf.Permissions != "" {
+			return fmt.Errorf("write_files entry %s has attributes that can't be sealed", wf.Path)
+		}
+		sealed = append(sealed, envelopeFile{Path: wf.Path, Content: wf.Content})
+	}
+
+	if len(sealed) == 0 {
+		return nil
+	}
+
+	plaintext, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("failed to initialize envelope encryption: %w", err)
+	}
+
+	envelope := &Envelope{
+		Version: envelopeVersion,
+		KeyID:   keyID,
+		Nonce:   make([]byte, gcm.NonceSize()),
+	}
+	if _, err := rand.Read(envelope.Nonce); err != nil {
+		return fmt.Errorf("failed to generate an envelope nonce: %w", err)
+	}
+	envelope.Ciphertext = gcm.Seal(nil, envelope.Nonce, plaintext, envelope.additionalData())
+
+	content, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	config.WriteFiles = append(remaining, WriteFile{
+		Path:    EnvelopePath,
+		Content: string(content),
+	})
+	return nil
+}
+
+// ParseEnvelope parses the content of the write_files entry at EnvelopePath
+func ParseEnvelope(content []byte) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+	if envelope.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	if envelope.KeyID == "" {
+		return nil, fmt.Errorf("envelope has no key ID")
+	}
+	return &envelope, nil
+}
+
+// Open decrypts the write_files entries in an envelope with key
+func (e *Envelope) Open(key []byte) ([]WriteFile, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize envelope decryption: %w", err)
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid envelope nonce")
+	}
+
+	plaintext, err := gcm.Open(nil, e.Nonce, e.Ciphertext, e.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt envelope with key %s: %w", e.KeyID, err)
+	}
+
+	var sealed []envelopeFile
+	if err := json.Unmarshal(plaintext, &sealed); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted envelope: %w", err)
+	}
+
+	files := make([]WriteFile, 0, len(sealed))
+	for _, f := range sealed {
+		files = append(files, WriteFile{Path: f.Path, Content: f.Content})
+	}
+	return files, nil
+}
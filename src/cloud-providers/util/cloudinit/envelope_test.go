@@ -0,0 +1,141 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const testKeyID = "kbs:///default/peerpod/userdata-key"
+
+func TestSealFiles(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, EnvelopeKeySize)
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: "{\"tls-server-key\": \"secret\"}\n"},
+			{Path: "/plain", Content: "plain\n"},
+			{Path: authJSONPath, Content: "{\"auths\": {}}"},
+		},
+	}
+
+	if err := cloudConfig.SealFiles(testKeyID, key, []string{forwarderConfigPath, authJSONPath}); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if len(cloudConfig.WriteFiles) != 2 {
+		t.Fatalf("Expect 2 write_files entries, got %d", len(cloudConfig.WriteFiles))
+	}
+	if cloudConfig.WriteFiles[0].Path != "/plain" || cloudConfig.WriteFiles[1].Path != EnvelopePath {
+		t.Fatalf("Unexpected write_files entries: %#v", cloudConfig.WriteFiles)
+	}
+
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if strings.Contains(userData, "secret") {
+		t.Fatalf("Sealed content is found in user data:\n%s", userData)
+	}
+
+	// Parse the generated user data like the pod VM does
+	var output CloudConfig
+	if err := yaml.UnmarshalStrict([]byte(userData), &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	envelope, err := ParseEnvelope([]byte(output.WriteFiles[1].Content))
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if envelope.KeyID != testKeyID {
+		t.Fatalf("Expect key ID %q, got %q", testKeyID, envelope.KeyID)
+	}
+
+	files, err := envelope.Open(key)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	expected := []WriteFile{
+		{Path: forwarderConfigPath, Content: "{\"tls-server-key\": \"secret\"}\n"},
+		{Path: authJSONPath, Content: "{\"auths\": {}}"},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("Expect %#v, got %#v", expected, files)
+	}
+
+	if _, err := envelope.Open(bytes.Repeat([]byte{2}, EnvelopeKeySize)); err == nil {
+		t.Fatal("Expect an error with a wrong key")
+	}
+
+	envelope.KeyID = "file:///etc/peerpod/userdata.key"
+	if _, err := envelope.Open(key); err == nil {
+		t.Fatal("Expect an error with a tampered key ID")
+	}
+}
+
+func TestSealFilesNoMatch(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, EnvelopeKeySize)
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{{Path: "/plain", Content: "plain\n"}},
+	}
+	if err := cloudConfig.SealFiles(testKeyID, key, []string{forwarderConfigPath}); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if len(cloudConfig.WriteFiles) != 1 || cloudConfig.WriteFiles[0].Path != "/plain" {
+		t.Fatalf("Unexpected write_files entries: %#v", cloudConfig.WriteFiles)
+	}
+
+	cloudConfig.WriteFiles[0].Permissions = "0600"
+	if err := cloudConfig.SealFiles(testKeyID, key, []string{"/plain"}); err == nil {
+		t.Fatal("Expect an error sealing an entry with permissions")
+	}
+
+	if err := cloudConfig.SealFiles(testKeyID, []byte("short"), []string{"/plain"}); err == nil {
+		t.Fatal("Expect an error with an invalid key")
+	}
+}
+
+func TestLoadEnvelopeKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, EnvelopeKeySize)
+	dir := t.TempDir()
+
+	rawPath := filepath.Join(dir, "raw.key")
+	if err := os.WriteFile(rawPath, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	encodedPath := filepath.Join(dir, "encoded.key")
+	if err := os.WriteFile(encodedPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shortPath := filepath.Join(dir, "short.key")
+	if err := os.WriteFile(shortPath, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{rawPath, encodedPath} {
+		loaded, err := LoadEnvelopeKey(path)
+		if err != nil {
+			t.Fatalf("Expect no error loading %s, got %v", path, err)
+		}
+		if !bytes.Equal(loaded, key) {
+			t.Fatalf("Unexpected key loaded from %s", path)
+		}
+	}
+
+	for _, path := range []string{shortPath, filepath.Join(dir, "missing.key")} {
+		if _, err := LoadEnvelopeKey(path); err == nil {
+			t.Fatalf("Expect an error loading %s", path)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+
+	"github.com/kdomanski/iso9660"
+)
+
+const (
+	NoCloudUserData   = "user-data"
+	NoCloudMetaData   = "meta-data"
+	NoCloudVendorData = "vendor-data"
+	// NoCloudNetworkConfig is the network configuration of cloud-init, version 1 or 2
+	NoCloudNetworkConfig = "network-config"
+	// NoCloudVolumeName is the volume label cloud-init and process-user-data look for
+	NoCloudVolumeName = "cidata"
+)
+
+// NoCloudISO produces a NoCloud ISO image as a data blob with a userdata and a metadata section
+func NoCloudISO(userData, metaData []byte) ([]byte, error) {
+	return NoCloudISOWithNetworkConfig(userData, metaData, nil)
+}
+
+// NoCloudISOWithNetworkConfig produces a NoCloud ISO image like NoCloudISO, with a network-config section
+// if networkConfig is not nil
+func NoCloudISOWithNetworkConfig(userData, metaData, networkConfig []byte) ([]byte, error) {
+	writer, err := iso9660.NewWriter()
+	if err != nil {
+		return nil, err
+	}
+	defer writer.Cleanup() //nolint:errcheck // no need to check error in deferal
+
+	err = writer.AddFile(bytes.NewReader(userData), NoCloudUserData)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.AddFile(bytes.NewReader(metaData), NoCloudMetaData)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.AddFile(bytes.NewReader([]byte{}), NoCloudVendorData)
+	if err != nil {
+		return nil, err
+	}
+
+	if networkConfig != nil {
+		err = writer.AddFile(bytes.NewReader(networkConfig), NoCloudNetworkConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err = writer.WriteTo(&buf, NoCloudVolumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
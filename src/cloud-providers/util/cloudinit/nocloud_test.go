@@ -0,0 +1,75 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/kdomanski/iso9660"
+)
+
+func TestNoCloudISO(t *testing.T) {
+	isoData, err := NoCloudISO([]byte("userdata"), []byte("metadata"))
+	if err != nil {
+		t.Fatalf("NoCloudISO() error = %v", err)
+	}
+
+	files := readNoCloudISO(t, isoData)
+	want := map[string]string{NoCloudUserData: "userdata", NoCloudMetaData: "metadata", NoCloudVendorData: ""}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s = %q, want %q", name, files[name], content)
+		}
+	}
+	if _, ok := files[NoCloudNetworkConfig]; ok {
+		t.Errorf("%s is in the ISO image, want no network configuration", NoCloudNetworkConfig)
+	}
+}
+
+func TestNoCloudISOWithNetworkConfig(t *testing.T) {
+	isoData, err := NoCloudISOWithNetworkConfig([]byte("userdata"), []byte("metadata"), []byte("version: 2"))
+	if err != nil {
+		t.Fatalf("NoCloudISOWithNetworkConfig() error = %v", err)
+	}
+
+	files := readNoCloudISO(t, isoData)
+	if files[NoCloudNetworkConfig] != "version: 2" || files[NoCloudUserData] != "userdata" {
+		t.Errorf("files = %v, want the network configuration and the userdata", files)
+	}
+}
+
+// readNoCloudISO returns the content of the files of a NoCloud ISO image
+func readNoCloudISO(t *testing.T, isoData []byte) map[string]string {
+	t.Helper()
+
+	isoImg, err := iso9660.OpenImage(bytes.NewReader(isoData))
+	if err != nil {
+		t.Fatalf("OpenImage() error = %v", err)
+	}
+	label, err := isoImg.Label()
+	if err != nil || label != NoCloudVolumeName {
+		t.Errorf("Label() = %q, %v, want %q", label, err, NoCloudVolumeName)
+	}
+
+	rootFile, err := isoImg.RootDir()
+	if err != nil {
+		t.Fatalf("RootDir() error = %v", err)
+	}
+	children, err := rootFile.GetChildren()
+	if err != nil {
+		t.Fatalf("GetChildren() error = %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, child := range children {
+		data, err := io.ReadAll(child.Reader())
+		if err != nil {
+			t.Fatalf("reading %s: %v", child.Name(), err)
+		}
+		files[child.Name()] = string(data)
+	}
+	return files
+}
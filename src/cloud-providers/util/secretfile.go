@@ -0,0 +1,116 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// SecretFile is a file with credentials, typically mounted from a Kubernetes Secret,
+// that is read again when it is replaced. Kubernetes updates mounted Secrets by
+// atomically replacing the files, so a rotated secret is a different file.
+type SecretFile struct {
+	path string
+
+	mutex sync.Mutex
+	info  os.FileInfo
+	data  []byte
+}
+
+// NewSecretFile reads a secret file, and fails if it is not readable
+func NewSecretFile(path string) (*SecretFile, error) {
+	f := &SecretFile{path: path}
+	if _, _, err := f.Read(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the secret file
+func (f *SecretFile) Path() string {
+	return f.path
+}
+
+// Read returns the content of the secret file, and whether it changed since it was last read.
+// The content read last is returned with an error if the file is not readable anymore.
+func (f *SecretFile) Read() (data []byte, changed bool, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.data, false, fmt.Errorf("reading secret file %s: %w", f.path, err)
+	}
+	if f.info != nil && os.SameFile(f.info, info) && f.info.ModTime().Equal(info.ModTime()) && f.info.Size() == info.Size() {
+		return f.data, false, nil
+	}
+
+	data, err = os.ReadFile(f.path)
+	if err != nil {
+		return f.data, false, fmt.Errorf("reading secret file %s: %w", f.path, err)
+	}
+	f.info, f.data = info, data
+	return data, true, nil
+}
+
+// SecretFileValue is a value parsed from a SecretFile, e.g. a credential, and parsed again when the
+// secret is rotated. When the rotated file is unreadable or invalid, the last valid value is kept
+// and the error is logged, so that a bad rotation does not break the clients using the value.
+type SecretFileValue[T any] struct {
+	file  *SecretFile
+	parse func(data []byte) (T, error)
+
+	mutex sync.Mutex
+	value T
+}
+
+// NewSecretFileValue reads and parses a secret file, and fails if it is not readable or invalid
+func NewSecretFileValue[T any](path string, parse func(data []byte) (T, error)) (*SecretFileValue[T], error) {
+	file, err := NewSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := file.Read()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret file %s: %w", path, err)
+	}
+	return &SecretFileValue[T]{file: file, parse: parse, value: value}, nil
+}
+
+// Path returns the path of the secret file
+func (v *SecretFileValue[T]) Path() string {
+	return v.file.Path()
+}
+
+// Get returns the value of the current content of the secret file, or the last valid value
+// if the file is not readable or invalid anymore
+func (v *SecretFileValue[T]) Get() T {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	data, changed, err := v.file.Read()
+	if err != nil {
+		log.Printf("Warning: using the last valid content of secret file %s: %v", v.file.Path(), err)
+		return v.value
+	}
+	if !changed {
+		return v.value
+	}
+
+	value, err := v.parse(data)
+	if err != nil {
+		log.Printf("Warning: using the last valid content of secret file %s, the new content is invalid: %v", v.file.Path(), err)
+		return v.value
+	}
+	log.Printf("secret file %s changed", v.file.Path())
+	v.value = value
+	return value
+}
@@ -0,0 +1,113 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rotateSecret replaces a file the way Kubernetes updates a mounted Secret
+func rotateSecret(t *testing.T, path, data string) {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+
+	if _, err := NewSecretFile(path); err == nil {
+		t.Fatal("NewSecretFile() expected an error for a missing file")
+	}
+
+	rotateSecret(t, path, "key1")
+	f, err := NewSecretFile(path)
+	if err != nil {
+		t.Fatalf("NewSecretFile() error = %v", err)
+	}
+
+	data, changed, err := f.Read()
+	if err != nil || changed || string(data) != "key1" {
+		t.Errorf("Read() = %q, %v, %v, want unchanged key1", data, changed, err)
+	}
+
+	rotateSecret(t, path, "key2")
+	data, changed, err = f.Read()
+	if err != nil || !changed || string(data) != "key2" {
+		t.Errorf("Read() = %q, %v, %v, want changed key2", data, changed, err)
+	}
+
+	// The last content is kept when the file is removed
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	data, changed, err = f.Read()
+	if err == nil || changed || string(data) != "key2" {
+		t.Errorf("Read() = %q, %v, %v, want an error with key2", data, changed, err)
+	}
+}
+
+func TestSecretFileValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+
+	parses := 0
+	parse := func(data []byte) (string, error) {
+		parses++
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", errors.New("empty key")
+		}
+		return key, nil
+	}
+
+	if _, err := NewSecretFileValue(path, parse); err == nil {
+		t.Fatal("NewSecretFileValue() expected an error for a missing file")
+	}
+	rotateSecret(t, path, "\n")
+	if _, err := NewSecretFileValue(path, parse); err == nil {
+		t.Fatal("NewSecretFileValue() expected an error for an invalid file")
+	}
+
+	rotateSecret(t, path, "key1\n")
+	v, err := NewSecretFileValue(path, parse)
+	if err != nil {
+		t.Fatalf("NewSecretFileValue() error = %v", err)
+	}
+	parses = 0
+	if got := v.Get(); got != "key1" || parses != 0 {
+		t.Errorf("Get() = %q after %d parses, want key1 without parsing", got, parses)
+	}
+
+	rotateSecret(t, path, "key2\n")
+	if got := v.Get(); got != "key2" {
+		t.Errorf("Get() = %q, want key2 after a rotation", got)
+	}
+
+	// The last valid value is kept when the rotated file is invalid
+	rotateSecret(t, path, "")
+	if got := v.Get(); got != "key2" {
+		t.Errorf("Get() = %q, want key2 after an invalid rotation", got)
+	}
+
+	// and when it is removed
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.Get(); got != "key2" {
+		t.Errorf("Get() = %q, want key2 after the file is removed", got)
+	}
+
+	rotateSecret(t, path, "key3\n")
+	if got := v.Get(); got != "key3" {
+		t.Errorf("Get() = %q, want key3 after a valid rotation", got)
+	}
+}
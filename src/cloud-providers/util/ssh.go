@@ -5,6 +5,7 @@ package util
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
@@ -339,31 +340,11 @@ func SendFileViaSFTP(address string, sshConfig *ssh.ClientConfig, remotePath str
 
 // SendFileViaSFTPWithContext sends file content to a remote path via SFTP with context support
 func SendFileViaSFTPWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
-	// Create a context-aware dialer
-	dialer := &net.Dialer{}
-	conn, err := dialer.DialContext(ctx, "tcp", address)
-	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
-	}
-	defer conn.Close()
-
-	// Create SSH connection using the established connection
-	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, sshConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create SSH connection: %w", err)
-	}
-	defer sshConn.Close()
-
-	// Create SSH client
-	client := ssh.NewClient(sshConn, chans, reqs)
-	defer client.Close()
-
-	// Create SFTP client
-	sftpClient, err := sftp.NewClient(client)
+	sftpClient, closeFn, err := dialSFTP(ctx, address, sshConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %w", err)
+		return err
 	}
-	defer sftpClient.Close()
+	defer closeFn()
 
 	// Ensure the directory exists
 	remoteDir := filepath.Dir(remotePath)
@@ -384,3 +365,61 @@ func SendFileViaSFTPWithContext(ctx context.Context, address string, sshConfig *
 
 	return nil
 }
+
+// CheckFilesViaSFTPWithContext reports which of the remote paths exist via SFTP with context support
+func CheckFilesViaSFTPWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePaths ...string) (map[string]bool, error) {
+	sftpClient, closeFn, err := dialSFTP(ctx, address, sshConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	result := make(map[string]bool, len(remotePaths))
+	for _, remotePath := range remotePaths {
+		_, err := sftpClient.Stat(remotePath)
+		switch {
+		case err == nil:
+			result[remotePath] = true
+		case errors.Is(err, fs.ErrNotExist):
+			result[remotePath] = false
+		default:
+			return nil, fmt.Errorf("failed to stat %s: %w", remotePath, err)
+		}
+	}
+
+	return result, nil
+}
+
+// dialSFTP opens an SFTP session to address. The returned function closes the session and the underlying connections.
+func dialSFTP(ctx context.Context, address string, sshConfig *ssh.ClientConfig) (*sftp.Client, func(), error) {
+	// Create a context-aware dialer
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	// Create SSH connection using the established connection
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+
+	// Create SSH client
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	// Create SFTP client
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+
+	return sftpClient, func() {
+		sftpClient.Close()
+		client.Close()
+		conn.Close()
+	}, nil
+}
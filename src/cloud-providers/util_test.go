@@ -759,3 +759,70 @@ func TestSelectInstanceTypeToUse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDataDisks(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []DataDisk
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "sizes and types", input: "100, 50:gp3", want: []DataDisk{{Size: 100}, {Size: 50, Type: "gp3"}}},
+		{name: "invalid size", input: "100,large:gp3", wantErr: true},
+		{name: "zero size", input: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDataDisks(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDataDisks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDataDisks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootVolumeSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       InstanceTypeSpec
+		configured int
+		imageSize  int
+		want       int
+	}{
+		{name: "image default", want: 0},
+		{name: "configured", configured: 30, imageSize: 10, want: 30},
+		{name: "pod override", spec: InstanceTypeSpec{RootVolumeSize: 50}, configured: 30, imageSize: 10, want: 50},
+		{name: "smaller than image", spec: InstanceTypeSpec{RootVolumeSize: 5}, configured: 30, imageSize: 10, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RootVolumeSize(tt.spec, tt.configured, tt.imageSize); got != tt.want {
+				t.Errorf("RootVolumeSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	configured := KeyValueFlag{"team": "peerpods", TagPodName: "configured"}
+	spec := InstanceTypeSpec{Tags: map[string]string{TagPodName: "nginx", TagPodNamespace: "default"}}
+
+	want := map[string]string{"team": "peerpods", TagPodName: "nginx", TagPodNamespace: "default"}
+	if got := MergeTags(configured, spec); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeTags() = %v, want %v", got, want)
+	}
+	if configured[TagPodName] != "configured" {
+		t.Errorf("MergeTags() changed the configured tags")
+	}
+
+	if got := MergeTags(nil, InstanceTypeSpec{}); got == nil || len(got) != 0 {
+		t.Errorf("MergeTags() = %v, want an empty map", got)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -40,12 +41,21 @@ type PeerPodReconciler struct {
 	client.Client
 	Scheme    *runtime.Scheme
 	Providers map[string]provider.Provider
+
+	// configVersion is the version of the ConfigMap and the Secret the providers are created with
+	configVersion string
+	// configKeys are the environment variables set from the ConfigMap and the Secret
+	configKeys      []string
+	configCheckedAt time.Time
 }
 
 const (
 	ppFinalizer = "peer.pod/finalizer"
 	ppConfigMap = "peer-pods-cm"
 	ppSecret    = "peer-pods-secret"
+
+	// configRefreshInterval is how often the ConfigMap and the Secret are checked for changes, e.g. rotated credentials
+	configRefreshInterval = time.Minute
 )
 
 //+kubebuilder:rbac:groups="",resourceNames=peer-pods-cm;peer-pods-secret,resources=configmaps;secrets,verbs=get
@@ -62,8 +72,9 @@ func (r *PeerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	// Load cloud providers ConfigMap and Secret
 	// make sure the matching RBAC rules are set
-	if len(r.Providers) == 0 {
+	if len(r.Providers) == 0 || time.Since(r.configCheckedAt) > configRefreshInterval {
 		logger.Info("trying to fetch cloud provider configs for peerpod-ctrl")
+		r.configCheckedAt = time.Now()
 		if err := r.cloudConfigsGetter(); err != nil {
 			// don't requeue, if cloud configs are missing it will requeue later
 			logger.Info("cannot fetch cloud configs at the moment", "error", err)
@@ -135,6 +146,8 @@ func (r *PeerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
+// cloudConfigsGetter sets the ConfigMap and the Secret as environment variables. The providers
+// are created again when they change, so that rotated credentials are used.
 func (r *PeerPodReconciler) cloudConfigsGetter() error {
 	peerpodscm := corev1.ConfigMap{}
 	peerpodssecret := corev1.Secret{}
@@ -143,18 +156,14 @@ func (r *PeerPodReconciler) cloudConfigsGetter() error {
 		return fmt.Errorf("PEERPODS_NAMESPACE is not set")
 	}
 
-	var cmErr error
-	if cmErr = r.Get(context.TODO(), types.NamespacedName{Name: ppConfigMap, Namespace: ns}, &peerpodscm); cmErr == nil {
-		// set all configs as env vars to make sure all the required vars for auth are set
-		for k, v := range peerpodscm.Data {
-			os.Setenv(k, v)
-		}
-	}
+	cmErr := r.Get(context.TODO(), types.NamespacedName{Name: ppConfigMap, Namespace: ns}, &peerpodscm)
+	secretErr := r.Get(context.TODO(), types.NamespacedName{Name: ppSecret, Namespace: ns}, &peerpodssecret)
 
-	var secretErr error
-	if secretErr = r.Get(context.TODO(), types.NamespacedName{Name: ppSecret, Namespace: ns}, &peerpodssecret); secretErr == nil {
-		for k, v := range peerpodssecret.Data {
-			os.Setenv(k, string(v))
+	// Keep the current environment and providers when the ConfigMap or the Secret cannot be read,
+	// e.g. on a transient API server error, rather than taking it for a removal of all their keys
+	for _, err := range []error{cmErr, secretErr} {
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("ConfigMap Error: %v, Secret Error: %v", cmErr, secretErr)
 		}
 	}
 
@@ -162,6 +171,43 @@ func (r *PeerPodReconciler) cloudConfigsGetter() error {
 		return fmt.Errorf("ConfigMap Error: %v, Secret Error: %v", cmErr, secretErr)
 	}
 
+	version := peerpodscm.ResourceVersion + "/" + peerpodssecret.ResourceVersion
+	if version == r.configVersion {
+		return nil
+	}
+
+	env := map[string]string{}
+	// set all configs as env vars to make sure all the required vars for auth are set
+	for k, v := range peerpodscm.Data {
+		env[k] = v
+	}
+	for k, v := range peerpodssecret.Data {
+		env[k] = string(v)
+	}
+
+	// Unset the variables removed from the ConfigMap and the Secret, e.g. static keys replaced by workload identity
+	for _, k := range r.configKeys {
+		if _, ok := env[k]; !ok {
+			os.Unsetenv(k)
+		}
+	}
+	r.configKeys = r.configKeys[:0]
+	for k, v := range env {
+		os.Setenv(k, v)
+		r.configKeys = append(r.configKeys, k)
+	}
+
+	if r.configVersion != "" && len(r.Providers) > 0 {
+		log.Log.Info("cloud provider configs changed, recreating cloud providers")
+		for name, p := range r.Providers {
+			if err := p.Teardown(); err != nil {
+				log.Log.Info("failed to tear down cloud provider", "CloudProvider", name, "error", err)
+			}
+		}
+		clear(r.Providers)
+	}
+	r.configVersion = version
+
 	return nil
 }
 
@@ -19,6 +19,7 @@ package mutating
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	corev1 "k8s.io/api/core/v1"
@@ -43,7 +44,14 @@ func (a *PodMutator) Handle(ctx context.Context, req admission.Request) admissio
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	mutatedPod, _ := a.mutatePod(pod)
+	mutatedPod, err := a.mutatePod(ctx, pod)
+	if err != nil {
+		if errors.Is(err, ErrUnknownPeerPodClass) || errors.Is(err, ErrInvalidPeerPodClass) {
+			return admission.Denied(err.Error())
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
 	marshaledPod, err := json.Marshal(mutatedPod)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
@@ -1,6 +1,7 @@
 package mutating
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -38,7 +39,7 @@ func TestMutatePod_CpuMemReqLimit(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -99,7 +100,7 @@ func TestMutatePod_CpuReq(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -160,7 +161,7 @@ func TestMutatePod_MemReq(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -222,7 +223,7 @@ func TestMutatePod_GpuReq(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -281,7 +282,7 @@ func TestMutatePod_NoReq(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -350,7 +351,7 @@ func TestMutatePod_CpuMemReqLimitSame(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -463,18 +464,19 @@ func TestMutatePod_InitContainers(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
 
 	// Check annotations
-	if mutatedPod.Annotations[PeerPodsCPUAnnotation] != "6" {
-		t.Errorf("Expected CPU annotation to be 6, got %s", mutatedPod.Annotations[PeerPodsCPUAnnotation])
+	// The init container runs before the containers, so only the larger of the two counts
+	if mutatedPod.Annotations[PeerPodsCPUAnnotation] != "5" {
+		t.Errorf("Expected CPU annotation to be 5, got %s", mutatedPod.Annotations[PeerPodsCPUAnnotation])
 	}
 
-	if mutatedPod.Annotations[PeerPodsMemoryAnnotation] != "8192" {
-		t.Errorf("Expected Memory annotation to be 8192, got %s", mutatedPod.Annotations[PeerPodsMemoryAnnotation])
+	if mutatedPod.Annotations[PeerPodsMemoryAnnotation] != "6144" {
+		t.Errorf("Expected Memory annotation to be 6144, got %s", mutatedPod.Annotations[PeerPodsMemoryAnnotation])
 	}
 
 	if mutatedPod.Annotations[PeerPodsGPUAnnotation] != "1" {
@@ -540,7 +542,7 @@ func TestMutatePod_NoChangeForDifferentRuntimeClass(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -598,7 +600,7 @@ func TestMutatePod_FractionalCpu(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -667,7 +669,7 @@ func TestMutatePod_FractionalCpuMoreThanOne(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
@@ -755,17 +757,18 @@ func TestMutatePod_FractionalCpu_MultipleContainers(t *testing.T) {
 	}
 
 	podMutator := &PodMutator{}
-	mutatedPod, err := podMutator.mutatePod(pod)
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
 	if err != nil {
 		t.Fatalf("mutatePod() error = %v", err)
 	}
 
 	// Check annotations
-	if mutatedPod.Annotations[PeerPodsCPUAnnotation] != "2" {
-		t.Errorf("Expected CPU annotation to be 2, got %s", mutatedPod.Annotations[PeerPodsCPUAnnotation])
+	// The init container runs before the container, so only the larger of the two counts
+	if mutatedPod.Annotations[PeerPodsCPUAnnotation] != "1" {
+		t.Errorf("Expected CPU annotation to be 1, got %s", mutatedPod.Annotations[PeerPodsCPUAnnotation])
 	}
 
-	if mutatedPod.Annotations[PeerPodsMemoryAnnotation] != "8192" {
+	if mutatedPod.Annotations[PeerPodsMemoryAnnotation] != "4096" {
 		t.Errorf("Expected Memory annotation to be 4096, got %s", mutatedPod.Annotations[PeerPodsMemoryAnnotation])
 	}
 
@@ -789,3 +792,49 @@ func TestMutatePod_FractionalCpu_MultipleContainers(t *testing.T) {
 			mutatedPod.Spec.Containers[0].Resources.Requests[corev1.ResourceName(PodVMExtendedResourceDefault)])
 	}
 }
+
+// Add test case with a non-GPU device plugin resource
+func TestMutatePod_RemovedExtendedResources(t *testing.T) {
+	// Mock environment variable
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+
+	// Create a sample pod spec
+	runtimeClassName := "kata-remote"
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			RuntimeClassName: &runtimeClassName,
+			Containers: []corev1.Container{
+				{
+					Name:  "container1",
+					Image: "busybox",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceName(GPUResourceName): resource.MustParse("1"),
+							"xilinx.com/fpga":                    resource.MustParse("1"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	podMutator := &PodMutator{}
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("mutatePod() error = %v", err)
+	}
+
+	if mutatedPod.Annotations[PeerPodsRemovedResourcesAnnotation] != "xilinx.com/fpga" {
+		t.Errorf("Expected removed resources annotation to be xilinx.com/fpga, got %s", mutatedPod.Annotations[PeerPodsRemovedResourcesAnnotation])
+	}
+
+	// Mutating the mutated pod again keeps the annotation
+	mutatedPod, err = podMutator.mutatePod(context.Background(), mutatedPod)
+	if err != nil {
+		t.Fatalf("mutatePod() error = %v", err)
+	}
+	if mutatedPod.Annotations[PeerPodsRemovedResourcesAnnotation] != "xilinx.com/fpga" {
+		t.Errorf("Expected removed resources annotation to be kept on reinvocation, got %s", mutatedPod.Annotations[PeerPodsRemovedResourcesAnnotation])
+	}
+}
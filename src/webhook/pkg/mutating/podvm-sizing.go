@@ -0,0 +1,141 @@
+package mutating
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+// podVMShape is a vCPU and memory combination offered by the configured instance types
+type podVMShape struct {
+	vcpus     int64
+	memoryMiB int64
+}
+
+// getPodVMShapes parses POD_VM_INSTANCE_SHAPES, a comma separated list of <vcpus>:<memory>
+// entries like "2:4Gi,4:16Gi", sorted from the smallest to the largest shape
+func getPodVMShapes() []podVMShape {
+	value := os.Getenv("POD_VM_INSTANCE_SHAPES")
+	if value == "" {
+		return nil
+	}
+
+	var shapes []podVMShape
+	for _, entry := range strings.Split(value, ",") {
+		shape, err := parsePodVMShape(strings.TrimSpace(entry))
+		if err != nil {
+			logger.Printf("Ignoring invalid instance shape %q: %v", entry, err)
+			continue
+		}
+		shapes = append(shapes, shape)
+	}
+
+	sort.Slice(shapes, func(i, j int) bool {
+		if shapes[i].vcpus != shapes[j].vcpus {
+			return shapes[i].vcpus < shapes[j].vcpus
+		}
+		return shapes[i].memoryMiB < shapes[j].memoryMiB
+	})
+	return shapes
+}
+
+// parsePodVMShape parses a single <vcpus>:<memory> entry
+func parsePodVMShape(entry string) (podVMShape, error) {
+	vcpusStr, memoryStr, found := strings.Cut(entry, ":")
+	if !found {
+		return podVMShape{}, fmt.Errorf("expected <vcpus>:<memory>")
+	}
+	vcpus, err := strconv.ParseInt(strings.TrimSpace(vcpusStr), 10, 64)
+	if err != nil || vcpus <= 0 {
+		return podVMShape{}, fmt.Errorf("invalid vCPU count %q", vcpusStr)
+	}
+	memory, err := resource.ParseQuantity(strings.TrimSpace(memoryStr))
+	if err != nil || memory.Sign() <= 0 {
+		return podVMShape{}, fmt.Errorf("invalid memory %q", memoryStr)
+	}
+	memoryMiB, err := helpers.RoundUpToMiB(memory)
+	if err != nil {
+		return podVMShape{}, err
+	}
+	return podVMShape{vcpus: vcpus, memoryMiB: memoryMiB}, nil
+}
+
+// getHeadroom parses the quantity in the named environment variable, 0 if unset or invalid
+func getHeadroom(name string) resource.Quantity {
+	value := os.Getenv(name)
+	if value == "" {
+		return resource.Quantity{}
+	}
+	headroom, err := resource.ParseQuantity(value)
+	if err != nil || headroom.Sign() < 0 {
+		logger.Printf("Ignoring invalid %s value %q", name, value)
+		return resource.Quantity{}
+	}
+	return headroom
+}
+
+// includePodOverhead returns true when the RuntimeClass pod overhead has to be added to the pod VM size
+func includePodOverhead() bool {
+	include, _ := strconv.ParseBool(os.Getenv("INCLUDE_POD_OVERHEAD"))
+	return include
+}
+
+// sizePodVM returns the vCPUs and the memory in MiB of the pod VM for the effective cpu
+// and memory of the pod. The configured overhead and headroom are added to the values the
+// pod specifies, and the result is rounded up to the smallest configured instance shape
+// that fits. A value is 0 when the pod doesn't specify it and no instance shape applies.
+func sizePodVM(pod *corev1.Pod, cpu, memory resource.Quantity) (int64, int64) {
+	cpu = cpu.DeepCopy()
+	memory = memory.DeepCopy()
+
+	if cpu.Sign() == 1 {
+		if includePodOverhead() {
+			cpu.Add(utils.GetPodOverheadQuantity(pod, corev1.ResourceCPU))
+		}
+		cpu.Add(getHeadroom("POD_VM_CPU_HEADROOM"))
+	}
+	if memory.Sign() == 1 {
+		if includePodOverhead() {
+			memory.Add(utils.GetPodOverheadQuantity(pod, corev1.ResourceMemory))
+		}
+		memory.Add(getHeadroom("POD_VM_MEMORY_HEADROOM"))
+	}
+
+	var vcpus, memoryMiB int64
+	if cpu.Sign() == 1 {
+		// Value rounds up fractional CPUs
+		vcpus = cpu.Value()
+	}
+	if memory.Sign() == 1 {
+		var err error
+		if memoryMiB, err = helpers.RoundUpToMiB(memory); err != nil {
+			logger.Printf("Error converting memory quantity to MiB: %v", err)
+			memoryMiB = 0
+		}
+	}
+
+	if vcpus == 0 && memoryMiB == 0 {
+		return 0, 0
+	}
+
+	shapes := getPodVMShapes()
+	for _, shape := range shapes {
+		if shape.vcpus >= vcpus && shape.memoryMiB >= memoryMiB {
+			logger.Printf("Rounding %d vCPUs and %d MiB up to instance shape %d vCPUs and %d MiB", vcpus, memoryMiB, shape.vcpus, shape.memoryMiB)
+			return shape.vcpus, shape.memoryMiB
+		}
+	}
+	if len(shapes) > 0 {
+		logger.Printf("No instance shape fits %d vCPUs and %d MiB", vcpus, memoryMiB)
+	}
+
+	return vcpus, memoryMiB
+}
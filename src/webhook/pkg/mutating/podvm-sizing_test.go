@@ -0,0 +1,136 @@
+package mutating
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func resourceRequirements(cpu, memory string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		},
+	}
+}
+
+func TestMutatePod_PodVMSizing(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+
+	always := corev1.ContainerRestartPolicyAlways
+	runtimeClassName := "kata-remote"
+
+	tests := []struct {
+		name           string
+		env            map[string]string
+		spec           corev1.PodSpec
+		expectedCPU    string
+		expectedMemory string
+	}{
+		{
+			name: "init container larger than containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Resources: resourceRequirements("4", "1Gi")}},
+				Containers:     []corev1.Container{{Name: "app", Resources: resourceRequirements("1", "2Gi")}},
+			},
+			expectedCPU:    "4",
+			expectedMemory: "2048",
+		},
+		{
+			name: "sidecars run next to containers and later init containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{Name: "sidecar", RestartPolicy: &always, Resources: resourceRequirements("1", "1Gi")},
+					{Name: "init", Resources: resourceRequirements("3", "1Gi")},
+				},
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("1", "2Gi")}},
+			},
+			// cpu: max(sidecar 1 + init 3, sidecar 1 + app 1), memory: max(1Gi + 1Gi, 1Gi + 2Gi)
+			expectedCPU:    "4",
+			expectedMemory: "3072",
+		},
+		{
+			name: "pod overhead is ignored by default",
+			spec: corev1.PodSpec{
+				Overhead:   resourceRequirements("250m", "160Mi").Requests,
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("1", "1Gi")}},
+			},
+			expectedCPU:    "1",
+			expectedMemory: "1024",
+		},
+		{
+			name: "pod overhead",
+			env:  map[string]string{"INCLUDE_POD_OVERHEAD": "true"},
+			spec: corev1.PodSpec{
+				Overhead:   resourceRequirements("250m", "160Mi").Requests,
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("1", "1Gi")}},
+			},
+			expectedCPU:    "2",
+			expectedMemory: "1184",
+		},
+		{
+			name: "headroom",
+			env:  map[string]string{"POD_VM_CPU_HEADROOM": "500m", "POD_VM_MEMORY_HEADROOM": "256Mi"},
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("1500m", "1Gi")}},
+			},
+			expectedCPU:    "2",
+			expectedMemory: "1280",
+		},
+		{
+			name: "headroom is not added to unspecified resources",
+			env:  map[string]string{"POD_VM_CPU_HEADROOM": "1", "POD_VM_MEMORY_HEADROOM": "256Mi"},
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		},
+		{
+			name: "rounded to instance shape",
+			env:  map[string]string{"POD_VM_INSTANCE_SHAPES": "8:32Gi, 2:4Gi,4:16Gi,invalid"},
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("2", "6Gi")}},
+			},
+			expectedCPU:    "4",
+			expectedMemory: "16384",
+		},
+		{
+			name: "no instance shape fits",
+			env:  map[string]string{"POD_VM_INSTANCE_SHAPES": "2:4Gi,4:16Gi"},
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Resources: resourceRequirements("16", "6Gi")}},
+			},
+			expectedCPU:    "16",
+			expectedMemory: "6144",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			pod := &corev1.Pod{Spec: tt.spec}
+			pod.Spec.RuntimeClassName = &runtimeClassName
+
+			podMutator := &PodMutator{}
+			mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("mutatePod() error = %v", err)
+			}
+
+			if got := mutatedPod.Annotations[PeerPodsCPUAnnotation]; got != tt.expectedCPU {
+				t.Errorf("Expected CPU annotation to be %q, got %q", tt.expectedCPU, got)
+			}
+			if got := mutatedPod.Annotations[PeerPodsMemoryAnnotation]; got != tt.expectedMemory {
+				t.Errorf("Expected Memory annotation to be %q, got %q", tt.expectedMemory, got)
+			}
+		})
+	}
+}
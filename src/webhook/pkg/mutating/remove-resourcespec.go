@@ -1,9 +1,11 @@
 package mutating
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/utils"
 
@@ -18,13 +20,16 @@ const (
 	PeerPodsMemoryAnnotation     = "io.katacontainers.config.hypervisor.default_memory"
 	GPUResourceName              = "nvidia.com/gpu"
 	PeerPodsGPUAnnotation        = "io.katacontainers.config.hypervisor.default_gpus"
+	// PeerPodsRemovedResourcesAnnotation lists the extended resources removed from the pod
+	// that cannot be converted to pod VM annotations, e.g. non-GPU device plugin resources
+	PeerPodsRemovedResourcesAnnotation = "peerpods.io/removed-resources"
 )
 
 var logger = log.New(log.Writer(), "[pod-mutator] ", log.LstdFlags|log.Lmsgprefix)
 
 // mutate POD spec
 // remove the POD resource spec
-func (a *PodMutator) mutatePod(pod *corev1.Pod) (*corev1.Pod, error) {
+func (a *PodMutator) mutatePod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
 	var runtimeClassName string
 	mpod := pod.DeepCopy()
 
@@ -38,6 +43,10 @@ func (a *PodMutator) mutatePod(pod *corev1.Pod) (*corev1.Pod, error) {
 
 	mpod = adjustResourceSpec(mpod)
 
+	if err := a.applyPeerPodClass(ctx, mpod); err != nil {
+		return nil, err
+	}
+
 	return mpod, nil
 }
 
@@ -64,6 +73,14 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 	// So we don't need to check for limits
 	gpuRequest := utils.GetResourceRequestQuantity(pod, corev1.ResourceName(GPUResourceName))
 
+	// Extended resources other than GPUs and the peer-pod resource can't be provided by the pod VM
+	var removedResources []string
+	for _, name := range utils.GetExtendedResourceNames(pod) {
+		if name != corev1.ResourceName(GPUResourceName) && name != corev1.ResourceName(getPodVMExtendedResource()) {
+			removedResources = append(removedResources, string(name))
+		}
+	}
+
 	// log the resource values
 	logger.Printf("CPU Request: %s, CPU Limit: %s, Memory Request: %s, Memory Limit: %s, GPU Request: %s",
 		cpuRequest.String(), cpuLimit.String(), memoryRequest.String(), memoryLimit.String(), gpuRequest.String())
@@ -79,32 +96,36 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 	// We only add annotation if the value is greater than 0
 	// Limit will always be preferred over request
 
-	// Add cpu annotation
+	var cpu, memory resource.Quantity
 	if !cpuRequest.IsZero() && cpuLimit.Cmp(cpuRequest) >= 0 {
-		logger.Printf("Adding CPU annotation based on cpuLimit (integer value): %d", cpuLimit.Value())
-		// We need the scaled value for the annotation and not the raw value like 1000m, 0.4 etc for CPU
-		annotations[PeerPodsCPUAnnotation] = strconv.FormatInt(cpuLimit.Value(), 10)
+		logger.Printf("Sizing CPU based on cpuLimit: %s", cpuLimit.String())
+		cpu = cpuLimit
 	} else if cpuRequest.Sign() == 1 {
-		logger.Printf("Adding CPU annotation based on cpuRequest (integer value): %d", cpuRequest.Value())
-		annotations[PeerPodsCPUAnnotation] = strconv.FormatInt(cpuRequest.Value(), 10)
+		logger.Printf("Sizing CPU based on cpuRequest: %s", cpuRequest.String())
+		cpu = cpuRequest
 	}
 
-	// Add memory annotation
 	if !memoryRequest.IsZero() && memoryLimit.Cmp(memoryRequest) >= 0 {
-		logger.Printf("Adding Memory annotation based on memoryLimit: %s", memoryLimit.String())
-		memoryLimitMiBStr, err := utils.ConvertMemoryQuantityToMib(memoryLimit)
-		if err != nil {
-			logger.Printf("Error converting memory quantity to MiB: %v", err)
-		}
-		annotations[PeerPodsMemoryAnnotation] = memoryLimitMiBStr
-
+		logger.Printf("Sizing Memory based on memoryLimit: %s", memoryLimit.String())
+		memory = memoryLimit
 	} else if memoryRequest.Sign() == 1 {
-		logger.Printf("Adding Memory annotation based on memoryRequest: %s", memoryRequest.String())
-		memoryRequestMiBStr, err := utils.ConvertMemoryQuantityToMib(memoryRequest)
-		if err != nil {
-			logger.Printf("Error converting memory quantity to MiB: %v", err)
-		}
-		annotations[PeerPodsMemoryAnnotation] = memoryRequestMiBStr
+		logger.Printf("Sizing Memory based on memoryRequest: %s", memoryRequest.String())
+		memory = memoryRequest
+	}
+
+	vcpus, memoryMiB := sizePodVM(pod, cpu, memory)
+
+	// Add cpu annotation
+	if vcpus > 0 {
+		// We need the scaled value for the annotation and not the raw value like 1000m, 0.4 etc for CPU
+		logger.Printf("Adding CPU annotation (integer value): %d", vcpus)
+		annotations[PeerPodsCPUAnnotation] = strconv.FormatInt(vcpus, 10)
+	}
+
+	// Add memory annotation
+	if memoryMiB > 0 {
+		logger.Printf("Adding Memory annotation (MiB): %d", memoryMiB)
+		annotations[PeerPodsMemoryAnnotation] = strconv.FormatInt(memoryMiB, 10)
 	}
 
 	// Add GPU annotation
@@ -113,6 +134,12 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 		annotations[PeerPodsGPUAnnotation] = gpuRequest.String()
 	}
 
+	// Record the removed resources so that the validating webhook can reject the pod
+	if len(removedResources) > 0 {
+		logger.Printf("Removing unsupported extended resources: %v", removedResources)
+		annotations[PeerPodsRemovedResourcesAnnotation] = strings.Join(removedResources, ",")
+	}
+
 	pod.SetAnnotations(annotations)
 
 	// Remove all resource specs
@@ -135,12 +162,17 @@ func defaultContainerResourceRequirements() corev1.ResourceRequirements {
 	requirements.Requests = corev1.ResourceList{}
 	requirements.Limits = corev1.ResourceList{}
 
-	var podVMExtResource string
-	if podVMExtResource = os.Getenv("POD_VM_EXTENDED_RESOURCE"); podVMExtResource == "" {
-		podVMExtResource = PodVMExtendedResourceDefault
-	}
+	podVMExtResource := getPodVMExtendedResource()
 
 	requirements.Requests[corev1.ResourceName(podVMExtResource)] = resource.MustParse("1")
 	requirements.Limits[corev1.ResourceName(podVMExtResource)] = resource.MustParse("1")
 	return requirements
 }
+
+// getPodVMExtendedResource returns the name of the peer-pod extended resource
+func getPodVMExtendedResource() string {
+	if podVMExtResource := os.Getenv("POD_VM_EXTENDED_RESOURCE"); podVMExtResource != "" {
+		return podVMExtResource
+	}
+	return PodVMExtendedResourceDefault
+}
@@ -0,0 +1,149 @@
+package mutating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PeerPodClassKey is the pod label or annotation selecting a peer-pod class
+	PeerPodClassKey                = "peerpods.io/class"
+	PeerPodClassesConfigMapDefault = "peer-pods-classes"
+	WebhookNamespaceDefault        = "peer-pods-webhook-system"
+	PeerPodsMachineTypeAnnotation  = "io.katacontainers.config.hypervisor.machine_type"
+	PeerPodsImageAnnotation        = "io.katacontainers.config.hypervisor.image"
+)
+
+var (
+	// ErrUnknownPeerPodClass is returned when a pod selects a class that is not defined
+	ErrUnknownPeerPodClass = errors.New("unknown peer-pod class")
+
+	// ErrInvalidPeerPodClass is returned when a pod selects a class that is defined incorrectly
+	// or conflicts with the annotations of the pod
+	ErrInvalidPeerPodClass = errors.New("invalid peer-pod class")
+)
+
+// PeerPodClass is a named pod VM flavour. The classes are read from the data of the
+// PEERPOD_CLASSES_CONFIGMAP ConfigMap, each key being a class name and each value a
+// YAML document like
+//
+//	machineType: Standard_DC4as_v5
+//	image: /subscriptions/.../images/podvm-gpu
+type PeerPodClass struct {
+	MachineType string `json:"machineType,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// annotations returns the pod annotations the class translates to
+func (c *PeerPodClass) annotations() map[string]string {
+	annotations := make(map[string]string)
+	if c.MachineType != "" {
+		annotations[PeerPodsMachineTypeAnnotation] = c.MachineType
+	}
+	if c.Image != "" {
+		annotations[PeerPodsImageAnnotation] = c.Image
+	}
+	return annotations
+}
+
+// parsePeerPodClass parses and validates the definition of a class
+func parsePeerPodClass(name, data string) (*PeerPodClass, error) {
+	class := &PeerPodClass{}
+	if err := yaml.UnmarshalStrict([]byte(data), class); err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidPeerPodClass, name, err)
+	}
+	class.MachineType = strings.TrimSpace(class.MachineType)
+	class.Image = strings.TrimSpace(class.Image)
+	if class.MachineType == "" && class.Image == "" {
+		return nil, fmt.Errorf("%w %q: neither machineType nor image is set", ErrInvalidPeerPodClass, name)
+	}
+	return class, nil
+}
+
+// getPeerPodClassName returns the class selected by the pod, the label takes precedence over the annotation
+func getPeerPodClassName(pod *corev1.Pod) string {
+	if name, ok := pod.Labels[PeerPodClassKey]; ok {
+		return strings.TrimSpace(name)
+	}
+	return strings.TrimSpace(pod.Annotations[PeerPodClassKey])
+}
+
+// getPeerPodClasses reads the data of the classes ConfigMap
+func (a *PodMutator) getPeerPodClasses(ctx context.Context) (map[string]string, error) {
+	var name, namespace string
+	if name = os.Getenv("PEERPOD_CLASSES_CONFIGMAP"); name == "" {
+		name = PeerPodClassesConfigMapDefault
+	}
+	if namespace = os.Getenv("POD_NAMESPACE"); namespace == "" {
+		namespace = WebhookNamespaceDefault
+	}
+
+	if a.Client == nil {
+		return nil, fmt.Errorf("no client to read ConfigMap %s/%s", namespace, name)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Printf("Peer-pod classes ConfigMap %s/%s not found", namespace, name)
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return cm.Data, nil
+}
+
+// applyPeerPodClass translates the peer-pod class selected by the pod into the
+// machine type and image annotations consumed by cloud-api-adaptor
+func (a *PodMutator) applyPeerPodClass(ctx context.Context, pod *corev1.Pod) error {
+	className := getPeerPodClassName(pod)
+	if className == "" {
+		return nil
+	}
+
+	classes, err := a.getPeerPodClasses(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, ok := classes[className]
+	if !ok {
+		known := make([]string, 0, len(classes))
+		for name := range classes {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("%w %q, available classes: [%s]", ErrUnknownPeerPodClass, className, strings.Join(known, ", "))
+	}
+
+	class, err := parsePeerPodClass(className, data)
+	if err != nil {
+		return err
+	}
+
+	annotations := pod.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	// Explicit annotations must not silently be overridden by the class
+	for key, value := range class.annotations() {
+		if current, ok := annotations[key]; ok && current != value {
+			return fmt.Errorf("%w %q: annotation %s=%q conflicts with the class value %q", ErrInvalidPeerPodClass, className, key, current, value)
+		}
+		annotations[key] = value
+	}
+
+	logger.Printf("Applied peer-pod class %q: machine type %q, image %q", className, class.MachineType, class.Image)
+	pod.SetAnnotations(annotations)
+	return nil
+}
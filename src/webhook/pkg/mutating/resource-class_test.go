@@ -0,0 +1,209 @@
+package mutating
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newClassesPodMutator(classes map[string]string) *PodMutator {
+	builder := fake.NewClientBuilder()
+	if classes != nil {
+		builder = builder.WithObjects(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      PeerPodClassesConfigMapDefault,
+				Namespace: WebhookNamespaceDefault,
+			},
+			Data: classes,
+		})
+	}
+	return &PodMutator{Client: builder.Build()}
+}
+
+func newClassPod(labels, annotations map[string]string) *corev1.Pod {
+	runtimeClassName := "kata-remote"
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-pod",
+			Namespace:   "default",
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{
+			RuntimeClassName: &runtimeClassName,
+			Containers: []corev1.Container{
+				{
+					Name:  "container1",
+					Image: "busybox",
+				},
+			},
+		},
+	}
+}
+
+var testClasses = map[string]string{
+	"small-cvm": "machineType: Standard_DC2as_v5\n",
+	"gpu-a100":  "machineType: Standard_NC24ads_A100_v4\nimage: podvm-gpu\n",
+	"broken":    "machineType: [a, b]\n",
+	"empty":     "{}\n",
+}
+
+func TestMutatePod_PeerPodClass(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+	os.Unsetenv("PEERPOD_CLASSES_CONFIGMAP")
+	os.Unsetenv("POD_NAMESPACE")
+
+	tests := []struct {
+		name                string
+		classes             map[string]string
+		labels              map[string]string
+		annotations         map[string]string
+		expectedMachineType string
+		expectedImage       string
+		expectedErr         error
+	}{
+		{
+			name:                "class from label",
+			classes:             testClasses,
+			labels:              map[string]string{PeerPodClassKey: "small-cvm"},
+			expectedMachineType: "Standard_DC2as_v5",
+		},
+		{
+			name:                "class from annotation",
+			classes:             testClasses,
+			annotations:         map[string]string{PeerPodClassKey: "gpu-a100"},
+			expectedMachineType: "Standard_NC24ads_A100_v4",
+			expectedImage:       "podvm-gpu",
+		},
+		{
+			name:                "label takes precedence",
+			classes:             testClasses,
+			labels:              map[string]string{PeerPodClassKey: "small-cvm"},
+			annotations:         map[string]string{PeerPodClassKey: "gpu-a100"},
+			expectedMachineType: "Standard_DC2as_v5",
+		},
+		{
+			name:                "matching explicit annotation",
+			classes:             testClasses,
+			labels:              map[string]string{PeerPodClassKey: "small-cvm"},
+			annotations:         map[string]string{PeerPodsMachineTypeAnnotation: "Standard_DC2as_v5"},
+			expectedMachineType: "Standard_DC2as_v5",
+		},
+		{
+			name:        "conflicting explicit annotation",
+			classes:     testClasses,
+			labels:      map[string]string{PeerPodClassKey: "small-cvm"},
+			annotations: map[string]string{PeerPodsMachineTypeAnnotation: "Standard_DC8as_v5"},
+			expectedErr: ErrInvalidPeerPodClass,
+		},
+		{
+			name:        "unknown class",
+			classes:     testClasses,
+			labels:      map[string]string{PeerPodClassKey: "huge-cvm"},
+			expectedErr: ErrUnknownPeerPodClass,
+		},
+		{
+			name:        "missing ConfigMap",
+			labels:      map[string]string{PeerPodClassKey: "small-cvm"},
+			expectedErr: ErrUnknownPeerPodClass,
+		},
+		{
+			name:        "malformed class",
+			classes:     testClasses,
+			labels:      map[string]string{PeerPodClassKey: "broken"},
+			expectedErr: ErrInvalidPeerPodClass,
+		},
+		{
+			name:        "class without machine type and image",
+			classes:     testClasses,
+			labels:      map[string]string{PeerPodClassKey: "empty"},
+			expectedErr: ErrInvalidPeerPodClass,
+		},
+		{
+			name:    "no class",
+			classes: testClasses,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podMutator := newClassesPodMutator(tt.classes)
+			mutatedPod, err := podMutator.mutatePod(context.Background(), newClassPod(tt.labels, tt.annotations))
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mutatePod() error = %v", err)
+			}
+
+			if got, exists := mutatedPod.Annotations[PeerPodsMachineTypeAnnotation]; got != tt.expectedMachineType || exists != (tt.expectedMachineType != "") {
+				t.Errorf("Expected machine type annotation %q, got %q", tt.expectedMachineType, got)
+			}
+			if got, exists := mutatedPod.Annotations[PeerPodsImageAnnotation]; got != tt.expectedImage || exists != (tt.expectedImage != "") {
+				t.Errorf("Expected image annotation %q, got %q", tt.expectedImage, got)
+			}
+		})
+	}
+}
+
+func TestMutatePod_PeerPodClassOtherRuntimeClass(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+
+	// Pods using other runtime classes are not looked at, not even without a client
+	pod := newClassPod(map[string]string{PeerPodClassKey: "huge-cvm"}, nil)
+	pod.Spec.RuntimeClassName = nil
+
+	podMutator := &PodMutator{}
+	mutatedPod, err := podMutator.mutatePod(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("mutatePod() error = %v", err)
+	}
+	if _, exists := mutatedPod.Annotations[PeerPodsMachineTypeAnnotation]; exists {
+		t.Errorf("Expected no machine type annotation, got %s", mutatedPod.Annotations[PeerPodsMachineTypeAnnotation])
+	}
+}
+
+func TestHandle_UnknownPeerPodClassDenied(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Unsetenv("PEERPOD_CLASSES_CONFIGMAP")
+	os.Unsetenv("POD_NAMESPACE")
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to build scheme: %v", err)
+	}
+	podMutator := newClassesPodMutator(testClasses)
+	podMutator.Decoder = admission.NewDecoder(scheme)
+
+	raw, err := json.Marshal(newClassPod(map[string]string{PeerPodClassKey: "huge-cvm"}, nil))
+	if err != nil {
+		t.Fatalf("Failed to marshal pod: %v", err)
+	}
+
+	resp := podMutator.Handle(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if resp.Allowed {
+		t.Fatal("Expected pod with unknown class to be denied")
+	}
+	if resp.Result == nil || resp.Result.Message == "" {
+		t.Errorf("Expected a denial message, got %+v", resp.Result)
+	}
+}
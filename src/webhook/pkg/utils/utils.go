@@ -1,36 +1,24 @@
 package utils
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/cloud-provider/volume/helpers"
 )
 
-// GetResourceRequestQuantity finds and returns the request quantity for a specific resource.
+// GetResourceRequestQuantity finds and returns the effective request quantity for a specific resource.
 func GetResourceRequestQuantity(pod *corev1.Pod, resourceName corev1.ResourceName) resource.Quantity {
 
-	requestQuantity := getResourceQuantity(resourceName)
-	// Add the request quantity for each container
-	for _, container := range pod.Spec.Containers {
-		if rQuantity, ok := container.Resources.Requests[resourceName]; ok {
-			requestQuantity.Add(rQuantity)
-		}
-	}
-
-	// Add the request quantity for each init container
-	for _, container := range pod.Spec.InitContainers {
-		if rQuantity, ok := container.Resources.Requests[resourceName]; ok {
-			requestQuantity.Add(rQuantity)
-		}
-	}
-
 	// Don't add PodOverhead to the total requests
-	// as its not needed for peer-pod since the VM is external to the worker
-
-	return requestQuantity
-
+	// as its not needed for peer-pod since the VM is external to the worker.
+	// Use GetPodOverheadQuantity when it has to be accounted for.
+	return getEffectiveResourceQuantity(pod, resourceName, func(container *corev1.Container) corev1.ResourceList {
+		return container.Resources.Requests
+	})
 }
 
 // GetResourceRequest finds and returns the request value for a specific resource.
@@ -45,24 +33,65 @@ func GetResourceRequest(pod *corev1.Pod, resource corev1.ResourceName) int64 {
 	return requestQuantity.Value()
 }
 
-// GetResourceLimitQuantity finds and returns the limit quantity for a specific resource.
+// GetResourceLimitQuantity finds and returns the effective limit quantity for a specific resource.
 func GetResourceLimitQuantity(pod *corev1.Pod, resourceName corev1.ResourceName) resource.Quantity {
 
-	limitQuantity := getResourceQuantity(resourceName)
+	return getEffectiveResourceQuantity(pod, resourceName, func(container *corev1.Container) corev1.ResourceList {
+		return container.Resources.Limits
+	})
+}
+
+// GetPodOverheadQuantity returns the pod overhead set from the RuntimeClass for a specific resource.
+func GetPodOverheadQuantity(pod *corev1.Pod, resourceName corev1.ResourceName) resource.Quantity {
 
-	for _, container := range pod.Spec.Containers {
-		if lQuantity, ok := container.Resources.Limits[resourceName]; ok {
-			limitQuantity.Add(lQuantity)
+	overheadQuantity := getResourceQuantity(resourceName)
+	if oQuantity, ok := pod.Spec.Overhead[resourceName]; ok {
+		overheadQuantity.Add(oQuantity)
+	}
+	return overheadQuantity
+}
+
+// getEffectiveResourceQuantity computes the resources of a pod the way the scheduler does:
+// - regular containers and sidecars (init containers with restartPolicy Always) run concurrently, so they are summed
+// - init containers run one at a time, next to the sidecars started before them, so only the largest counts
+// - the pod needs the larger of the two
+func getEffectiveResourceQuantity(pod *corev1.Pod, resourceName corev1.ResourceName, resources func(*corev1.Container) corev1.ResourceList) resource.Quantity {
+
+	// Add the quantity for each container
+	containersQuantity := getResourceQuantity(resourceName)
+	for idx := range pod.Spec.Containers {
+		if quantity, ok := resources(&pod.Spec.Containers[idx])[resourceName]; ok {
+			containersQuantity.Add(quantity)
 		}
 	}
 
-	for _, container := range pod.Spec.InitContainers {
-		if lQuantity, ok := container.Resources.Limits[resourceName]; ok {
-			limitQuantity.Add(lQuantity)
+	sidecarsQuantity := getResourceQuantity(resourceName)
+	initQuantity := getResourceQuantity(resourceName)
+	for idx := range pod.Spec.InitContainers {
+		container := &pod.Spec.InitContainers[idx]
+		quantity := getResourceQuantity(resourceName)
+		if cQuantity, ok := resources(container)[resourceName]; ok {
+			quantity.Add(cQuantity)
+		}
 
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			// Sidecars keep running for the lifetime of the pod
+			containersQuantity.Add(quantity)
+			sidecarsQuantity.Add(quantity)
+			continue
 		}
+
+		// An init container runs together with the sidecars started before it
+		quantity.Add(sidecarsQuantity)
+		if quantity.Cmp(initQuantity) > 0 {
+			initQuantity = quantity
+		}
+	}
+
+	if initQuantity.Cmp(containersQuantity) > 0 {
+		return initQuantity
 	}
-	return limitQuantity
+	return containersQuantity
 }
 
 // Method to get the resource Quantity from the resource name
@@ -85,3 +114,36 @@ func ConvertMemoryQuantityToMib(memoryQuantity resource.Quantity) (string, error
 	}
 	return strconv.FormatInt(memoryQuantityMib, 10), nil
 }
+
+// GetExtendedResourceNames returns the sorted names of the extended resources
+// requested or limited by any container of the pod
+func GetExtendedResourceNames(pod *corev1.Pod) []corev1.ResourceName {
+	seen := make(map[corev1.ResourceName]bool)
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, list := range []corev1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+			for name := range list {
+				if IsExtendedResourceName(name) {
+					seen[name] = true
+				}
+			}
+		}
+	}
+
+	names := make([]corev1.ResourceName, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// IsExtendedResourceName returns true for resources outside the kubernetes.io domain,
+// such as the ones advertised by device plugins
+func IsExtendedResourceName(name corev1.ResourceName) bool {
+	domain, _, found := strings.Cut(string(name), "/")
+	if !found {
+		return false
+	}
+	return domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io") && !strings.HasPrefix(string(name), corev1.DefaultResourceRequestsPrefix)
+}
@@ -0,0 +1,142 @@
+package validating
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/mutating"
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/utils"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ValidationModeReject = "reject"
+	ValidationModeWarn   = "warn"
+)
+
+var logger = log.New(log.Writer(), "[pod-validator] ", log.LstdFlags|log.Lmsgprefix)
+
+// getValidationMode returns VALIDATION_MODE, defaulting to reject
+func getValidationMode() string {
+	if mode := os.Getenv("VALIDATION_MODE"); mode == ValidationModeWarn {
+		return mode
+	}
+	return ValidationModeReject
+}
+
+// getMaxContainers returns MAX_CONTAINERS, 0 meaning no limit
+func getMaxContainers() int {
+	value := os.Getenv("MAX_CONTAINERS")
+	if value == "" {
+		return 0
+	}
+	maxContainers, err := strconv.Atoi(value)
+	if err != nil || maxContainers < 0 {
+		logger.Printf("Ignoring invalid MAX_CONTAINERS value %q", value)
+		return 0
+	}
+	return maxContainers
+}
+
+// validatePod returns the reasons why the pod can't run as a peer-pod.
+// Pods using other runtime classes are not validated.
+func validatePod(pod *corev1.Pod) []string {
+	var runtimeClassName string
+	if runtimeClassName = os.Getenv("TARGET_RUNTIMECLASS"); runtimeClassName == "" {
+		runtimeClassName = mutating.RuntimeClassNameDefault
+	}
+	if pod.Spec.RuntimeClassName == nil || *pod.Spec.RuntimeClassName != runtimeClassName {
+		return nil
+	}
+
+	var violations []string
+
+	if pod.Spec.HostNetwork {
+		violations = append(violations, "hostNetwork is not supported, the pod runs in a separate VM")
+	}
+	if pod.Spec.HostPID || pod.Spec.HostIPC {
+		violations = append(violations, "hostPID and hostIPC are not supported, the pod runs in a separate VM")
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			violations = append(violations, fmt.Sprintf("hostPath volume %q is not supported, the worker node filesystem is not available in the pod VM", volume.Name))
+		}
+	}
+
+	forEachContainer(pod, func(kind string, container *corev1.Container) {
+		if container.SecurityContext != nil && container.SecurityContext.Privileged != nil && *container.SecurityContext.Privileged {
+			violations = append(violations, fmt.Sprintf("%s %q is privileged, privileged containers are not supported", kind, container.Name))
+		}
+	})
+
+	if resources := unsupportedExtendedResources(pod); len(resources) > 0 {
+		violations = append(violations, fmt.Sprintf("extended resources %s are not supported, only %s can be attached to the pod VM", strings.Join(resources, ", "), mutating.GPUResourceName))
+	}
+
+	if maxContainers := getMaxContainers(); maxContainers > 0 {
+		if count := countContainers(pod); count > maxContainers {
+			violations = append(violations, fmt.Sprintf("pod has %d containers, the pod VM supports at most %d", count, maxContainers))
+		}
+	}
+
+	return violations
+}
+
+// forEachContainer calls f for all init, regular and ephemeral containers of the pod
+func forEachContainer(pod *corev1.Pod, f func(kind string, container *corev1.Container)) {
+	for idx := range pod.Spec.InitContainers {
+		f("init container", &pod.Spec.InitContainers[idx])
+	}
+	for idx := range pod.Spec.Containers {
+		f("container", &pod.Spec.Containers[idx])
+	}
+	for idx := range pod.Spec.EphemeralContainers {
+		container := corev1.Container(pod.Spec.EphemeralContainers[idx].EphemeralContainerCommon)
+		f("ephemeral container", &container)
+	}
+}
+
+// unsupportedExtendedResources returns the extended resources other than GPUs and
+// the peer-pod resource. The mutating webhook removes them from the containers and
+// records them in the PeerPodsRemovedResourcesAnnotation annotation.
+func unsupportedExtendedResources(pod *corev1.Pod) []string {
+	podVMExtResource := os.Getenv("POD_VM_EXTENDED_RESOURCE")
+	if podVMExtResource == "" {
+		podVMExtResource = mutating.PodVMExtendedResourceDefault
+	}
+
+	seen := make(map[string]bool)
+	var resources []string
+	add := func(name string) {
+		if name == "" || name == mutating.GPUResourceName || name == podVMExtResource || seen[name] {
+			return
+		}
+		seen[name] = true
+		resources = append(resources, name)
+	}
+
+	for _, name := range strings.Split(pod.Annotations[mutating.PeerPodsRemovedResourcesAnnotation], ",") {
+		add(strings.TrimSpace(name))
+	}
+	for _, name := range utils.GetExtendedResourceNames(pod) {
+		add(string(name))
+	}
+	return resources
+}
+
+// countContainers returns the number of containers running concurrently in the pod VM,
+// init containers only count when they are sidecars
+func countContainers(pod *corev1.Pod) int {
+	count := len(pod.Spec.Containers)
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,42 @@
+package validating
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:admissionReviewVersions=v1,path=/validate-v1-pod,mutating=false,failurePolicy=fail,groups="",resources=pods,verbs=create,versions=v1,name=vwebhook.peerpods.io,sideEffects=None
+
+// PodValidator validates Pods
+type PodValidator struct {
+	Client  client.Client
+	Decoder admission.Decoder
+}
+
+// PodValidator rejects, or warns about, peer-pods using constructs the pod VM can't support
+func (v *PodValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+
+	err := v.Decoder.Decode(req, pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	violations := validatePod(pod)
+	if len(violations) == 0 {
+		return admission.Allowed("")
+	}
+
+	if getValidationMode() == ValidationModeWarn {
+		logger.Printf("Admitting pod %s/%s with unsupported peer-pod settings: %s", req.Namespace, pod.Name, strings.Join(violations, "; "))
+		return admission.Allowed("").WithWarnings(violations...)
+	}
+
+	logger.Printf("Rejecting pod %s/%s: %s", req.Namespace, pod.Name, strings.Join(violations, "; "))
+	return admission.Denied("pod is not supported by peer-pods: " + strings.Join(violations, "; "))
+}
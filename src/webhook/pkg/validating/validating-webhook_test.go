@@ -0,0 +1,195 @@
+package validating
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/mutating"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newTestPod(runtimeClassName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			RuntimeClassName: &runtimeClassName,
+			Containers: []corev1.Container{
+				{
+					Name:  "container1",
+					Image: "busybox",
+				},
+			},
+		},
+	}
+}
+
+func TestValidatePod(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+	os.Setenv("MAX_CONTAINERS", "2")
+	defer os.Unsetenv("MAX_CONTAINERS")
+
+	privileged := true
+	always := corev1.ContainerRestartPolicyAlways
+
+	tests := []struct {
+		name     string
+		mutate   func(pod *corev1.Pod)
+		expected []string
+	}{
+		{
+			name:   "supported pod",
+			mutate: func(pod *corev1.Pod) {},
+		},
+		{
+			name: "other runtime class",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.RuntimeClassName = nil
+				pod.Spec.HostNetwork = true
+			},
+		},
+		{
+			name:     "hostNetwork",
+			mutate:   func(pod *corev1.Pod) { pod.Spec.HostNetwork = true },
+			expected: []string{"hostNetwork"},
+		},
+		{
+			name: "hostPath volume",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.Volumes = []corev1.Volume{{
+					Name:         "host",
+					VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run"}},
+				}}
+			},
+			expected: []string{`hostPath volume "host"`},
+		},
+		{
+			name: "privileged init container",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = []corev1.Container{{
+					Name:            "init",
+					SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+				}}
+			},
+			expected: []string{`init container "init" is privileged`},
+		},
+		{
+			name: "GPU is supported",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Resources.Limits = corev1.ResourceList{
+					corev1.ResourceName(mutating.GPUResourceName): resource.MustParse("1"),
+				}
+			},
+		},
+		{
+			name: "device plugin resource",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Resources.Limits = corev1.ResourceList{
+					"xilinx.com/fpga":       resource.MustParse("1"),
+					corev1.ResourceMemory:   resource.MustParse("1Gi"),
+					"hugepages-2Mi":         resource.MustParse("2Mi"),
+					"kata.peerpods.io/vm":   resource.MustParse("1"),
+					corev1.ResourceStorage:  resource.MustParse("1Gi"),
+					"example.kubernetes.io": resource.MustParse("1"),
+				}
+			},
+			expected: []string{"extended resources xilinx.com/fpga"},
+		},
+		{
+			name: "device plugin resource removed by the mutating webhook",
+			mutate: func(pod *corev1.Pod) {
+				pod.Annotations = map[string]string{mutating.PeerPodsRemovedResourcesAnnotation: "intel.com/sgx"}
+			},
+			expected: []string{"extended resources intel.com/sgx"},
+		},
+		{
+			name: "too many containers",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = []corev1.Container{{Name: "sidecar", RestartPolicy: &always}, {Name: "init"}}
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "container2"})
+			},
+			expected: []string{"pod has 3 containers, the pod VM supports at most 2"},
+		},
+		{
+			name: "multiple violations",
+			mutate: func(pod *corev1.Pod) {
+				pod.Spec.HostNetwork = true
+				pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{Privileged: &privileged}
+			},
+			expected: []string{"hostNetwork", `container "container1" is privileged`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTestPod("kata-remote")
+			tt.mutate(pod)
+
+			violations := validatePod(pod)
+			if len(violations) != len(tt.expected) {
+				t.Fatalf("Expected %d violations, got %d: %v", len(tt.expected), len(violations), violations)
+			}
+			for idx, expected := range tt.expected {
+				if !strings.Contains(violations[idx], expected) {
+					t.Errorf("Expected violation %q to contain %q", violations[idx], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestHandle_ValidationMode(t *testing.T) {
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	defer os.Unsetenv("VALIDATION_MODE")
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to build scheme: %v", err)
+	}
+	podValidator := &PodValidator{Decoder: admission.NewDecoder(scheme)}
+
+	pod := newTestPod("kata-remote")
+	pod.Spec.HostNetwork = true
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Failed to marshal pod: %v", err)
+	}
+	req := admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Namespace: "default",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+
+	os.Setenv("VALIDATION_MODE", ValidationModeReject)
+	resp := podValidator.Handle(context.Background(), req)
+	if resp.Allowed {
+		t.Error("Expected pod to be rejected in reject mode")
+	}
+	if resp.Result == nil || !strings.Contains(resp.Result.Message, "hostNetwork") {
+		t.Errorf("Expected rejection message to explain hostNetwork, got %+v", resp.Result)
+	}
+
+	os.Setenv("VALIDATION_MODE", ValidationModeWarn)
+	resp = podValidator.Handle(context.Background(), req)
+	if !resp.Allowed {
+		t.Error("Expected pod to be allowed in warn mode")
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "hostNetwork") {
+		t.Errorf("Expected a hostNetwork warning, got %v", resp.Warnings)
+	}
+}